@@ -27,10 +27,12 @@ package core
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 
 	"github.com/superkkt/cherry/api"
+	"github.com/superkkt/cherry/network"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/davecgh/go-spew/spew"
@@ -43,13 +45,52 @@ var (
 
 type API struct {
 	api.Server
+	Network      Network
+	Database     Database
+	Applications Applications
+}
+
+// Network provides the information that only the core controller has about the network.
+type Network interface {
+	// Snapshot returns a read-only model of the current network topology.
+	Snapshot() (*network.TopologySnapshot, error)
+	// Events returns the event bus that publishes the network events.
+	Events() *network.EventBus
+	// Paths returns at most k candidate paths from the src host to the dst host that satisfy c.
+	Paths(src, dst net.HardwareAddr, k int, c network.PathConstraint) ([]network.PathSnapshot, error)
+}
+
+// Database provides the host information stored in the database.
+type Database interface {
+	// MAC returns the MAC address of the host whose IP address is ip.
+	MAC(ip net.IP) (mac net.HardwareAddr, ok bool, err error)
 }
 
 func (r *API) Serve() error {
+	if r.Network == nil {
+		return errors.New("nil network")
+	}
+	if r.Database == nil {
+		return errors.New("nil database")
+	}
+	if r.Applications == nil {
+		return errors.New("nil applications")
+	}
+
 	return r.Server.Serve(
 		rest.Post("/api/v1/status", api.ResponseHandler(r.status)),
 		rest.Post("/api/v1/remove", api.ResponseHandler(r.remove)),
 		rest.Post("/api/v1/announce", api.ResponseHandler(r.announce)),
+		rest.Post("/api/v1/topology", api.ResponseHandler(r.topology)),
+		rest.Get("/api/v1/events", api.ResponseHandler(r.events)),
+		rest.Post("/api/v1/path", api.ResponseHandler(r.path)),
+		rest.Post("/api/v1/app/list", api.ResponseHandler(r.listApp)),
+		rest.Post("/api/v1/app/enable", api.ResponseHandler(r.enableApp)),
+		rest.Post("/api/v1/app/disable", api.ResponseHandler(r.disableApp)),
+		rest.Post("/api/v1/app/reorder", api.ResponseHandler(r.reorderApp)),
+		rest.Post("/api/v1/app/metrics", api.ResponseHandler(r.appMetrics)),
+		rest.Post("/api/v1/app/trace", api.ResponseHandler(r.traceApp)),
+		rest.Get("/api/v1/metrics", api.ResponseHandler(r.prometheus)),
 	)
 }
 
@@ -0,0 +1,237 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/superkkt/cherry/api"
+	"github.com/superkkt/cherry/northbound"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// Applications manages the north-bound applications at runtime.
+type Applications interface {
+	// Applications returns the status of all the registered applications. The enabled
+	// ones come first in the order of the application chain.
+	Applications() []northbound.AppStatus
+	Enable(name string) error
+	Disable(name string) error
+	// Reorder changes the order of the enabled applications in the application chain.
+	Reorder(names []string) error
+	// Metrics returns the processing metrics of the applications for each event type.
+	Metrics() []northbound.AppMetrics
+	// WriteMetrics writes the metrics in the Prometheus text exposition format.
+	WriteMetrics(w io.Writer) error
+	// SetTrace sets the filter of the packets whose processing is logged. nil disables it.
+	SetTrace(filter *northbound.TraceFilter)
+	// Trace returns the filter of the trace mode, which is nil if the trace mode is disabled.
+	Trace() *northbound.TraceFilter
+}
+
+func (r *API) listApp(w api.ResponseWriter, req *rest.Request) {
+	logger.Debugf("listApp request from %v", req.RemoteAddr)
+
+	w.Write(api.Response{Status: api.StatusOkay, Data: r.Applications.Applications()})
+}
+
+func (r *API) enableApp(w api.ResponseWriter, req *rest.Request) {
+	p := new(appParam)
+	if err := req.DecodeJsonPayload(p); err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to decode param: %v", err.Error())})
+		return
+	}
+	logger.Debugf("enableApp request from %v: %v", req.RemoteAddr, spew.Sdump(p))
+
+	if err := r.Applications.Enable(p.Name); err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to enable an application: %v", err.Error())})
+		return
+	}
+	logger.Infof("enabled %v application by the API request from %v", p.Name, req.RemoteAddr)
+
+	w.Write(api.Response{Status: api.StatusOkay, Data: r.Applications.Applications()})
+}
+
+func (r *API) disableApp(w api.ResponseWriter, req *rest.Request) {
+	p := new(appParam)
+	if err := req.DecodeJsonPayload(p); err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to decode param: %v", err.Error())})
+		return
+	}
+	logger.Debugf("disableApp request from %v: %v", req.RemoteAddr, spew.Sdump(p))
+
+	if err := r.Applications.Disable(p.Name); err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to disable an application: %v", err.Error())})
+		return
+	}
+	logger.Infof("disabled %v application by the API request from %v", p.Name, req.RemoteAddr)
+
+	w.Write(api.Response{Status: api.StatusOkay, Data: r.Applications.Applications()})
+}
+
+type appParam struct {
+	Name string
+}
+
+func (r *appParam) UnmarshalJSON(data []byte) error {
+	v := struct {
+		Name string `json:"name"`
+	}{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	r.Name = strings.TrimSpace(v.Name)
+	if len(r.Name) == 0 {
+		return errors.New("empty application name")
+	}
+
+	return nil
+}
+
+func (r *API) reorderApp(w api.ResponseWriter, req *rest.Request) {
+	p := new(reorderAppParam)
+	if err := req.DecodeJsonPayload(p); err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to decode param: %v", err.Error())})
+		return
+	}
+	logger.Debugf("reorderApp request from %v: %v", req.RemoteAddr, spew.Sdump(p))
+
+	if err := r.Applications.Reorder(p.Names); err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to reorder the applications: %v", err.Error())})
+		return
+	}
+	logger.Infof("reordered the applications by the API request from %v: %v", req.RemoteAddr, p.Names)
+
+	w.Write(api.Response{Status: api.StatusOkay, Data: r.Applications.Applications()})
+}
+
+type reorderAppParam struct {
+	Names []string
+}
+
+func (r *reorderAppParam) UnmarshalJSON(data []byte) error {
+	v := struct {
+		Names []string `json:"names"`
+	}{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	if len(v.Names) == 0 {
+		return errors.New("empty application names")
+	}
+	r.Names = make([]string, len(v.Names))
+	for i, name := range v.Names {
+		r.Names[i] = strings.TrimSpace(name)
+	}
+
+	return nil
+}
+
+func (r *API) appMetrics(w api.ResponseWriter, req *rest.Request) {
+	logger.Debugf("appMetrics request from %v", req.RemoteAddr)
+
+	w.Write(api.Response{Status: api.StatusOkay, Data: r.Applications.Metrics()})
+}
+
+// prometheus exposes the metrics of the applications to the Prometheus server.
+func (r *API) prometheus(w api.ResponseWriter, req *rest.Request) {
+	logger.Debugf("prometheus request from %v", req.RemoteAddr)
+
+	var buf bytes.Buffer
+	if err := r.Applications.WriteMetrics(&buf); err != nil {
+		w.Write(api.Response{Status: api.StatusInternalServerError, Message: fmt.Sprintf("failed to write the metrics: %v", err.Error())})
+		return
+	}
+	w.WriteRaw("text/plain; version=0.0.4", buf.Bytes())
+}
+
+func (r *API) traceApp(w api.ResponseWriter, req *rest.Request) {
+	p := new(traceAppParam)
+	if err := req.DecodeJsonPayload(p); err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to decode param: %v", err.Error())})
+		return
+	}
+	logger.Debugf("traceApp request from %v: %v", req.RemoteAddr, spew.Sdump(p))
+
+	r.Applications.SetTrace(p.Filter)
+	w.Write(api.Response{Status: api.StatusOkay, Data: r.Applications.Trace()})
+}
+
+type traceAppParam struct {
+	// nil means disabling the trace mode.
+	Filter *northbound.TraceFilter
+}
+
+func (r *traceAppParam) UnmarshalJSON(data []byte) error {
+	v := struct {
+		Enabled   bool   `json:"enabled"`
+		MAC       string `json:"mac"`
+		IP        string `json:"ip"`
+		EtherType string `json:"eth_type"`
+	}{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	if !v.Enabled {
+		r.Filter = nil
+		return nil
+	}
+
+	filter := new(northbound.TraceFilter)
+	if len(v.MAC) > 0 {
+		mac, err := net.ParseMAC(v.MAC)
+		if err != nil {
+			return err
+		}
+		filter.MAC = mac
+	}
+	if len(v.IP) > 0 {
+		ip := net.ParseIP(v.IP)
+		if ip == nil {
+			return fmt.Errorf("invalid IP address: %v", v.IP)
+		}
+		filter.IP = ip
+	}
+	if len(v.EtherType) > 0 {
+		// Decimal or hex with 0x prefix.
+		t, err := strconv.ParseUint(v.EtherType, 0, 16)
+		if err != nil {
+			return fmt.Errorf("invalid ether type: %v", v.EtherType)
+		}
+		filter.EtherType = uint16(t)
+	}
+	r.Filter = filter
+
+	return nil
+}
@@ -0,0 +1,119 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/superkkt/cherry/api"
+	"github.com/superkkt/cherry/network"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+const (
+	// Interval to send a comment line to keep the idle event stream alive.
+	eventKeepAliveInterval = 15 * time.Second
+)
+
+// events streams the network events as Server-Sent Events. The client can resume the
+// stream from the event next to the sequence number specified by the since query
+// parameter or the Last-Event-ID header.
+func (r *API) events(w api.ResponseWriter, req *rest.Request) {
+	since, err := parseEventSeq(req)
+	if err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("invalid event sequence number: %v", err.Error())})
+		return
+	}
+	logger.Debugf("events request from %v: since=%v", req.RemoteAddr, since)
+
+	backlog, sub, err := r.Network.Events().Subscribe(since)
+	if err != nil {
+		if err == network.ErrEventExpired {
+			w.Write(api.Response{Status: api.StatusNotFound, Message: fmt.Sprintf("events since %v are no longer available", since)})
+		} else {
+			w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to subscribe the events: %v", err.Error())})
+		}
+		return
+	}
+	defer sub.Close()
+
+	stream := w.Stream("text/event-stream")
+	for _, v := range backlog {
+		if err := writeEvent(stream, v); err != nil {
+			logger.Infof("failed to write an event to %v: %v", req.RemoteAddr, err)
+			return
+		}
+	}
+
+	ticker := time.NewTicker(eventKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			logger.Debugf("event stream to %v is closed", req.RemoteAddr)
+			return
+		case <-ticker.C:
+			if _, err := io.WriteString(stream, ": keepalive\n\n"); err != nil {
+				logger.Infof("failed to write a keepalive to %v: %v", req.RemoteAddr, err)
+				return
+			}
+		case v, ok := <-sub.Events():
+			if !ok {
+				// The client should reconnect to resume the subscription.
+				logger.Infof("event subscription of %v is dropped", req.RemoteAddr)
+				return
+			}
+			if err := writeEvent(stream, v); err != nil {
+				logger.Infof("failed to write an event to %v: %v", req.RemoteAddr, err)
+				return
+			}
+		}
+	}
+}
+
+func parseEventSeq(req *rest.Request) (uint64, error) {
+	v := req.URL.Query().Get("since")
+	if len(v) == 0 {
+		v = req.Header.Get("Last-Event-ID")
+	}
+	if len(v) == 0 {
+		return 0, nil
+	}
+
+	return strconv.ParseUint(v, 10, 64)
+}
+
+func writeEvent(w io.Writer, e network.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %v\nevent: %v\ndata: %s\n\n", e.Seq, e.Type, data)
+
+	return err
+}
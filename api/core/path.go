@@ -0,0 +1,167 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/superkkt/cherry/api"
+	"github.com/superkkt/cherry/network"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/davecgh/go-spew/spew"
+)
+
+const (
+	// Default number of the candidate paths returned by the path API.
+	defaultNumPaths = 3
+	// Maximum number of the candidate paths returned by the path API.
+	maxNumPaths = 16
+)
+
+func (r *API) path(w api.ResponseWriter, req *rest.Request) {
+	p := new(pathParam)
+	if err := req.DecodeJsonPayload(p); err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to decode param: %v", err.Error())})
+		return
+	}
+	logger.Debugf("path request from %v: %v", req.RemoteAddr, spew.Sdump(p))
+
+	src, err := r.hostMAC(p.Src)
+	if err != nil {
+		w.Write(api.Response{Status: api.StatusInternalServerError, Message: fmt.Sprintf("failed to query the source host: %v", err.Error())})
+		return
+	}
+	if src == nil {
+		w.Write(api.Response{Status: api.StatusNotFound, Message: fmt.Sprintf("unknown source host: %v", p.Src)})
+		return
+	}
+	dst, err := r.hostMAC(p.Dst)
+	if err != nil {
+		w.Write(api.Response{Status: api.StatusInternalServerError, Message: fmt.Sprintf("failed to query the destination host: %v", err.Error())})
+		return
+	}
+	if dst == nil {
+		w.Write(api.Response{Status: api.StatusNotFound, Message: fmt.Sprintf("unknown destination host: %v", p.Dst)})
+		return
+	}
+
+	paths, err := r.Network.Paths(src, dst, p.K, p.Constraint)
+	if err != nil {
+		w.Write(api.Response{Status: api.StatusInternalServerError, Message: fmt.Sprintf("failed to find the paths: %v", err.Error())})
+		return
+	}
+
+	w.Write(api.Response{
+		Status: api.StatusOkay,
+		Data: struct {
+			Src   string                 `json:"src"`
+			Dst   string                 `json:"dst"`
+			Paths []network.PathSnapshot `json:"paths"`
+		}{
+			Src:   src.String(),
+			Dst:   dst.String(),
+			Paths: paths,
+		},
+	})
+}
+
+// hostMAC returns the MAC address of host that is a MAC or IP address. It returns nil
+// if host is an IP address that is not registered in the database.
+func (r *API) hostMAC(host string) (net.HardwareAddr, error) {
+	if mac, err := net.ParseMAC(host); err == nil {
+		return mac, nil
+	}
+
+	mac, ok, err := r.Database.MAC(net.ParseIP(host))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	return mac, nil
+}
+
+type pathParam struct {
+	// Src and Dst are MAC or IP addresses of the hosts.
+	Src, Dst   string
+	K          int
+	Constraint network.PathConstraint
+}
+
+func (r *pathParam) UnmarshalJSON(data []byte) error {
+	v := struct {
+		Src            string   `json:"src"`
+		Dst            string   `json:"dst"`
+		K              int      `json:"k"`
+		ExcludeDevices []string `json:"exclude_devices"`
+		ExcludeLinks   []string `json:"exclude_links"`
+		MinBandwidth   uint64   `json:"min_bandwidth"`
+		MaxHops        int      `json:"max_hops"`
+	}{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	if err := validateHost(v.Src); err != nil {
+		return err
+	}
+	if err := validateHost(v.Dst); err != nil {
+		return err
+	}
+	switch {
+	case v.K == 0:
+		v.K = defaultNumPaths
+	case v.K < 0 || v.K > maxNumPaths:
+		return fmt.Errorf("invalid number of paths: %v", v.K)
+	}
+	if v.MaxHops < 0 {
+		return fmt.Errorf("invalid maximum hop count: %v", v.MaxHops)
+	}
+
+	r.Src = v.Src
+	r.Dst = v.Dst
+	r.K = v.K
+	r.Constraint = network.PathConstraint{
+		ExcludeDevices: v.ExcludeDevices,
+		ExcludeLinks:   v.ExcludeLinks,
+		MinBandwidth:   v.MinBandwidth,
+		MaxHops:        v.MaxHops,
+	}
+
+	return nil
+}
+
+func validateHost(host string) error {
+	if _, err := net.ParseMAC(host); err == nil {
+		return nil
+	}
+	if net.ParseIP(host) == nil {
+		return fmt.Errorf("invalid host address: %v", host)
+	}
+
+	return nil
+}
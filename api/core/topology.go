@@ -0,0 +1,265 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015-2019 Samjung Data Service, Inc. All rights reserved.
+ *
+ *  Kitae Kim <superkkt@sds.co.kr>
+ *  Donam Kim <donam.kim@sds.co.kr>
+ *  Jooyoung Kang <jooyoung.kang@sds.co.kr>
+ *  Changjin Choi <ccj9707@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/superkkt/cherry/api"
+	"github.com/superkkt/cherry/network"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/davecgh/go-spew/spew"
+)
+
+type topologyFormat string
+
+const (
+	formatJSON    topologyFormat = "json"
+	formatDOT     topologyFormat = "dot"
+	formatGraphML topologyFormat = "graphml"
+)
+
+func (r *API) topology(w api.ResponseWriter, req *rest.Request) {
+	p := new(topologyParam)
+	if err := req.DecodeJsonPayload(p); err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to decode param: %v", err.Error())})
+		return
+	}
+	logger.Debugf("topology request from %v: %v", req.RemoteAddr, spew.Sdump(p))
+
+	topo, err := r.Network.Snapshot()
+	if err != nil {
+		w.Write(api.Response{Status: api.StatusInternalServerError, Message: fmt.Sprintf("failed to query the topology: %v", err.Error())})
+		return
+	}
+
+	switch p.Format {
+	case formatJSON:
+		w.Write(api.Response{Status: api.StatusOkay, Data: topo})
+	case formatDOT:
+		w.WriteRaw("text/vnd.graphviz; charset=utf-8", encodeDOT(topo))
+	case formatGraphML:
+		v, err := encodeGraphML(topo)
+		if err != nil {
+			w.Write(api.Response{Status: api.StatusInternalServerError, Message: fmt.Sprintf("failed to encode the topology: %v", err.Error())})
+			return
+		}
+		w.WriteRaw("application/graphml+xml; charset=utf-8", v)
+	default:
+		w.Write(api.Response{Status: api.StatusInternalServerError, Message: fmt.Sprintf("unexpected topology format: %v", p.Format)})
+	}
+}
+
+type topologyParam struct {
+	Format topologyFormat
+}
+
+func (r *topologyParam) UnmarshalJSON(data []byte) error {
+	v := struct {
+		Format string `json:"format"`
+	}{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	switch f := topologyFormat(strings.ToLower(v.Format)); f {
+	case "":
+		// Default format.
+		r.Format = formatJSON
+	case formatJSON, formatDOT, formatGraphML:
+		r.Format = f
+	default:
+		return fmt.Errorf("invalid topology format: %v", v.Format)
+	}
+
+	return nil
+}
+
+func hostID(h network.HostSnapshot) string {
+	return "host:" + h.MAC
+}
+
+// encodeDOT encodes topo in the Graphviz DOT language. Switches and hosts are nodes, and
+// links among switches are edges whose style is dashed if they are disabled by STP.
+func encodeDOT(topo *network.TopologySnapshot) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("graph cherry {\n")
+	for _, d := range topo.Devices {
+		label := fmt.Sprintf("%v\n%v %v", d.ID, d.Manufacturer, d.Hardware)
+		buf.WriteString(fmt.Sprintf("\t%v [shape=box, label=%v];\n", strconv.Quote(d.ID), strconv.Quote(label)))
+	}
+	for _, h := range topo.Hosts {
+		label := fmt.Sprintf("%v\n%v", h.IP, h.MAC)
+		buf.WriteString(fmt.Sprintf("\t%v [shape=ellipse, label=%v];\n", strconv.Quote(hostID(h)), strconv.Quote(label)))
+	}
+	for _, l := range topo.Links {
+		p1, p2 := splitPortID(l.Ports[0]), splitPortID(l.Ports[1])
+		style := "solid"
+		if l.Enabled == false {
+			style = "dashed"
+		}
+		// Links through a broadcast domain are drawn in a different color.
+		color := "black"
+		if l.Broadcast {
+			color = "blue"
+		}
+		buf.WriteString(fmt.Sprintf("\t%v -- %v [taillabel=%v, headlabel=%v, style=%v, color=%v, weight=%v];\n",
+			strconv.Quote(p1[0]), strconv.Quote(p2[0]), strconv.Quote(p1[1]), strconv.Quote(p2[1]), style, color, l.Weight))
+	}
+	for _, h := range topo.Hosts {
+		p := splitPortID(h.Port)
+		buf.WriteString(fmt.Sprintf("\t%v -- %v [taillabel=%v];\n", strconv.Quote(p[0]), strconv.Quote(hostID(h)), strconv.Quote(p[1])))
+	}
+	buf.WriteString("}\n")
+
+	return buf.Bytes()
+}
+
+// splitPortID splits a port ID into the device ID and the port number.
+func splitPortID(id string) [2]string {
+	i := strings.LastIndex(id, ":")
+	if i < 0 {
+		return [2]string{id, ""}
+	}
+
+	return [2]string{id[:i], id[i+1:]}
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+func encodeGraphML(topo *network.TopologySnapshot) ([]byte, error) {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "type", For: "node", Name: "type", Type: "string"},
+			{ID: "label", For: "node", Name: "label", Type: "string"},
+			{ID: "source_port", For: "edge", Name: "source_port", Type: "string"},
+			{ID: "target_port", For: "edge", Name: "target_port", Type: "string"},
+			{ID: "enabled", For: "edge", Name: "enabled", Type: "boolean"},
+			{ID: "weight", For: "edge", Name: "weight", Type: "double"},
+			{ID: "broadcast", For: "edge", Name: "broadcast", Type: "boolean"},
+			{ID: "latency", For: "edge", Name: "latency", Type: "double"},
+		},
+		Graph: graphMLGraph{ID: "cherry", EdgeDefault: "undirected"},
+	}
+
+	for _, d := range topo.Devices {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: d.ID,
+			Data: []graphMLData{
+				{Key: "type", Value: "switch"},
+				{Key: "label", Value: fmt.Sprintf("%v %v", d.Manufacturer, d.Hardware)},
+			},
+		})
+	}
+	for _, h := range topo.Hosts {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: hostID(h),
+			Data: []graphMLData{
+				{Key: "type", Value: "host"},
+				{Key: "label", Value: h.IP},
+			},
+		})
+	}
+	for _, l := range topo.Links {
+		p1, p2 := splitPortID(l.Ports[0]), splitPortID(l.Ports[1])
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			ID:     l.ID,
+			Source: p1[0],
+			Target: p2[0],
+			Data: []graphMLData{
+				{Key: "source_port", Value: p1[1]},
+				{Key: "target_port", Value: p2[1]},
+				{Key: "enabled", Value: strconv.FormatBool(l.Enabled)},
+				{Key: "weight", Value: strconv.FormatFloat(l.Weight, 'f', -1, 64)},
+				{Key: "broadcast", Value: strconv.FormatBool(l.Broadcast)},
+				{Key: "latency", Value: strconv.FormatFloat(l.Latency, 'f', -1, 64)},
+			},
+		})
+	}
+	for _, h := range topo.Hosts {
+		p := splitPortID(h.Port)
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			ID:     fmt.Sprintf("%v/%v", h.Port, hostID(h)),
+			Source: p[0],
+			Target: hostID(h),
+			Data: []graphMLData{
+				{Key: "source_port", Value: p[1]},
+				{Key: "enabled", Value: "true"},
+			},
+		})
+	}
+
+	v, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), v...), nil
+}
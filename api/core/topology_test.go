@@ -0,0 +1,209 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/superkkt/cherry/api"
+	"github.com/superkkt/cherry/network"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+type mockNetwork struct {
+	topo *network.TopologySnapshot
+}
+
+func (r *mockNetwork) Snapshot() (*network.TopologySnapshot, error) {
+	return r.topo, nil
+}
+
+func (r *mockNetwork) Events() *network.EventBus {
+	return nil
+}
+
+func (r *mockNetwork) Paths(src, dst net.HardwareAddr, k int, c network.PathConstraint) ([]network.PathSnapshot, error) {
+	return nil, nil
+}
+
+// mockResponseWriter records the response written by an API handler.
+type mockResponseWriter struct {
+	header      http.Header
+	resp        *api.Response
+	contentType string
+	raw         []byte
+}
+
+func (r *mockResponseWriter) Header() http.Header {
+	if r.header == nil {
+		r.header = make(http.Header)
+	}
+	return r.header
+}
+
+func (r *mockResponseWriter) Write(resp api.Response) {
+	r.resp = &resp
+}
+
+func (r *mockResponseWriter) WriteHeader(int) {}
+
+func (r *mockResponseWriter) WriteRaw(contentType string, data []byte) {
+	r.contentType = contentType
+	r.raw = data
+}
+
+func (r *mockResponseWriter) Stream(contentType string) io.Writer {
+	r.contentType = contentType
+	return new(bytes.Buffer)
+}
+
+// testSnapshot returns a small topology that has two switches connected by a link, and a
+// host attached to one of them. The switch description has the characters to be escaped.
+func testSnapshot() *network.TopologySnapshot {
+	return &network.TopologySnapshot{
+		Devices: []network.DeviceSnapshot{
+			{ID: "1", Manufacturer: `Acme "Networks"`, Hardware: "<S&W>"},
+			{ID: "2", Manufacturer: "Acme", Hardware: "S2"},
+		},
+		Links: []network.LinkSnapshot{
+			{ID: "1:1/2:3", Ports: [2]string{"1:1", "2:3"}, Enabled: false, Weight: 1.5, Latency: -1},
+		},
+		Hosts: []network.HostSnapshot{
+			{MAC: "00:00:00:00:00:01", IP: "10.0.0.1", Port: "2:7"},
+		},
+	}
+}
+
+func requestTopology(t *testing.T, format string) *mockResponseWriter {
+	body := strings.NewReader(`{"format":"` + format + `"}`)
+	req, err := http.NewRequest("POST", "/api/v1/topology", body)
+	if err != nil {
+		t.Fatalf("failed to create a request: %v", err)
+	}
+
+	w := new(mockResponseWriter)
+	r := &API{Network: &mockNetwork{topo: testSnapshot()}}
+	r.topology(w, &rest.Request{Request: req})
+
+	return w
+}
+
+func TestTopologyJSON(t *testing.T) {
+	w := requestTopology(t, "")
+	if w.resp == nil || w.resp.Status != api.StatusOkay {
+		t.Fatalf("unexpected response: %+v", w.resp)
+	}
+
+	v, err := json.Marshal(w.resp.Data)
+	if err != nil {
+		t.Fatalf("failed to marshal the topology: %v", err)
+	}
+	topo := new(network.TopologySnapshot)
+	if err := json.Unmarshal(v, topo); err != nil {
+		t.Fatalf("failed to unmarshal the topology: %v", err)
+	}
+	if len(topo.Devices) != 2 || len(topo.Links) != 1 || len(topo.Hosts) != 1 {
+		t.Fatalf("unexpected topology: %+v", topo)
+	}
+	if topo.Devices[0].Manufacturer != `Acme "Networks"` || topo.Links[0].Ports != [2]string{"1:1", "2:3"} {
+		t.Fatalf("unexpected topology: %+v", topo)
+	}
+}
+
+func TestTopologyDOT(t *testing.T) {
+	w := requestTopology(t, "DOT")
+	if w.resp != nil {
+		t.Fatalf("unexpected JSON response: %+v", w.resp)
+	}
+	if !strings.HasPrefix(w.contentType, "text/vnd.graphviz") {
+		t.Fatalf("unexpected content type: %v", w.contentType)
+	}
+
+	dot := string(w.raw)
+	expected := []string{
+		"graph cherry {\n",
+		// The quotes and the new lines in the labels should be escaped.
+		`"1" [shape=box, label="1\nAcme \"Networks\" <S&W>"];`,
+		`"host:00:00:00:00:00:01" [shape=ellipse, label="10.0.0.1\n00:00:00:00:00:01"];`,
+		// The port numbers are split from the port IDs.
+		`"1" -- "2" [taillabel="1", headlabel="3", style=dashed, color=black, weight=1.5];`,
+		`"2" -- "host:00:00:00:00:00:01" [taillabel="7"];`,
+	}
+	for _, v := range expected {
+		if !strings.Contains(dot, v) {
+			t.Errorf("missing %v in the DOT output:\n%v", v, dot)
+		}
+	}
+	if !strings.HasSuffix(dot, "}\n") {
+		t.Errorf("unterminated DOT output:\n%v", dot)
+	}
+}
+
+func TestTopologyGraphML(t *testing.T) {
+	w := requestTopology(t, "graphml")
+	if w.resp != nil {
+		t.Fatalf("unexpected JSON response: %+v", w.resp)
+	}
+	if !strings.HasPrefix(w.contentType, "application/graphml+xml") {
+		t.Fatalf("unexpected content type: %v", w.contentType)
+	}
+
+	// The special characters should be escaped as the XML entities.
+	if !bytes.Contains(w.raw, []byte("Acme &#34;Networks&#34; &lt;S&amp;W&gt;")) {
+		t.Errorf("unescaped label in the GraphML output:\n%s", w.raw)
+	}
+
+	doc := new(graphML)
+	if err := xml.Unmarshal(w.raw, doc); err != nil {
+		t.Fatalf("failed to parse the GraphML output: %v", err)
+	}
+	if len(doc.Graph.Nodes) != 3 || len(doc.Graph.Edges) != 2 {
+		t.Fatalf("unexpected graph: %+v", doc.Graph)
+	}
+	if v := doc.Graph.Nodes[0]; v.ID != "1" || v.Data[1].Value != `Acme "Networks" <S&W>` {
+		t.Errorf("unexpected switch node: %+v", v)
+	}
+	if v := doc.Graph.Nodes[2]; v.ID != "host:00:00:00:00:00:01" || v.Data[0].Value != "host" {
+		t.Errorf("unexpected host node: %+v", v)
+	}
+	if v := doc.Graph.Edges[0]; v.ID != "1:1/2:3" || v.Source != "1" || v.Target != "2" {
+		t.Errorf("unexpected link edge: %+v", v)
+	}
+	if v := doc.Graph.Edges[1]; v.ID != "2:7/host:00:00:00:00:00:01" || v.Source != "2" || v.Target != "host:00:00:00:00:00:01" {
+		t.Errorf("unexpected host edge: %+v", v)
+	}
+}
+
+func TestTopologyInvalidFormat(t *testing.T) {
+	w := requestTopology(t, "svg")
+	if w.resp == nil || w.resp.Status != api.StatusInvalidParameter {
+		t.Fatalf("unexpected response: %+v", w.resp)
+	}
+}
@@ -26,6 +26,8 @@
 package api
 
 import (
+	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/ant0ine/go-json-rest/rest"
@@ -79,6 +81,13 @@ type ResponseWriter interface {
 	// Similar to the http.ResponseWriter interface, with additional JSON related
 	// headers set.
 	WriteHeader(int)
+
+	// WriteRaw writes data as it is, without the JSON response envelope, with the content type.
+	WriteRaw(contentType string, data []byte)
+
+	// Stream writes the response header with the content type, and returns a writer
+	// that sends the written data to the client immediately without buffering.
+	Stream(contentType string) io.Writer
 }
 
 type logWriter struct {
@@ -107,3 +116,67 @@ func (r *logWriter) Write(resp Response) {
 func (r *logWriter) WriteHeader(status int) {
 	r.w.WriteHeader(status)
 }
+
+func (r *logWriter) WriteRaw(contentType string, data []byte) {
+	logger.Debugf("raw response: contentType=%v, length=%v", contentType, len(data))
+
+	w, ok := r.w.(http.ResponseWriter)
+	if !ok {
+		r.Write(Response{Status: StatusInternalServerError, Message: fmt.Sprintf("raw response is not supported by the response writer: %T", r.w)})
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		logger.Errorf("failed to write a raw response: %v", err)
+	}
+}
+
+func (r *logWriter) Stream(contentType string) io.Writer {
+	logger.Debugf("streaming response: contentType=%v", contentType)
+
+	w, ok := r.w.(http.ResponseWriter)
+	if !ok {
+		r.WriteHeader(http.StatusInternalServerError)
+		err := fmt.Errorf("streaming response is not supported by the response writer: %T", r.w)
+		logger.Errorf("%v", err)
+		return &errWriter{err: err}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, ok := r.w.(http.Flusher)
+	if !ok {
+		// Fallback to the non-streaming response that is sent when the handler returns.
+		logger.Warningf("response writer does not support flushing: %T", r.w)
+		return w
+	}
+	flusher.Flush()
+
+	return &flushWriter{w: w, flusher: flusher}
+}
+
+type flushWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (r *flushWriter) Write(data []byte) (n int, err error) {
+	n, err = r.w.Write(data)
+	if err != nil {
+		return n, err
+	}
+	r.flusher.Flush()
+
+	return n, nil
+}
+
+// errWriter is a writer that always fails with err.
+type errWriter struct {
+	err error
+}
+
+func (r *errWriter) Write(data []byte) (n int, err error) {
+	return 0, r.err
+}
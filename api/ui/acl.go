@@ -0,0 +1,512 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015-2019 Samjung Data Service, Inc. All rights reserved.
+ *
+ *  Kitae Kim <superkkt@sds.co.kr>
+ *  Donam Kim <donam.kim@sds.co.kr>
+ *  Jooyoung Kang <jooyoung.kang@sds.co.kr>
+ *  Changjin Choi <ccj9707@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+	"unicode/utf8"
+
+	"github.com/superkkt/cherry/api"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/davecgh/go-spew/spew"
+)
+
+type ACLTransaction interface {
+	// ACLs returns a list of registered ACL rules in descending order of their priorities. Pagination limit can be 0 that means no pagination.
+	ACLs(Pagination) ([]*ACL, error)
+	// AddACL adds a new ACL rule. invalidGroup is true if a group of the rule does not exist.
+	AddACL(requesterID uint64, rule ACLRule) (acl *ACL, invalidGroup bool, err error)
+	// UpdateACL updates an ACL rule specified by id and then returns information of the rule. It returns nil if the rule does not exist.
+	UpdateACL(requesterID, aclID uint64, rule ACLRule) (acl *ACL, invalidGroup bool, err error)
+	// RemoveACL removes an ACL rule specified by id and then returns information of the rule before removing. It returns nil if the rule does not exist.
+	RemoveACL(requesterID, aclID uint64) (*ACL, error)
+}
+
+type ACLAction string
+
+const (
+	ACLActionAllow ACLAction = "ALLOW"
+	ACLActionDeny  ACLAction = "DENY"
+)
+
+func (r ACLAction) Validate() error {
+	if r != ACLActionAllow && r != ACLActionDeny {
+		return fmt.Errorf("invalid ACL action: %v", r)
+	}
+
+	return nil
+}
+
+// ACLRule filters the IPv4 packets from the source to the destination, each of which is a network
+// or a group of hosts. The packets that do not match any rule are allowed.
+type ACLRule struct {
+	// Larger value has higher priority. A deny rule takes precedence over an allow rule that has the same priority.
+	Priority   uint16
+	Action     ACLAction
+	SrcNetwork *net.IPNet // Nil means any address.
+	SrcGroupID uint64     // Zero means no group.
+	DstNetwork *net.IPNet // Nil means any address.
+	DstGroupID uint64     // Zero means no group.
+	Protocol   uint8      // Zero means any protocol.
+	// Zero means any port. They require TCP or UDP protocol.
+	SrcPort     uint16
+	DstPort     uint16
+	Description string
+}
+
+type ACL struct {
+	ID uint64
+	ACLRule
+	SrcGroup  string // Empty if there is no source group.
+	DstGroup  string // Empty if there is no destination group.
+	Timestamp time.Time
+}
+
+func (r *ACL) MarshalJSON() ([]byte, error) {
+	network := func(n *net.IPNet) string {
+		if n == nil {
+			return ""
+		}
+		return n.String()
+	}
+
+	return json.Marshal(&struct {
+		ID          uint64 `json:"id"`
+		Priority    uint16 `json:"priority"`
+		Action      string `json:"action"`
+		SrcNetwork  string `json:"src_network"`
+		SrcGroupID  uint64 `json:"src_group_id"`
+		SrcGroup    string `json:"src_group"`
+		DstNetwork  string `json:"dst_network"`
+		DstGroupID  uint64 `json:"dst_group_id"`
+		DstGroup    string `json:"dst_group"`
+		Protocol    uint8  `json:"protocol"`
+		SrcPort     uint16 `json:"src_port"`
+		DstPort     uint16 `json:"dst_port"`
+		Description string `json:"description"`
+		Timestamp   int64  `json:"timestamp"`
+	}{
+		ID:          r.ID,
+		Priority:    r.Priority,
+		Action:      string(r.Action),
+		SrcNetwork:  network(r.SrcNetwork),
+		SrcGroupID:  r.SrcGroupID,
+		SrcGroup:    r.SrcGroup,
+		DstNetwork:  network(r.DstNetwork),
+		DstGroupID:  r.DstGroupID,
+		DstGroup:    r.DstGroup,
+		Protocol:    r.Protocol,
+		SrcPort:     r.SrcPort,
+		DstPort:     r.DstPort,
+		Description: r.Description,
+		Timestamp:   r.Timestamp.Unix(),
+	})
+}
+
+func (r *API) listACL(w api.ResponseWriter, req *rest.Request) {
+	p := new(listACLParam)
+	if err := req.DecodeJsonPayload(p); err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to decode param: %v", err.Error())})
+		return
+	}
+	logger.Debugf("listACL request from %v: %v", req.RemoteAddr, spew.Sdump(p))
+
+	if _, ok := r.session.Get(p.SessionID); ok == false {
+		w.Write(api.Response{Status: api.StatusUnknownSession, Message: fmt.Sprintf("unknown session id: %v", p.SessionID)})
+		return
+	}
+
+	var acl []*ACL
+	f := func(tx Transaction) (err error) {
+		acl, err = tx.ACLs(p.Pagination)
+		return err
+	}
+	if err := r.DB.Exec(f); err != nil {
+		w.Write(api.Response{Status: api.StatusInternalServerError, Message: fmt.Sprintf("failed to query the ACL rules: %v", err.Error())})
+		return
+	}
+	logger.Debugf("queried ACL list: %v", spew.Sdump(acl))
+
+	w.Write(api.Response{Status: api.StatusOkay, Data: acl})
+}
+
+type listACLParam struct {
+	SessionID  string
+	Pagination Pagination
+}
+
+func (r *listACLParam) UnmarshalJSON(data []byte) error {
+	v := struct {
+		SessionID  string     `json:"session_id"`
+		Pagination Pagination `json:"pagination"`
+	}{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*r = listACLParam(v)
+
+	return r.validate()
+}
+
+func (r *listACLParam) validate() error {
+	if len(r.SessionID) != 64 {
+		return errors.New("invalid session id")
+	}
+
+	return nil
+}
+
+func (r *API) addACL(w api.ResponseWriter, req *rest.Request) {
+	p := new(addACLParam)
+	if err := req.DecodeJsonPayload(p); err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to decode param: %v", err.Error())})
+		return
+	}
+	logger.Debugf("addACL request from %v: %v", req.RemoteAddr, spew.Sdump(p))
+
+	session, ok := r.session.Get(p.SessionID)
+	if ok == false {
+		w.Write(api.Response{Status: api.StatusUnknownSession, Message: fmt.Sprintf("unknown session id: %v", p.SessionID)})
+		return
+	}
+
+	var acl, conflict *ACL
+	var invalidGroup bool
+	f := func(tx Transaction) (err error) {
+		if conflict, err = r.unenforceableACL(tx, 0, p.Rule); err != nil || conflict != nil {
+			return err
+		}
+		acl, invalidGroup, err = tx.AddACL(session.(*User).ID, p.Rule)
+		return err
+	}
+	if err := r.DB.Exec(f); err != nil {
+		w.Write(api.Response{Status: api.StatusInternalServerError, Message: fmt.Sprintf("failed to add a new ACL rule: %v", err.Error())})
+		return
+	}
+
+	if conflict != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: unenforceableACLMessage(conflict)})
+		return
+	}
+	if invalidGroup {
+		w.Write(api.Response{Status: api.StatusNotFound, Message: fmt.Sprintf("not found group: src=%v, dst=%v", p.Rule.SrcGroupID, p.Rule.DstGroupID)})
+		return
+	}
+	logger.Debugf("added ACL rule: %v", spew.Sdump(acl))
+
+	w.Write(api.Response{Status: api.StatusOkay, Data: acl})
+}
+
+type addACLParam struct {
+	SessionID string
+	Rule      ACLRule
+}
+
+func (r *addACLParam) UnmarshalJSON(data []byte) error {
+	v := struct {
+		SessionID string `json:"session_id"`
+		aclRuleParam
+	}{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if len(v.SessionID) != 64 {
+		return errors.New("invalid session id")
+	}
+	rule, err := v.aclRuleParam.parse()
+	if err != nil {
+		return err
+	}
+	*r = addACLParam{SessionID: v.SessionID, Rule: rule}
+
+	return nil
+}
+
+type aclRuleParam struct {
+	Priority    uint16    `json:"priority"`
+	Action      ACLAction `json:"action"`
+	SrcNetwork  string    `json:"src_network"` // CIDR notation. Empty means any address.
+	SrcGroupID  uint64    `json:"src_group_id"`
+	DstNetwork  string    `json:"dst_network"` // CIDR notation. Empty means any address.
+	DstGroupID  uint64    `json:"dst_group_id"`
+	Protocol    uint8     `json:"protocol"`
+	SrcPort     uint16    `json:"src_port"`
+	DstPort     uint16    `json:"dst_port"`
+	Description string    `json:"description"`
+}
+
+func (r *aclRuleParam) parse() (rule ACLRule, err error) {
+	if err := r.Action.Validate(); err != nil {
+		return ACLRule{}, err
+	}
+	if rule.SrcNetwork, err = parseACLNetwork(r.SrcNetwork, r.SrcGroupID); err != nil {
+		return ACLRule{}, err
+	}
+	if rule.DstNetwork, err = parseACLNetwork(r.DstNetwork, r.DstGroupID); err != nil {
+		return ACLRule{}, err
+	}
+	if (r.SrcPort != 0 || r.DstPort != 0) && r.Protocol != 6 && r.Protocol != 17 {
+		return ACLRule{}, errors.New("ports require TCP or UDP protocol")
+	}
+	if utf8.RuneCountInString(r.Description) > 255 {
+		return ACLRule{}, errors.New("too long description")
+	}
+
+	rule.Priority = r.Priority
+	rule.Action = r.Action
+	rule.SrcGroupID = r.SrcGroupID
+	rule.DstGroupID = r.DstGroupID
+	rule.Protocol = r.Protocol
+	rule.SrcPort = r.SrcPort
+	rule.DstPort = r.DstPort
+	rule.Description = r.Description
+
+	return rule, nil
+}
+
+// parseACLNetwork parses an IPv4 network in CIDR notation, which cannot be used with a group.
+// It returns nil if network is empty.
+func parseACLNetwork(network string, groupID uint64) (*net.IPNet, error) {
+	if len(network) == 0 {
+		return nil, nil
+	}
+	if groupID != 0 {
+		return nil, errors.New("network and group cannot be used together")
+	}
+
+	ip, n, err := net.ParseCIDR(network)
+	if err != nil || ip.To4() == nil {
+		return nil, fmt.Errorf("invalid network: %v", network)
+	}
+
+	return n, nil
+}
+
+// unenforceableACL returns an existing rule, except the one specified by id, that makes
+// an exception with rule, i.e., an allow rule over a lower deny rule that overlaps it. Such
+// an exception cannot be enforced on the switches without the table dedicated to the ACL
+// flows, which deny the packets allowed by the exception. It returns nil if there is no
+// such a rule or all the switches have the dedicated table.
+func (r *API) unenforceableACL(tx Transaction, id uint64, rule ACLRule) (*ACL, error) {
+	if r.DedicatedACLTable {
+		return nil, nil
+	}
+
+	rules, err := tx.ACLs(Pagination{})
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range rules {
+		if v.ID == id {
+			continue
+		}
+		if rule.Action == ACLActionAllow && v.Action == ACLActionDeny && isACLException(rule, v.ACLRule) {
+			return v, nil
+		}
+		if rule.Action == ACLActionDeny && v.Action == ACLActionAllow && isACLException(v.ACLRule, rule) {
+			return v, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func unenforceableACLMessage(conflict *ACL) string {
+	return fmt.Sprintf("allow rule over an overlapping lower deny rule cannot be enforced on the switches without the ACL table: conflicting rule ID=%v", conflict.ID)
+}
+
+// isACLException returns whether the allow rule makes an exception to the lower deny rule.
+// A deny rule takes precedence over an allow rule that has the same priority.
+func isACLException(allow, deny ACLRule) bool {
+	if allow.Priority <= deny.Priority {
+		return false
+	}
+
+	return overlapsACLEndpoint(allow.SrcNetwork, allow.SrcGroupID, deny.SrcNetwork, deny.SrcGroupID) &&
+		overlapsACLEndpoint(allow.DstNetwork, allow.DstGroupID, deny.DstNetwork, deny.DstGroupID) &&
+		overlapsACLValue(uint16(allow.Protocol), uint16(deny.Protocol)) &&
+		overlapsACLValue(allow.SrcPort, deny.SrcPort) && overlapsACLValue(allow.DstPort, deny.DstPort)
+}
+
+// overlapsACLEndpoint returns whether two endpoints may have a common address. A group is
+// considered to overlap any endpoint because its hosts can be changed later.
+func overlapsACLEndpoint(aNet *net.IPNet, aGroup uint64, bNet *net.IPNet, bGroup uint64) bool {
+	if aGroup != 0 || bGroup != 0 {
+		return true
+	}
+	if aNet == nil || bNet == nil {
+		return true
+	}
+
+	return aNet.Contains(bNet.IP) || bNet.Contains(aNet.IP)
+}
+
+// Zero value means any value.
+func overlapsACLValue(a, b uint16) bool {
+	return a == 0 || b == 0 || a == b
+}
+
+func (r *API) updateACL(w api.ResponseWriter, req *rest.Request) {
+	p := new(updateACLParam)
+	if err := req.DecodeJsonPayload(p); err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to decode param: %v", err.Error())})
+		return
+	}
+	logger.Debugf("updateACL request from %v: %v", req.RemoteAddr, spew.Sdump(p))
+
+	session, ok := r.session.Get(p.SessionID)
+	if ok == false {
+		w.Write(api.Response{Status: api.StatusUnknownSession, Message: fmt.Sprintf("unknown session id: %v", p.SessionID)})
+		return
+	}
+
+	var acl, conflict *ACL
+	var invalidGroup bool
+	f := func(tx Transaction) (err error) {
+		if conflict, err = r.unenforceableACL(tx, p.ID, p.Rule); err != nil || conflict != nil {
+			return err
+		}
+		acl, invalidGroup, err = tx.UpdateACL(session.(*User).ID, p.ID, p.Rule)
+		return err
+	}
+	if err := r.DB.Exec(f); err != nil {
+		w.Write(api.Response{Status: api.StatusInternalServerError, Message: fmt.Sprintf("failed to update an ACL rule: %v", err.Error())})
+		return
+	}
+
+	if conflict != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: unenforceableACLMessage(conflict)})
+		return
+	}
+	if invalidGroup {
+		w.Write(api.Response{Status: api.StatusNotFound, Message: fmt.Sprintf("not found group: src=%v, dst=%v", p.Rule.SrcGroupID, p.Rule.DstGroupID)})
+		return
+	}
+	if acl == nil {
+		w.Write(api.Response{Status: api.StatusNotFound, Message: fmt.Sprintf("not found ACL rule to update: %v", p.ID)})
+		return
+	}
+	logger.Debugf("updated the ACL rule: %v", spew.Sdump(acl))
+
+	w.Write(api.Response{Status: api.StatusOkay, Data: acl})
+}
+
+type updateACLParam struct {
+	SessionID string
+	ID        uint64
+	Rule      ACLRule
+}
+
+func (r *updateACLParam) UnmarshalJSON(data []byte) error {
+	v := struct {
+		SessionID string `json:"session_id"`
+		ID        uint64 `json:"id"`
+		aclRuleParam
+	}{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if len(v.SessionID) != 64 {
+		return errors.New("invalid session id")
+	}
+	if v.ID == 0 {
+		return errors.New("invalid ACL rule id")
+	}
+	rule, err := v.aclRuleParam.parse()
+	if err != nil {
+		return err
+	}
+	*r = updateACLParam{SessionID: v.SessionID, ID: v.ID, Rule: rule}
+
+	return nil
+}
+
+func (r *API) removeACL(w api.ResponseWriter, req *rest.Request) {
+	p := new(removeACLParam)
+	if err := req.DecodeJsonPayload(p); err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to decode param: %v", err.Error())})
+		return
+	}
+	logger.Debugf("removeACL request from %v: %v", req.RemoteAddr, spew.Sdump(p))
+
+	session, ok := r.session.Get(p.SessionID)
+	if ok == false {
+		w.Write(api.Response{Status: api.StatusUnknownSession, Message: fmt.Sprintf("unknown session id: %v", p.SessionID)})
+		return
+	}
+
+	var acl *ACL
+	f := func(tx Transaction) (err error) {
+		acl, err = tx.RemoveACL(session.(*User).ID, p.ID)
+		return err
+	}
+	if err := r.DB.Exec(f); err != nil {
+		w.Write(api.Response{Status: api.StatusInternalServerError, Message: fmt.Sprintf("failed to remove an ACL rule: %v", err.Error())})
+		return
+	}
+
+	if acl == nil {
+		w.Write(api.Response{Status: api.StatusNotFound, Message: fmt.Sprintf("not found ACL rule to remove: %v", p.ID)})
+		return
+	}
+	logger.Debugf("removed the ACL rule: %v", spew.Sdump(acl))
+
+	w.Write(api.Response{Status: api.StatusOkay})
+}
+
+type removeACLParam struct {
+	SessionID string
+	ID        uint64
+}
+
+func (r *removeACLParam) UnmarshalJSON(data []byte) error {
+	v := struct {
+		SessionID string `json:"session_id"`
+		ID        uint64 `json:"id"`
+	}{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*r = removeACLParam(v)
+
+	return r.validate()
+}
+
+func (r *removeACLParam) validate() error {
+	if len(r.SessionID) != 64 {
+		return errors.New("invalid session id")
+	}
+	if r.ID == 0 {
+		return errors.New("invalid ACL rule id")
+	}
+
+	return nil
+}
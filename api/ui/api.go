@@ -47,6 +47,9 @@ type API struct {
 	api.Server
 	DB   Database
 	LDAP LDAP
+	// DedicatedACLTable is true if all the switches have the table dedicated to the ACL flows,
+	// which is required to enforce the allow ACL rules that make exceptions to lower deny rules.
+	DedicatedACLTable bool
 
 	session *session
 }
@@ -72,6 +75,7 @@ type Transaction interface {
 	LogTransaction
 	CategoryTransaction
 	ComponentTransaction
+	ACLTransaction
 }
 
 type Search struct {
@@ -237,6 +241,10 @@ func (r *API) Serve() error {
 		rest.Post("/api/v1/switch/list", api.ResponseHandler(r.listSwitch)),
 		rest.Post("/api/v1/switch/add", api.ResponseHandler(r.addSwitch)),
 		rest.Post("/api/v1/switch/remove", api.ResponseHandler(r.removeSwitch)),
+		rest.Post("/api/v1/switch/pending/list", api.ResponseHandler(r.listPendingSwitch)),
+		rest.Post("/api/v1/switch/pending/approve", api.ResponseHandler(r.approveSwitch)),
+		rest.Post("/api/v1/switch/discovered/list", api.ResponseHandler(r.listDiscoveredSwitch)),
+		rest.Post("/api/v1/switch/discovered/confirm", api.ResponseHandler(r.confirmSwitch)),
 		rest.Post("/api/v1/network/list", api.ResponseHandler(r.listNetwork)),
 		rest.Post("/api/v1/network/add", api.ResponseHandler(r.addNetwork)),
 		rest.Post("/api/v1/network/remove", api.ResponseHandler(r.removeNetwork)),
@@ -261,6 +269,10 @@ func (r *API) Serve() error {
 		rest.Post("/api/v1/component/add", api.ResponseHandler(r.addComponent)),
 		rest.Post("/api/v1/component/update", api.ResponseHandler(r.updateComponent)),
 		rest.Post("/api/v1/component/remove", api.ResponseHandler(r.removeComponent)),
+		rest.Post("/api/v1/acl/list", api.ResponseHandler(r.listACL)),
+		rest.Post("/api/v1/acl/add", api.ResponseHandler(r.addACL)),
+		rest.Post("/api/v1/acl/update", api.ResponseHandler(r.updateACL)),
+		rest.Post("/api/v1/acl/remove", api.ResponseHandler(r.removeACL)),
 	)
 }
 
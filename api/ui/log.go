@@ -48,11 +48,12 @@ const (
 	LogTypeVIP       LogType = "VIP"
 	LogTypeCategory  LogType = "CATEGORY"
 	LogTypeComponent LogType = "COMPONENT"
+	LogTypeACL       LogType = "ACL"
 )
 
 func (r LogType) Validate() error {
 	if r != LogTypeUser && r != LogTypeGroup && r != LogTypeSwitch && r != LogTypeNetwork &&
-		r != LogTypeHost && r != LogTypeVIP && r != LogTypeCategory && r != LogTypeComponent {
+		r != LogTypeHost && r != LogTypeVIP && r != LogTypeCategory && r != LogTypeComponent && r != LogTypeACL {
 		return fmt.Errorf("invalid log type: %v", r)
 	}
 
@@ -32,6 +32,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/superkkt/cherry/api"
@@ -45,6 +46,13 @@ type SwitchTransaction interface {
 	AddSwitch(requesterID, dpid uint64, nPorts, firstPort, firstPrintedPort uint16, desc string) (sw *Switch, duplicated bool, err error)
 	// RemoveSwitch removes a switch specified by id and then returns information of the switch before removing. It returns nil if the switch does not exist.
 	RemoveSwitch(requesterID, swID uint64) (*Switch, error)
+	PendingSwitches(Pagination) ([]*PendingSwitch, error)
+	// ApproveSwitch adds the pending switch specified by dpid, which is then removed from the pending switches. It returns nil if the pending switch does not exist.
+	ApproveSwitch(requesterID, dpid uint64, nPorts, firstPort, firstPrintedPort uint16, desc string) (sw *Switch, duplicated bool, err error)
+	// DiscoveredSwitches returns the switches that have been discovered by the controller, but not yet registered.
+	DiscoveredSwitches(Pagination) ([]*DiscoveredSwitch, error)
+	// ConfirmSwitch adds the discovered switch specified by dpid with its discovered ports. The discovered description is used if desc is empty. It returns nil if the discovered switch does not exist.
+	ConfirmSwitch(requesterID, dpid uint64, desc string) (sw *Switch, duplicated bool, err error)
 }
 
 type Switch struct {
@@ -80,6 +88,76 @@ func (r *Switch) MarshalJSON() ([]byte, error) {
 	return json.Marshal(&s)
 }
 
+// PendingSwitch is an unregistered switch that has tried to connect to the controller.
+type PendingSwitch struct {
+	DPID        uint64
+	Address     string
+	Quarantined bool
+	FirstSeen   time.Time
+	LastSeen    time.Time
+}
+
+func (r *PendingSwitch) MarshalJSON() ([]byte, error) {
+	s := new(struct {
+		DPID struct {
+			Int uint64 `json:"int"`
+			Hex string `json:"hex"`
+		} `json:"dpid"`
+		Address     string `json:"address"`
+		Quarantined bool   `json:"quarantined"`
+		FirstSeen   int64  `json:"first_seen"`
+		LastSeen    int64  `json:"last_seen"`
+	})
+
+	s.DPID.Int = r.DPID
+	s.DPID.Hex = hexDPID(r.DPID)
+	s.Address = r.Address
+	s.Quarantined = r.Quarantined
+	s.FirstSeen = r.FirstSeen.Unix()
+	s.LastSeen = r.LastSeen.Unix()
+
+	return json.Marshal(&s)
+}
+
+// DiscoveredSwitch is a switch whose ports have been learned from the switch itself.
+type DiscoveredSwitch struct {
+	DPID        uint64
+	Description string
+	FirstSeen   time.Time
+	LastSeen    time.Time
+	Ports       []DiscoveredPort
+}
+
+type DiscoveredPort struct {
+	Number uint16 `json:"number"`
+	Name   string `json:"name"`
+	MAC    string `json:"mac"`
+	// Current link speed in MB.
+	Speed uint64 `json:"speed"`
+}
+
+func (r *DiscoveredSwitch) MarshalJSON() ([]byte, error) {
+	s := new(struct {
+		DPID struct {
+			Int uint64 `json:"int"`
+			Hex string `json:"hex"`
+		} `json:"dpid"`
+		Description string           `json:"description"`
+		FirstSeen   int64            `json:"first_seen"`
+		LastSeen    int64            `json:"last_seen"`
+		Ports       []DiscoveredPort `json:"ports"`
+	})
+
+	s.DPID.Int = r.DPID
+	s.DPID.Hex = hexDPID(r.DPID)
+	s.Description = r.Description
+	s.FirstSeen = r.FirstSeen.Unix()
+	s.LastSeen = r.LastSeen.Unix()
+	s.Ports = r.Ports
+
+	return json.Marshal(&s)
+}
+
 func hexDPID(dpid uint64) string {
 	hex := fmt.Sprintf("%016x", dpid)
 	re := regexp.MustCompile("..")
@@ -213,23 +291,12 @@ func (r *addSwitchParam) UnmarshalJSON(data []byte) error {
 	if uint32(v.FirstPort)+uint32(v.NumPorts) > 0xFFFF {
 		return errors.New("too high first port number")
 	}
-	ok, err := regexp.MatchString("^([0-9a-fA-F]{2}:){7}([0-9a-fA-F]{2})$", v.DPID)
+	dpid, err := parseDPID(v.DPID)
 	if err != nil {
 		return err
 	}
 
-	// Is the DP id in hex format?
-	if ok {
-		v.DPID = strings.Replace(v.DPID, ":", "", -1)
-		if r.DPID, err = strconv.ParseUint(v.DPID, 16, 64); err != nil {
-			return err
-		}
-	} else {
-		if r.DPID, err = strconv.ParseUint(v.DPID, 10, 64); err != nil {
-			return err
-		}
-	}
-
+	r.DPID = dpid
 	r.SessionID = v.SessionID
 	r.NumPorts = v.NumPorts
 	r.FirstPort = v.FirstPort
@@ -239,6 +306,21 @@ func (r *addSwitchParam) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// parseDPID parses s that is a DPID in the decimal or colon-separated hex format.
+func parseDPID(s string) (uint64, error) {
+	ok, err := regexp.MatchString("^([0-9a-fA-F]{2}:){7}([0-9a-fA-F]{2})$", s)
+	if err != nil {
+		return 0, err
+	}
+
+	// Is the DP id in hex format?
+	if ok {
+		return strconv.ParseUint(strings.Replace(s, ":", "", -1), 16, 64)
+	}
+
+	return strconv.ParseUint(s, 10, 64)
+}
+
 func (r *API) removeSwitch(w api.ResponseWriter, req *rest.Request) {
 	p := new(removeSwitchParam)
 	if err := req.DecodeJsonPayload(p); err != nil {
@@ -308,3 +390,199 @@ func (r *removeSwitchParam) validate() error {
 
 	return nil
 }
+
+func (r *API) listPendingSwitch(w api.ResponseWriter, req *rest.Request) {
+	p := new(listSwitchParam)
+	if err := req.DecodeJsonPayload(p); err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to decode param: %v", err.Error())})
+		return
+	}
+	logger.Debugf("listPendingSwitch request from %v: %v", req.RemoteAddr, spew.Sdump(p))
+
+	if _, ok := r.session.Get(p.SessionID); ok == false {
+		w.Write(api.Response{Status: api.StatusUnknownSession, Message: fmt.Sprintf("unknown session id: %v", p.SessionID)})
+		return
+	}
+
+	var sw []*PendingSwitch
+	f := func(tx Transaction) (err error) {
+		sw, err = tx.PendingSwitches(p.Pagination)
+		return err
+	}
+	if err := r.DB.Exec(f); err != nil {
+		w.Write(api.Response{Status: api.StatusInternalServerError, Message: fmt.Sprintf("failed to query the pending switch list: %v", err.Error())})
+		return
+	}
+	logger.Debugf("queried pending switch list: %v", spew.Sdump(sw))
+
+	w.Write(api.Response{Status: api.StatusOkay, Data: sw})
+}
+
+func (r *API) approveSwitch(w api.ResponseWriter, req *rest.Request) {
+	p := new(addSwitchParam)
+	if err := req.DecodeJsonPayload(p); err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to decode param: %v", err.Error())})
+		return
+	}
+	logger.Debugf("approveSwitch request from %v: %v", req.RemoteAddr, spew.Sdump(p))
+
+	session, ok := r.session.Get(p.SessionID)
+	if ok == false {
+		w.Write(api.Response{Status: api.StatusUnknownSession, Message: fmt.Sprintf("unknown session id: %v", p.SessionID)})
+		return
+	}
+
+	var sw *Switch
+	var duplicated bool
+	f := func(tx Transaction) (err error) {
+		sw, duplicated, err = tx.ApproveSwitch(session.(*User).ID, p.DPID, p.NumPorts, p.FirstPort, p.FirstPrintedPort, p.Description)
+		return err
+	}
+	if err := r.DB.Exec(f); err != nil {
+		w.Write(api.Response{Status: api.StatusInternalServerError, Message: fmt.Sprintf("failed to approve a pending switch: %v", err.Error())})
+		return
+	}
+
+	if duplicated {
+		w.Write(api.Response{Status: api.StatusDuplicated, Message: fmt.Sprintf("duplicated switch: dpid=%v", p.DPID)})
+		return
+	}
+	if sw == nil {
+		w.Write(api.Response{Status: api.StatusNotFound, Message: fmt.Sprintf("not found pending switch to approve: dpid=%v", p.DPID)})
+		return
+	}
+	// The quarantined switch will be admitted when it is probed by the device explorer of the controller.
+	logger.Debugf("approved pending switch: %v", spew.Sdump(sw))
+
+	w.Write(api.Response{Status: api.StatusOkay, Data: sw})
+}
+
+var errConfirmAborted = errors.New("confirming the discovered switches is aborted")
+
+func (r *API) listDiscoveredSwitch(w api.ResponseWriter, req *rest.Request) {
+	p := new(listSwitchParam)
+	if err := req.DecodeJsonPayload(p); err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to decode param: %v", err.Error())})
+		return
+	}
+	logger.Debugf("listDiscoveredSwitch request from %v: %v", req.RemoteAddr, spew.Sdump(p))
+
+	if _, ok := r.session.Get(p.SessionID); ok == false {
+		w.Write(api.Response{Status: api.StatusUnknownSession, Message: fmt.Sprintf("unknown session id: %v", p.SessionID)})
+		return
+	}
+
+	var sw []*DiscoveredSwitch
+	f := func(tx Transaction) (err error) {
+		sw, err = tx.DiscoveredSwitches(p.Pagination)
+		return err
+	}
+	if err := r.DB.Exec(f); err != nil {
+		w.Write(api.Response{Status: api.StatusInternalServerError, Message: fmt.Sprintf("failed to query the discovered switch list: %v", err.Error())})
+		return
+	}
+	logger.Debugf("queried discovered switch list: %v", spew.Sdump(sw))
+
+	w.Write(api.Response{Status: api.StatusOkay, Data: sw})
+}
+
+func (r *API) confirmSwitch(w api.ResponseWriter, req *rest.Request) {
+	p := new(confirmSwitchParam)
+	if err := req.DecodeJsonPayload(p); err != nil {
+		w.Write(api.Response{Status: api.StatusInvalidParameter, Message: fmt.Sprintf("failed to decode param: %v", err.Error())})
+		return
+	}
+	logger.Debugf("confirmSwitch request from %v: %v", req.RemoteAddr, spew.Sdump(p))
+
+	session, ok := r.session.Get(p.SessionID)
+	if ok == false {
+		w.Write(api.Response{Status: api.StatusUnknownSession, Message: fmt.Sprintf("unknown session id: %v", p.SessionID)})
+		return
+	}
+
+	var sw []*Switch
+	var notFound, duplicated uint64
+	f := func(tx Transaction) error {
+		sw = []*Switch{}
+		for _, v := range p.Switches {
+			s, dup, err := tx.ConfirmSwitch(session.(*User).ID, v.DPID, v.Description)
+			if err != nil {
+				return err
+			}
+			if dup {
+				duplicated = v.DPID
+				// Rollback to confirm all the switches or nothing.
+				return errConfirmAborted
+			}
+			if s == nil {
+				notFound = v.DPID
+				// Rollback to confirm all the switches or nothing.
+				return errConfirmAborted
+			}
+			sw = append(sw, s)
+		}
+
+		return nil
+	}
+	if err := r.DB.Exec(f); err != nil && err != errConfirmAborted {
+		w.Write(api.Response{Status: api.StatusInternalServerError, Message: fmt.Sprintf("failed to confirm the discovered switches: %v", err.Error())})
+		return
+	}
+
+	if duplicated != 0 {
+		w.Write(api.Response{Status: api.StatusDuplicated, Message: fmt.Sprintf("duplicated switch: dpid=%v", duplicated)})
+		return
+	}
+	if notFound != 0 {
+		w.Write(api.Response{Status: api.StatusNotFound, Message: fmt.Sprintf("not found discovered switch to confirm: dpid=%v", notFound)})
+		return
+	}
+	logger.Debugf("confirmed discovered switches: %v", spew.Sdump(sw))
+
+	w.Write(api.Response{Status: api.StatusOkay, Data: sw})
+}
+
+type confirmSwitchParam struct {
+	SessionID string
+	Switches  []confirmSwitchEntry
+}
+
+type confirmSwitchEntry struct {
+	DPID        uint64
+	Description string
+}
+
+func (r *confirmSwitchParam) UnmarshalJSON(data []byte) error {
+	v := struct {
+		SessionID string `json:"session_id"`
+		Switches  []struct {
+			DPID        string `json:"dpid"`
+			Description string `json:"description"`
+		} `json:"switches"`
+	}{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	if len(v.SessionID) != 64 {
+		return errors.New("invalid session id")
+	}
+	if len(v.Switches) == 0 {
+		return errors.New("empty switches to confirm")
+	}
+
+	r.SessionID = v.SessionID
+	r.Switches = make([]confirmSwitchEntry, len(v.Switches))
+	for i, s := range v.Switches {
+		dpid, err := parseDPID(s.DPID)
+		if err != nil {
+			return err
+		}
+		if utf8.RuneCountInString(s.Description) > 255 {
+			return errors.New("too long description")
+		}
+		r.Switches[i] = confirmSwitchEntry{DPID: dpid, Description: s.Description}
+	}
+
+	return nil
+}
@@ -82,12 +82,14 @@ func main() {
 
 	observer := initElectionObserver(ctx, db)
 	controller := network.NewController(db)
-	initAPIServer(observer, controller)
-	manager, err := createAppManager(db)
+	// Keep the host location cache of the controller consistent with the database.
+	db.SetHostLocationListener(controller)
+	manager, err := createAppManager(db, controller.Events())
 	if err != nil {
 		logger.Fatalf("failed to create application manager: %v", err)
 	}
 	manager.AddEventSender(controller)
+	initAPIServer(observer, controller, db, manager)
 
 	initSignalHandler(controller, manager, cancel)
 
@@ -116,6 +118,11 @@ func initConfig() {
 	if err := validateConfig(); err != nil {
 		logger.Fatalf("failed to validate the configuration: %v", err)
 	}
+	if path := viper.GetString("default.driver_profiles"); len(path) > 0 {
+		if err := network.LoadDriverProfiles(path); err != nil {
+			logger.Fatalf("failed to load the driver profiles: %v", err)
+		}
+	}
 }
 
 func validateConfig() error {
@@ -135,6 +142,45 @@ func validateConfig() error {
 	if vlanID < 0 || vlanID > 4095 {
 		return errors.New("invalid default.vlan_id in the config file")
 	}
+	if err := network.ValidateVLANConfig(); err != nil {
+		return err
+	}
+	mode, err := network.ParseForwardingMode(viper.GetString("default.forwarding_mode"))
+	if err != nil {
+		return errors.New("invalid default.forwarding_mode in the config file")
+	}
+	// The groups cannot be adopted on warm start, and removing them also removes the flows
+	// using them, which defeats the purpose of warm start.
+	if viper.GetBool("default.warm_start") && (mode == network.ForwardingECMP || viper.GetBool("default.fast_failover")) {
+		return errors.New("default.warm_start cannot be used with the ecmp forwarding mode or default.fast_failover")
+	}
+	if _, err := network.ParseAdmissionPolicy(viper.GetString("default.admission")); err != nil {
+		return errors.New("invalid default.admission in the config file")
+	}
+	if viper.GetFloat64("packet_in.port_rate") < 0 {
+		return errors.New("invalid packet_in.port_rate in the config file")
+	}
+	if viper.GetFloat64("packet_in.device_rate") < 0 {
+		return errors.New("invalid packet_in.device_rate in the config file")
+	}
+	if blockTime := viper.GetInt("packet_in.block_time"); blockTime < 0 || blockTime > 0xFFFF {
+		return errors.New("invalid packet_in.block_time in the config file")
+	}
+	if viper.GetInt("packet_in.workers") < 0 {
+		return errors.New("invalid packet_in.workers in the config file")
+	}
+	if viper.GetInt("packet_in.queue_size") < 0 {
+		return errors.New("invalid packet_in.queue_size in the config file")
+	}
+	if _, err := network.ParsePacketInOverflow(viper.GetString("packet_in.overflow")); err != nil {
+		return errors.New("invalid packet_in.overflow in the config file")
+	}
+	if viper.GetInt("external.timeout") < 0 {
+		return errors.New("invalid external.timeout in the config file")
+	}
+	if viper.GetInt("external.queue_size") < 0 {
+		return errors.New("invalid external.queue_size in the config file")
+	}
 
 	return nil
 }
@@ -151,7 +197,7 @@ func initElectionObserver(ctx context.Context, db *database.MySQL) *election.Obs
 	return observer
 }
 
-func initAPIServer(observer *election.Observer, controller *network.Controller) {
+func initAPIServer(observer *election.Observer, controller *network.Controller, db *database.MySQL, manager *northbound.Manager) {
 	go func() {
 		s := api.Server{}
 		s.Port = uint16(viper.GetInt("rest.port"))
@@ -162,7 +208,7 @@ func initAPIServer(observer *election.Observer, controller *network.Controller)
 		s.Observer = observer
 		s.Controller = controller
 
-		srv := &core.API{Server: s}
+		srv := &core.API{Server: s, Network: controller, Database: db, Applications: manager}
 		if err := srv.Serve(); err != nil {
 			logger.Fatalf("failed to run the API server: %v", err)
 		}
@@ -282,8 +328,8 @@ func listen(ctx context.Context, port int, controller *network.Controller, obser
 	}
 }
 
-func createAppManager(db *database.MySQL) (*northbound.Manager, error) {
-	manager, err := northbound.NewManager(db)
+func createAppManager(db *database.MySQL, events network.EventPublisher) (*northbound.Manager, error) {
+	manager, err := northbound.NewManager(db, events)
 	if err != nil {
 		return nil, err
 	}
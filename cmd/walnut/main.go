@@ -191,7 +191,7 @@ func initAPIServer() {
 		s.Observer = sdk
 		s.Controller = sdk
 
-		srv := &ui.API{Server: s, DB: initDatabase(), LDAP: initLDAPClient()}
+		srv := &ui.API{Server: s, DB: initDatabase(), LDAP: initLDAPClient(), DedicatedACLTable: viper.GetBool("acl.dedicated_table")}
 		if err := srv.Serve(); err != nil {
 			logger.Fatalf("failed to run the API server: %v", err)
 		}
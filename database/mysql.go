@@ -32,11 +32,13 @@ import (
 	"math/rand"
 	"net"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/superkkt/cherry/api/ui"
 	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app/acl"
 	"github.com/superkkt/cherry/northbound/app/announcer"
 	"github.com/superkkt/cherry/northbound/app/dhcp"
 	"github.com/superkkt/cherry/northbound/app/discovery"
@@ -65,8 +67,9 @@ var (
 )
 
 type MySQL struct {
-	db     *sql.DB
-	random *rand.Rand
+	db               *sql.DB
+	random           *rand.Rand
+	locationListener network.HostLocationListener
 }
 
 func NewMySQL() (*MySQL, error) {
@@ -313,6 +316,44 @@ func (r *MySQL) Location(mac net.HardwareAddr) (dpid string, port uint32, status
 	return dpid, port, status, nil
 }
 
+func (r *MySQL) HostLocations() (result []network.HostLocation, err error) {
+	f := func(tx *sql.Tx) error {
+		qry := "SELECT HEX(A.`mac`), INET_NTOA(B.`address`), D.`dpid`, C.`number` "
+		qry += "FROM `host` A "
+		qry += "JOIN `ip` B ON A.`ip_id` = B.`id` "
+		qry += "JOIN `port` C ON A.`port_id` = C.`id` "
+		qry += "JOIN `switch` D ON C.`switch_id` = D.`id`"
+
+		rows, err := tx.Query(qry)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		result = make([]network.HostLocation, 0)
+		for rows.Next() {
+			var v network.HostLocation
+			var mac string
+			if err := rows.Scan(&mac, &v.IP, &v.DPID, &v.Port); err != nil {
+				return err
+			}
+			addr, err := decodeMAC(mac)
+			if err != nil {
+				return err
+			}
+			v.MAC = addr.String()
+			result = append(result, v)
+		}
+
+		return rows.Err()
+	}
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 func (r *MySQL) TogglePortVIP(swDPID uint64, portNum uint16) (result []virtualip.Address, err error) {
 	f := func(tx *sql.Tx) error {
 		portID, err := portID(tx, swDPID, portNum)
@@ -560,6 +601,7 @@ func (r *MySQL) GetUndiscoveredHosts(expiration time.Duration) (result []net.IPN
 // addresses are matched with mac and ip, to the port identified by swDPID and
 // portNum. updated will be true if its location has been actually updated.
 func (r *MySQL) UpdateHostLocation(mac net.HardwareAddr, ip net.IP, swDPID uint64, portNum uint16) (updated bool, err error) {
+	var version uint64
 	f := func(tx *sql.Tx) error {
 		hostID, ok, err := getHostID(tx, mac, ip)
 		if err != nil {
@@ -580,12 +622,19 @@ func (r *MySQL) UpdateHostLocation(mac net.HardwareAddr, ip net.IP, swDPID uint6
 		if err != nil {
 			return err
 		}
+		if !updated {
+			return nil
+		}
+		version, err = increaseHostLocationVersion(tx)
 
-		return nil
+		return err
 	}
 	if err = r.query(f); err != nil {
 		return false, err
 	}
+	if updated && r.locationListener != nil {
+		r.locationListener.HostLocationUpdated(mac, strconv.FormatUint(swDPID, 10), uint32(portNum), version)
+	}
 
 	return updated, nil
 }
@@ -640,6 +689,7 @@ func updateLocation(tx *sql.Tx, hostID, portID uint64) (updated bool, err error)
 // ResetHostLocationsByPort sets NULL to the host locations that belong to the
 // port specified by swDPID and portNum.
 func (r *MySQL) ResetHostLocationsByPort(swDPID uint64, portNum uint16) error {
+	var version uint64
 	f := func(tx *sql.Tx) error {
 		portID, err := portID(tx, swDPID, portNum)
 		if err != nil {
@@ -650,16 +700,22 @@ func (r *MySQL) ResetHostLocationsByPort(swDPID uint64, portNum uint16) error {
 		if _, err := tx.Exec(qry, portID); err != nil {
 			return err
 		}
+		version, err = increaseHostLocationVersion(tx)
 
-		return nil
+		return err
 	}
+	if err := r.query(f); err != nil {
+		return err
+	}
+	r.invalidateHostLocations(version)
 
-	return r.query(f)
+	return nil
 }
 
 // ResetHostLocationsByDevice sets NULL to the host locations that belong to the
 // device specified by swDPID.
 func (r *MySQL) ResetHostLocationsByDevice(swDPID uint64) error {
+	var version uint64
 	f := func(tx *sql.Tx) error {
 		qry := "UPDATE `host` A "
 		qry += "JOIN `port` B ON A.`port_id` = B.`id` "
@@ -671,66 +727,256 @@ func (r *MySQL) ResetHostLocationsByDevice(swDPID uint64) error {
 		if err != nil {
 			return err
 		}
+		version, err = increaseHostLocationVersion(tx)
+
+		return err
+	}
+	if err := r.query(f); err != nil {
+		return err
+	}
+	r.invalidateHostLocations(version)
+
+	return nil
+}
+
+// SetHostLocationListener sets l that will be notified when the host locations
+// are changed by this database instance.
+func (r *MySQL) SetHostLocationListener(l network.HostLocationListener) {
+	r.locationListener = l
+}
+
+func (r *MySQL) invalidateHostLocations(version uint64) {
+	if r.locationListener == nil {
+		return
+	}
+	r.locationListener.HostLocationsInvalidated(version)
+}
+
+// HostLocationVersion returns the version of the host locations, which is increased
+// whenever the locations are changed by any process sharing this database.
+func (r *MySQL) HostLocationVersion() (version uint64, err error) {
+	f := func(tx *sql.Tx) error {
+		qry := "SELECT `version` FROM `host_location_version` WHERE `id` = 1"
+		if err := tx.QueryRow(qry).Scan(&version); err != nil {
+			// Not yet changed?
+			if err == sql.ErrNoRows {
+				version = 0
+				return nil
+			}
+			return err
+		}
 
 		return nil
 	}
+	if err := r.query(f); err != nil {
+		return 0, err
+	}
 
-	return r.query(f)
+	return version, nil
 }
 
-// Elect selects a new master as uid if there is a no existing master that has
-// been updated within expiration. elected will be true if this uid has been
-// elected as the new master or was already elected.
-func (r *MySQL) Elect(uid string, expiration time.Duration) (elected bool, err error) {
-	qry := "INSERT INTO `master_election` (`id`, `name`, `timestamp`) VALUES (1, ?, NOW()) "
-	qry += "ON DUPLICATE KEY UPDATE "
-	qry += fmt.Sprintf("`name` = IF (`timestamp` < NOW() - INTERVAL %v SECOND, VALUES(`name`), `name`), ", int(expiration.Seconds()))
-	qry += "`timestamp` = IF (`name` = VALUES(`name`), VALUES(`timestamp`), `timestamp`)"
-	if _, err := r.db.Exec(qry, uid); err != nil {
+// IsRegisteredSwitch returns whether the switch whose DPID is dpid is registered in
+// the switch table.
+func (r *MySQL) IsRegisteredSwitch(dpid uint64) (registered bool, err error) {
+	f := func(tx *sql.Tx) error {
+		var count int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM `switch` WHERE `dpid` = ?", dpid).Scan(&count); err != nil {
+			return err
+		}
+		registered = count > 0
+
+		return nil
+	}
+	if err := r.query(f); err != nil {
 		return false, err
 	}
 
-	var count int
-	qry = "SELECT COUNT(*) FROM `master_election` WHERE `id` = 1 AND `name` = ?"
-	if err := r.db.QueryRow(qry, uid).Scan(&count); err != nil {
-		return false, err
+	return registered, nil
+}
+
+// AddPendingSwitch records the unregistered switch that has tried to connect. The
+// existing record of the same switch is updated with the latest connection attempt.
+func (r *MySQL) AddPendingSwitch(sw network.PendingSwitch) error {
+	f := func(tx *sql.Tx) error {
+		qry := "INSERT INTO `pending_switch` (`dpid`, `address`, `quarantined`, `first_seen`, `last_seen`) "
+		qry += "VALUES (?, ?, ?, NOW(), NOW()) "
+		qry += "ON DUPLICATE KEY UPDATE `address` = VALUES(`address`), `quarantined` = VALUES(`quarantined`), `last_seen` = NOW()"
+		_, err := tx.Exec(qry, sw.DPID, sw.Address, sw.Quarantined)
+
+		return err
 	}
 
-	return count > 0, nil
+	return r.query(f)
 }
 
-// MACAddrs returns all the registered MAC addresses.
-func (r *MySQL) MACAddrs() (result []net.HardwareAddr, err error) {
+// UpdateDiscoveredSwitch records the switch whose ports have been learned from the switch
+// itself. The ports of the switch are also synchronized if the switch is registered.
+func (r *MySQL) UpdateDiscoveredSwitch(sw network.DiscoveredSwitch) error {
 	f := func(tx *sql.Tx) error {
-		rows, err := tx.Query("SELECT HEX(`mac`) FROM `host`")
+		qry := "INSERT INTO `discovered_switch` (`dpid`, `description`, `first_seen`, `last_seen`) "
+		qry += "VALUES (?, ?, NOW(), NOW()) "
+		qry += "ON DUPLICATE KEY UPDATE `description` = VALUES(`description`), `last_seen` = NOW()"
+		if _, err := tx.Exec(qry, sw.DPID, sw.Description); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("DELETE FROM `discovered_port` WHERE `dpid` = ?", sw.DPID); err != nil {
+			return err
+		}
+		stmt, err := tx.Prepare("INSERT INTO `discovered_port` (`dpid`, `number`, `name`, `mac`, `speed`) VALUES (?, ?, ?, ?, ?)")
 		if err != nil {
 			return err
 		}
-		defer rows.Close()
+		defer stmt.Close()
 
-		for rows.Next() {
-			var mac string
-			if err := rows.Scan(&mac); err != nil {
+		for _, p := range sw.Ports {
+			if _, err := stmt.Exec(sw.DPID, p.Number, p.Name, p.MAC.String(), p.Speed); err != nil {
 				return err
 			}
+		}
 
-			// Parse the MAC address.
-			v, err := decodeMAC(mac)
-			if err != nil {
-				return err
-			}
+		return syncPorts(tx, sw)
+	}
 
-			result = append(result, v)
+	return r.query(f)
+}
+
+// syncPorts adds the discovered ports of the registered switch that do not exist in the
+// port table, and removes the ones that have disappeared from the switch, e.g., due to
+// replacing its line cards, unless a host is connected to them. first_port is not changed
+// to keep the printed port numbers.
+func syncPorts(tx *sql.Tx, sw network.DiscoveredSwitch) error {
+	// Do not remove all the ports by an empty port list.
+	if len(sw.Ports) == 0 {
+		return nil
+	}
+
+	var swID uint64
+	if err := tx.QueryRow("SELECT `id` FROM `switch` WHERE `dpid` = ? FOR UPDATE", sw.DPID).Scan(&swID); err != nil {
+		// Not yet registered switch.
+		if err == sql.ErrNoRows {
+			return nil
 		}
+		return err
+	}
 
-		return rows.Err()
+	numbers := make([]uint16, len(sw.Ports))
+	for i, p := range sw.Ports {
+		numbers[i] = p.Number
+	}
+	added, err := addPortNumbers(tx, swID, numbers)
+	if err != nil {
+		return err
+	}
+	removed, err := removeUnusedPorts(tx, swID, numbers)
+	if err != nil {
+		return err
+	}
+	// Nothing changed.
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
 	}
 
-	if err = r.query(f); err != nil {
+	// Cover the port numbers from first_port to the last port.
+	qry := "UPDATE `switch` SET `n_ports` = "
+	qry += "(SELECT IFNULL(MAX(`number`) - `switch`.`first_port` + 1, `switch`.`n_ports`) FROM `port` WHERE `switch_id` = ? AND `number` >= `switch`.`first_port`) "
+	qry += "WHERE `id` = ?"
+	if _, err := tx.Exec(qry, swID, swID); err != nil {
+		return err
+	}
+
+	s, err := getSwitch(tx, swID)
+	if err != nil {
+		return err
+	}
+	// Nil user means that the ports have been changed by the controller itself.
+	return addLog(tx, nil, logTypeSwitch, logMethodUpdate, &struct {
+		Switch       *ui.Switch `json:"switch"`
+		AddedPorts   []uint16   `json:"added_ports"`
+		RemovedPorts []uint16   `json:"removed_ports"`
+	}{
+		Switch:       s,
+		AddedPorts:   added,
+		RemovedPorts: removed,
+	})
+}
+
+// removeUnusedPorts removes the ports of the switch whose numbers are not in numbers,
+// unless a host is connected to them, and then returns the numbers of the removed ports.
+func removeUnusedPorts(tx *sql.Tx, swID uint64, numbers []uint16) (removed []uint16, err error) {
+	args := []interface{}{swID}
+	for _, v := range numbers {
+		args = append(args, v)
+	}
+
+	cond := "FROM `port` A "
+	cond += "LEFT JOIN `host` B ON A.`id` = B.`port_id` "
+	cond += "WHERE A.`switch_id` = ? AND B.`id` IS NULL "
+	cond += fmt.Sprintf("AND A.`number` NOT IN (%v)", strings.TrimRight(strings.Repeat("?, ", len(numbers)), ", "))
+
+	rows, err := tx.Query("SELECT A.`number` "+cond+" FOR UPDATE", args...)
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return result, nil
+	for rows.Next() {
+		var number uint16
+		if err := rows.Scan(&number); err != nil {
+			return nil, err
+		}
+		removed = append(removed, number)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	if _, err := tx.Exec("DELETE A "+cond, args...); err != nil {
+		return nil, err
+	}
+
+	return removed, nil
+}
+
+// increaseHostLocationVersion increases the version of the host locations, and then
+// returns the increased version.
+func increaseHostLocationVersion(tx *sql.Tx) (version uint64, err error) {
+	qry := "INSERT INTO `host_location_version` (`id`, `version`) VALUES (1, 1) "
+	qry += "ON DUPLICATE KEY UPDATE `version` = `version` + 1"
+	if _, err := tx.Exec(qry); err != nil {
+		return 0, err
+	}
+	// The row is locked by the update above until the transaction ends.
+	qry = "SELECT `version` FROM `host_location_version` WHERE `id` = 1"
+	if err := tx.QueryRow(qry).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// Elect selects a new master as uid if there is a no existing master that has
+// been updated within expiration. elected will be true if this uid has been
+// elected as the new master or was already elected.
+func (r *MySQL) Elect(uid string, expiration time.Duration) (elected bool, err error) {
+	qry := "INSERT INTO `master_election` (`id`, `name`, `timestamp`) VALUES (1, ?, NOW()) "
+	qry += "ON DUPLICATE KEY UPDATE "
+	qry += fmt.Sprintf("`name` = IF (`timestamp` < NOW() - INTERVAL %v SECOND, VALUES(`name`), `name`), ", int(expiration.Seconds()))
+	qry += "`timestamp` = IF (`name` = VALUES(`name`), VALUES(`timestamp`), `timestamp`)"
+	if _, err := r.db.Exec(qry, uid); err != nil {
+		return false, err
+	}
+
+	var count int
+	qry = "SELECT COUNT(*) FROM `master_election` WHERE `id` = 1 AND `name` = ?"
+	if err := r.db.QueryRow(qry, uid).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
 }
 
 func (r *MySQL) RenewARPTable() error {
@@ -848,6 +1094,114 @@ func (r *MySQL) GetARPTable() (result []announcer.ARPTableEntry, err error) {
 	return result, nil
 }
 
+// ACLRules returns all the ACL rules whose groups have been resolved into the addresses
+// of their hosts.
+func (r *MySQL) ACLRules() (result []acl.Rule, err error) {
+	f := func(tx *sql.Tx) error {
+		qry := "SELECT `id`, `priority`, `action`, INET_NTOA(`src_network`), `src_mask`, `src_group_id`, "
+		qry += "INET_NTOA(`dst_network`), `dst_mask`, `dst_group_id`, `protocol`, `src_port`, `dst_port` "
+		qry += "FROM `acl`"
+		rows, err := tx.Query(qry)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		type endpoint struct {
+			network string
+			mask    uint8
+			groupID sql.NullInt64
+		}
+		var src, dst []endpoint
+		result = []acl.Rule{}
+		for rows.Next() {
+			var v acl.Rule
+			var action string
+			var s, d endpoint
+			if err := rows.Scan(&v.ID, &v.Priority, &action, &s.network, &s.mask, &s.groupID, &d.network, &d.mask, &d.groupID, &v.Protocol, &v.SrcPort, &v.DstPort); err != nil {
+				return err
+			}
+			v.Allow = action == "ALLOW"
+			result = append(result, v)
+			src = append(src, s)
+			dst = append(dst, d)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// Addresses of the hosts in each group.
+		groups := make(map[int64][]*net.IPNet)
+		resolve := func(e endpoint) ([]*net.IPNet, error) {
+			if e.groupID.Valid {
+				if v, ok := groups[e.groupID.Int64]; ok {
+					return v, nil
+				}
+				v, err := getGroupAddresses(tx, uint64(e.groupID.Int64))
+				if err != nil {
+					return nil, err
+				}
+				groups[e.groupID.Int64] = v
+				return v, nil
+			}
+			// Any address?
+			if e.mask == 0 {
+				return nil, nil
+			}
+			ip := net.ParseIP(e.network)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ACL network address: %v", e.network)
+			}
+			return []*net.IPNet{{IP: ip.To4(), Mask: net.CIDRMask(int(e.mask), 32)}}, nil
+		}
+		for i := range result {
+			if result[i].Src, err = resolve(src[i]); err != nil {
+				return err
+			}
+			if result[i].Dst, err = resolve(dst[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err = r.query(f); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// getGroupAddresses returns the addresses of the hosts that belong to the group specified
+// by groupID. It returns an empty slice if the group has no host.
+func getGroupAddresses(tx *sql.Tx, groupID uint64) ([]*net.IPNet, error) {
+	qry := "SELECT INET_NTOA(B.`address`) "
+	qry += "FROM `host` A "
+	qry += "JOIN `ip` B ON A.`ip_id` = B.`id` "
+	qry += "WHERE A.`group_id` = ?"
+	rows, err := tx.Query(qry, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*net.IPNet{}
+	for rows.Next() {
+		var addr string
+		if err := rows.Scan(&addr); err != nil {
+			return nil, err
+		}
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid host IP address: %v", addr)
+		}
+		result = append(result, &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)})
+	}
+
+	return result, rows.Err()
+}
+
 func updateARPTableEntryByHost(tx *sql.Tx, id uint64, invalidate bool) error {
 	var ip, mac string
 	qry := "SELECT INET_NTOA(B.`address`), HEX(A.`mac`) "
@@ -1083,7 +1437,7 @@ func (r *uiTx) RemoveGroup(requesterID, groupID uint64) (group *ui.Group, err er
 
 	if _, err := r.handle.Exec("DELETE FROM `group` WHERE `id` = ?", groupID); err != nil {
 		if isForeignkeyErr(err) {
-			return nil, errors.New("failed to remove a group: it has child hosts that are being used by group")
+			return nil, errors.New("failed to remove a group: it has child hosts or ACL rules that are being used by group")
 		}
 		return nil, err
 	}
@@ -1352,6 +1706,9 @@ func (r *uiTx) AddHost(requesterID, ipID uint64, groupID *uint64, mac net.Hardwa
 	if duplicated {
 		return nil, true, nil
 	}
+	if _, err := increaseHostLocationVersion(r.handle); err != nil {
+		return nil, false, err
+	}
 
 	if err := r.log(requesterID, logTypeHost, logMethodAdd, h.convert()); err != nil {
 		return nil, false, err
@@ -1452,6 +1809,9 @@ func (r *uiTx) UpdateHost(requesterID, hostID uint64, ipID, groupID *uint64, mac
 	if duplicated {
 		return nil, true, nil
 	}
+	if _, err := increaseHostLocationVersion(r.handle); err != nil {
+		return nil, false, err
+	}
 
 	err = r.log(requesterID, logTypeHost, logMethodUpdate, &struct {
 		Old *ui.Host `json:"old"`
@@ -1580,6 +1940,9 @@ func (r *uiTx) RemoveHost(requesterID, hostID uint64) (host *ui.Host, err error)
 	if err := removeHost(r.handle, hostID); err != nil {
 		return nil, err
 	}
+	if _, err := increaseHostLocationVersion(r.handle); err != nil {
+		return nil, err
+	}
 
 	if err := r.log(requesterID, logTypeHost, logMethodRemove, h.convert()); err != nil {
 		return nil, err
@@ -1838,6 +2201,164 @@ func (r *uiTx) AddSwitch(requesterID, dpid uint64, nPorts, firstPort, firstPrint
 	if err := addPorts(r.handle, id, firstPort, nPorts); err != nil {
 		return nil, false, err
 	}
+	// The switch is not pending anymore.
+	if _, err := r.handle.Exec("DELETE FROM `pending_switch` WHERE `dpid` = ?", dpid); err != nil {
+		return nil, false, err
+	}
+
+	sw, err = getSwitch(r.handle, id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := r.log(requesterID, logTypeSwitch, logMethodAdd, sw); err != nil {
+		return nil, false, err
+	}
+
+	return sw, false, nil
+}
+
+func (r *uiTx) PendingSwitches(pagination ui.Pagination) (sw []*ui.PendingSwitch, err error) {
+	qry := "SELECT `dpid`, `address`, `quarantined`, `first_seen`, `last_seen` "
+	qry += "FROM `pending_switch` "
+	qry += "ORDER BY `last_seen` DESC "
+	qry += "LIMIT ?, ?"
+
+	rows, err := r.handle.Query(qry, pagination.Offset, pagination.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sw = []*ui.PendingSwitch{}
+	for rows.Next() {
+		v := new(ui.PendingSwitch)
+		if err := rows.Scan(&v.DPID, &v.Address, &v.Quarantined, &v.FirstSeen, &v.LastSeen); err != nil {
+			return nil, err
+		}
+		sw = append(sw, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sw, nil
+}
+
+func (r *uiTx) ApproveSwitch(requesterID, dpid uint64, nPorts, firstPort, firstPrintedPort uint16, desc string) (sw *ui.Switch, duplicated bool, err error) {
+	var count int
+	if err := r.handle.QueryRow("SELECT COUNT(*) FROM `pending_switch` WHERE `dpid` = ? FOR UPDATE", dpid).Scan(&count); err != nil {
+		return nil, false, err
+	}
+	// Not found pending switch to approve.
+	if count == 0 {
+		return nil, false, nil
+	}
+
+	return r.AddSwitch(requesterID, dpid, nPorts, firstPort, firstPrintedPort, desc)
+}
+
+func (r *uiTx) DiscoveredSwitches(pagination ui.Pagination) (sw []*ui.DiscoveredSwitch, err error) {
+	qry := "SELECT A.`dpid`, A.`description`, A.`first_seen`, A.`last_seen` "
+	qry += "FROM `discovered_switch` A "
+	qry += "LEFT JOIN `switch` B ON A.`dpid` = B.`dpid` "
+	qry += "WHERE B.`id` IS NULL "
+	qry += "ORDER BY A.`last_seen` DESC "
+	qry += "LIMIT ?, ?"
+
+	rows, err := r.handle.Query(qry, pagination.Offset, pagination.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sw = []*ui.DiscoveredSwitch{}
+	for rows.Next() {
+		v := new(ui.DiscoveredSwitch)
+		if err := rows.Scan(&v.DPID, &v.Description, &v.FirstSeen, &v.LastSeen); err != nil {
+			return nil, err
+		}
+		sw = append(sw, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, v := range sw {
+		if v.Ports, err = getDiscoveredPorts(r.handle, v.DPID); err != nil {
+			return nil, err
+		}
+	}
+
+	return sw, nil
+}
+
+func getDiscoveredPorts(tx *sql.Tx, dpid uint64) ([]ui.DiscoveredPort, error) {
+	qry := "SELECT `number`, `name`, `mac`, `speed` "
+	qry += "FROM `discovered_port` "
+	qry += "WHERE `dpid` = ? "
+	qry += "ORDER BY `number` ASC"
+
+	rows, err := tx.Query(qry, dpid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ports := []ui.DiscoveredPort{}
+	for rows.Next() {
+		v := ui.DiscoveredPort{}
+		if err := rows.Scan(&v.Number, &v.Name, &v.MAC, &v.Speed); err != nil {
+			return nil, err
+		}
+		ports = append(ports, v)
+	}
+
+	return ports, rows.Err()
+}
+
+func (r *uiTx) ConfirmSwitch(requesterID, dpid uint64, desc string) (sw *ui.Switch, duplicated bool, err error) {
+	var discovered string
+	if err := r.handle.QueryRow("SELECT `description` FROM `discovered_switch` WHERE `dpid` = ? FOR UPDATE", dpid).Scan(&discovered); err != nil {
+		// Not found discovered switch to confirm.
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	ports, err := getDiscoveredPorts(r.handle, dpid)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(ports) == 0 {
+		return nil, false, fmt.Errorf("no discovered ports on the switch: dpid=%v", dpid)
+	}
+	if len(desc) == 0 {
+		desc = discovered
+	}
+
+	// The ports are sorted by their numbers, and the port numbers are printed as they are.
+	first, last := ports[0].Number, ports[len(ports)-1].Number
+	id, err := addSwitch(r.handle, dpid, last-first+1, first, first, desc)
+	if err != nil {
+		// No error.
+		if isDuplicated(err) {
+			return nil, true, nil
+		}
+
+		return nil, false, err
+	}
+	numbers := make([]uint16, len(ports))
+	for i, p := range ports {
+		numbers[i] = p.Number
+	}
+	if _, err := addPortNumbers(r.handle, id, numbers); err != nil {
+		return nil, false, err
+	}
+	// The switch is not pending anymore.
+	if _, err := r.handle.Exec("DELETE FROM `pending_switch` WHERE `dpid` = ?", dpid); err != nil {
+		return nil, false, err
+	}
 
 	sw, err = getSwitch(r.handle, id)
 	if err != nil {
@@ -1866,19 +2387,41 @@ func addSwitch(tx *sql.Tx, dpid uint64, nPorts, firstPort, firstPrintedPort uint
 }
 
 func addPorts(tx *sql.Tx, swID uint64, firstPort, n_ports uint16) error {
-	stmt, err := tx.Prepare("INSERT INTO port (switch_id, number) VALUES (?, ?)")
+	numbers := make([]uint16, n_ports)
+	for i := uint16(0); i < n_ports; i++ {
+		numbers[i] = firstPort + i
+	}
+	_, err := addPortNumbers(tx, swID, numbers)
+
+	return err
+}
+
+// addPortNumbers adds the ports of the switch whose numbers are in numbers, and then returns
+// the numbers of the added ports. The ports that already exist are skipped.
+func addPortNumbers(tx *sql.Tx, swID uint64, numbers []uint16) (added []uint16, err error) {
+	stmt, err := tx.Prepare("INSERT IGNORE INTO `port` (`switch_id`, `number`) VALUES (?, ?)")
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer stmt.Close()
 
-	for i := uint16(0); i < n_ports; i++ {
-		if _, err := stmt.Exec(swID, firstPort+i); err != nil {
-			return err
+	for _, v := range numbers {
+		result, err := stmt.Exec(swID, v)
+		if err != nil {
+			return nil, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		// Already exists?
+		if n == 0 {
+			continue
 		}
+		added = append(added, v)
 	}
 
-	return nil
+	return added, nil
 }
 
 func getSwitch(tx *sql.Tx, id uint64) (*ui.Switch, error) {
@@ -2323,14 +2866,15 @@ func (r *uiTx) QueryLog(search *ui.Search, pagination ui.Pagination) (log []*ui.
 }
 
 func buildLogsQuery(search *ui.Search, pagination ui.Pagination) (qry string, args []interface{}) {
-	qry = "SELECT `log`.`id`, "       // ID
-	qry += "      `user`.`name`, "    // User
-	qry += "      `log`.`type`, "     // Type
-	qry += "      `log`.`method`, "   // Method
-	qry += "      `log`.`data`, "     // Data
-	qry += "      `log`.`timestamp` " // Timestamp
+	qry = "SELECT `log`.`id`, "                            // ID
+	qry += "      IFNULL(`user`.`name`, '(controller)'), " // User
+	qry += "      `log`.`type`, "                          // Type
+	qry += "      `log`.`method`, "                        // Method
+	qry += "      `log`.`data`, "                          // Data
+	qry += "      `log`.`timestamp` "                      // Timestamp
 	qry += "FROM `log` "
-	qry += "JOIN `user` ON `log`.`user_id` = `user`.`id` "
+	// The logs of the changes made by the controller itself do not have their users.
+	qry += "LEFT JOIN `user` ON `log`.`user_id` = `user`.`id` "
 
 	if search != nil {
 		switch search.Key {
@@ -2366,10 +2910,11 @@ const (
 	logTypeVIP
 	logTypeCategory
 	logTypeComponent
+	logTypeACL
 )
 
 func (r logType) validate() error {
-	if r <= logTypeInvalid || r > logTypeComponent {
+	if r <= logTypeInvalid || r > logTypeACL {
 		return fmt.Errorf("invalid log type: %v", r)
 	}
 
@@ -2394,6 +2939,12 @@ func (r logMethod) validate() error {
 }
 
 func (r *uiTx) log(userID uint64, t logType, m logMethod, data interface{}) error {
+	return addLog(r.handle, &userID, t, m, data)
+}
+
+// addLog records an audit log. Nil userID means that the change has been made by the
+// controller itself, not by a user.
+func addLog(tx *sql.Tx, userID *uint64, t logType, m logMethod, data interface{}) error {
 	if err := t.validate(); err != nil {
 		return err
 	}
@@ -2405,8 +2956,12 @@ func (r *uiTx) log(userID uint64, t logType, m logMethod, data interface{}) erro
 	if err != nil {
 		return err
 	}
+	var user interface{}
+	if userID != nil {
+		user = *userID
+	}
 	qry := "INSERT INTO `log` (`user_id`, `type`, `method`, `data`, `timestamp`) VALUES (?, ?, ?, ?, NOW())"
-	_, err = r.handle.Exec(qry, userID, t, m, b)
+	_, err = tx.Exec(qry, user, t, m, b)
 	return err
 }
 
@@ -2696,3 +3251,202 @@ func addSpec(tx *sql.Tx, hostID, componentID uint64, count uint16) error {
 	_, err := tx.Exec(qry, hostID, componentID, count)
 	return err
 }
+
+const aclColumns = "A.`id`, A.`priority`, A.`action`, INET_NTOA(A.`src_network`), A.`src_mask`, IFNULL(A.`src_group_id`, 0), IFNULL(B.`name`, ''), " +
+	"INET_NTOA(A.`dst_network`), A.`dst_mask`, IFNULL(A.`dst_group_id`, 0), IFNULL(C.`name`, ''), " +
+	"A.`protocol`, A.`src_port`, A.`dst_port`, A.`description`, A.`timestamp` " +
+	"FROM `acl` A " +
+	"LEFT JOIN `group` B ON A.`src_group_id` = B.`id` " +
+	"LEFT JOIN `group` C ON A.`dst_group_id` = C.`id` "
+
+func (r *uiTx) ACLs(pagination ui.Pagination) (acl []*ui.ACL, err error) {
+	qry := "SELECT " + aclColumns
+	qry += "ORDER BY A.`priority` DESC, A.`action` DESC, A.`id` ASC "
+	if pagination.Limit > 0 {
+		qry += fmt.Sprintf("LIMIT %v, %v", pagination.Offset, pagination.Limit)
+	}
+
+	rows, err := r.handle.Query(qry)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	acl = []*ui.ACL{}
+	for rows.Next() {
+		v, err := scanACL(rows)
+		if err != nil {
+			return nil, err
+		}
+		acl = append(acl, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return acl, nil
+}
+
+func scanACL(row interface {
+	Scan(dest ...interface{}) error
+}) (*ui.ACL, error) {
+	v := new(ui.ACL)
+	var action, srcNetwork, dstNetwork string
+	var srcMask, dstMask uint8
+	if err := row.Scan(&v.ID, &v.Priority, &action, &srcNetwork, &srcMask, &v.SrcGroupID, &v.SrcGroup,
+		&dstNetwork, &dstMask, &v.DstGroupID, &v.DstGroup, &v.Protocol, &v.SrcPort, &v.DstPort, &v.Description, &v.Timestamp); err != nil {
+		return nil, err
+	}
+	v.Action = ui.ACLAction(action)
+	// Zero mask means any address.
+	if srcMask > 0 {
+		v.SrcNetwork = &net.IPNet{IP: net.ParseIP(srcNetwork).To4(), Mask: net.CIDRMask(int(srcMask), 32)}
+	}
+	if dstMask > 0 {
+		v.DstNetwork = &net.IPNet{IP: net.ParseIP(dstNetwork).To4(), Mask: net.CIDRMask(int(dstMask), 32)}
+	}
+
+	return v, nil
+}
+
+func getACL(tx *sql.Tx, id uint64) (*ui.ACL, error) {
+	qry := "SELECT " + aclColumns
+	qry += "WHERE A.`id` = ?"
+
+	return scanACL(tx.QueryRow(qry, id))
+}
+
+// aclArgs returns the column values of rule in the order of `priority`, `action`, `src_network`,
+// `src_mask`, `src_group_id`, `dst_network`, `dst_mask`, `dst_group_id`, `protocol`, `src_port`,
+// `dst_port`, and `description`.
+func aclArgs(rule ui.ACLRule) []interface{} {
+	network := func(n *net.IPNet) (addr string, mask int) {
+		if n == nil {
+			return "0.0.0.0", 0
+		}
+		mask, _ = n.Mask.Size()
+		return n.IP.String(), mask
+	}
+	group := func(id uint64) interface{} {
+		if id == 0 {
+			return nil
+		}
+		return id
+	}
+	srcAddr, srcMask := network(rule.SrcNetwork)
+	dstAddr, dstMask := network(rule.DstNetwork)
+
+	return []interface{}{
+		rule.Priority, string(rule.Action),
+		srcAddr, srcMask, group(rule.SrcGroupID),
+		dstAddr, dstMask, group(rule.DstGroupID),
+		rule.Protocol, rule.SrcPort, rule.DstPort, rule.Description,
+	}
+}
+
+// validACLGroups returns whether all the groups of rule exist.
+func validACLGroups(tx *sql.Tx, rule ui.ACLRule) (bool, error) {
+	for _, id := range []uint64{rule.SrcGroupID, rule.DstGroupID} {
+		if id == 0 {
+			continue
+		}
+		if _, err := getGroup(tx, id); err != nil {
+			if err == sql.ErrNoRows {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (r *uiTx) AddACL(requesterID uint64, rule ui.ACLRule) (acl *ui.ACL, invalidGroup bool, err error) {
+	ok, err := validACLGroups(r.handle, rule)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		return nil, true, nil
+	}
+
+	qry := "INSERT INTO `acl` (`priority`, `action`, `src_network`, `src_mask`, `src_group_id`, "
+	qry += "`dst_network`, `dst_mask`, `dst_group_id`, `protocol`, `src_port`, `dst_port`, `description`, `timestamp`) "
+	qry += "VALUES (?, ?, INET_ATON(?), ?, ?, INET_ATON(?), ?, ?, ?, ?, ?, ?, NOW())"
+	result, err := r.handle.Exec(qry, aclArgs(rule)...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, false, err
+	}
+	acl, err = getACL(r.handle, uint64(id))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := r.log(requesterID, logTypeACL, logMethodAdd, acl); err != nil {
+		return nil, false, err
+	}
+
+	return acl, false, nil
+}
+
+func (r *uiTx) UpdateACL(requesterID, aclID uint64, rule ui.ACLRule) (acl *ui.ACL, invalidGroup bool, err error) {
+	if _, err := getACL(r.handle, aclID); err != nil {
+		// Not found ACL rule to update.
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	ok, err := validACLGroups(r.handle, rule)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		return nil, true, nil
+	}
+
+	qry := "UPDATE `acl` SET `priority` = ?, `action` = ?, `src_network` = INET_ATON(?), `src_mask` = ?, `src_group_id` = ?, "
+	qry += "`dst_network` = INET_ATON(?), `dst_mask` = ?, `dst_group_id` = ?, `protocol` = ?, `src_port` = ?, `dst_port` = ?, "
+	qry += "`description` = ?, `timestamp` = NOW() "
+	qry += "WHERE `id` = ?"
+	if _, err := r.handle.Exec(qry, append(aclArgs(rule), aclID)...); err != nil {
+		return nil, false, err
+	}
+
+	acl, err = getACL(r.handle, aclID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := r.log(requesterID, logTypeACL, logMethodUpdate, acl); err != nil {
+		return nil, false, err
+	}
+
+	return acl, false, nil
+}
+
+func (r *uiTx) RemoveACL(requesterID, aclID uint64) (acl *ui.ACL, err error) {
+	acl, err = getACL(r.handle, aclID)
+	if err != nil {
+		// Not found ACL rule to remove.
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if _, err := r.handle.Exec("DELETE FROM `acl` WHERE `id` = ?", aclID); err != nil {
+		return nil, err
+	}
+
+	if err := r.log(requesterID, logTypeACL, logMethodRemove, acl); err != nil {
+		return nil, err
+	}
+
+	return acl, nil
+}
@@ -0,0 +1,47 @@
+--
+-- Migration statements for the existing databases that have been created by an older
+-- mysql_schema.sql. CREATE TABLE IF NOT EXISTS in mysql_schema.sql does not change the
+-- existing tables, so apply the statements below in order after loading mysql_schema.sql.
+--
+
+--
+-- The logs of the changes made by the controller itself, e.g., synchronizing the ports
+-- of a switch, do not have their users.
+--
+
+ALTER TABLE `log` MODIFY `user_id` bigint(20) unsigned DEFAULT NULL;
+
+--
+-- The ACL rules have sources, destinations and actions, and their changes are logged.
+--
+
+ALTER TABLE `log` MODIFY `type` ENUM('USER', 'GROUP', 'SWITCH', 'NETWORK', 'HOST', 'VIP', 'CATEGORY', 'COMPONENT', 'ACL') NOT NULL;
+
+-- Apply the statements below only if the `acl` table has the legacy `network` and `mask`
+-- columns. The legacy table, which has not been used by the controller, is kept as
+-- `acl_legacy` to convert its rows into the new rules by hand.
+RENAME TABLE `acl` TO `acl_legacy`;
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `acl` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `priority` smallint(5) unsigned NOT NULL,
+  `action` ENUM('ALLOW', 'DENY') NOT NULL,
+  `src_network` int(10) unsigned NOT NULL DEFAULT '0',
+  `src_mask` tinyint(3) unsigned NOT NULL DEFAULT '0',
+  `src_group_id` bigint(20) unsigned default NULL,
+  `dst_network` int(10) unsigned NOT NULL DEFAULT '0',
+  `dst_mask` tinyint(3) unsigned NOT NULL DEFAULT '0',
+  `dst_group_id` bigint(20) unsigned default NULL,
+  `protocol` tinyint(3) unsigned NOT NULL DEFAULT '0',
+  `src_port` smallint(5) unsigned NOT NULL DEFAULT '0',
+  `dst_port` smallint(5) unsigned NOT NULL DEFAULT '0',
+  `description` varchar(255) NOT NULL,
+  `timestamp` TIMESTAMP NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `priority` (`priority`),
+  CONSTRAINT `acl_ibfk_1` FOREIGN KEY (`src_group_id`) REFERENCES `group` (`id`) ON DELETE RESTRICT ON UPDATE CASCADE,
+  CONSTRAINT `acl_ibfk_2` FOREIGN KEY (`dst_group_id`) REFERENCES `group` (`id`) ON DELETE RESTRICT ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
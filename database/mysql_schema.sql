@@ -56,8 +56,8 @@ CREATE TABLE IF NOT EXISTS `group` (
 /*!40101 SET character_set_client = utf8 */;
 CREATE TABLE IF NOT EXISTS `log` (
   `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
-  `user_id` bigint(20) unsigned NOT NULL,
-  `type` ENUM('USER', 'GROUP', 'SWITCH', 'NETWORK', 'HOST', 'VIP', 'CATEGORY', 'COMPONENT') NOT NULL,
+  `user_id` bigint(20) unsigned DEFAULT NULL,
+  `type` ENUM('USER', 'GROUP', 'SWITCH', 'NETWORK', 'HOST', 'VIP', 'CATEGORY', 'COMPONENT', 'ACL') NOT NULL,
   `method` ENUM('ADD', 'UPDATE', 'REMOVE') NOT NULL,
   `data` LONGTEXT NOT NULL,
   `timestamp` TIMESTAMP NOT NULL,
@@ -155,10 +155,23 @@ CREATE TABLE IF NOT EXISTS `master_election` (
 /*!40101 SET character_set_client = utf8 */;
 CREATE TABLE IF NOT EXISTS `acl` (
   `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
-  `network` int(10) unsigned NOT NULL,
-  `mask` int(10) unsigned NOT NULL,
+  `priority` smallint(5) unsigned NOT NULL,
+  `action` ENUM('ALLOW', 'DENY') NOT NULL,
+  `src_network` int(10) unsigned NOT NULL DEFAULT '0',
+  `src_mask` tinyint(3) unsigned NOT NULL DEFAULT '0',
+  `src_group_id` bigint(20) unsigned default NULL,
+  `dst_network` int(10) unsigned NOT NULL DEFAULT '0',
+  `dst_mask` tinyint(3) unsigned NOT NULL DEFAULT '0',
+  `dst_group_id` bigint(20) unsigned default NULL,
+  `protocol` tinyint(3) unsigned NOT NULL DEFAULT '0',
+  `src_port` smallint(5) unsigned NOT NULL DEFAULT '0',
+  `dst_port` smallint(5) unsigned NOT NULL DEFAULT '0',
+  `description` varchar(255) NOT NULL,
+  `timestamp` TIMESTAMP NOT NULL,
   PRIMARY KEY (`id`),
-  UNIQUE KEY `acl` (`network`,`mask`)
+  KEY `priority` (`priority`),
+  CONSTRAINT `acl_ibfk_1` FOREIGN KEY (`src_group_id`) REFERENCES `group` (`id`) ON DELETE RESTRICT ON UPDATE CASCADE,
+  CONSTRAINT `acl_ibfk_2` FOREIGN KEY (`dst_group_id`) REFERENCES `group` (`id`) ON DELETE RESTRICT ON UPDATE CASCADE
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
@@ -309,6 +322,67 @@ DELIMITER ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
 
+--
+-- Table structure for table `pending_switch`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE IF NOT EXISTS `pending_switch` (
+  `dpid` bigint(20) unsigned NOT NULL,
+  `address` varchar(64) NOT NULL,
+  `quarantined` tinyint(1) NOT NULL DEFAULT '0',
+  `first_seen` datetime NOT NULL,
+  `last_seen` datetime NOT NULL,
+  PRIMARY KEY (`dpid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `discovered_switch`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE IF NOT EXISTS `discovered_switch` (
+  `dpid` bigint(20) unsigned NOT NULL,
+  `description` varchar(255) NOT NULL,
+  `first_seen` datetime NOT NULL,
+  `last_seen` datetime NOT NULL,
+  PRIMARY KEY (`dpid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `discovered_port`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE IF NOT EXISTS `discovered_port` (
+  `dpid` bigint(20) unsigned NOT NULL,
+  `number` smallint(5) unsigned NOT NULL,
+  `name` varchar(64) NOT NULL,
+  `mac` char(17) NOT NULL,
+  `speed` bigint(20) unsigned NOT NULL,
+  PRIMARY KEY (`dpid`,`number`),
+  CONSTRAINT `discovered_port_ibfk_1` FOREIGN KEY (`dpid`) REFERENCES `discovered_switch` (`dpid`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `host_location_version`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE IF NOT EXISTS `host_location_version` (
+  `id` tinyint(3) unsigned NOT NULL,
+  `version` bigint(20) unsigned NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `vip`
 --
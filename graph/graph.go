@@ -55,6 +55,35 @@ type Edge interface {
 	Weight() float64
 }
 
+// BroadcastEdge is an edge through a broadcast domain, e.g., a legacy non-OpenFlow switch, among two
+// points. A point can have multiple broadcast edges as the broadcast domain may connect more than two
+// points, but a normal edge (i.e., a direct link) takes precedence over the broadcast edges on its points.
+type BroadcastEdge interface {
+	Edge
+	BroadcastDomain() bool
+}
+
+func isBroadcastEdge(e Edge) bool {
+	v, ok := e.(BroadcastEdge)
+	return ok && v.BroadcastDomain()
+}
+
+// TreeEdge is an edge that has a separate weight for the minimum spanning tree. Any
+// change of the spanning tree disrupts the traffic, so that the tree weight should only
+// consist of the stable factors of the edge unlike the weight used for the shortest paths.
+type TreeEdge interface {
+	Edge
+	TreeWeight() float64
+}
+
+func treeWeight(e Edge) float64 {
+	if v, ok := e.(TreeEdge); ok {
+		return v.TreeWeight()
+	}
+
+	return e.Weight()
+}
+
 type edge struct {
 	value     Edge
 	enabled   bool
@@ -70,14 +99,18 @@ type Graph struct {
 	mutex     sync.RWMutex
 	vertexies map[string]vertex
 	edges     map[string]*edge
-	points    map[string]*edge
+	// Key is the point ID, and the value is a map whose key is the edge ID.
+	points map[string]map[string]*edge
+	// Cached shortest-path trees whose key is the destination vertex ID.
+	trees *treeCache
 }
 
 func New() *Graph {
 	return &Graph{
 		vertexies: make(map[string]vertex),
 		edges:     make(map[string]*edge),
-		points:    make(map[string]*edge),
+		points:    make(map[string]map[string]*edge),
+		trees:     newTreeCache(),
 	}
 }
 
@@ -89,7 +122,7 @@ func (r *Graph) String() string {
 	var buf bytes.Buffer
 	for _, v := range r.edges {
 		e := v.value
-		buf.WriteString(fmt.Sprintf("Edge ID=%v, Enabled=%v, Timestamp=%v\n", e.ID(), v.enabled, v.timestamp))
+		buf.WriteString(fmt.Sprintf("Edge ID=%v, Enabled=%v, Broadcast=%v, Timestamp=%v\n", e.ID(), v.enabled, isBroadcastEdge(e), v.timestamp))
 	}
 
 	return buf.String()
@@ -126,8 +159,57 @@ func (r *Graph) removeEdge(e Edge) {
 		delete(v2.edges, e.ID())
 	}
 	delete(r.edges, e.ID())
-	delete(r.points, v[0].ID())
-	delete(r.points, v[1].ID())
+	r.removePoint(v[0], e)
+	r.removePoint(v[1], e)
+}
+
+func (r *Graph) addPoint(p Point, e *edge) {
+	edges, ok := r.points[p.ID()]
+	if !ok {
+		edges = make(map[string]*edge)
+		r.points[p.ID()] = edges
+	}
+	edges[e.value.ID()] = e
+}
+
+func (r *Graph) removePoint(p Point, e Edge) {
+	edges, ok := r.points[p.ID()]
+	if !ok {
+		return
+	}
+	delete(edges, e.ID())
+	if len(edges) == 0 {
+		delete(r.points, p.ID())
+	}
+}
+
+// hasDirectEdge returns whether p has a normal edge that is not a broadcast edge.
+func (r *Graph) hasDirectEdge(p Point) bool {
+	for _, v := range r.points[p.ID()] {
+		if !isBroadcastEdge(v.value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeEdgesOf removes all the edges on p.
+func (r *Graph) removeEdgesOf(p Point) {
+	for _, v := range r.points[p.ID()] {
+		r.removeEdge(v.value)
+		logger.Debugf("removed an edge: id=%v", v.value.ID())
+	}
+}
+
+func (r *Graph) removeBroadcastEdgesOf(p Point) {
+	for _, v := range r.points[p.ID()] {
+		if !isBroadcastEdge(v.value) {
+			continue
+		}
+		r.removeEdge(v.value)
+		logger.Debugf("removed a broadcast edge: id=%v", v.value.ID())
+	}
 }
 
 func (r *Graph) RemoveVertex(v Vertex) {
@@ -156,12 +238,14 @@ func (r *Graph) AddEdge(e Edge) (added bool, err error) {
 	if e == nil {
 		panic("adding nil edge")
 	}
-	// Check duplication
+	// Check duplication. Note that a direct edge can replace the broadcast edge that has same ID.
 	elem, ok := r.edges[e.ID()]
-	if ok {
+	if ok && (isBroadcastEdge(e) || !isBroadcastEdge(elem.value)) {
 		// Update the timestamp if we already have same one.
-		elem.timestamp = time.Now()
-		logger.Debugf("updated the edge timestamp: id=%v", e.ID())
+		if isBroadcastEdge(e) == isBroadcastEdge(elem.value) {
+			elem.timestamp = time.Now()
+			logger.Debugf("updated the edge timestamp: id=%v", e.ID())
+		}
 		return false, nil
 	}
 
@@ -175,12 +259,24 @@ func (r *Graph) AddEdge(e Edge) (added bool, err error) {
 		return false, errors.New("AddEdge: adding an edge to unknown vertex")
 	}
 
+	if isBroadcastEdge(e) {
+		// A direct link takes precedence over the broadcast domain.
+		if r.hasDirectEdge(points[0]) || r.hasDirectEdge(points[1]) {
+			logger.Debugf("ignoring a broadcast edge on the point that has a direct edge: id=%v", e.ID())
+			return false, nil
+		}
+	} else {
+		// A direct link replaces the broadcast edges on its points.
+		r.removeBroadcastEdgesOf(points[0])
+		r.removeBroadcastEdgesOf(points[1])
+	}
+
 	edge := &edge{value: e, timestamp: time.Now()}
 	r.edges[e.ID()] = edge
 	first.edges[e.ID()] = edge
 	second.edges[e.ID()] = edge
-	r.points[points[0].ID()] = edge
-	r.points[points[1].ID()] = edge
+	r.addPoint(points[0], edge)
+	r.addPoint(points[1], edge)
 	r.calculateMST()
 	logger.Debugf("added a new edge: id=%v", e.ID())
 
@@ -191,13 +287,43 @@ func (r *Graph) RemoveEdge(p Point) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	e, ok := r.points[p.ID()]
-	if !ok {
+	if _, ok := r.points[p.ID()]; !ok {
 		return
 	}
-	r.removeEdge(e.value)
+	r.removeEdgesOf(p)
+	r.calculateMST()
+}
+
+// Edge returns the edge whose ID is id. It returns nil if there is no such an edge.
+func (r *Graph) Edge(id string) Edge {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	e, ok := r.edges[id]
+	if !ok {
+		return nil
+	}
+
+	return e.value
+}
+
+// UpdateWeights recalculates the minimum spanning tree. It should be called when the weights of edges are changed.
+func (r *Graph) UpdateWeights() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
 	r.calculateMST()
-	logger.Debugf("removed an edge: id=%v", e.value.ID())
+}
+
+// UpdatePathWeights invalidates the shortest paths without recalculating the minimum
+// spanning tree. It should be called instead of UpdateWeights when only the weights of
+// edges that do not affect their tree weights are changed.
+func (r *Graph) UpdatePathWeights() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.trees.reset()
 }
 
 // IsEdge returns whether p is on an edge between two vertexeis.
@@ -224,12 +350,36 @@ func (r *Graph) IsEnabledPoint(p Point) bool {
 		panic("nil point")
 	}
 
-	v, ok := r.points[p.ID()]
-	if !ok {
-		return false
+	// A point on the broadcast edges is enabled if any of them belongs to MST.
+	for _, v := range r.points[p.ID()] {
+		if v.enabled {
+			return true
+		}
 	}
 
-	return v.enabled
+	return false
+}
+
+// EdgeStatus is an edge with its state in the minimum spanning tree.
+type EdgeStatus struct {
+	Edge      Edge
+	Enabled   bool
+	Broadcast bool
+}
+
+// Edges returns all the edges of this graph sorted by their IDs.
+func (r *Graph) Edges() []EdgeStatus {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make([]EdgeStatus, 0, len(r.edges))
+	for _, v := range r.edges {
+		result = append(result, EdgeStatus{Edge: v.value, Enabled: v.enabled, Broadcast: isBroadcastEdge(v.value)})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Edge.ID() < result[j].Edge.ID() })
+
+	return result
 }
 
 type sortedEdge []*edge
@@ -239,11 +389,13 @@ func (r sortedEdge) Len() int {
 }
 
 func (r sortedEdge) Less(i, j int) bool {
-	if r[i].value.Weight() < r[j].value.Weight() {
-		return true
+	w1, w2 := treeWeight(r[i].value), treeWeight(r[j].value)
+	if w1 != w2 {
+		return w1 < w2
 	}
 
-	return false
+	// Tie-breaker to pick the same spanning tree for the same tree weights.
+	return r[i].value.ID() < r[j].value.ID()
 }
 
 func (r sortedEdge) Swap(i, j int) {
@@ -316,6 +468,9 @@ func mergeCluster(clusters map[string]*list.List, l1, l2 *list.List) {
 // calculateMST finds a minimum spanning tree of this graph using Kruskal's algorithm.
 // A caller should lock the mutex before calling this function.
 func (r *Graph) calculateMST() {
+	// The shortest-path trees are also outdated whenever the MST should be recalculated.
+	r.trees.reset()
+
 	if len(r.edges) == 0 || len(r.vertexies) == 0 {
 		return
 	}
@@ -64,6 +64,14 @@ func (r link) Weight() float64 {
 	return r.weight
 }
 
+type broadcastLink struct {
+	link
+}
+
+func (r broadcastLink) BroadcastDomain() bool {
+	return true
+}
+
 func printEnabledEdges(g *Graph) (int, float64) {
 	count := 0
 	weight := 0.0
@@ -558,3 +566,220 @@ func TestMST4(t *testing.T) {
 		}
 	}
 }
+
+func TestEqualCostPaths(t *testing.T) {
+	graph := New()
+	graph.AddVertex(node{"1"})
+	graph.AddVertex(node{"2"})
+	graph.AddVertex(node{"3"})
+	graph.AddVertex(node{"4"})
+
+	// Two equal-cost paths (1-2-4 and 1-3-4) and a longer path (1-4 via a heavy link).
+	graph.AddEdge(link{points: [2]point{point{"1", 1}, point{"2", 1}}})
+	graph.AddEdge(link{points: [2]point{point{"1", 2}, point{"3", 1}}})
+	graph.AddEdge(link{points: [2]point{point{"2", 2}, point{"4", 1}}})
+	graph.AddEdge(link{points: [2]point{point{"3", 2}, point{"4", 2}}})
+	graph.AddEdge(link{points: [2]point{point{"1", 3}, point{"4", 3}}, weight: 5})
+
+	paths := graph.FindEqualCostPaths(node{"1"}, node{"4"})
+	if len(paths) != 2 {
+		t.Fatalf("Expected number of equal-cost paths is 2, but got %v", len(paths))
+	}
+	for _, p := range paths {
+		if len(p) != 2 {
+			t.Fatalf("Expected path length is 2, but got %v", len(p))
+		}
+		if p[0].V.ID() != "1" {
+			t.Fatalf("Expected first vertex is 1, but got %v", p[0].V.ID())
+		}
+	}
+	if paths[0][0].E.ID() == paths[1][0].E.ID() {
+		t.Fatalf("Expected different first hops, but got same edge %v", paths[0][0].E.ID())
+	}
+
+	// Removing an edge leaves only one shortest path.
+	graph.RemoveEdge(point{"2", 2})
+	paths = graph.FindEqualCostPaths(node{"1"}, node{"4"})
+	if len(paths) != 1 {
+		t.Fatalf("Expected number of equal-cost paths is 1, but got %v", len(paths))
+	}
+
+	if len(graph.FindEqualCostPaths(node{"1"}, node{"1"})) != 0 {
+		t.Fatal("Expected no path to itself")
+	}
+}
+
+func TestShortestPathTree(t *testing.T) {
+	graph := New()
+	graph.AddVertex(node{"1"})
+	graph.AddVertex(node{"2"})
+	graph.AddVertex(node{"3"})
+	graph.AddVertex(node{"4"})
+
+	// A ring whose one link is disabled by the spanning tree.
+	graph.AddEdge(link{points: [2]point{point{"1", 1}, point{"2", 1}}})
+	graph.AddEdge(link{points: [2]point{point{"2", 2}, point{"3", 1}}})
+	graph.AddEdge(link{points: [2]point{point{"3", 2}, point{"4", 1}}})
+	graph.AddEdge(link{points: [2]point{point{"4", 2}, point{"1", 2}}})
+
+	// Every link is used to reach the neighbors regardless of the spanning tree.
+	neighbors := [][2]string{{"1", "2"}, {"2", "3"}, {"3", "4"}, {"4", "1"}}
+	for _, v := range neighbors {
+		for _, p := range [][2]string{v, {v[1], v[0]}} {
+			path := graph.FindTreePath(node{p[0]}, node{p[1]})
+			if len(path) != 1 {
+				t.Fatalf("Expected path length from %v to %v is 1, but got %v", p[0], p[1], len(path))
+			}
+		}
+	}
+
+	// The paths toward the same destination should make a tree.
+	path1 := graph.FindTreePath(node{"1"}, node{"3"})
+	if len(path1) != 2 {
+		t.Fatalf("Expected path length is 2, but got %v", len(path1))
+	}
+	path2 := graph.FindTreePath(path1[1].V, node{"3"})
+	if len(path2) != 1 || path2[0].E.ID() != path1[1].E.ID() {
+		t.Fatalf("Expected the same next hop of %v, but got %v", path1[1].V.ID(), path2)
+	}
+
+	// The tree should be recalculated after removing an edge.
+	graph.RemoveEdge(point{"1", 1})
+	path := graph.FindTreePath(node{"1"}, node{"2"})
+	if len(path) != 3 {
+		t.Fatalf("Expected path length is 3, but got %v", len(path))
+	}
+
+	if len(graph.FindTreePath(node{"1"}, node{"1"})) != 0 {
+		t.Fatal("Expected no path to itself")
+	}
+	graph.AddVertex(node{"5"})
+	if len(graph.FindTreePath(node{"5"}, node{"1"})) != 0 {
+		t.Fatal("Expected no path to the unreachable vertex")
+	}
+}
+
+func TestKShortestPaths(t *testing.T) {
+	graph := New()
+	graph.AddVertex(node{"1"})
+	graph.AddVertex(node{"2"})
+	graph.AddVertex(node{"3"})
+	graph.AddVertex(node{"4"})
+
+	// Two equal-cost paths (1-2-4 and 1-3-4), a longer path (1-4 via a heavy link), and
+	// the longest path (1-2-3-4) through the link between 2 and 3.
+	graph.AddEdge(link{points: [2]point{point{"1", 1}, point{"2", 1}}})
+	graph.AddEdge(link{points: [2]point{point{"1", 2}, point{"3", 1}}})
+	graph.AddEdge(link{points: [2]point{point{"2", 2}, point{"4", 1}}})
+	graph.AddEdge(link{points: [2]point{point{"3", 2}, point{"4", 2}}})
+	graph.AddEdge(link{points: [2]point{point{"1", 3}, point{"4", 3}}, weight: 5})
+	graph.AddEdge(link{points: [2]point{point{"2", 3}, point{"3", 3}}, weight: 1})
+
+	src := []struct {
+		k     int
+		c     Constraint
+		costs []float64
+	}{
+		{k: 10, costs: []float64{2, 2, 4, 4, 6}},
+		{k: 2, costs: []float64{2, 2}},
+		{k: 10, c: Constraint{ExcludeVertexies: map[string]bool{"2": true}}, costs: []float64{2, 6}},
+		{k: 10, c: Constraint{ExcludeEdges: map[string]bool{"1:3/4:3": true}}, costs: []float64{2, 2, 4, 4}},
+		{k: 10, c: Constraint{MaxHops: 2}, costs: []float64{2, 2, 6}},
+		{k: 10, c: Constraint{Filter: func(e Edge) bool { return e.Weight() == 0 }}, costs: []float64{2, 2}},
+		{k: 10, c: Constraint{ExcludeVertexies: map[string]bool{"4": true}}, costs: []float64{}},
+	}
+
+	for i, v := range src {
+		paths := graph.FindKShortestPaths(node{"1"}, node{"4"}, v.k, v.c)
+		if len(paths) != len(v.costs) {
+			t.Fatalf("#%v: expected number of paths is %v, but got %v", i, len(v.costs), len(paths))
+		}
+		for j, p := range paths {
+			if Cost(p) != v.costs[j] {
+				t.Fatalf("#%v: expected cost of path #%v is %v, but got %v", i, j, v.costs[j], Cost(p))
+			}
+			if p[0].V.ID() != "1" {
+				t.Fatalf("#%v: expected first vertex is 1, but got %v", i, p[0].V.ID())
+			}
+			if v.c.MaxHops > 0 && len(p) > v.c.MaxHops {
+				t.Fatalf("#%v: too many hops: %v", i, len(p))
+			}
+		}
+	}
+}
+
+func TestLoopFreeAlternates(t *testing.T) {
+	graph := New()
+	graph.AddVertex(node{"1"})
+	graph.AddVertex(node{"2"})
+	graph.AddVertex(node{"3"})
+	graph.AddVertex(node{"4"})
+
+	// 1-2 is the primary link toward 2. 3 reaches 2 directly, but 4 reaches 2 only through 1.
+	graph.AddEdge(link{points: [2]point{point{"1", 1}, point{"2", 1}}})
+	graph.AddEdge(link{points: [2]point{point{"1", 2}, point{"3", 1}}})
+	graph.AddEdge(link{points: [2]point{point{"3", 2}, point{"2", 2}}})
+	graph.AddEdge(link{points: [2]point{point{"1", 3}, point{"4", 1}}})
+
+	alternates := graph.FindLoopFreeAlternates(node{"1"}, node{"2"}, point{"1", 1})
+	if len(alternates) != 1 {
+		t.Fatalf("Expected number of alternates is 1, but got %v", len(alternates))
+	}
+	if alternates[0].ID() != "1:2/3:1" {
+		t.Fatalf("Expected alternate is 1:2/3:1, but got %v", alternates[0].ID())
+	}
+
+	// No alternate if the only other neighbor goes back through the source.
+	graph.RemoveEdge(point{"3", 2})
+	if len(graph.FindLoopFreeAlternates(node{"1"}, node{"2"}, point{"1", 1})) != 0 {
+		t.Fatal("Expected no alternate")
+	}
+}
+
+func TestBroadcastEdges(t *testing.T) {
+	graph := New()
+	graph.AddVertex(node{"1"})
+	graph.AddVertex(node{"2"})
+	graph.AddVertex(node{"3"})
+
+	// Three switches are connected through a legacy switch.
+	graph.AddEdge(broadcastLink{link{points: [2]point{point{"1", 1}, point{"2", 1}}, weight: 10}})
+	graph.AddEdge(broadcastLink{link{points: [2]point{point{"1", 1}, point{"3", 1}}, weight: 10}})
+	graph.AddEdge(broadcastLink{link{points: [2]point{point{"2", 1}, point{"3", 1}}, weight: 10}})
+	if len(graph.edges) != 3 {
+		t.Fatalf("Expected edge length is 3, got=%v", len(graph.edges))
+	}
+	if c, _ := printEnabledEdges(graph); c != 2 {
+		t.Fatalf("Expected enabled edges is 2, got=%v", c)
+	}
+	for _, p := range []point{point{"1", 1}, point{"2", 1}, point{"3", 1}} {
+		if !graph.IsEnabledPoint(p) {
+			t.Fatalf("Expected enabled point: %v", p.ID())
+		}
+	}
+
+	// A direct link replaces the broadcast edges on its points.
+	if added, err := graph.AddEdge(link{points: [2]point{point{"2", 1}, point{"3", 1}}}); !added || err != nil {
+		t.Fatalf("Expected the direct edge is added: added=%v, err=%v", added, err)
+	}
+	if len(graph.edges) != 1 {
+		t.Fatalf("Expected edge length is 1, got=%v", len(graph.edges))
+	}
+	// The broadcast edge is ignored on the point that has a direct link.
+	if added, _ := graph.AddEdge(broadcastLink{link{points: [2]point{point{"1", 1}, point{"2", 1}}, weight: 10}}); added {
+		t.Fatal("Expected the broadcast edge is ignored")
+	}
+
+	// The redundant broadcast edge is disabled to prevent a loop.
+	graph.AddEdge(link{points: [2]point{point{"1", 2}, point{"2", 2}}})
+	graph.AddEdge(broadcastLink{link{points: [2]point{point{"1", 3}, point{"3", 3}}, weight: 10}})
+	graph.AddEdge(broadcastLink{link{points: [2]point{point{"1", 3}, point{"2", 3}}, weight: 10}})
+	if graph.IsEnabledPoint(point{"2", 3}) && graph.IsEnabledPoint(point{"3", 3}) {
+		t.Fatal("Expected one of the broadcast points is disabled")
+	}
+
+	graph.RemoveEdge(point{"1", 3})
+	if graph.IsEdge(point{"2", 3}) || graph.IsEdge(point{"3", 3}) {
+		t.Fatal("Expected all the broadcast edges on the point are removed")
+	}
+}
@@ -0,0 +1,236 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package graph
+
+import (
+	"bytes"
+	"math"
+	"sort"
+)
+
+const (
+	// Maximum number of the candidate paths examined by FindKShortestPaths to find
+	// the paths that satisfy the hop count constraint.
+	maxKShortestCandidates = 1024
+)
+
+// Constraint restricts the paths that are found by FindKShortestPaths.
+type Constraint struct {
+	// ExcludeVertexies is the set of vertex IDs that should not be on the paths.
+	ExcludeVertexies map[string]bool
+	// ExcludeEdges is the set of edge IDs that should not be on the paths.
+	ExcludeEdges map[string]bool
+	// MaxHops is the maximum number of edges on a path. Zero means no limit.
+	MaxHops int
+	// Filter returns false for the edges that should not be on the paths. Nil means
+	// all the edges are allowed.
+	Filter func(Edge) bool
+}
+
+func (r Constraint) allowVertex(id string) bool {
+	return r.ExcludeVertexies[id] == false
+}
+
+func (r Constraint) allowEdge(e Edge) bool {
+	if r.ExcludeEdges[e.ID()] {
+		return false
+	}
+
+	return r.Filter == nil || r.Filter(e)
+}
+
+// Cost returns the total cost of path that is used to find the shortest paths.
+func Cost(path []Path) float64 {
+	total := 0.0
+	for _, p := range path {
+		total += 1 + p.E.Weight()
+	}
+
+	return total
+}
+
+// FindKShortestPaths returns at most k loop-free paths from src to dst that satisfy c,
+// in increasing order of their costs, using Yen's algorithm. Unlike FindPath, this
+// function uses all the edges including the disabled edges by the minimum spanning tree.
+func (r *Graph) FindKShortestPaths(src, dst Vertex, k int, c Constraint) [][]Path {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make([][]Path, 0)
+	if k <= 0 || len(r.vertexies) == 0 || len(r.edges) == 0 || src.ID() == dst.ID() {
+		return result
+	}
+	if !c.allowVertex(src.ID()) || !c.allowVertex(dst.ID()) {
+		return result
+	}
+
+	first := r.constrainedPath(src, dst, c, nil, nil)
+	if first == nil {
+		return result
+	}
+	// All the paths that have been selected from the candidates, including the paths
+	// that do not satisfy the hop count constraint.
+	selected := [][]Path{first}
+	candidates := make([][]Path, 0)
+	dup := map[string]bool{pathKey(first): true}
+
+	for {
+		last := selected[len(selected)-1]
+		if c.MaxHops <= 0 || len(last) <= c.MaxHops {
+			result = append(result, last)
+			if len(result) >= k {
+				break
+			}
+		}
+		if len(selected) >= maxKShortestCandidates {
+			break
+		}
+
+		// Find the deviations from the last path at each of its vertexies.
+		for i := range last {
+			root := last[:i]
+			bannedEdges := make(map[string]bool)
+			for _, p := range selected {
+				if len(p) > i && samePath(p[:i], root) {
+					bannedEdges[p[i].E.ID()] = true
+				}
+			}
+			// Vertexies on the root path should not be visited again to avoid a loop.
+			bannedVertexies := make(map[string]bool)
+			for _, p := range root {
+				bannedVertexies[p.V.ID()] = true
+			}
+
+			spur := r.constrainedPath(last[i].V, dst, c, bannedVertexies, bannedEdges)
+			if spur == nil {
+				continue
+			}
+			path := make([]Path, 0, len(root)+len(spur))
+			path = append(path, root...)
+			path = append(path, spur...)
+			key := pathKey(path)
+			if dup[key] {
+				continue
+			}
+			dup[key] = true
+			candidates = append(candidates, path)
+		}
+		if len(candidates) == 0 {
+			break
+		}
+
+		sort.SliceStable(candidates, func(i, j int) bool {
+			ci, cj := Cost(candidates[i]), Cost(candidates[j])
+			if math.Abs(ci-cj) > costEpsilon {
+				return ci < cj
+			}
+			return len(candidates[i]) < len(candidates[j])
+		})
+		selected = append(selected, candidates[0])
+		candidates = candidates[1:]
+	}
+
+	return result
+}
+
+// constrainedPath returns the shortest path from src to dst that satisfies c and does
+// not go through the banned vertexies and edges, using Dijkstra's algorithm. It returns
+// nil if there is no such a path. A caller should lock the mutex before calling this function.
+func (r *Graph) constrainedPath(src, dst Vertex, c Constraint, bannedVertexies, bannedEdges map[string]bool) []Path {
+	dist := map[string]float64{src.ID(): 0}
+	prev := make(map[string]Path)
+	done := make(map[string]bool)
+
+	for {
+		// Pick the closest vertex that is not yet done. Ties are broken by the vertex ID
+		// to make the result deterministic.
+		var u string
+		min := math.Inf(1)
+		for id, d := range dist {
+			if done[id] || d > min || (d == min && id > u) {
+				continue
+			}
+			u, min = id, d
+		}
+		if math.IsInf(min, 1) {
+			return nil
+		}
+		if u == dst.ID() {
+			break
+		}
+		done[u] = true
+
+		vertex, ok := r.vertexies[u]
+		if !ok {
+			continue
+		}
+		for _, e := range sortedEdgesOf(vertex) {
+			if bannedEdges[e.value.ID()] || !c.allowEdge(e.value) {
+				continue
+			}
+			next := opposite(e, vertex.value).ID()
+			if done[next] || bannedVertexies[next] || !c.allowVertex(next) {
+				continue
+			}
+			if d, ok := dist[next]; ok && d <= min+cost(e) {
+				continue
+			}
+			dist[next] = min + cost(e)
+			prev[next] = Path{V: vertex.value, E: e.value}
+		}
+	}
+
+	result := make([]Path, 0)
+	for v := dst.ID(); v != src.ID(); {
+		p := prev[v]
+		result = append(result, p)
+		v = p.V.ID()
+	}
+
+	return reverse(result)
+}
+
+func samePath(p1, p2 []Path) bool {
+	if len(p1) != len(p2) {
+		return false
+	}
+	for i := range p1 {
+		if p1[i].V.ID() != p2[i].V.ID() || p1[i].E.ID() != p2[i].E.ID() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func pathKey(path []Path) string {
+	var buf bytes.Buffer
+	for _, p := range path {
+		buf.WriteString(p.V.ID())
+		buf.WriteString(">")
+		buf.WriteString(p.E.ID())
+		buf.WriteString(";")
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,198 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package graph
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// Maximum number of equal-cost paths that will be returned by FindEqualCostPaths.
+	maxEqualCostPaths = 16
+	// Tolerance that is used to compare two path costs.
+	costEpsilon = 1e-9
+)
+
+// cost returns the cost of e to be used in the shortest path calculation. Each hop costs
+// at least 1 so that the shortest path is the minimum hop path if all the weights are zero.
+func cost(e *edge) float64 {
+	return 1 + e.value.Weight()
+}
+
+func opposite(e *edge, v Vertex) Vertex {
+	points := e.value.Points()
+	if points[0].Vertex().ID() == v.ID() {
+		return points[1].Vertex()
+	}
+
+	return points[0].Vertex()
+}
+
+// sortedEdgesOf returns the edges of v sorted by their IDs to make the result deterministic.
+func sortedEdgesOf(v vertex) []*edge {
+	result := make([]*edge, 0, len(v.edges))
+	for _, e := range v.edges {
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].value.ID() < result[j].value.ID() })
+
+	return result
+}
+
+// distances calculates the shortest distances from all vertexies to dst using Dijkstra's
+// algorithm. Unlike FindPath, this function uses all the edges including the disabled
+// edges by the minimum spanning tree. Unreachable vertexies are not included in the result.
+// A caller should lock the mutex before calling this function.
+func (r *Graph) distances(dst Vertex) map[string]float64 {
+	dist := map[string]float64{dst.ID(): 0}
+	done := make(map[string]bool)
+
+	for {
+		// Pick the closest vertex that is not yet done.
+		var u string
+		min := math.Inf(1)
+		for id, d := range dist {
+			if done[id] == false && d < min {
+				u, min = id, d
+			}
+		}
+		if math.IsInf(min, 1) {
+			break
+		}
+		done[u] = true
+
+		vertex, ok := r.vertexies[u]
+		if !ok {
+			continue
+		}
+		for _, e := range vertex.edges {
+			next := opposite(e, vertex.value).ID()
+			d, ok := dist[next]
+			if ok && d <= min+cost(e) {
+				continue
+			}
+			dist[next] = min + cost(e)
+		}
+	}
+
+	return dist
+}
+
+// FindEqualCostPaths returns all the shortest paths, whose costs are same, from src to
+// dst. The number of returned paths is limited to maxEqualCostPaths.
+func (r *Graph) FindEqualCostPaths(src, dst Vertex) [][]Path {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make([][]Path, 0)
+	if len(r.vertexies) == 0 || len(r.edges) == 0 || src.ID() == dst.ID() {
+		return result
+	}
+
+	dist := r.distances(dst)
+	// Unreachable?
+	if _, ok := dist[src.ID()]; !ok {
+		return result
+	}
+
+	var walk func(v Vertex, path []Path)
+	walk = func(v Vertex, path []Path) {
+		if len(result) >= maxEqualCostPaths {
+			return
+		}
+		if v.ID() == dst.ID() {
+			p := make([]Path, len(path))
+			copy(p, path)
+			result = append(result, p)
+			return
+		}
+
+		vertex, ok := r.vertexies[v.ID()]
+		if !ok {
+			return
+		}
+		for _, e := range sortedEdgesOf(vertex) {
+			next := opposite(e, v)
+			d, ok := dist[next.ID()]
+			// Follow the edges that are on a shortest path.
+			if !ok || math.Abs(dist[v.ID()]-(d+cost(e))) > costEpsilon {
+				continue
+			}
+			walk(next, append(path, Path{V: v, E: e.value}))
+		}
+	}
+	walk(src, make([]Path, 0))
+
+	return result
+}
+
+// FindLoopFreeAlternates returns the edges of src, except the edge on primary, that can
+// be used to reach dst without a loop when the primary edge fails. A neighbor N is loop
+// free if dist(N, dst) < dist(N, src) + dist(src, dst), which means that the shortest
+// path from N to dst does not go back through src. The result is sorted by the path cost.
+func (r *Graph) FindLoopFreeAlternates(src, dst Vertex, primary Point) []Edge {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make([]Edge, 0)
+	vertex, ok := r.vertexies[src.ID()]
+	if !ok || src.ID() == dst.ID() {
+		return result
+	}
+
+	toDst := r.distances(dst)
+	toSrc := r.distances(src)
+	d, ok := toDst[src.ID()]
+	// Unreachable?
+	if !ok {
+		return result
+	}
+
+	type alternate struct {
+		edge Edge
+		cost float64
+	}
+	candidates := make([]alternate, 0)
+	for _, e := range sortedEdgesOf(vertex) {
+		if primary != nil {
+			if _, ok := r.points[primary.ID()][e.value.ID()]; ok {
+				continue
+			}
+		}
+		next := opposite(e, src).ID()
+		n, ok := toDst[next]
+		if !ok || n+costEpsilon >= toSrc[next]+d {
+			continue
+		}
+		candidates = append(candidates, alternate{edge: e.value, cost: cost(e) + n})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].cost < candidates[j].cost })
+
+	for _, v := range candidates {
+		result = append(result, v.edge)
+	}
+
+	return result
+}
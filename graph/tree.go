@@ -0,0 +1,123 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package graph
+
+import (
+	"math"
+	"sync"
+)
+
+// tree is a shortest-path tree toward a destination vertex. Key is the vertex ID, and the
+// value is the next hop of the vertex toward the destination.
+type tree map[string]Path
+
+type treeCache struct {
+	mutex sync.Mutex
+	trees map[string]tree
+}
+
+func newTreeCache() *treeCache {
+	return &treeCache{
+		trees: make(map[string]tree),
+	}
+}
+
+func (r *treeCache) get(dst string) (tree, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	v, ok := r.trees[dst]
+	return v, ok
+}
+
+func (r *treeCache) set(dst string, t tree) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.trees[dst] = t
+}
+
+func (r *treeCache) reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.trees = make(map[string]tree)
+}
+
+// shortestPathTree returns the shortest-path tree toward dst that uses all the edges
+// including the disabled edges by the minimum spanning tree. Each vertex picks the edge
+// whose ID is the smallest among its equal-cost next hops, so that the next hops of all
+// the vertexies always form a loop-free tree. A caller should lock the mutex before
+// calling this function.
+func (r *Graph) shortestPathTree(dst Vertex) tree {
+	if v, ok := r.trees.get(dst.ID()); ok {
+		return v
+	}
+
+	result := make(tree)
+	dist := r.distances(dst)
+	for id, d := range dist {
+		vertex, ok := r.vertexies[id]
+		if !ok || id == dst.ID() {
+			continue
+		}
+		for _, e := range sortedEdgesOf(vertex) {
+			next, ok := dist[opposite(e, vertex.value).ID()]
+			if !ok || math.Abs(d-(next+cost(e))) > costEpsilon {
+				continue
+			}
+			result[id] = Path{V: vertex.value, E: e.value}
+			break
+		}
+	}
+	r.trees.set(dst.ID(), result)
+
+	return result
+}
+
+// FindTreePath returns the path from src to dst along the shortest-path tree of dst.
+// The paths from all the vertexies to the same destination never make a loop, so that
+// they can be used to forward packets toward the destination regardless of their sources.
+func (r *Graph) FindTreePath(src, dst Vertex) []Path {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make([]Path, 0)
+	if len(r.vertexies) == 0 || len(r.edges) == 0 || src.ID() == dst.ID() {
+		return result
+	}
+
+	t := r.shortestPathTree(dst)
+	v := src
+	for v.ID() != dst.ID() {
+		hop, ok := t[v.ID()]
+		// Unreachable or the tree is broken?
+		if !ok || len(result) > len(r.vertexies) {
+			return make([]Path, 0)
+		}
+		result = append(result, hop)
+		v = opposite(r.edges[hop.E.ID()], v)
+	}
+
+	return result
+}
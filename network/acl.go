@@ -0,0 +1,256 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/superkkt/cherry/openflow"
+)
+
+const (
+	// Flow priority of the lowest ACL flows, which is higher than the normal flows.
+	aclFlowPriority = 20
+	// MaxACLPriority is the maximum priority of the ACL flows. The ACL flows are installed
+	// below the port drop flows of the PACKET_IN policer.
+	MaxACLPriority = 159
+	// MaxACLFlows is the maximum number of the ACL flows installed in a switch, which should
+	// fit in the flow table of the switch with the other flows.
+	MaxACLFlows = 1000
+	// ACL flows are special flows in their own cookie namespace.
+	aclCookie     uint64 = 0x1<<63 | 0x1<<62
+	aclCookieMask uint64 = 0x1<<63 | 0x1<<62
+)
+
+// ACLFlow is a flow that allows or denies the IPv4 packets before they are forwarded by the
+// normal flows.
+//
+// The ACL flows are installed on the table right before the normal flow table if the driver
+// profile of the switch dedicates the table to them, so that the allowed packets go to the
+// normal flows. Otherwise, they are installed on the normal flow table where the allowed
+// packets cannot go to the normal flows. So, the allow flows are not installed on such a
+// switch, and a deny flow also drops the packets that are allowed by higher allow flows,
+// which fails closed. The UI API rejects such allow rules unless all the switches have
+// the dedicated table.
+type ACLFlow struct {
+	// Priority of the flow among the ACL flows, which should not be greater than MaxACLPriority.
+	Priority uint16
+	Allow    bool
+	// Nil means any address.
+	SrcIP, DstIP *net.IPNet
+	// Zero means any protocol.
+	Protocol uint8
+	// Zero means any port. They require TCP or UDP protocol.
+	SrcPort, DstPort uint16
+}
+
+func (r ACLFlow) String() string {
+	action := "deny"
+	if r.Allow {
+		action = "allow"
+	}
+
+	return fmt.Sprintf("ACLFlow Priority=%v, Action=%v, Src=%v:%v, Dst=%v:%v, Protocol=%v", r.Priority, action, r.SrcIP, r.SrcPort, r.DstIP, r.DstPort, r.Protocol)
+}
+
+type aclEntry struct {
+	flow  ACLFlow
+	match openflow.Match
+}
+
+// SetACLFlows replaces the ACL flows installed in this device with flows.
+func (r *Device) SetACLFlows(flows []ACLFlow) error {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return ErrClosedDevice
+	}
+
+	if len(flows) > MaxACLFlows {
+		return fmt.Errorf("too many ACL flows: %v (max %v)", len(flows), MaxACLFlows)
+	}
+
+	tableID, dedicated := r.aclTable()
+	entries := make(map[string]aclEntry)
+	skipped := 0
+	for _, v := range flows {
+		if v.Priority > MaxACLPriority {
+			return fmt.Errorf("too high ACL flow priority: %v", v.Priority)
+		}
+		if v.Allow && !dedicated {
+			skipped++
+			continue
+		}
+		match, err := r.newACLMatch(v, dedicated)
+		if err != nil {
+			return err
+		}
+		m, err := match.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		entries[fmt.Sprintf("%v/%v", v.Priority, m)] = aclEntry{flow: v, match: match}
+	}
+
+	if skipped > 0 {
+		logger.Warningf("%v allow ACL flow(s) are not installed due to no table dedicated to the ACL flows, so the packets allowed by them are denied: deviceID=%v", skipped, r.id)
+	}
+
+	// Remove the stale ACL flows that have been installed before connecting to the device.
+	// OF1.0 cannot remove them by the cookie, but they are removed on connection unless
+	// the warm start is enabled.
+	if r.acl == nil && r.factory.ProtocolVersion() == openflow.OF13_VERSION {
+		if err := r.sendACLDelete(openflow.FlowDelete, tableID, nil, 0); err != nil {
+			return err
+		}
+	}
+	// Install the new flows first not to pass the packets that should be denied. A flow
+	// that has the same match and priority with an installed one replaces it.
+	for k, v := range entries {
+		if old, ok := r.acl[k]; ok && old.flow.Allow == v.flow.Allow {
+			continue
+		}
+		if err := r.sendACLAdd(tableID, v); err != nil {
+			return err
+		}
+	}
+	for k, v := range r.acl {
+		if _, ok := entries[k]; ok {
+			continue
+		}
+		if err := r.sendACLDelete(openflow.FlowDeleteStrict, tableID, v.match, aclFlowPriority+v.flow.Priority); err != nil {
+			return err
+		}
+	}
+	r.acl = entries
+
+	if r.driver.NoBarrier {
+		return nil
+	}
+	barrier, err := r.factory.NewBarrierRequest()
+	if err != nil {
+		return err
+	}
+
+	return r.session.Write(barrier)
+}
+
+// aclTable returns the table ID that the ACL flows are installed on. dedicated is true if
+// the table is dedicated to the ACL flows.
+//
+// XXX: Caller should lock the mutex.
+func (r *Device) aclTable() (tableID uint8, dedicated bool) {
+	tables := r.driver.Tables
+	if r.driver.ACL && r.factory.ProtocolVersion() == openflow.OF13_VERSION {
+		return tables[len(tables)-2], true
+	}
+
+	return r.flowTableID, false
+}
+
+// XXX: Caller should lock the mutex.
+func (r *Device) newACLMatch(flow ACLFlow, dedicated bool) (openflow.Match, error) {
+	match, err := r.factory.NewMatch()
+	if err != nil {
+		return nil, err
+	}
+	match.SetEtherType(0x0800) // IPv4.
+	if flow.SrcIP != nil {
+		match.SetSrcIP(flow.SrcIP)
+	}
+	if flow.DstIP != nil {
+		match.SetDstIP(flow.DstIP)
+	}
+	if flow.Protocol != 0 {
+		match.SetIPProtocol(flow.Protocol)
+	}
+	if flow.SrcPort != 0 {
+		match.SetSrcPort(flow.SrcPort)
+	}
+	if flow.DstPort != 0 {
+		match.SetDstPort(flow.DstPort)
+	}
+	// The flows on the normal flow table should have the default VLAN ID as the normal flows.
+	if !dedicated {
+		match.SetVLANID(r.vlanID)
+	}
+	if err := r.driver.checkMatch(match); err != nil {
+		return nil, err
+	}
+
+	return match, nil
+}
+
+// XXX: Caller should lock the mutex.
+func (r *Device) sendACLAdd(tableID uint8, entry aclEntry) error {
+	flow, err := r.factory.NewFlowMod(openflow.FlowAdd)
+	if err != nil {
+		return err
+	}
+	flow.SetCookie(aclCookie)
+	flow.SetTableID(tableID)
+	// Permanent flow.
+	flow.SetIdleTimeout(0)
+	flow.SetHardTimeout(0)
+	flow.SetPriority(aclFlowPriority + entry.flow.Priority)
+	flow.SetFlowMatch(entry.match)
+	// The denied packets are dropped because no instruction is present in the flow.
+	if entry.flow.Allow {
+		inst, err := r.factory.NewInstruction()
+		if err != nil {
+			return err
+		}
+		inst.GotoTable(r.flowTableID)
+		flow.SetFlowInstruction(inst)
+	}
+
+	return r.session.Write(flow)
+}
+
+// sendACLDelete removes the ACL flows that match match, which can be nil to match all the
+// flows. priority is only used by the strict command.
+//
+// XXX: Caller should lock the mutex.
+func (r *Device) sendACLDelete(cmd openflow.FlowModCmd, tableID uint8, match openflow.Match, priority uint16) error {
+	flow, err := r.factory.NewFlowMod(cmd)
+	if err != nil {
+		return err
+	}
+	if match == nil {
+		if match, err = r.factory.NewMatch(); err != nil {
+			return err
+		}
+	}
+	flow.SetCookie(aclCookie)
+	flow.SetCookieMask(aclCookieMask)
+	flow.SetTableID(tableID)
+	flow.SetPriority(priority)
+	flow.SetFlowMatch(match)
+	port := openflow.NewOutPort()
+	port.SetNone()
+	flow.SetOutPort(port)
+
+	return r.session.Write(flow)
+}
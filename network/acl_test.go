@@ -0,0 +1,155 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/superkkt/cherry/openflow/of13"
+	"github.com/superkkt/cherry/openflow/transceiver"
+)
+
+// messageRecorder records the OpenFlow messages written to a device.
+type messageRecorder struct {
+	messages [][]byte
+}
+
+func (r *messageRecorder) Read(p []byte) (n int, err error) {
+	select {}
+}
+
+func (r *messageRecorder) Write(p []byte) (n int, err error) {
+	r.messages = append(r.messages, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+func (r *messageRecorder) Close() error {
+	return nil
+}
+
+// flowMods returns the FLOW_MOD messages that have the command.
+func (r *messageRecorder) flowMods(command uint8) [][]byte {
+	result := make([][]byte, 0)
+	for _, v := range r.messages {
+		if v[1] == of13.OFPT_FLOW_MOD && v[25] == command {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+func newACLTestDevice(driver DriverProfile, flowTableID uint8) (*Device, *messageRecorder) {
+	recorder := new(messageRecorder)
+	s := new(session)
+	s.transceiver = transceiver.NewTransceiver(transceiver.NewStream(recorder, 0xFFFF), s)
+
+	return &Device{
+		id:          "1",
+		session:     s,
+		ports:       make(map[uint32]*Port),
+		flowTableID: flowTableID,
+		factory:     of13.NewFactory(),
+		flows:       newFlowStore(false),
+		groups:      newGroupTable(),
+		driver:      mustCompileDriver(driver),
+	}, recorder
+}
+
+func testACLFlows() []ACLFlow {
+	mustParseCIDR := func(s string) *net.IPNet {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+		return n
+	}
+
+	// Deny the traffic from 10.0.1.0/24 except MySQL, and deny all the traffic from 10.0.1.1.
+	return []ACLFlow{
+		{Priority: 2, Allow: false, SrcIP: mustParseCIDR("10.0.1.1/32")},
+		{Priority: 1, Allow: true, SrcIP: mustParseCIDR("10.0.1.0/24"), Protocol: 6, DstPort: 3306},
+		{Priority: 0, Allow: false, SrcIP: mustParseCIDR("10.0.1.0/24")},
+	}
+}
+
+func TestSetACLFlowsDedicatedTable(t *testing.T) {
+	device, recorder := newACLTestDevice(DriverProfile{Name: "test", Tables: []uint8{0, 1, 2}, ACL: true}, 2)
+	if err := device.SetACLFlows(testACLFlows()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stale ACL flows are removed first.
+	if v := recorder.flowMods(of13.OFPFC_DELETE); len(v) != 1 || v[0][24] != 1 {
+		t.Fatalf("unexpected removal of the stale ACL flows: %v", v)
+	}
+	added := recorder.flowMods(of13.OFPFC_ADD)
+	if len(added) != 3 {
+		t.Fatalf("unexpected number of the added ACL flows: expected=3, got=%v", len(added))
+	}
+	for _, v := range added {
+		if v[24] != 1 {
+			t.Fatalf("ACL flow is installed on an unexpected table: %v", v[24])
+		}
+		priority := binary.BigEndian.Uint16(v[30:32])
+		// Only the allow flow goes to the normal flow table.
+		gotoTable := binary.BigEndian.Uint16(v[len(v)-8:]) == of13.OFPIT_GOTO_TABLE && v[len(v)-4] == 2
+		if gotoTable != (priority == aclFlowPriority+1) {
+			t.Fatalf("unexpected instruction of the ACL flow: priority=%v, goto=%v", priority, gotoTable)
+		}
+	}
+}
+
+func TestSetACLFlowsNormalTable(t *testing.T) {
+	device, recorder := newACLTestDevice(DriverProfile{Name: "test"}, 0)
+	if err := device.SetACLFlows(testACLFlows()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The deny flows are installed even if the allow flow cannot be installed, so that the
+	// packets allowed by the allow flow are also denied instead of passing the denied ones.
+	added := recorder.flowMods(of13.OFPFC_ADD)
+	if len(added) != 2 {
+		t.Fatalf("unexpected number of the added ACL flows: expected=2, got=%v", len(added))
+	}
+	for i, priority := range []uint16{aclFlowPriority + 2, aclFlowPriority} {
+		found := false
+		for _, v := range added {
+			if v[24] == 0 && binary.BigEndian.Uint16(v[30:32]) == priority {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("#%v: not found the deny flow: priority=%v", i, priority)
+		}
+	}
+
+	// Removing the rules removes the installed flows.
+	if err := device.SetACLFlows(nil); err != nil {
+		t.Fatal(err)
+	}
+	if v := recorder.flowMods(of13.OFPFC_DELETE_STRICT); len(v) != 2 {
+		t.Fatalf("unexpected number of the removed ACL flows: expected=2, got=%v", len(v))
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AdmissionPolicy decides how to treat the switches whose DPIDs are not registered
+// in the database.
+type AdmissionPolicy int
+
+const (
+	// AdmissionNone admits all the switches regardless of their registration.
+	AdmissionNone AdmissionPolicy = iota
+	// AdmissionReject disconnects the unregistered switches.
+	AdmissionReject
+	// AdmissionQuarantine keeps the connections of the unregistered switches without
+	// adding them to the topology, so that no forwarding flows are installed on them
+	// until they are registered.
+	AdmissionQuarantine
+)
+
+func (r AdmissionPolicy) String() string {
+	switch r {
+	case AdmissionNone:
+		return "none"
+	case AdmissionReject:
+		return "reject"
+	case AdmissionQuarantine:
+		return "quarantine"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(r))
+	}
+}
+
+// ParseAdmissionPolicy converts policy into an AdmissionPolicy. An empty string means
+// the default policy that admits all the switches.
+func ParseAdmissionPolicy(policy string) (AdmissionPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(policy)) {
+	case "", "none":
+		return AdmissionNone, nil
+	case "reject":
+		return AdmissionReject, nil
+	case "quarantine":
+		return AdmissionQuarantine, nil
+	default:
+		return AdmissionNone, fmt.Errorf("unknown admission policy: %v", policy)
+	}
+}
+
+// PendingSwitch is an unregistered switch that has tried to connect to the controller.
+type PendingSwitch struct {
+	DPID uint64
+	// Remote address of the switch's connection.
+	Address string
+	// Quarantined is true if the switch is still connected in the quarantine state,
+	// or false if it has been rejected.
+	Quarantined bool
+}
@@ -0,0 +1,225 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/openflow/of13"
+	"github.com/superkkt/cherry/openflow/transceiver"
+)
+
+type mockAdmissionDB struct {
+	mockLocationDB
+	registered map[uint64]bool
+	pending    []PendingSwitch
+}
+
+func (r *mockAdmissionDB) IsRegisteredSwitch(dpid uint64) (bool, error) {
+	return r.registered[dpid], nil
+}
+
+func (r *mockAdmissionDB) AddPendingSwitch(sw PendingSwitch) error {
+	r.pending = append(r.pending, sw)
+	return nil
+}
+
+type mockPublisher struct {
+	events []EventType
+}
+
+func (r *mockPublisher) Publish(t EventType, data interface{}) {
+	r.events = append(r.events, t)
+}
+
+// mockAdmissionTopology is the finder and the watcher of the sessions that have no
+// connected devices yet. It also counts the devices that have been brought up.
+type mockAdmissionTopology struct {
+	Finder
+	watcher
+	ControllerEventListener
+	up    int
+	added int
+}
+
+func (r *mockAdmissionTopology) Device(id string) *Device {
+	return nil
+}
+
+func (r *mockAdmissionTopology) OnDeviceUp(finder Finder, device *Device) error {
+	r.up++
+	return nil
+}
+
+func (r *mockAdmissionTopology) DeviceAdded(device *Device) {
+	r.added++
+}
+
+func newAdmissionTestSession(admission AdmissionPolicy, db database) (*session, *mockPublisher, *mockAdmissionTopology, *messageRecorder) {
+	recorder := new(messageRecorder)
+	publisher := new(mockPublisher)
+	topo := new(mockAdmissionTopology)
+
+	s := &session{
+		negotiated: true,
+		remoteAddr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 6653},
+		watcher:    topo,
+		finder:     topo,
+		listener:   topo,
+		publisher:  publisher,
+		db:         db,
+		admission:  admission,
+	}
+	s.device = newDevice(s)
+	s.device.setFactory(of13.NewFactory())
+	s.handler = newOF13Session(s.device)
+	s.transceiver = transceiver.NewTransceiver(transceiver.NewStream(recorder, 0xFFFF), s)
+
+	return s, publisher, topo, recorder
+}
+
+func newFeaturesReply(t *testing.T, dpid uint64) openflow.FeaturesReply {
+	packet := make([]byte, 32)
+	packet[0] = openflow.OF13_VERSION
+	packet[1] = of13.OFPT_FEATURES_REPLY
+	binary.BigEndian.PutUint16(packet[2:4], uint16(len(packet)))
+	binary.BigEndian.PutUint64(packet[8:16], dpid)
+	// Number of tables.
+	packet[20] = 2
+
+	v := new(of13.FeaturesReply)
+	if err := v.UnmarshalBinary(packet); err != nil {
+		t.Fatalf("failed to unmarshal FEATURES_REPLY: %v", err)
+	}
+
+	return v
+}
+
+// multipartRequests returns the types of the multipart requests that have been sent.
+func (r *messageRecorder) multipartRequests() []uint16 {
+	result := make([]uint16, 0)
+	for _, v := range r.messages {
+		if v[1] == of13.OFPT_MULTIPART_REQUEST {
+			result = append(result, binary.BigEndian.Uint16(v[8:10]))
+		}
+	}
+
+	return result
+}
+
+func equalEvents(events []EventType, expected ...EventType) bool {
+	if len(events) != len(expected) {
+		return false
+	}
+	for i := range events {
+		if events[i] != expected[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestAdmissionReject(t *testing.T) {
+	db := &mockAdmissionDB{registered: map[uint64]bool{2: true}}
+	s, publisher, topo, _ := newAdmissionTestSession(AdmissionReject, db)
+
+	if err := s.OnFeaturesReply(of13.NewFactory(), s.transceiver, newFeaturesReply(t, 1)); err == nil {
+		t.Fatal("expected an error for the unregistered device, but got nil")
+	}
+	if len(db.pending) != 1 || db.pending[0].DPID != 1 || db.pending[0].Quarantined || db.pending[0].Address != "10.0.0.1:6653" {
+		t.Fatalf("unexpected pending switches: %+v", db.pending)
+	}
+	if !equalEvents(publisher.events, EventSwitchRejected) {
+		t.Fatalf("unexpected events: %v", publisher.events)
+	}
+	if s.device.isReady() || topo.up != 0 || topo.added != 0 {
+		t.Fatal("rejected device has been initialized")
+	}
+
+	// The registered device should be admitted without any event.
+	publisher.events = nil
+	if admitted, err := s.admit(2); err != nil || !admitted {
+		t.Fatalf("registered device is not admitted: admitted=%v, err=%v", admitted, err)
+	}
+	if len(publisher.events) != 0 || len(db.pending) != 1 {
+		t.Fatalf("unexpected events or pending switches: events=%v, pending=%+v", publisher.events, db.pending)
+	}
+}
+
+func TestAdmissionQuarantine(t *testing.T) {
+	db := &mockAdmissionDB{registered: make(map[uint64]bool)}
+	s, publisher, topo, recorder := newAdmissionTestSession(AdmissionQuarantine, db)
+
+	// The first FEATURES_REPLY and the following ones probed by the device explorer.
+	for i := 0; i < 3; i++ {
+		if err := s.OnFeaturesReply(of13.NewFactory(), s.transceiver, newFeaturesReply(t, 1)); err != nil {
+			t.Fatalf("unexpected error for the quarantined device: %v", err)
+		}
+	}
+	if !s.isQuarantined() {
+		t.Fatal("unregistered device is not quarantined")
+	}
+	// The event should be published only once regardless of the probes.
+	if !equalEvents(publisher.events, EventSwitchQuarantined) {
+		t.Fatalf("unexpected events: %v", publisher.events)
+	}
+	if len(db.pending) != 1 || db.pending[0].DPID != 1 || !db.pending[0].Quarantined {
+		t.Fatalf("unexpected pending switches: %+v", db.pending)
+	}
+	if s.device.isReady() || topo.up != 0 || topo.added != 0 {
+		t.Fatal("quarantined device has been initialized")
+	}
+	// The ports of the quarantined device are discovered for the registration.
+	requests := recorder.multipartRequests()
+	if len(requests) != 3 {
+		t.Fatalf("unexpected number of multipart requests for the quarantined device: %v", len(requests))
+	}
+	for _, v := range requests {
+		if v != of13.OFPMP_PORT_DESC {
+			t.Fatalf("unexpected multipart request for the quarantined device: %v", v)
+		}
+	}
+
+	// Register the device, and then the next probe should admit it.
+	db.registered[1] = true
+	recorder.messages = nil
+	if err := s.OnFeaturesReply(of13.NewFactory(), s.transceiver, newFeaturesReply(t, 1)); err != nil {
+		t.Fatalf("unexpected error for the registered device: %v", err)
+	}
+	if s.isQuarantined() {
+		t.Fatal("registered device is still quarantined")
+	}
+	if !equalEvents(publisher.events, EventSwitchQuarantined, EventSwitchAdmitted) {
+		t.Fatalf("unexpected events: %v", publisher.events)
+	}
+	// The device initialization should continue.
+	if !s.device.isReady() || s.device.ID() != "1" || topo.up != 1 || topo.added != 1 {
+		t.Fatalf("admitted device has not been initialized: ready=%v, up=%v, added=%v", s.device.isReady(), topo.up, topo.added)
+	}
+	if v := recorder.multipartRequests(); len(v) != 1 || v[0] != of13.OFPMP_DESC {
+		t.Fatalf("unexpected multipart requests for the admitted device: %v", v)
+	}
+}
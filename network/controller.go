@@ -37,6 +37,19 @@ var (
 
 type database interface {
 	Location(mac net.HardwareAddr) (dpid string, port uint32, status LocationStatus, err error)
+	// HostLocations returns all the hosts whose physical locations have been discovered.
+	HostLocations() ([]HostLocation, error)
+	// HostLocationVersion returns the version of the host locations, which is increased
+	// whenever the locations are changed.
+	HostLocationVersion() (uint64, error)
+	// IsRegisteredSwitch returns whether the switch whose DPID is dpid is registered.
+	IsRegisteredSwitch(dpid uint64) (bool, error)
+	// AddPendingSwitch records the unregistered switch that has tried to connect, which
+	// will be listed to the administrator to approve it.
+	AddPendingSwitch(PendingSwitch) error
+	// UpdateDiscoveredSwitch records the switch whose ports have been learned from the
+	// switch itself, and then synchronizes the ports of the switch if it is registered.
+	UpdateDiscoveredSwitch(DiscoveredSwitch) error
 }
 
 type LocationStatus int
@@ -66,39 +79,73 @@ type ControllerEventListener interface {
 
 type TopologyEventListener interface {
 	OnTopologyChange(Finder) error
+	// OnPathChange is called when the paths among the switches have been changed by the
+	// link weights, such as the latency and the congestion, without any topology change.
+	OnPathChange(Finder) error
 }
 
 type Controller struct {
 	topo     *topology
 	listener EventListener
+	events   *EventBus
 }
 
 func NewController(db database) *Controller {
 	return &Controller{
-		topo: newTopology(db),
+		topo:   newTopology(db),
+		events: NewEventBus(),
 	}
 }
 
+// HostLocationUpdated implements HostLocationListener to update the host location cache.
+func (r *Controller) HostLocationUpdated(mac net.HardwareAddr, dpid string, port uint32, version uint64) {
+	event := HostMoveEvent{MAC: mac.String(), DeviceID: dpid, Port: port}
+	if prev, ok := r.topo.locations.update(mac, dpid, port, version); ok {
+		event.PrevDeviceID = prev.dpid
+		event.PrevPort = prev.port
+	}
+	r.events.Publish(EventHostMoved, event)
+}
+
+// HostLocationsInvalidated implements HostLocationListener to invalidate the host location cache.
+func (r *Controller) HostLocationsInvalidated(version uint64) {
+	r.topo.locations.invalidate(version)
+}
+
 func (r *Controller) AddConnection(ctx context.Context, c net.Conn) {
 	conf := sessionConfig{
-		conn:     c,
-		watcher:  r.topo,
-		finder:   r.topo,
-		listener: r.listener,
+		conn:      c,
+		db:        r.topo.db,
+		watcher:   r.topo,
+		finder:    r.topo,
+		listener:  r.listener,
+		publisher: r.events,
 	}
 	session := newSession(conf)
 	go session.Run(ctx)
 }
 
 func (r *Controller) SetEventListener(l EventListener) {
-	r.listener = l
-	r.topo.setEventListener(l)
+	// Publish the network events to the subscribers of the event bus as well.
+	p := &eventPublisher{EventListener: l, publisher: r.events}
+	r.listener = p
+	r.topo.setEventListener(p)
+}
+
+// Events returns the event bus that publishes the network events.
+func (r *Controller) Events() *EventBus {
+	return r.events
 }
 
 func (r *Controller) String() string {
 	return r.topo.String()
 }
 
+// Snapshot returns a read-only model of the current network topology.
+func (r *Controller) Snapshot() (*TopologySnapshot, error) {
+	return r.topo.snapshot()
+}
+
 func (r *Controller) Announce(ip net.IP, mac net.HardwareAddr) error {
 	for _, device := range r.topo.Devices() {
 		logger.Debugf("sending ARP announcement for a host (IP: %v, MAC: %v) via %v", ip, mac, device.ID())
@@ -22,10 +22,12 @@
 package network
 
 import (
+	"bytes"
 	"encoding"
 	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"sync"
 	"time"
 
@@ -61,7 +63,12 @@ type Device struct {
 	factory      openflow.Factory
 	closed       bool
 	flowCache    *flowCache
-	vlanID       uint16
+	flows        *flowStore // Desired normal flows that should be installed in this device.
+	vlanID       uint16     // Service VLAN ID that is used to match the normal flows.
+	groups       *groupTable
+	driver       *DriverProfile
+	// ACL flows installed in this device. Nil until the ACL flows are installed.
+	acl map[string]aclEntry
 }
 
 var (
@@ -83,7 +90,10 @@ func newDevice(s *session) *Device {
 		session:   s,
 		ports:     make(map[uint32]*Port),
 		flowCache: newFlowCache(5 * time.Second),
+		flows:     newFlowStore(viper.GetBool("default.warm_start")),
 		vlanID:    uint16(vlanID),
+		groups:    newGroupTable(),
+		driver:    defaultDriver,
 	}
 }
 
@@ -114,6 +124,17 @@ func (r *Device) setID(id string) {
 	defer r.mutex.Unlock()
 
 	r.id = id
+	// Now we know the device ID, so that we can apply the per-device VLAN configuration.
+	r.vlanID = deviceVLANID(id)
+}
+
+// VLANID returns the service VLAN ID of this device that is used to match the normal flows.
+func (r *Device) VLANID() uint16 {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.vlanID
 }
 
 func (r *Device) isReady() bool {
@@ -167,6 +188,23 @@ func (r *Device) setDescriptions(d Descriptions) {
 	r.descriptions = d
 }
 
+// Driver returns the driver profile of this device, which is decided by its descriptions.
+func (r *Device) Driver() *DriverProfile {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.driver
+}
+
+func (r *Device) setDriver(d *DriverProfile) {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.driver = d
+}
+
 func (r *Device) Features() Features {
 	// Read lock
 	r.mutex.RLock()
@@ -266,6 +304,43 @@ func (r *Device) IsClosed() bool {
 
 // SetFlow installs a normal flow entry for packet switching and routing into the switch device.
 func (r *Device) SetFlow(match openflow.Match, port openflow.OutPort) error {
+	return r.SetOwnedFlow(NoFlowOwner, match, port)
+}
+
+// SetOwnedFlow is same as SetFlow except that the flow is installed in the cookie
+// namespace of owner, so that only owner can remove it by using the RemoveOwned
+// functions.
+func (r *Device) SetOwnedFlow(owner FlowOwner, match openflow.Match, port openflow.OutPort) error {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return ErrClosedDevice
+	}
+
+	action, err := r.factory.NewAction()
+	if err != nil {
+		return err
+	}
+	action.SetOutPort(port)
+	if port.IsPhysical() {
+		r.setPortVLAN(action, port.Value())
+	}
+
+	return r.setFlow(owner, match, action, port)
+}
+
+// SetGroupFlow installs a normal flow entry whose packets are forwarded to the group
+// specified by groupID. The group should be installed in advance by using SetSelectGroup
+// or SetFailoverGroup.
+func (r *Device) SetGroupFlow(match openflow.Match, groupID uint32) error {
+	return r.SetOwnedGroupFlow(NoFlowOwner, match, groupID)
+}
+
+// SetOwnedGroupFlow is same as SetGroupFlow except that the flow is installed in the
+// cookie namespace of owner.
+func (r *Device) SetOwnedGroupFlow(owner FlowOwner, match openflow.Match, groupID uint32) error {
 	// Write lock
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -274,20 +349,51 @@ func (r *Device) SetFlow(match openflow.Match, port openflow.OutPort) error {
 		return ErrClosedDevice
 	}
 
+	action, err := r.factory.NewAction()
+	if err != nil {
+		return err
+	}
+	action.SetGroup(groupID)
+
+	return r.setFlow(owner, match, action, groupID)
+}
+
+// XXX: Caller should lock the mutex.
+func (r *Device) setFlow(owner FlowOwner, match openflow.Match, action openflow.Action, target interface{}) error {
 	// Set the default VLAN ID. It is necessary to use the L2 MAC flow table of Dell SXXX switches.
 	match.SetVLANID(r.vlanID)
+	if err := r.driver.checkMatch(match); err != nil {
+		return err
+	}
 
-	action, err := r.factory.NewAction()
+	ok, err := r.flowCache.InProgress(match, target)
 	if err != nil {
 		return err
 	}
-	action.SetOutPort(port)
+	if ok {
+		logger.Debugf("skip to install a new flow: already installed one: deviceID=%v", r.id)
+		return nil
+	}
 
+	flow, err := r.flows.add(owner, match, action, target)
+	if err != nil {
+		return err
+	}
+	// Install the new flow.
+	if err := r.writeFlow(flow); err != nil {
+		return err
+	}
+
+	return r.flowCache.Add(match, target)
+}
+
+// XXX: Caller should lock the mutex.
+func (r *Device) writeFlow(f *desiredFlow) error {
 	inst, err := r.factory.NewInstruction()
 	if err != nil {
 		return err
 	}
-	inst.ApplyAction(action)
+	inst.ApplyAction(f.action)
 
 	// For valid (non-overlapping) ADD requests, or those with no overlap checking,
 	// the switch must insert the flow entry at the lowest numbered table for which
@@ -299,40 +405,215 @@ func (r *Device) SetFlow(match openflow.Match, port openflow.OutPort) error {
 	if err != nil {
 		return err
 	}
+	flow.SetCookie(f.cookie)
 	flow.SetTableID(r.flowTableID)
-	// This idle timeout is actually useless because we update the installed flows
-	// more frequently than this timeout.
-	flow.SetIdleTimeout(90)
-	flow.SetPriority(10)
-	flow.SetFlowMatch(match)
+	// The unused flow will be removed by this idle timeout, and then the flow store
+	// also forgets it in the next reconciliation.
+	flow.SetIdleTimeout(normalFlowIdleTimeout)
+	flow.SetPriority(normalFlowPriority)
+	flow.SetFlowMatch(f.match)
 	flow.SetFlowInstruction(inst)
-
-	ok, err := r.flowCache.InProgress(match, port)
-	if err != nil {
+	if err := r.session.Write(flow); err != nil {
 		return err
 	}
-	if ok {
-		logger.Debugf("skip to install a new flow: already installed one: deviceID=%v", r.id)
+	if r.driver.NoBarrier {
 		return nil
 	}
-	// Install the new flow.
-	if err := r.session.Write(flow); err != nil {
+
+	barrier, err := r.factory.NewBarrierRequest()
+	if err != nil {
 		return err
 	}
-	if err := r.flowCache.Add(match, port); err != nil {
-		return err
+
+	return r.session.Write(barrier)
+}
+
+// SetSelectGroup installs a SELECT group, which distributes packets over the ports
+// by hashing, into the switch device and then returns its group ID. An existing
+// group is reused if there is already a group that consists of the same ports.
+func (r *Device) SetSelectGroup(ports []uint32) (groupID uint32, err error) {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return 0, ErrClosedDevice
+	}
+	if len(ports) == 0 {
+		return 0, errors.New("empty ports for a select group")
+	}
+
+	num := make([]uint32, len(ports))
+	copy(num, ports)
+	sort.Slice(num, func(i, j int) bool { return num[i] < num[j] })
+
+	buckets := make([]openflow.Bucket, 0, len(num))
+	for _, n := range num {
+		action, err := r.newOutputAction(n)
+		if err != nil {
+			return 0, err
+		}
+		buckets = append(buckets, openflow.Bucket{Weight: 1, Action: action})
+	}
+
+	return r.setGroup(fmt.Sprintf("select/%v", num), openflow.GroupTypeSelect, buckets)
+}
+
+// SetFailoverGroup installs a FAST_FAILOVER group, which forwards packets to primary
+// while it is alive and to backup otherwise, into the switch device and then returns
+// its group ID. An existing group is reused if there is already a same group.
+func (r *Device) SetFailoverGroup(primary, backup uint32) (groupID uint32, err error) {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return 0, ErrClosedDevice
+	}
+	if primary == backup {
+		return 0, errors.New("same primary and backup ports for a failover group")
 	}
 
+	buckets := make([]openflow.Bucket, 0, 2)
+	// The first live bucket is used, so that the primary port should be placed first.
+	for _, n := range []uint32{primary, backup} {
+		action, err := r.newOutputAction(n)
+		if err != nil {
+			return 0, err
+		}
+		buckets = append(buckets, openflow.Bucket{WatchPort: n, Action: action})
+	}
+
+	return r.setGroup(fmt.Sprintf("failover/%v/%v", primary, backup), openflow.GroupTypeFastFailover, buckets)
+}
+
+// XXX: Caller should lock the mutex.
+func (r *Device) newOutputAction(port uint32) (openflow.Action, error) {
+	action, err := r.factory.NewAction()
+	if err != nil {
+		return nil, err
+	}
+	outPort := openflow.NewOutPort()
+	outPort.SetValue(port)
+	action.SetOutPort(outPort)
+	r.setPortVLAN(action, port)
+
+	return action, nil
+}
+
+// setPortVLAN adds the VLAN actions required by the port configuration to action whose
+// packets will be sent out to the port.
+// XXX: Caller should lock the mutex.
+func (r *Device) setPortVLAN(action openflow.Action, port uint32) {
+	conf := portVLAN(r.id, port)
+	switch conf.Mode {
+	case VLANAccess:
+		action.SetStripVLAN()
+	case VLANTrunk:
+		// The matched packets are already tagged with the service VLAN.
+		if conf.ID != r.vlanID {
+			action.SetVLANID(conf.ID)
+		}
+	}
+}
+
+// XXX: Caller should lock the mutex.
+func (r *Device) setGroup(key string, t openflow.GroupType, buckets []openflow.Bucket) (groupID uint32, err error) {
+	if id, ok := r.groups.lookup(key); ok {
+		return id, nil
+	}
+
+	group, err := r.factory.NewGroupMod(openflow.GroupAdd)
+	if err != nil {
+		return 0, err
+	}
+	id := r.groups.add(key, time.Now())
+	group.SetGroupID(id)
+	group.SetGroupType(t)
+	for _, b := range buckets {
+		group.AddBucket(b)
+	}
+	if err := r.session.Write(group); err != nil {
+		return 0, err
+	}
+	logger.Debugf("installed a new group: deviceID=%v, groupID=%v, key=%v", r.id, id, key)
+
 	barrier, err := r.factory.NewBarrierRequest()
 	if err != nil {
+		return 0, err
+	}
+
+	return id, r.session.Write(barrier)
+}
+
+// XXX: Caller should lock the mutex.
+func (r *Device) removeGroups() error {
+	// OF1.0 does not support the group table.
+	if r.factory.ProtocolVersion() == openflow.OF10_VERSION {
+		return nil
+	}
+
+	group, err := r.factory.NewGroupMod(openflow.GroupDelete)
+	if err != nil {
+		return err
+	}
+	group.SetGroupID(openflow.AllGroups)
+	if err := r.session.Write(group); err != nil {
 		return err
 	}
+	r.groups.removeAll()
 
-	return r.session.Write(barrier)
+	return nil
+}
+
+// RemoveUnusedGroups removes the groups that are no longer referenced by any normal
+// flow of this device, so that the stale groups do not pile up in the group table.
+func (r *Device) RemoveUnusedGroups() error {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return ErrClosedDevice
+	}
+
+	return r.removeUnusedGroups()
+}
+
+// XXX: Caller should lock the mutex.
+func (r *Device) removeUnusedGroups() error {
+	// OF1.0 does not support the group table.
+	if r.factory.ProtocolVersion() == openflow.OF10_VERSION {
+		return nil
+	}
+
+	removed := r.groups.removeUnused(r.flows.groups(), time.Now())
+	for _, id := range removed {
+		group, err := r.factory.NewGroupMod(openflow.GroupDelete)
+		if err != nil {
+			return err
+		}
+		group.SetGroupID(id)
+		if err := r.session.Write(group); err != nil {
+			return err
+		}
+		logger.Debugf("removed an unused group: deviceID=%v, groupID=%v", r.id, id)
+	}
+
+	return nil
 }
 
 // RemoveFlows removes all the normal flows except special ones for table miss and ARP packets.
 func (r *Device) RemoveFlows() error {
+	return r.removeFlows(anyFlowOwner)
+}
+
+// RemoveOwnedFlows removes all the normal flows owned by owner.
+func (r *Device) RemoveOwnedFlows(owner FlowOwner) error {
+	return r.removeFlows(owner)
+}
+
+func (r *Device) removeFlows(owner FlowOwner) error {
 	// Write lock
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -352,27 +633,34 @@ func (r *Device) RemoveFlows() error {
 	port := openflow.NewOutPort()
 	port.SetNone()
 
-	flowmod, err := r.factory.NewFlowMod(openflow.FlowDelete)
-	if err != nil {
-		return err
-	}
-	// Remove all the normal flows, except the special table miss and ARP flows whose MSB is 1.
-	flowmod.SetCookieMask(0x1 << 63)
-	flowmod.SetTableID(0xFF) // ALL
-	flowmod.SetFlowMatch(match)
-	flowmod.SetOutPort(port)
-	if err := r.session.Write(flowmod); err != nil {
+	if err := r.sendFlowDelete(owner, match, port); err != nil {
 		return err
 	}
 	r.flowCache.RemoveAll()
+	if owner != anyFlowOwner {
+		r.flows.removeIf(func(f *desiredFlow) bool { return f.owner == owner })
+		// The groups can be shared by the flows of other owners.
+		return nil
+	}
+	r.flows.removeAll()
 
-	return nil
+	// Remove the groups that were referenced by the removed flows.
+	return r.removeGroups()
 }
 
 // TODO:
 // Remove the flow caches that match the removed flows. This is not a critical
 // issue, but same flows cannot be installed until the caches are expired.
 func (r *Device) RemoveFlow(match openflow.Match, port openflow.OutPort) error {
+	return r.removeFlow(anyFlowOwner, match, port)
+}
+
+// RemoveOwnedFlow is same as RemoveFlow except that it only removes the flows owned by owner.
+func (r *Device) RemoveOwnedFlow(owner FlowOwner, match openflow.Match, port openflow.OutPort) error {
+	return r.removeFlow(owner, match, port)
+}
+
+func (r *Device) removeFlow(owner FlowOwner, match openflow.Match, port openflow.OutPort) error {
 	// Write lock
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -384,23 +672,30 @@ func (r *Device) RemoveFlow(match openflow.Match, port openflow.OutPort) error {
 	// Default VLAN ID specified for the normal flows.
 	match.SetVLANID(r.vlanID)
 
-	flowmod, err := r.factory.NewFlowMod(openflow.FlowDelete)
-	if err != nil {
+	if err := r.sendFlowDelete(owner, match, port); err != nil {
 		return err
 	}
-	// Remove all the normal flows, except the table miss and ARP flows whose MSB is 1.
-	flowmod.SetCookieMask(0x1 << 63)
-	flowmod.SetTableID(0xFF) // ALL
-	flowmod.SetFlowMatch(match)
-	flowmod.SetOutPort(port)
+	// Forget the desired flows that have been removed by the flowmod.
+	r.flows.removeIf(func(f *desiredFlow) bool {
+		return owner.covers(f.owner) && matchDstMAC(f.match, match) && outputTo(f.target, port)
+	})
 
-	return r.session.Write(flowmod)
+	return nil
 }
 
 // TODO:
 // Remove the flow caches that match the removed flows. This is not a critical
 // issue, but same flows cannot be installed until the caches are expired.
 func (r *Device) RemoveFlowByMAC(mac net.HardwareAddr) error {
+	return r.removeFlowByMAC(anyFlowOwner, mac)
+}
+
+// RemoveOwnedFlowByMAC is same as RemoveFlowByMAC except that it only removes the flows owned by owner.
+func (r *Device) RemoveOwnedFlowByMAC(owner FlowOwner, mac net.HardwareAddr) error {
+	return r.removeFlowByMAC(owner, mac)
+}
+
+func (r *Device) removeFlowByMAC(owner FlowOwner, mac net.HardwareAddr) error {
 	// Write lock
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -420,12 +715,28 @@ func (r *Device) RemoveFlowByMAC(mac net.HardwareAddr) error {
 	port := openflow.NewOutPort()
 	port.SetNone()
 
+	if err := r.sendFlowDelete(owner, match, port); err != nil {
+		return err
+	}
+	// Forget the desired flows that have been removed by the flowmod.
+	r.flows.removeIf(func(f *desiredFlow) bool {
+		return owner.covers(f.owner) && matchDstMAC(f.match, match)
+	})
+
+	return nil
+}
+
+// XXX: Caller should lock the mutex.
+func (r *Device) sendFlowDelete(owner FlowOwner, match openflow.Match, port openflow.OutPort) error {
 	flowmod, err := r.factory.NewFlowMod(openflow.FlowDelete)
 	if err != nil {
 		return err
 	}
-	// Remove all the normal flows, except the table miss and ARP flows whose MSB is 1.
-	flowmod.SetCookieMask(0x1 << 63)
+	// Remove the normal flows in the cookie namespace of the owner. The special
+	// table miss and ARP flows whose MSB is 1 are never removed.
+	cookie, mask := owner.cookie()
+	flowmod.SetCookie(cookie)
+	flowmod.SetCookieMask(mask)
 	flowmod.SetTableID(0xFF) // ALL
 	flowmod.SetFlowMatch(match)
 	flowmod.SetOutPort(port)
@@ -433,6 +744,59 @@ func (r *Device) RemoveFlowByMAC(mac net.HardwareAddr) error {
 	return r.session.Write(flowmod)
 }
 
+// matchDstMAC returns whether the destination MAC address of flow is covered by
+// that of match, which is used to remove the flows.
+func matchDstMAC(flow, match openflow.Match) bool {
+	wildcard, mac := match.DstMAC()
+	if wildcard {
+		return true
+	}
+	wildcard, dst := flow.DstMAC()
+
+	return !wildcard && bytes.Equal(dst, mac)
+}
+
+// outputTo returns whether target is the output port that is covered by port,
+// which is used to remove the flows.
+func outputTo(target interface{}, port openflow.OutPort) bool {
+	if port.IsNone() {
+		return true
+	}
+	p, ok := target.(openflow.OutPort)
+
+	return ok && p.Value() == port.Value()
+}
+
+// OwnedFlowDstMACs returns the destination MAC addresses of the normal flows owned by
+// owner that should be installed in this device. The flows removed by the idle timeout
+// are forgotten by the flow reconciliation.
+func (r *Device) OwnedFlowDstMACs(owner FlowOwner) map[string]bool {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make(map[string]bool)
+	for _, v := range r.flows.flows {
+		if v.owner != owner {
+			continue
+		}
+		if wildcard, mac := v.match.DstMAC(); !wildcard {
+			result[mac.String()] = true
+		}
+	}
+
+	return result
+}
+
+// removeDesiredFlow forgets the desired flow for cookie that has been removed from this device.
+func (r *Device) removeDesiredFlow(cookie uint64) {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.flows.remove(cookie)
+}
+
 // NullMAC is a random local MAC address, which does not belong to any host, to disconnect a host from the network.
 var NullMAC = net.HardwareAddr([]byte{0x06, 0xff, 0x01, 0x21, 0x09, 0x03})
 
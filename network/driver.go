@@ -0,0 +1,299 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/superkkt/cherry/openflow"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// TableMissStrategy decides how the table-miss flows are installed into a switch.
+type TableMissStrategy string
+
+const (
+	// TableMissController chains the tables of the pipeline in order, and then sends
+	// the unmatched packets on the last table to the controller.
+	TableMissController TableMissStrategy = "controller"
+	// TableMissNone does not install any table-miss flow. This is useful for the switches
+	// that already have their own table-miss flows, or reject them.
+	TableMissNone TableMissStrategy = "none"
+)
+
+// Match fields that can be declared in DriverProfile.Matches.
+const (
+	MatchInPort       = "in_port"
+	MatchSrcMAC       = "eth_src"
+	MatchDstMAC       = "eth_dst"
+	MatchEtherType    = "eth_type"
+	MatchVLANID       = "vlan_vid"
+	MatchVLANPriority = "vlan_pcp"
+	MatchIPProtocol   = "ip_proto"
+	MatchSrcIP        = "ipv4_src"
+	MatchDstIP        = "ipv4_dst"
+	MatchSrcPort      = "tp_src"
+	MatchDstPort      = "tp_dst"
+)
+
+// DriverProfile describes the quirks of a switch model that is identified by the
+// regular expressions matched against its DESC_REPLY. An empty expression matches
+// anything.
+type DriverProfile struct {
+	Name         string `yaml:"name"`
+	Manufacturer string `yaml:"manufacturer"`
+	Hardware     string `yaml:"hardware"`
+	Software     string `yaml:"software"`
+	// Tables is the pipeline of OpenFlow 1.3 switches. The normal flows are installed
+	// on the last table. The default is Table-0 only.
+	Tables    []uint8           `yaml:"tables"`
+	TableMiss TableMissStrategy `yaml:"table_miss"`
+	// Matches is the list of match fields supported by the switch. Empty means that all
+	// the fields are supported. Flows that use unsupported fields are rejected.
+	Matches []string `yaml:"matches"`
+	// NoBarrier is true if we should not send a barrier request after installing a flow.
+	NoBarrier bool `yaml:"no_barrier"`
+	// ACL is true if the table right before the normal flow table is dedicated to the ACL
+	// flows, which requires three or more tables not to share the first table with the access
+	// VLAN flows. The allow ACL flows are not installed on a switch without the dedicated table.
+	ACL bool `yaml:"acl"`
+
+	manufacturer, hardware, software *regexp.Regexp
+}
+
+func (r *DriverProfile) compile() (err error) {
+	if r.manufacturer, err = regexp.Compile(r.Manufacturer); err != nil {
+		return errors.Wrap(err, "invalid manufacturer regex")
+	}
+	if r.hardware, err = regexp.Compile(r.Hardware); err != nil {
+		return errors.Wrap(err, "invalid hardware regex")
+	}
+	if r.software, err = regexp.Compile(r.Software); err != nil {
+		return errors.Wrap(err, "invalid software regex")
+	}
+
+	if len(r.Tables) == 0 {
+		r.Tables = []uint8{0}
+	}
+	// The first table is used to tag the untagged frames from the access ports before the
+	// ACL flows, which match the frames tagged with the service VLAN ID.
+	if r.ACL && len(r.Tables) < 3 {
+		return errors.New("ACL table requires three or more tables")
+	}
+	switch r.TableMiss {
+	case "":
+		r.TableMiss = TableMissController
+	case TableMissController, TableMissNone:
+	default:
+		return fmt.Errorf("unknown table-miss strategy: %v", r.TableMiss)
+	}
+	for _, v := range r.Matches {
+		if !isKnownMatchField(v) {
+			return fmt.Errorf("unknown match field: %v", v)
+		}
+	}
+
+	return nil
+}
+
+func (r *DriverProfile) match(d Descriptions) bool {
+	return r.manufacturer.MatchString(d.Manufacturer) && r.hardware.MatchString(d.Hardware) && r.software.MatchString(d.Software)
+}
+
+// FlowTableID returns the table ID that the normal flows are installed on.
+func (r *DriverProfile) FlowTableID() uint8 {
+	return r.Tables[len(r.Tables)-1]
+}
+
+// checkMatch returns an error if match uses the fields that are not supported by the switch.
+func (r *DriverProfile) checkMatch(match openflow.Match) error {
+	if len(r.Matches) == 0 {
+		return nil
+	}
+
+	supported := make(map[string]bool)
+	for _, v := range r.Matches {
+		supported[v] = true
+	}
+	for _, v := range matchFields(match) {
+		if !supported[v] {
+			return fmt.Errorf("unsupported match field for %v: %v", r.Name, v)
+		}
+	}
+
+	return nil
+}
+
+func isKnownMatchField(field string) bool {
+	switch field {
+	case MatchInPort, MatchSrcMAC, MatchDstMAC, MatchEtherType, MatchVLANID, MatchVLANPriority,
+		MatchIPProtocol, MatchSrcIP, MatchDstIP, MatchSrcPort, MatchDstPort:
+		return true
+	default:
+		return false
+	}
+}
+
+// matchFields returns the non-wildcard fields of match.
+func matchFields(match openflow.Match) []string {
+	result := make([]string, 0)
+	add := func(wildcard bool, field string) {
+		if !wildcard {
+			result = append(result, field)
+		}
+	}
+
+	wildcard, _ := match.InPort()
+	add(wildcard, MatchInPort)
+	wildcard, _ = match.SrcMAC()
+	add(wildcard, MatchSrcMAC)
+	wildcard, _ = match.DstMAC()
+	add(wildcard, MatchDstMAC)
+	wildcard, _ = match.EtherType()
+	add(wildcard, MatchEtherType)
+	wildcard, _ = match.VLANID()
+	add(wildcard, MatchVLANID)
+	wildcard, _ = match.VLANPriority()
+	add(wildcard, MatchVLANPriority)
+	wildcard, _ = match.IPProtocol()
+	add(wildcard, MatchIPProtocol)
+	add(match.SrcIP() == nil, MatchSrcIP)
+	add(match.DstIP() == nil, MatchDstIP)
+	wildcard, _ = match.SrcPort()
+	add(wildcard, MatchSrcPort)
+	wildcard, _ = match.DstPort()
+	add(wildcard, MatchDstPort)
+
+	return result
+}
+
+type driverRegistry struct {
+	mutex    sync.RWMutex
+	profiles []*DriverProfile
+}
+
+var (
+	drivers = &driverRegistry{}
+	// defaultDriver is used for the switches that do not match any registered profile.
+	defaultDriver = mustCompileDriver(DriverProfile{Name: "default"})
+)
+
+func init() {
+	// Built-in profiles.
+	builtins := []DriverProfile{
+		{
+			Name:         "HP 2920-24G",
+			Manufacturer: "^HP",
+			Hardware:     "^2920-24G",
+			// Table-100 is a hardware table, and Table-200 is a software table
+			// that has very low performance.
+			Tables:    []uint8{0, 100, 200},
+			TableMiss: TableMissController,
+		},
+		{
+			Name:     "AS4600-54T",
+			Hardware: "AS4600-54T",
+			// FIXME:
+			// AS460054-T gives an error (type=5, code=1) that means TABLE_FULL
+			// when we install a table-miss flow on Table-0 after we delete all
+			// flows already installed from the switch. Is this a bug of this switch??
+			TableMiss: TableMissNone,
+		},
+	}
+	for _, v := range builtins {
+		if err := RegisterDriverProfile(v); err != nil {
+			panic(fmt.Sprintf("invalid built-in driver profile: %v", err))
+		}
+	}
+}
+
+func mustCompileDriver(p DriverProfile) *DriverProfile {
+	if err := p.compile(); err != nil {
+		panic(err)
+	}
+
+	return &p
+}
+
+// RegisterDriverProfile adds a new driver profile. Profiles registered later take
+// precedence over the earlier ones, so that the built-in profiles can be overridden.
+func RegisterDriverProfile(p DriverProfile) error {
+	if len(strings.TrimSpace(p.Name)) == 0 {
+		return errors.New("empty driver profile name")
+	}
+	if err := p.compile(); err != nil {
+		return errors.Wrapf(err, "driver profile %v", p.Name)
+	}
+
+	// Write lock
+	drivers.mutex.Lock()
+	defer drivers.mutex.Unlock()
+
+	drivers.profiles = append([]*DriverProfile{&p}, drivers.profiles...)
+
+	return nil
+}
+
+// LoadDriverProfiles registers the driver profiles in the YAML file, which has a list of
+// profiles under the profiles key.
+func LoadDriverProfiles(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	v := struct {
+		Profiles []DriverProfile `yaml:"profiles"`
+	}{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return errors.Wrap(err, "failed to parse the driver profiles")
+	}
+	for _, p := range v.Profiles {
+		if err := RegisterDriverProfile(p); err != nil {
+			return err
+		}
+		logger.Infof("loaded a driver profile: %v", p.Name)
+	}
+
+	return nil
+}
+
+// findDriverProfile returns the first profile that matches d, or the default profile.
+func findDriverProfile(d Descriptions) *DriverProfile {
+	// Read lock
+	drivers.mutex.RLock()
+	defer drivers.mutex.RUnlock()
+
+	for _, p := range drivers.profiles {
+		if p.match(d) {
+			return p
+		}
+	}
+
+	return defaultDriver
+}
@@ -0,0 +1,77 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015-2019 Samjung Data Service, Inc. All rights reserved.
+ *  Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"testing"
+)
+
+func TestFindDriverProfile(t *testing.T) {
+	src := []struct {
+		Descriptions Descriptions
+		Expected     string
+		FlowTableID  uint8
+	}{
+		{
+			Descriptions: Descriptions{Manufacturer: "HP", Hardware: "2920-24G Switch", Software: "WB.16.04"},
+			Expected:     "HP 2920-24G",
+			FlowTableID:  200,
+		},
+		{
+			Descriptions: Descriptions{Manufacturer: "Accton", Hardware: "AS4600-54T"},
+			Expected:     "AS4600-54T",
+			FlowTableID:  0,
+		},
+		{
+			Descriptions: Descriptions{Manufacturer: "Nicira, Inc.", Hardware: "Open vSwitch"},
+			Expected:     "default",
+			FlowTableID:  0,
+		},
+	}
+
+	for _, v := range src {
+		p := findDriverProfile(v.Descriptions)
+		if p.Name != v.Expected {
+			t.Fatalf("unexpected driver profile for %+v: expected=%v, got=%v", v.Descriptions, v.Expected, p.Name)
+		}
+		if p.FlowTableID() != v.FlowTableID {
+			t.Fatalf("unexpected flow table ID for %v: expected=%v, got=%v", p.Name, v.FlowTableID, p.FlowTableID())
+		}
+	}
+}
+
+func TestInvalidDriverProfile(t *testing.T) {
+	src := []DriverProfile{
+		{Name: ""},
+		{Name: "invalid regex", Hardware: "("},
+		{Name: "invalid table miss", TableMiss: "drop"},
+		{Name: "invalid match", Matches: []string{"mpls_label"}},
+		// The ACL table cannot be the first table that has the access VLAN flows.
+		{Name: "too few tables for ACL", Tables: []uint8{0, 1}, ACL: true},
+	}
+
+	for _, v := range src {
+		if err := RegisterDriverProfile(v); err == nil {
+			t.Fatalf("expected error for %+v, but got nil", v)
+		}
+	}
+}
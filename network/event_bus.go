@@ -0,0 +1,254 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of the recent events kept in the event bus to resume the subscriptions.
+	eventHistorySize = 4096
+	// Number of the pending events of a subscriber. The subscriber that cannot keep
+	// up with the events is dropped, and it should resume its subscription.
+	eventQueueSize = 256
+)
+
+var (
+	// ErrEventExpired is returned when the events requested to resume a subscription
+	// are no longer available in the event bus.
+	ErrEventExpired = errors.New("requested events are expired")
+)
+
+type EventType string
+
+const (
+	EventDeviceUp          EventType = "device_up"
+	EventDeviceDown        EventType = "device_down"
+	EventPortUp            EventType = "port_up"
+	EventPortDown          EventType = "port_down"
+	EventTopologyChange    EventType = "topology_change"
+	EventHostMoved         EventType = "host_moved"
+	EventVIPToggled        EventType = "vip_toggled"
+	EventPacketInPoliced   EventType = "packet_in_policed"
+	EventSwitchRejected    EventType = "switch_rejected"
+	EventSwitchQuarantined EventType = "switch_quarantined"
+	EventSwitchAdmitted    EventType = "switch_admitted"
+)
+
+type Event struct {
+	// Sequence number of the event, which is increased monotonically from 1.
+	Seq       uint64      `json:"seq"`
+	Timestamp time.Time   `json:"timestamp"`
+	Type      EventType   `json:"type"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// DeviceEvent is the data of EventDeviceUp and EventDeviceDown.
+type DeviceEvent struct {
+	DeviceID string `json:"device_id"`
+}
+
+// PortEvent is the data of EventPortUp and EventPortDown.
+type PortEvent struct {
+	DeviceID string `json:"device_id"`
+	Port     uint32 `json:"port"`
+}
+
+// HostMoveEvent is the data of EventHostMoved. PrevDeviceID is empty if the previous
+// location of the host is unknown.
+type HostMoveEvent struct {
+	MAC          string `json:"mac"`
+	DeviceID     string `json:"device_id"`
+	Port         uint32 `json:"port"`
+	PrevDeviceID string `json:"prev_device_id,omitempty"`
+	PrevPort     uint32 `json:"prev_port,omitempty"`
+}
+
+// PolicerEvent is the data of EventPacketInPoliced. Port is zero if the device has
+// exceeded its budget, and Blocked is true if the port is blocked by a drop flow.
+type PolicerEvent struct {
+	DeviceID string `json:"device_id"`
+	Port     uint32 `json:"port,omitempty"`
+	Blocked  bool   `json:"blocked"`
+}
+
+// AdmissionEvent is the data of EventSwitchRejected, EventSwitchQuarantined and
+// EventSwitchAdmitted. EventSwitchAdmitted is raised only for the quarantined switches.
+type AdmissionEvent struct {
+	DeviceID string `json:"device_id"`
+	Address  string `json:"address"`
+}
+
+// VIPEvent is the data of EventVIPToggled.
+type VIPEvent struct {
+	IP  string `json:"ip"`
+	MAC string `json:"mac"`
+}
+
+// EventPublisher publishes the network events to the subscribers.
+type EventPublisher interface {
+	Publish(t EventType, data interface{})
+}
+
+// EventBus delivers the published events to all of its subscribers.
+type EventBus struct {
+	mutex   sync.Mutex
+	lastSeq uint64
+	// Ring buffer of the recent events.
+	history     []Event
+	subscribers map[*Subscription]struct{}
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		history:     make([]Event, 0, eventHistorySize),
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish implements EventPublisher. It never blocks even if a subscriber is slow.
+func (r *EventBus) Publish(t EventType, data interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.lastSeq++
+	e := Event{Seq: r.lastSeq, Timestamp: time.Now(), Type: t, Data: data}
+	if len(r.history) < eventHistorySize {
+		r.history = append(r.history, e)
+	} else {
+		r.history[(e.Seq-1)%eventHistorySize] = e
+	}
+
+	for s := range r.subscribers {
+		select {
+		case s.c <- e:
+		default:
+			logger.Warningf("dropping a slow event subscriber: lastSeq=%v", e.Seq-1)
+			r.unsubscribe(s)
+		}
+	}
+}
+
+// Subscribe returns a new subscription that receives the events published after
+// the event whose sequence number is since, and the events in the history whose
+// sequence numbers are greater than since. Zero since means that only the new
+// events are received. ErrEventExpired is returned if the history does not have
+// all the events after since.
+func (r *EventBus) Subscribe(since uint64) (backlog []Event, sub *Subscription, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if since > r.lastSeq {
+		return nil, nil, errors.New("unknown event sequence number")
+	}
+	if since > 0 {
+		backlog, err = r.eventsAfter(since)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sub = &Subscription{
+		bus: r,
+		c:   make(chan Event, eventQueueSize),
+	}
+	r.subscribers[sub] = struct{}{}
+
+	return backlog, sub, nil
+}
+
+// XXX: Caller should lock the mutex.
+func (r *EventBus) eventsAfter(since uint64) ([]Event, error) {
+	oldest := r.lastSeq - uint64(len(r.history)) + 1
+	if since+1 < oldest {
+		return nil, ErrEventExpired
+	}
+
+	result := make([]Event, 0, r.lastSeq-since)
+	for seq := since + 1; seq <= r.lastSeq; seq++ {
+		result = append(result, r.history[(seq-1)%eventHistorySize])
+	}
+
+	return result, nil
+}
+
+// XXX: Caller should lock the mutex.
+func (r *EventBus) unsubscribe(s *Subscription) {
+	if _, ok := r.subscribers[s]; !ok {
+		return
+	}
+	delete(r.subscribers, s)
+	close(s.c)
+}
+
+type Subscription struct {
+	bus *EventBus
+	c   chan Event
+}
+
+// Events returns the channel that receives the events. The channel is closed when
+// the subscription is closed or dropped due to the overflow of the pending events.
+func (r *Subscription) Events() <-chan Event {
+	return r.c
+}
+
+func (r *Subscription) Close() {
+	r.bus.mutex.Lock()
+	defer r.bus.mutex.Unlock()
+
+	r.bus.unsubscribe(r)
+}
+
+// eventPublisher publishes the network events raised by the switches and the
+// topology before delivering them to the event listener.
+type eventPublisher struct {
+	EventListener
+	publisher EventPublisher
+}
+
+func (r *eventPublisher) OnPortUp(finder Finder, port *Port) error {
+	r.publisher.Publish(EventPortUp, PortEvent{DeviceID: port.Device().ID(), Port: port.Number()})
+	return r.EventListener.OnPortUp(finder, port)
+}
+
+func (r *eventPublisher) OnPortDown(finder Finder, port *Port) error {
+	r.publisher.Publish(EventPortDown, PortEvent{DeviceID: port.Device().ID(), Port: port.Number()})
+	return r.EventListener.OnPortDown(finder, port)
+}
+
+func (r *eventPublisher) OnDeviceUp(finder Finder, device *Device) error {
+	r.publisher.Publish(EventDeviceUp, DeviceEvent{DeviceID: device.ID()})
+	return r.EventListener.OnDeviceUp(finder, device)
+}
+
+func (r *eventPublisher) OnDeviceDown(finder Finder, device *Device) error {
+	r.publisher.Publish(EventDeviceDown, DeviceEvent{DeviceID: device.ID()})
+	return r.EventListener.OnDeviceDown(finder, device)
+}
+
+func (r *eventPublisher) OnTopologyChange(finder Finder) error {
+	r.publisher.Publish(EventTopologyChange, nil)
+	return r.EventListener.OnTopologyChange(finder)
+}
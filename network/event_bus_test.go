@@ -0,0 +1,85 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"testing"
+)
+
+func TestEventBusResume(t *testing.T) {
+	bus := NewEventBus()
+
+	_, sub, err := bus.Subscribe(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		bus.Publish(EventPortUp, PortEvent{DeviceID: "1", Port: uint32(i)})
+	}
+	for i := 1; i <= 3; i++ {
+		v := <-sub.Events()
+		if v.Seq != uint64(i) || v.Type != EventPortUp {
+			t.Fatalf("unexpected event: expected seq=%v, got=%+v", i, v)
+		}
+	}
+	sub.Close()
+	if _, ok := <-sub.Events(); ok {
+		t.Fatalf("expected closed subscription")
+	}
+
+	backlog, sub, err := bus.Subscribe(1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sub.Close()
+	if len(backlog) != 2 || backlog[0].Seq != 2 || backlog[1].Seq != 3 {
+		t.Fatalf("unexpected backlog: %+v", backlog)
+	}
+	if _, _, err := bus.Subscribe(4); err == nil {
+		t.Fatalf("expected error for the unknown sequence number")
+	}
+
+	// Overflow the history.
+	for i := 0; i < eventHistorySize; i++ {
+		bus.Publish(EventTopologyChange, nil)
+	}
+	if _, _, err := bus.Subscribe(1); err != ErrEventExpired {
+		t.Fatalf("expected ErrEventExpired, got=%v", err)
+	}
+	backlog, s, err := bus.Subscribe(3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.Close()
+	if len(backlog) != eventHistorySize || backlog[0].Seq != 4 || backlog[len(backlog)-1].Seq != eventHistorySize+3 {
+		t.Fatalf("unexpected backlog: len=%v, first=%v", len(backlog), backlog[0].Seq)
+	}
+
+	// The slow subscriber should have been dropped.
+	n := 0
+	for range sub.Events() {
+		n++
+	}
+	if n != eventQueueSize {
+		t.Fatalf("unexpected number of the pending events: expected=%v, got=%v", eventQueueSize, n)
+	}
+}
@@ -47,31 +47,38 @@ func newFlowCache(expiration time.Duration) *flowCache {
 	}
 }
 
-func (r *flowCache) Add(match openflow.Match, port openflow.OutPort) error {
-	key, err := r.key(match, port)
+type flowCacheEntry struct {
+	target    string
+	timestamp time.Time
+}
+
+func (r *flowCache) Add(match openflow.Match, target interface{}) error {
+	key, err := r.key(match)
 	if err != nil {
 		return err
 	}
 
-	t := time.Now()
-	// Update if the key already exists.
-	r.cache.Add(key, t)
-	logger.Debugf("added a new flow cache: key=%v, timestamp=%v", key, t)
+	v := flowCacheEntry{target: fmt.Sprintf("%T/%v", target, target), timestamp: time.Now()}
+	// Update if the key already exists. A flow for the same match but different target replaces the previous one.
+	r.cache.Add(key, v)
+	logger.Debugf("added a new flow cache: key=%v, target=%v, timestamp=%v", key, v.target, v.timestamp)
 
 	return nil
 }
 
-func (r *flowCache) key(match openflow.Match, port openflow.OutPort) (string, error) {
+func (r *flowCache) key(match openflow.Match) (string, error) {
 	m, err := match.MarshalBinary()
 	if err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("%v/%v", m, port), nil
+	return fmt.Sprintf("%v", m), nil
 }
 
-func (r *flowCache) InProgress(match openflow.Match, port openflow.OutPort) (ok bool, err error) {
-	key, err := r.key(match, port)
+// InProgress returns whether a flow for match has been recently installed. target is
+// the forwarding target of the flow, which is either an output port or a group ID.
+func (r *flowCache) InProgress(match openflow.Match, target interface{}) (ok bool, err error) {
+	key, err := r.key(match)
 	if err != nil {
 		return false, err
 	}
@@ -80,10 +87,14 @@ func (r *flowCache) InProgress(match openflow.Match, port openflow.OutPort) (ok
 	if !ok {
 		return false, nil
 	}
-	timestamp := v.(time.Time)
+	entry := v.(flowCacheEntry)
+	// Different target?
+	if entry.target != fmt.Sprintf("%T/%v", target, target) {
+		return false, nil
+	}
 
 	// Timeout?
-	if time.Since(timestamp) > r.expiration {
+	if time.Since(entry.timestamp) > r.expiration {
 		r.cache.Remove(key)
 		logger.Debugf("removed the timed-out flow cache: key=%v", key)
 		return false, nil
@@ -0,0 +1,70 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+// FlowOwner identifies an application that owns normal flows. Each owner has its own
+// cookie namespace, so that an owner can remove its flows without affecting the
+// flows of other owners.
+//
+// Cookie layout of the flows:
+//
+//	bit 63: 1 for the special flows such as table-miss and ARP flows, 0 for the normal flows.
+//	bit 48-62: owner of the normal flow.
+//	bit 0-47: sequence number of the normal flow.
+type FlowOwner uint16
+
+const (
+	// NoFlowOwner owns the flows that are installed without an explicit owner.
+	NoFlowOwner FlowOwner = 0
+	// MaxFlowOwner is the maximum value of the flow owner.
+	MaxFlowOwner FlowOwner = 0x7FFF
+	// anyFlowOwner represents all the owners of the normal flows.
+	anyFlowOwner FlowOwner = 0xFFFF
+
+	flowOwnerShift        = 48
+	flowOwnerMask  uint64 = uint64(MaxFlowOwner) << flowOwnerShift
+	flowSeqMask    uint64 = 0x1<<flowOwnerShift - 1
+)
+
+// CookieOwner returns the owner of the normal flow whose cookie is cookie. ok is
+// false if the cookie belongs to a special flow.
+func CookieOwner(cookie uint64) (owner FlowOwner, ok bool) {
+	if cookie&(0x1<<63) != 0 {
+		return 0, false
+	}
+
+	return FlowOwner((cookie & flowOwnerMask) >> flowOwnerShift), true
+}
+
+// cookie returns the cookie and its mask that select all the normal flows of this owner.
+func (r FlowOwner) cookie() (cookie, mask uint64) {
+	if r == anyFlowOwner {
+		return 0, 0x1 << 63
+	}
+
+	return uint64(r) << flowOwnerShift, 0x1<<63 | flowOwnerMask
+}
+
+// covers returns whether the flows of owner are included in the namespace of this owner.
+func (r FlowOwner) covers(owner FlowOwner) bool {
+	return r == anyFlowOwner || r == owner
+}
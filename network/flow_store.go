@@ -0,0 +1,469 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/superkkt/cherry/openflow"
+)
+
+const (
+	normalFlowPriority    = 10
+	normalFlowIdleTimeout = 90 // Seconds.
+)
+
+// desiredFlow is a normal flow entry that should be installed in a switch device.
+type desiredFlow struct {
+	owner     FlowOwner
+	cookie    uint64
+	key       string
+	match     openflow.Match
+	action    openflow.Action
+	target    interface{}
+	installed time.Time
+	// Last time when the packet counter of this flow has been increased.
+	lastUsed time.Time
+	packets  uint64
+}
+
+// FlowDrift is the difference between the desired flows and the flows actually
+// installed in a switch device, which has been found by the last reconciliation.
+type FlowDrift struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Number of the desired flows that were missing in the device and then reinstalled.
+	Missing int `json:"missing"`
+	// Number of the unknown normal flows that were removed from the device.
+	Stray int `json:"stray"`
+}
+
+// flowStore is the authoritative set of the normal flows that should be installed
+// in a switch device. Each flow is identified by its cookie whose MSB is always 0,
+// which consists of the owner and sequence number of the flow.
+//
+// XXX: flowStore is not thread-safe. Caller should lock the mutex of the device.
+type flowStore struct {
+	lastSeq uint64
+	flows   map[uint64]*desiredFlow // Key = cookie.
+	index   map[string]uint64       // Key = marshaled match, Value = cookie.
+	// Cookies of the flows that have been replaced by new flows for the same match.
+	replaced map[uint64]time.Time
+	// Flow stats that are being collected from the device.
+	dump        []openflow.FlowStats
+	dumpStarted time.Time
+	drift       FlowDrift
+	// True if the flows installed before connecting to the device should be adopted
+	// into the store by the next reconciliation, instead of being removed as strays.
+	adopting bool
+	// Cookies of the adopted flows that have not been taken by their owners yet.
+	adopted []uint64
+}
+
+// AdoptedFlow is a normal flow that has been installed by the previous controller instance
+// and then adopted into the flow store.
+type AdoptedFlow struct {
+	DstMAC  net.HardwareAddr
+	OutPort uint32
+}
+
+func newFlowStore(adopting bool) *flowStore {
+	return &flowStore{
+		// Start the sequence from the current time not to reuse the cookies of the flows
+		// installed by the previous controller instance, which may be adopted later.
+		lastSeq:  uint64(time.Now().Unix()) << 16 & flowSeqMask,
+		flows:    make(map[uint64]*desiredFlow),
+		index:    make(map[string]uint64),
+		replaced: make(map[uint64]time.Time),
+		adopting: adopting,
+	}
+}
+
+func (r *flowStore) newCookie(owner FlowOwner) uint64 {
+	r.lastSeq = (r.lastSeq + 1) & flowSeqMask
+	if r.lastSeq == 0 {
+		r.lastSeq = 1
+	}
+	cookie, _ := owner.cookie()
+
+	return cookie | r.lastSeq
+}
+
+// add adds a new desired flow that replaces the previous flow for the same match.
+func (r *flowStore) add(owner FlowOwner, match openflow.Match, action openflow.Action, target interface{}) (*desiredFlow, error) {
+	m, err := match.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%v", m)
+
+	now := time.Now()
+	if cookie, ok := r.index[key]; ok {
+		r.remove(cookie)
+		// The switch replaces the previous flow, so that it should not be treated as a stray flow.
+		r.replaced[cookie] = now
+	}
+
+	v := &desiredFlow{
+		owner:     owner,
+		cookie:    r.newCookie(owner),
+		key:       key,
+		match:     match,
+		action:    action,
+		target:    target,
+		installed: now,
+		lastUsed:  now,
+	}
+	r.flows[v.cookie] = v
+	r.index[key] = v.cookie
+
+	return v, nil
+}
+
+func (r *flowStore) remove(cookie uint64) {
+	v, ok := r.flows[cookie]
+	if !ok {
+		return
+	}
+	delete(r.flows, cookie)
+	if r.index[v.key] == cookie {
+		delete(r.index, v.key)
+	}
+}
+
+func (r *flowStore) removeAll() {
+	r.flows = make(map[uint64]*desiredFlow)
+	r.index = make(map[string]uint64)
+}
+
+// removeIf removes the desired flows for which fn returns true.
+func (r *flowStore) removeIf(fn func(*desiredFlow) bool) {
+	for cookie, v := range r.flows {
+		if fn(v) {
+			r.remove(cookie)
+		}
+	}
+}
+
+// groups returns the IDs of the groups referenced by the desired flows.
+func (r *flowStore) groups() map[uint32]bool {
+	used := make(map[uint32]bool)
+	for _, v := range r.flows {
+		if id, ok := v.target.(uint32); ok {
+			used[id] = true
+		}
+	}
+
+	return used
+}
+
+// startDump prepares to collect the flow stats from the device. The flow stats
+// collected previously are discarded if they have not been completed yet.
+func (r *flowStore) startDump(now time.Time) {
+	r.dump = nil
+	r.dumpStarted = now
+}
+
+func (r *flowStore) appendDump(flows []openflow.FlowStats) {
+	r.dump = append(r.dump, flows...)
+}
+
+// adopt adds the flow installed by the previous controller instance into the store.
+func (r *flowStore) adopt(v openflow.FlowStats, now time.Time) error {
+	owner, ok := CookieOwner(v.Cookie)
+	if !ok {
+		return fmt.Errorf("special flow cannot be adopted: cookie=%v", v.Cookie)
+	}
+	// Zero sequence number is never used by us.
+	if v.Cookie&flowSeqMask == 0 {
+		return fmt.Errorf("flow without our cookie cannot be adopted: cookie=%v", v.Cookie)
+	}
+	m, err := v.Match.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	flow := &desiredFlow{
+		owner:     owner,
+		cookie:    v.Cookie,
+		key:       fmt.Sprintf("%v", m),
+		match:     v.Match,
+		action:    v.Action,
+		target:    v.Action.OutPort(),
+		installed: now,
+		lastUsed:  now,
+		packets:   v.PacketCount,
+	}
+	// Don't replace the flow that has been installed by us after connecting to the device.
+	if _, ok := r.index[flow.key]; ok {
+		return fmt.Errorf("flow for the same match already exists: cookie=%v", v.Cookie)
+	}
+	r.flows[flow.cookie] = flow
+	r.index[flow.key] = flow.cookie
+	r.adopted = append(r.adopted, flow.cookie)
+	// Make sure that the new cookies do not collide with the adopted one.
+	if seq := v.Cookie & flowSeqMask; seq > r.lastSeq {
+		r.lastSeq = seq
+	}
+
+	return nil
+}
+
+// takeAdopted returns the adopted flows owned by owner that are still desired, and then
+// forgets them so that they are taken only once.
+func (r *flowStore) takeAdopted(owner FlowOwner) []AdoptedFlow {
+	var result []AdoptedFlow
+	remaining := r.adopted[:0]
+	for _, cookie := range r.adopted {
+		flow, ok := r.flows[cookie]
+		// Removed or replaced?
+		if !ok {
+			continue
+		}
+		if flow.owner != owner {
+			remaining = append(remaining, cookie)
+			continue
+		}
+		wildcard, mac := flow.match.DstMAC()
+		port, ok := flow.target.(openflow.OutPort)
+		if wildcard || !ok {
+			continue
+		}
+		result = append(result, AdoptedFlow{DstMAC: mac, OutPort: port.Value()})
+	}
+	r.adopted = remaining
+
+	return result
+}
+
+// reconcile compares the desired flows with the collected flow stats, and then
+// returns the desired flows missing in the device and the stray flows that are
+// installed in the device but not desired. If the store is adopting the flows,
+// the stray flows for which valid returns true are adopted into the store instead.
+func (r *flowStore) reconcile(now time.Time, valid func(openflow.FlowStats) bool) (missing []*desiredFlow, stray []openflow.FlowStats) {
+	found := make(map[uint64]bool)
+	for _, v := range r.dump {
+		// Skip the special flows.
+		if v.Cookie&(0x1<<63) != 0 || v.Priority != normalFlowPriority {
+			continue
+		}
+		flow, ok := r.flows[v.Cookie]
+		if !ok {
+			if _, ok := r.replaced[v.Cookie]; ok {
+				continue
+			}
+			if r.adopting && valid(v) {
+				err := r.adopt(v, now)
+				if err == nil {
+					logger.Debugf("adopted a flow installed previously: cookie=%v", v.Cookie)
+					found[v.Cookie] = true
+					continue
+				}
+				logger.Debugf("failed to adopt a flow: %v", err)
+			}
+			stray = append(stray, v)
+			continue
+		}
+		found[v.Cookie] = true
+		// Has the flow been used since the last reconciliation?
+		if v.PacketCount > flow.packets {
+			flow.lastUsed = now
+		}
+		flow.packets = v.PacketCount
+	}
+
+	for cookie, flow := range r.flows {
+		// Skip the flows that have been installed after sending the flow stats request.
+		if found[cookie] || flow.installed.After(r.dumpStarted) {
+			continue
+		}
+		// The idle-timed-out flow should be removed naturally.
+		if now.Sub(flow.lastUsed) > normalFlowIdleTimeout*time.Second {
+			r.remove(cookie)
+			continue
+		}
+		// The flow has been evicted by the device silently.
+		flow.packets = 0
+		missing = append(missing, flow)
+	}
+
+	for cookie, t := range r.replaced {
+		if t.Before(r.dumpStarted) {
+			delete(r.replaced, cookie)
+		}
+	}
+	r.dump = nil
+	r.adopting = false
+	r.drift = FlowDrift{Timestamp: now, Missing: len(missing), Stray: len(stray)}
+
+	return missing, stray
+}
+
+// TakeAdoptedFlows returns the flows owned by owner that have been adopted from the previous
+// controller instance since the last call, so that the owner can manage them as if it has
+// installed them by itself.
+func (r *Device) TakeAdoptedFlows(owner FlowOwner) []AdoptedFlow {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.flows.takeAdopted(owner)
+}
+
+// FlowDrift returns the result of the last reconciliation between the desired flows
+// and the flows actually installed in this device.
+func (r *Device) FlowDrift() FlowDrift {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.flows.drift
+}
+
+// sendFlowStatsRequest requests the normal flows installed in this device to
+// reconcile them with the desired flows.
+func (r *Device) sendFlowStatsRequest() error {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return ErrClosedDevice
+	}
+
+	match, err := r.factory.NewMatch() // Wildcard
+	if err != nil {
+		return err
+	}
+	msg, err := r.factory.NewFlowStatsRequest()
+	if err != nil {
+		return err
+	}
+	// Only the normal flows whose MSB of the cookie is 0. Note that OpenFlow 1.0 does not support the cookie mask.
+	msg.SetCookie(0)
+	msg.SetCookieMask(0x1 << 63)
+	msg.SetTableID(0xFF) // ALL
+	msg.SetMatch(match)
+	r.flows.startDump(time.Now())
+
+	return r.session.Write(msg)
+}
+
+// reconcileFlows collects the flow stats in v, and then reinstalls the missing
+// flows and removes the stray flows after all the flow stats have been collected.
+func (r *Device) reconcileFlows(v openflow.FlowStatsReply) error {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return ErrClosedDevice
+	}
+
+	r.flows.appendDump(v.Flows())
+	// More replies will follow?
+	if v.More() {
+		return nil
+	}
+
+	missing, stray := r.flows.reconcile(time.Now(), r.isValidFlow)
+	if len(missing) > 0 || len(stray) > 0 {
+		logger.Warningf("flow drift on %v: missing=%v, stray=%v", r.id, len(missing), len(stray))
+	}
+
+	for _, flow := range missing {
+		logger.Debugf("reinstalling the missing flow: deviceID=%v, cookie=%v", r.id, flow.cookie)
+		if err := r.writeFlow(flow); err != nil {
+			return err
+		}
+	}
+	for _, flow := range stray {
+		logger.Debugf("removing the stray flow: deviceID=%v, cookie=%v", r.id, flow.Cookie)
+		if err := r.removeStrayFlow(flow); err != nil {
+			return err
+		}
+	}
+
+	// The groups referenced only by the idle-timed-out flows are no longer necessary.
+	return r.removeUnusedGroups()
+}
+
+// isValidFlow returns whether flow, which has been installed by the previous controller
+// instance, is still valid so that it can be adopted.
+// XXX: Caller should lock the mutex.
+func (r *Device) isValidFlow(flow openflow.FlowStats) bool {
+	// The groups have been removed when connecting to the device.
+	if flow.Action == nil {
+		return false
+	}
+	if ok, _ := flow.Action.Group(); ok {
+		return false
+	}
+	// The service VLAN ID may have been changed.
+	wildcard, vlanID := flow.Match.VLANID()
+	if wildcard || vlanID != r.vlanID {
+		return false
+	}
+
+	out := flow.Action.OutPort()
+	if !out.IsPhysical() {
+		return false
+	}
+	port, ok := r.ports[out.Value()]
+	if !ok {
+		return false
+	}
+	if v := port.Value(); v.IsPortDown() || v.IsLinkDown() {
+		return false
+	}
+
+	// The VLAN configuration of the port may have been changed.
+	expected, err := r.newOutputAction(out.Value())
+	if err != nil {
+		return false
+	}
+	ok1, vid1 := expected.VLANID()
+	ok2, vid2 := flow.Action.VLANID()
+
+	return expected.StripVLAN() == flow.Action.StripVLAN() && ok1 == ok2 && vid1 == vid2
+}
+
+// XXX: Caller should lock the mutex.
+func (r *Device) removeStrayFlow(flow openflow.FlowStats) error {
+	port := openflow.NewOutPort()
+	port.SetNone()
+
+	flowmod, err := r.factory.NewFlowMod(openflow.FlowDeleteStrict)
+	if err != nil {
+		return err
+	}
+	// OpenFlow 1.0 ignores the cookie, but the strict match and priority are enough to identify the flow.
+	flowmod.SetCookie(flow.Cookie)
+	flowmod.SetCookieMask(0xFFFFFFFFFFFFFFFF)
+	flowmod.SetTableID(0xFF) // ALL
+	flowmod.SetPriority(flow.Priority)
+	flowmod.SetFlowMatch(flow.Match)
+	flowmod.SetOutPort(port)
+
+	return r.session.Write(flowmod)
+}
@@ -0,0 +1,166 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/openflow/of13"
+)
+
+func newTestFlow(t *testing.T, s *flowStore, mac string) *desiredFlow {
+	addr, err := net.ParseMAC(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := of13.NewMatch()
+	match.SetDstMAC(addr)
+
+	flow, err := s.add(NoFlowOwner, match, nil, uint32(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return flow
+}
+
+func TestFlowStoreReconcile(t *testing.T) {
+	s := newFlowStore(false)
+	present := newTestFlow(t, s, "00:00:00:00:00:01")
+	evicted := newTestFlow(t, s, "00:00:00:00:00:02")
+	expired := newTestFlow(t, s, "00:00:00:00:00:03")
+	old := newTestFlow(t, s, "00:00:00:00:00:04")
+	// Replace the old flow for the same match.
+	replacing := newTestFlow(t, s, "00:00:00:00:00:04")
+	if old.cookie == replacing.cookie {
+		t.Fatalf("replacing flow has the same cookie: %v", old.cookie)
+	}
+
+	now := time.Now()
+	expired.lastUsed = now.Add(-(normalFlowIdleTimeout + 1) * time.Second)
+	s.startDump(now)
+	s.appendDump([]openflow.FlowStats{
+		{Cookie: present.cookie, Priority: normalFlowPriority, PacketCount: 10},
+		{Cookie: replacing.cookie, Priority: normalFlowPriority},
+		// Replaced flow that has not been removed yet.
+		{Cookie: old.cookie, Priority: normalFlowPriority},
+		// Special flow.
+		{Cookie: 0x1 << 63, Priority: 100},
+		// Stray flow.
+		{Cookie: 12345, Priority: normalFlowPriority},
+	})
+
+	missing, stray := s.reconcile(now, func(openflow.FlowStats) bool { return false })
+	if len(missing) != 1 || missing[0] != evicted {
+		t.Fatalf("unexpected missing flows: %+v", missing)
+	}
+	if len(stray) != 1 || stray[0].Cookie != 12345 {
+		t.Fatalf("unexpected stray flows: %+v", stray)
+	}
+	if _, ok := s.flows[expired.cookie]; ok {
+		t.Fatalf("expired flow still exists in the store")
+	}
+	if present.packets != 10 || !present.lastUsed.Equal(now) {
+		t.Fatalf("unexpected packet counter of the present flow: packets=%v, lastUsed=%v", present.packets, present.lastUsed)
+	}
+	if s.drift.Missing != 1 || s.drift.Stray != 1 {
+		t.Fatalf("unexpected flow drift: %+v", s.drift)
+	}
+}
+
+func TestFlowOwnerCookie(t *testing.T) {
+	s := newFlowStore(false)
+	match := of13.NewMatch()
+
+	for _, owner := range []FlowOwner{NoFlowOwner, 1, 2, MaxFlowOwner} {
+		flow, err := s.add(owner, match, nil, uint32(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, ok := CookieOwner(flow.cookie)
+		if !ok || v != owner {
+			t.Fatalf("unexpected owner of cookie %x: expected=%v, got=%v (ok=%v)", flow.cookie, owner, v, ok)
+		}
+		cookie, mask := owner.cookie()
+		if flow.cookie&mask != cookie {
+			t.Fatalf("cookie %x is not in the namespace of owner %v", flow.cookie, owner)
+		}
+	}
+
+	if _, ok := CookieOwner(0x1 << 63); ok {
+		t.Fatalf("special flow cookie has an owner")
+	}
+}
+
+func TestFlowStoreAdopt(t *testing.T) {
+	s := newFlowStore(true)
+	mine := newTestFlow(t, s, "00:00:00:00:00:01")
+
+	newStats := func(mac string, cookie uint64) openflow.FlowStats {
+		addr, err := net.ParseMAC(mac)
+		if err != nil {
+			t.Fatal(err)
+		}
+		match := of13.NewMatch()
+		match.SetDstMAC(addr)
+		port := openflow.NewOutPort()
+		port.SetValue(1)
+		action := of13.NewAction()
+		action.SetOutPort(port)
+
+		return openflow.FlowStats{Cookie: cookie, Priority: normalFlowPriority, Match: match, Action: action}
+	}
+	valid := newStats("00:00:00:00:00:02", 1<<flowOwnerShift|mine.cookie+100)
+	invalid := newStats("00:00:00:00:00:03", 2)
+	// Installed by the previous instance for the same match with our flow.
+	dup := newStats("00:00:00:00:00:01", 3)
+
+	now := time.Now()
+	s.startDump(now)
+	s.appendDump([]openflow.FlowStats{
+		{Cookie: mine.cookie, Priority: normalFlowPriority},
+		valid,
+		invalid,
+		dup,
+	})
+	missing, stray := s.reconcile(now, func(v openflow.FlowStats) bool { return v.Cookie != invalid.Cookie })
+	if len(missing) != 0 {
+		t.Fatalf("unexpected missing flows: %+v", missing)
+	}
+	if len(stray) != 2 {
+		t.Fatalf("unexpected stray flows: %+v", stray)
+	}
+	flow, ok := s.flows[valid.Cookie]
+	if !ok || flow.owner != 1 {
+		t.Fatalf("valid flow has not been adopted: %+v", flow)
+	}
+	if s.adopting {
+		t.Fatalf("flow store is still adopting")
+	}
+	// New cookies should not collide with the adopted one.
+	if c := newTestFlow(t, s, "00:00:00:00:00:04").cookie; c&flowSeqMask <= valid.Cookie&flowSeqMask {
+		t.Fatalf("new cookie %x may collide with the adopted cookie %x", c, valid.Cookie)
+	}
+}
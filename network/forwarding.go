@@ -0,0 +1,70 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ForwardingMode decides how the unicast packets are forwarded among switches.
+type ForwardingMode int
+
+const (
+	// ForwardingSTP forwards packets only through the edges of the spanning tree.
+	ForwardingSTP ForwardingMode = iota
+	// ForwardingECMP distributes packets over all the equal-cost shortest paths. The
+	// spanning tree is still used to flood the broadcast packets without a loop.
+	ForwardingECMP
+	// ForwardingSPB forwards packets toward a destination switch along its own shortest-path
+	// tree, so that all the links can be used by the packets to the different destinations.
+	// The spanning tree is still used to flood the broadcast packets without a loop.
+	ForwardingSPB
+)
+
+func (r ForwardingMode) String() string {
+	switch r {
+	case ForwardingSTP:
+		return "stp"
+	case ForwardingECMP:
+		return "ecmp"
+	case ForwardingSPB:
+		return "spb"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(r))
+	}
+}
+
+// ParseForwardingMode converts mode into a ForwardingMode. An empty string means the
+// default STP mode.
+func ParseForwardingMode(mode string) (ForwardingMode, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", "stp":
+		return ForwardingSTP, nil
+	case "ecmp":
+		return ForwardingECMP, nil
+	case "spb":
+		return ForwardingSPB, nil
+	default:
+		return ForwardingSTP, fmt.Errorf("unknown forwarding mode: %v", mode)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"time"
+)
+
+// groupGracePeriod is the minimum age of a group before it can be removed for not
+// being referenced. A group is installed in advance of the flow that references it,
+// so that a new group should not be removed before the flow is installed.
+const groupGracePeriod = 10 * time.Second
+
+type groupEntry struct {
+	id      uint32
+	created time.Time
+}
+
+// groupTable is the set of the groups installed in a switch device.
+//
+// XXX: groupTable is not thread-safe. Caller should lock the mutex of the device.
+type groupTable struct {
+	lastID uint32
+	groups map[string]groupEntry // Key = group type and bucket ports.
+}
+
+func newGroupTable() *groupTable {
+	return &groupTable{
+		groups: make(map[string]groupEntry),
+	}
+}
+
+func (r *groupTable) lookup(key string) (groupID uint32, ok bool) {
+	v, ok := r.groups[key]
+	if !ok {
+		return 0, false
+	}
+
+	return v.id, true
+}
+
+// add allocates a new group ID for key. The group IDs are never reused while the
+// device is connected, so that a flow cannot be redirected to a different group by
+// referencing an already removed group.
+func (r *groupTable) add(key string, now time.Time) (groupID uint32) {
+	// Group ID starts from 1.
+	r.lastID++
+	r.groups[key] = groupEntry{id: r.lastID, created: now}
+
+	return r.lastID
+}
+
+// removeUnused forgets the groups that are not referenced by any flow in used and
+// then returns their IDs. The groups created within the grace period are kept.
+func (r *groupTable) removeUnused(used map[uint32]bool, now time.Time) (removed []uint32) {
+	for key, v := range r.groups {
+		if used[v.id] || now.Sub(v.created) < groupGracePeriod {
+			continue
+		}
+		delete(r.groups, key)
+		removed = append(removed, v.id)
+	}
+
+	return removed
+}
+
+func (r *groupTable) removeAll() {
+	r.groups = make(map[string]groupEntry)
+}
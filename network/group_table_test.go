@@ -0,0 +1,90 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/superkkt/cherry/openflow/of13"
+)
+
+func TestGroupTableRemoveUnused(t *testing.T) {
+	groups := newGroupTable()
+	flows := newFlowStore(false)
+
+	now := time.Now()
+	created := now.Add(-2 * groupGracePeriod)
+	select1 := groups.add("select/[1 2]", created)
+	select2 := groups.add("select/[3 4]", created)
+	if select1 == select2 {
+		t.Fatalf("same group ID for different groups: %v", select1)
+	}
+
+	mac, err := net.ParseMAC("00:00:00:00:00:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := of13.NewMatch()
+	match.SetDstMAC(mac)
+	if _, err := flows.add(NoFlowOwner, match, nil, select1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first group is referenced by the flow.
+	removed := groups.removeUnused(flows.groups(), now)
+	if len(removed) != 1 || removed[0] != select2 {
+		t.Fatalf("unexpected removed groups: %v", removed)
+	}
+	if _, ok := groups.lookup("select/[3 4]"); ok {
+		t.Fatalf("unused group still exists")
+	}
+
+	// A new group within the grace period should be kept until its flow is installed.
+	failover := groups.add("failover/1/2", now)
+	// The flow now references the failover group instead of the first group.
+	if _, err := flows.add(NoFlowOwner, match, nil, failover); err != nil {
+		t.Fatal(err)
+	}
+	removed = groups.removeUnused(flows.groups(), now)
+	if len(removed) != 1 || removed[0] != select1 {
+		t.Fatalf("unexpected removed groups: %v", removed)
+	}
+
+	// The group is removed once no flow references it.
+	flows.removeAll()
+	if removed := groups.removeUnused(flows.groups(), now); len(removed) != 0 {
+		t.Fatalf("group within the grace period has been removed: %v", removed)
+	}
+	removed = groups.removeUnused(flows.groups(), now.Add(groupGracePeriod))
+	if len(removed) != 1 || removed[0] != failover {
+		t.Fatalf("unexpected removed groups: %v", removed)
+	}
+	if len(groups.groups) != 0 {
+		t.Fatalf("unexpected remaining groups: %v", groups.groups)
+	}
+	// Group IDs are never reused.
+	if id := groups.add("select/[3 4]", now); id == select1 || id == select2 || id == failover {
+		t.Fatalf("group ID %v has been reused", id)
+	}
+}
@@ -24,17 +24,49 @@ package network
 import (
 	"fmt"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/superkkt/cherry/graph"
 )
 
+// broadcastLinkWeight is the weight of a link through a broadcast domain, which is discovered by BDDP.
+// It is heavier than direct links so that the spanning tree prefers direct links.
+const broadcastLinkWeight = 10
+
+const (
+	// latencySmoothingFactor is the weight of a new latency sample in the moving average.
+	latencySmoothingFactor = 0.2
+	// latencyWeightUnit is the latency that increases the link weight by one.
+	latencyWeightUnit = time.Millisecond
+	// latencyHysteresis is the minimum difference between the moving average and the
+	// latency applied to the link weight to apply the new latency, so that the weight
+	// does not change on small jitters around a unit boundary.
+	latencyHysteresis = 2 * latencyWeightUnit
+)
+
 type link struct {
 	ports [2]*Port
+	// broadcast is true if this link goes through a broadcast domain, e.g., legacy switches.
+	broadcast bool
+
+	mutex sync.Mutex
+	// Exponential moving average of the one-way latency. Negative value means unknown.
+	latency time.Duration
+	// Latency that has been applied to the link weight. Negative value means unknown.
+	weightLatency time.Duration
+	// Congestion level measured by the utilization of the ports. Zero means not congested.
+	congestion int
+	// Time when the congestion level has been changed last.
+	congestionChanged time.Time
 }
 
-func newLink(ports [2]*Port) *link {
+func newLink(ports [2]*Port, broadcast bool) *link {
 	return &link{
-		ports: ports,
+		ports:         ports,
+		broadcast:     broadcast,
+		latency:       -1,
+		weightLatency: -1,
 	}
 }
 
@@ -49,7 +81,89 @@ func (r *link) Points() [2]graph.Point {
 	return [2]graph.Point{r.ports[0], r.ports[1]}
 }
 
+// Weight returns the weight of this link for the shortest paths, which includes the
+// latency and congestion of the link.
 func (r *link) Weight() float64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.TreeWeight() + latencyWeight(r.weightLatency) + float64(r.congestion*congestionWeightUnit)
+}
+
+// TreeWeight returns the weight of this link for the spanning tree. The latency and
+// congestion are excluded not to change the spanning tree whenever they are changed.
+func (r *link) TreeWeight() float64 {
+	weight := 0.0
+	if r.broadcast {
+		weight = broadcastLinkWeight
+	}
 	// TODO: Calculate weight dynamically based on the link speed among these two ports
-	return 0
+	return weight
+}
+
+// Bandwidth returns the link speed in MB, which is the slower one of its two ports.
+// It returns zero if the speed of a port is unknown.
+func (r *link) Bandwidth() uint64 {
+	var result uint64
+	for i, p := range r.ports {
+		v := p.Value()
+		if v == nil {
+			return 0
+		}
+		if i == 0 || v.Speed() < result {
+			result = v.Speed()
+		}
+	}
+
+	return result
+}
+
+func latencyWeight(latency time.Duration) float64 {
+	if latency <= 0 {
+		return 0
+	}
+
+	return float64(latency / latencyWeightUnit)
+}
+
+// Latency returns the moving average of the one-way latency of this link. It returns
+// a negative value if the latency has not been measured yet.
+func (r *link) Latency() time.Duration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.latency
+}
+
+// updateLatency adds a new latency sample to the moving average, and then returns
+// whether the weight of this link has been changed.
+func (r *link) updateLatency(sample time.Duration) (weightChanged bool) {
+	if sample < 0 {
+		return false
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.latency < 0 {
+		r.latency = sample
+	} else {
+		r.latency += time.Duration(latencySmoothingFactor * float64(sample-r.latency))
+	}
+
+	diff := r.latency - r.weightLatency
+	if diff < 0 {
+		diff = -diff
+	}
+	if r.weightLatency >= 0 && diff <= latencyHysteresis {
+		return false
+	}
+	prev := r.weightLatency
+	r.weightLatency = r.latency
+
+	return latencyWeight(prev) != latencyWeight(r.weightLatency)
+}
+
+func (r *link) BroadcastDomain() bool {
+	return r.broadcast
 }
@@ -0,0 +1,55 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015-2019 Samjung Data Service, Inc. All rights reserved.
+ *  Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLinkLatencyHysteresis(t *testing.T) {
+	l := newLink([2]*Port{}, false)
+
+	src := []struct {
+		sample  time.Duration
+		changed bool
+	}{
+		// First sample is applied immediately.
+		{10 * time.Millisecond, true},
+		// Jitters around the unit boundary do not change the weight.
+		{11 * time.Millisecond, false},
+		{9 * time.Millisecond, false},
+		{12 * time.Millisecond, false},
+		// Consistent rise beyond the hysteresis margin changes the weight.
+		{30 * time.Millisecond, true},
+	}
+
+	for i, v := range src {
+		if changed := l.updateLatency(v.sample); changed != v.changed {
+			t.Fatalf("unexpected weight change on sample %v: expected=%v, got=%v (latency=%v)", i, v.changed, changed, l.Latency())
+		}
+	}
+
+	if l.TreeWeight() != 0 {
+		t.Fatalf("latency affects the tree weight: %v", l.TreeWeight())
+	}
+}
@@ -0,0 +1,234 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	locationCacheSize = 65536
+	// Interval to check whether the host locations have been changed by other
+	// processes, e.g., walnut, sharing the database.
+	locationVersionCheckInterval = 3 * time.Second
+)
+
+// HostLocationListener is notified when the host locations are changed in the database.
+type HostLocationListener interface {
+	// HostLocationUpdated is called when the host whose MAC address is mac has been
+	// moved to the port specified by dpid and port. version is the version of the host
+	// locations that has been increased by this update.
+	HostLocationUpdated(mac net.HardwareAddr, dpid string, port uint32, version uint64)
+	// HostLocationsInvalidated is called when the locations of several hosts have been reset.
+	// version is the version of the host locations that has been increased by this reset.
+	HostLocationsInvalidated(version uint64)
+}
+
+type hostLocation struct {
+	dpid   string
+	port   uint32
+	status LocationStatus
+}
+
+// locationCache is a write-through cache of the host locations stored in the database.
+type locationCache struct {
+	mutex sync.Mutex
+	db    database
+	cache *lru.Cache // Key = MAC address, Value = hostLocation.
+	// Generation of the cache that is increased whenever the cache is invalidated.
+	generation uint64
+	// Version of the host locations in the database that has been loaded into the cache.
+	dbVersion uint64
+	// Versions increased by the changes that have been already applied to the cache.
+	ownVersions map[uint64]bool
+}
+
+func newLocationCache(db database) *locationCache {
+	c, err := lru.New(locationCacheSize)
+	if err != nil {
+		panic(fmt.Sprintf("failed to init a LRU location cache: %v", err))
+	}
+
+	return &locationCache{
+		db:          db,
+		cache:       c,
+		ownVersions: make(map[uint64]bool),
+	}
+}
+
+// load populates the cache with all the discovered host locations in the database.
+func (r *locationCache) load() error {
+	version, err := r.db.HostLocationVersion()
+	if err != nil {
+		return err
+	}
+	hosts, err := r.db.HostLocations()
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.cache.Purge()
+	for _, v := range hosts {
+		mac, err := net.ParseMAC(v.MAC)
+		if err != nil {
+			return err
+		}
+		r.cache.Add(mac.String(), hostLocation{dpid: v.DPID, port: v.Port, status: LocationDiscovered})
+	}
+	r.generation++
+	r.dbVersion = version
+	logger.Infof("loaded %v host locations into the cache: version=%v", len(hosts), version)
+
+	return nil
+}
+
+// lookup returns the location of the host whose MAC address is mac. The database
+// is queried only if the location is not cached.
+func (r *locationCache) lookup(mac net.HardwareAddr) (hostLocation, error) {
+	if v, ok := r.cache.Get(mac.String()); ok {
+		return v.(hostLocation), nil
+	}
+
+	r.mutex.Lock()
+	generation := r.generation
+	r.mutex.Unlock()
+
+	dpid, port, status, err := r.db.Location(mac)
+	if err != nil {
+		return hostLocation{status: status}, err
+	}
+	v := hostLocation{dpid: dpid, port: port, status: status}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	// Do not cache the location that may be outdated by the invalidation during the query.
+	if generation == r.generation {
+		r.cache.Add(mac.String(), v)
+	}
+
+	return v, nil
+}
+
+// update caches the new location of the host whose MAC address is mac, and returns
+// its previous location if it was cached as a discovered one. version is the version
+// of the host locations that has been increased by the update.
+func (r *locationCache) update(mac net.HardwareAddr, dpid string, port uint32, version uint64) (prev hostLocation, ok bool) {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if v, exist := r.cache.Peek(mac.String()); exist {
+		prev = v.(hostLocation)
+		ok = prev.status == LocationDiscovered
+	}
+	r.cache.Add(mac.String(), hostLocation{dpid: dpid, port: port, status: LocationDiscovered})
+	// Make the ongoing lookups not to overwrite the new location with their outdated results.
+	r.generation++
+	r.ownVersions[version] = true
+
+	return prev, ok
+}
+
+// invalidate purges the cache. version is the version of the host locations that has
+// been increased by the change that requires the invalidation.
+func (r *locationCache) invalidate(version uint64) {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.cache.Purge()
+	// Make the ongoing lookups not to cache their results.
+	r.generation++
+	r.ownVersions[version] = true
+	logger.Debug("invalidated the host location cache")
+}
+
+// checkVersion invalidates the cache if the host locations have been changed in the
+// database by other processes.
+func (r *locationCache) checkVersion() error {
+	version, err := r.db.HostLocationVersion()
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if version == r.dbVersion {
+		return nil
+	}
+	own := r.isOwnVersions(r.dbVersion, version)
+	for v := range r.ownVersions {
+		if v <= version {
+			delete(r.ownVersions, v)
+		}
+	}
+	prev := r.dbVersion
+	r.dbVersion = version
+	// All the changes have been already applied to the cache by ourselves?
+	if own {
+		return nil
+	}
+	r.cache.Purge()
+	r.generation++
+	logger.Debugf("invalidated the host location cache: database version=%v -> %v", prev, version)
+
+	return nil
+}
+
+// isOwnVersions returns whether all the versions after from up to to have been increased
+// by the changes that have been already applied to the cache.
+//
+// XXX: Caller should lock the mutex.
+func (r *locationCache) isOwnVersions(from, to uint64) bool {
+	// The database may have been reset.
+	if to < from || to-from > uint64(len(r.ownVersions)) {
+		return false
+	}
+	for v := from + 1; v <= to; v++ {
+		if !r.ownVersions[v] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *locationCache) versionChecker() {
+	ticker := time.Tick(locationVersionCheckInterval)
+
+	// Infinite loop.
+	for range ticker {
+		if err := r.checkVersion(); err != nil {
+			logger.Errorf("failed to check the host location version: %v", err)
+			continue
+		}
+	}
+}
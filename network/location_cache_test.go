@@ -0,0 +1,125 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"net"
+	"testing"
+)
+
+type mockLocationDB struct {
+	queries int
+	version uint64
+	hosts   map[string]HostLocation
+}
+
+func (r *mockLocationDB) Location(mac net.HardwareAddr) (dpid string, port uint32, status LocationStatus, err error) {
+	r.queries++
+	v, ok := r.hosts[mac.String()]
+	if !ok {
+		return "", 0, LocationUnregistered, nil
+	}
+
+	return v.DPID, v.Port, LocationDiscovered, nil
+}
+
+func (r *mockLocationDB) HostLocations() ([]HostLocation, error) {
+	result := make([]HostLocation, 0)
+	for _, v := range r.hosts {
+		result = append(result, v)
+	}
+
+	return result, nil
+}
+
+func (r *mockLocationDB) HostLocationVersion() (uint64, error) {
+	return r.version, nil
+}
+
+func (r *mockLocationDB) IsRegisteredSwitch(dpid uint64) (bool, error) {
+	return true, nil
+}
+
+func (r *mockLocationDB) AddPendingSwitch(PendingSwitch) error {
+	return nil
+}
+
+func (r *mockLocationDB) UpdateDiscoveredSwitch(DiscoveredSwitch) error {
+	return nil
+}
+
+func TestLocationCache(t *testing.T) {
+	host1, _ := net.ParseMAC("00:00:00:00:00:01")
+	host2, _ := net.ParseMAC("00:00:00:00:00:02")
+	db := &mockLocationDB{
+		hosts: map[string]HostLocation{
+			host1.String(): {MAC: host1.String(), DPID: "1", Port: 1},
+		},
+	}
+
+	c := newLocationCache(db)
+	if err := c.load(); err != nil {
+		t.Fatal(err)
+	}
+	// Loaded location.
+	if v, err := c.lookup(host1); err != nil || v.status != LocationDiscovered || v.dpid != "1" || v.port != 1 {
+		t.Fatalf("unexpected location of %v: %+v (err=%v)", host1, v, err)
+	}
+	// Unregistered host is also cached.
+	for i := 0; i < 2; i++ {
+		if v, err := c.lookup(host2); err != nil || v.status != LocationUnregistered {
+			t.Fatalf("unexpected location of %v: %+v (err=%v)", host2, v, err)
+		}
+	}
+	if db.queries != 1 {
+		t.Fatalf("unexpected number of database queries: expected=1, got=%v", db.queries)
+	}
+
+	// Write-through update that increases the database version.
+	db.version++
+	generation := c.generation
+	c.update(host1, "2", 3, db.version)
+	// The ongoing lookups should not overwrite the new location.
+	if c.generation == generation {
+		t.Fatalf("generation has not been increased by the update")
+	}
+	if v, _ := c.lookup(host1); v.dpid != "2" || v.port != 3 {
+		t.Fatalf("unexpected location of %v after update: %+v", host1, v)
+	}
+	// Our own change should not invalidate the cache.
+	if err := c.checkVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := c.lookup(host1); v.dpid != "2" || v.port != 3 || db.queries != 1 {
+		t.Fatalf("cache has been invalidated by our own change: location=%+v, queries=%v", v, db.queries)
+	}
+
+	// Changed by another process.
+	db.hosts[host2.String()] = HostLocation{MAC: host2.String(), DPID: "1", Port: 2}
+	db.version++
+	if err := c.checkVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := c.lookup(host2); v.status != LocationDiscovered || v.port != 2 {
+		t.Fatalf("unexpected location of %v after invalidation: %+v", host2, v)
+	}
+}
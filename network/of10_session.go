@@ -27,6 +27,7 @@ import (
 	"github.com/superkkt/cherry/openflow/transceiver"
 
 	"github.com/pkg/errors"
+	"github.com/superkkt/viper"
 )
 
 type of10Session struct {
@@ -50,11 +51,14 @@ func (r *of10Session) OnHello(f openflow.Factory, w transceiver.Writer, v openfl
 	if err := sendSetConfig(f, w); err != nil {
 		return errors.Wrap(err, "failed to send SET_CONFIG")
 	}
-	if err := sendRemoveAllFlows(f, w); err != nil {
-		return errors.Wrap(err, "failed to send FLOW_MOD to remove all flows")
-	}
-	if err := setTemporaryDrop(f, w); err != nil {
-		return errors.Wrap(err, "failed to set the temporary drop rule")
+	// Keep the previously installed flows on warm start, which will be adopted by the flow reconciler.
+	if !viper.GetBool("default.warm_start") {
+		if err := sendRemoveAllFlows(f, w); err != nil {
+			return errors.Wrap(err, "failed to send FLOW_MOD to remove all flows")
+		}
+		if err := setTemporaryDrop(f, w); err != nil {
+			return errors.Wrap(err, "failed to set the temporary drop rule")
+		}
 	}
 	if err := setARPSender(f, w); err != nil {
 		return errors.Wrap(err, "failed to set the ARP sender")
@@ -62,6 +66,9 @@ func (r *of10Session) OnHello(f openflow.Factory, w transceiver.Writer, v openfl
 	if err := setLLDPSender(f, w); err != nil {
 		return errors.Wrap(err, "failed to set the LLDP sender")
 	}
+	if err := setBDDPSender(f, w); err != nil {
+		return errors.Wrap(err, "failed to set the BDDP sender")
+	}
 	if err := setDHCPSender(f, w); err != nil {
 		return errors.Wrap(err, "failed to set the DHCP sender")
 	}
@@ -132,6 +139,14 @@ func (r *of10Session) OnPortDescReply(f openflow.Factory, w transceiver.Writer,
 	return nil
 }
 
+func (r *of10Session) OnFlowStatsReply(f openflow.Factory, w transceiver.Writer, v openflow.FlowStatsReply) error {
+	return nil
+}
+
+func (r *of10Session) OnPortStatsReply(f openflow.Factory, w transceiver.Writer, v openflow.PortStatsReply) error {
+	return nil
+}
+
 func (r *of10Session) OnPortStatus(f openflow.Factory, w transceiver.Writer, v openflow.PortStatus) error {
 	return nil
 }
@@ -22,13 +22,12 @@
 package network
 
 import (
-	"strings"
-
 	"github.com/superkkt/cherry/openflow"
 	"github.com/superkkt/cherry/openflow/of13"
 	"github.com/superkkt/cherry/openflow/transceiver"
 
 	"github.com/pkg/errors"
+	"github.com/superkkt/viper"
 )
 
 type of13Session struct {
@@ -52,11 +51,23 @@ func (r *of13Session) OnHello(f openflow.Factory, w transceiver.Writer, v openfl
 	if err := sendSetConfig(f, w); err != nil {
 		return errors.Wrap(err, "failed to send SET_CONFIG")
 	}
-	if err := sendRemoveAllFlows(f, w); err != nil {
-		return errors.Wrap(err, "failed to send FLOW_MOD to remove all flows")
-	}
-	if err := setTemporaryDrop(f, w); err != nil {
-		return errors.Wrap(err, "failed to set the temporary drop rule")
+	if viper.GetBool("default.warm_start") {
+		// Keep the previously installed flows that will be adopted by the flow reconciler. The
+		// groups are removed because we don't know them, which also removes the flows using them.
+		// So, warm start is refused with the forwarding modes using the groups on config validation.
+		if err := sendRemoveAllGroups(f, w); err != nil {
+			return errors.Wrap(err, "failed to send GROUP_MOD to remove all groups")
+		}
+	} else {
+		if err := sendRemoveAllFlows(f, w); err != nil {
+			return errors.Wrap(err, "failed to send FLOW_MOD to remove all flows")
+		}
+		if err := sendRemoveAllGroups(f, w); err != nil {
+			return errors.Wrap(err, "failed to send GROUP_MOD to remove all groups")
+		}
+		if err := setTemporaryDrop(f, w); err != nil {
+			return errors.Wrap(err, "failed to set the temporary drop rule")
+		}
 	}
 	if err := setARPSender(f, w); err != nil {
 		return errors.Wrap(err, "failed to set the ARP sender")
@@ -64,6 +75,9 @@ func (r *of13Session) OnHello(f openflow.Factory, w transceiver.Writer, v openfl
 	if err := setLLDPSender(f, w); err != nil {
 		return errors.Wrap(err, "failed to set the LLDP sender")
 	}
+	if err := setBDDPSender(f, w); err != nil {
+		return errors.Wrap(err, "failed to set the BDDP sender")
+	}
 	if err := setDHCPSender(f, w); err != nil {
 		return errors.Wrap(err, "failed to set the DHCP sender")
 	}
@@ -105,14 +119,6 @@ func (r *of13Session) OnGetConfigReply(f openflow.Factory, w transceiver.Writer,
 	return nil
 }
 
-func isHP2920_24G(msg openflow.DescReply) bool {
-	return strings.HasPrefix(msg.Manufacturer(), "HP") && strings.HasPrefix(msg.Hardware(), "2920-24G")
-}
-
-func isAS460054_T(msg openflow.DescReply) bool {
-	return strings.Contains(msg.Hardware(), "AS4600-54T")
-}
-
 func (r *of13Session) setTableMiss(f openflow.Factory, w transceiver.Writer, tableID uint8, inst openflow.Instruction) error {
 	match, err := f.NewMatch() // Wildcard
 	if err != nil {
@@ -137,26 +143,28 @@ func (r *of13Session) setTableMiss(f openflow.Factory, w transceiver.Writer, tab
 	return w.Write(msg)
 }
 
-func (r *of13Session) setHP2920TableMiss(f openflow.Factory, w transceiver.Writer) error {
-	// Table-100 is a hardware table, and Table-200 is a software table
-	// that has very low performance.
+// setTableMisses installs the table-miss flows according to the driver profile of the device.
+func (r *of13Session) setTableMisses(f openflow.Factory, w transceiver.Writer, driver *DriverProfile) error {
+	tables := driver.Tables
+	if driver.TableMiss == TableMissNone {
+		logger.Debugf("skip to install the table-miss flows: DPID=%v, driver=%v", r.device.ID(), driver.Name)
+		r.device.setFlowTableID(driver.FlowTableID())
+		return nil
+	}
+
 	inst, err := f.NewInstruction()
 	if err != nil {
 		return err
 	}
-
-	// 0 -> 100
-	inst.GotoTable(100)
-	if err := r.setTableMiss(f, w, 0, inst); err != nil {
-		return errors.Wrap(err, "failed to set table_miss flow entry")
-	}
-	// 100 -> 200
-	inst.GotoTable(200)
-	if err := r.setTableMiss(f, w, 100, inst); err != nil {
-		return errors.Wrap(err, "failed to set table_miss flow entry")
+	// Chain the tables in order: e.g., 0 -> 100 -> 200.
+	for i := 0; i < len(tables)-1; i++ {
+		inst.GotoTable(tables[i+1])
+		if err := r.setTableMiss(f, w, tables[i], inst); err != nil {
+			return errors.Wrap(err, "failed to set table_miss flow entry")
+		}
 	}
 
-	// 200 -> Controller
+	// Last table -> Controller
 	outPort := openflow.NewOutPort()
 	outPort.SetController()
 	action, err := f.NewAction()
@@ -166,62 +174,86 @@ func (r *of13Session) setHP2920TableMiss(f openflow.Factory, w transceiver.Write
 	action.SetOutPort(outPort)
 
 	inst.ApplyAction(action)
-	if err := r.setTableMiss(f, w, 200, inst); err != nil {
+	if err := r.setTableMiss(f, w, driver.FlowTableID(), inst); err != nil {
 		return errors.Wrap(err, "failed to set table_miss flow entry")
 	}
-	r.device.setFlowTableID(200)
+	r.device.setFlowTableID(driver.FlowTableID())
 
 	return nil
 }
 
-func (r *of13Session) setAS4600TableMiss(f openflow.Factory, w transceiver.Writer) error {
-	// FIXME:
-	// AS460054-T gives an error (type=5, code=1) that means TABLE_FULL
-	// when we install a table-miss flow on Table-0 after we delete all
-	// flows already installed from the switch. Is this a bug of this switch??
-
-	return nil
-}
-
-func (r *of13Session) setDefaultTableMiss(f openflow.Factory, w transceiver.Writer) error {
-	inst, err := f.NewInstruction()
-	if err != nil {
-		return err
+// setAccessVLANs installs the flows that tag the untagged frames received from the access
+// ports with their VLAN IDs, and then send them to the next table to be matched by the
+// normal flows, or the ACL flows if the next table is dedicated to them. It requires two or
+// more tables in the pipeline of the driver profile.
+func (r *of13Session) setAccessVLANs(f openflow.Factory, w transceiver.Writer, driver *DriverProfile) error {
+	ports := accessVLANs(r.device.ID())
+	if len(ports) == 0 {
+		return nil
 	}
-
-	// 0 -> Controller
-	outPort := openflow.NewOutPort()
-	outPort.SetController()
-	action, err := f.NewAction()
-	if err != nil {
-		return err
+	tables := driver.Tables
+	if len(tables) < 2 {
+		logger.Errorf("access VLANs on %v are not applied: driver profile %v has only one table", r.device.ID(), driver.Name)
+		return nil
 	}
-	action.SetOutPort(outPort)
 
-	inst.ApplyAction(action)
-	if err := r.setTableMiss(f, w, 0, inst); err != nil {
-		return errors.Wrap(err, "failed to set table_miss flow entry")
+	for num, vlanID := range ports {
+		match, err := f.NewMatch()
+		if err != nil {
+			return err
+		}
+		inPort := openflow.NewInPort()
+		inPort.SetValue(num)
+		match.SetInPort(inPort)
+		match.SetUntaggedVLAN()
+		if err := driver.checkMatch(match); err != nil {
+			return err
+		}
+
+		action, err := f.NewAction()
+		if err != nil {
+			return err
+		}
+		action.SetPushVLAN()
+		action.SetVLANID(vlanID)
+		// No output port. The tagged frames go to the next table.
+		outPort := openflow.NewOutPort()
+		outPort.SetNone()
+		action.SetOutPort(outPort)
+		inst, err := f.NewInstruction()
+		if err != nil {
+			return err
+		}
+		inst.ApplyActionAndGotoTable(action, tables[1])
+
+		flow, err := f.NewFlowMod(openflow.FlowAdd)
+		if err != nil {
+			return err
+		}
+		// We use MSB to distinguish the special flows from the normal flows.
+		flow.SetCookie(0x1 << 63)
+		flow.SetTableID(tables[0])
+		// Permanent flow entry
+		flow.SetIdleTimeout(0)
+		flow.SetHardTimeout(0)
+		flow.SetPriority(accessVLANFlowPriority)
+		flow.SetFlowMatch(match)
+		flow.SetFlowInstruction(inst)
+		if err := w.Write(flow); err != nil {
+			return errors.Wrap(err, "failed to set the access VLAN flow")
+		}
+		logger.Debugf("installed the access VLAN flow: DPID=%v, port=%v, vlanID=%v", r.device.ID(), num, vlanID)
 	}
-	r.device.setFlowTableID(0)
 
 	return nil
 }
 
 func (r *of13Session) OnDescReply(f openflow.Factory, w transceiver.Writer, v openflow.DescReply) error {
-	var err error
-
-	// FIXME:
-	// Implement general routines for various table structures of OF1.3 switches
-	// based on table features reply
-	switch {
-	case isHP2920_24G(v):
-		err = r.setHP2920TableMiss(f, w)
-	case isAS460054_T(v):
-		err = r.setAS4600TableMiss(f, w)
-	default:
-		err = r.setDefaultTableMiss(f, w)
+	// The driver profile has been decided by the descriptions before calling this handler.
+	if err := r.setTableMisses(f, w, r.device.Driver()); err != nil {
+		return err
 	}
-	if err != nil {
+	if err := r.setAccessVLANs(f, w, r.device.Driver()); err != nil {
 		return err
 	}
 
@@ -257,6 +289,14 @@ func (r *of13Session) OnPortDescReply(f openflow.Factory, w transceiver.Writer,
 	return nil
 }
 
+func (r *of13Session) OnFlowStatsReply(f openflow.Factory, w transceiver.Writer, v openflow.FlowStatsReply) error {
+	return nil
+}
+
+func (r *of13Session) OnPortStatsReply(f openflow.Factory, w transceiver.Writer, v openflow.PortStatsReply) error {
+	return nil
+}
+
 func (r *of13Session) OnPortStatus(f openflow.Factory, w transceiver.Writer, v openflow.PortStatus) error {
 	return nil
 }
@@ -0,0 +1,105 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/superkkt/cherry/openflow"
+)
+
+const (
+	// Maximum length of the switch description in the database.
+	maxSwitchDescription = 255
+)
+
+// DiscoveredSwitch is a switch whose ports have been learned from the switch itself,
+// which can be registered in the database without typing its information by hand.
+type DiscoveredSwitch struct {
+	DPID        uint64
+	Description string
+	// Ports sorted by their numbers.
+	Ports []DiscoveredPort
+}
+
+type DiscoveredPort struct {
+	Number uint16
+	Name   string
+	MAC    net.HardwareAddr
+	// Current link speed in MB.
+	Speed uint64
+}
+
+// newDiscoveredSwitch returns a DiscoveredSwitch of the device whose DPID is dpid. The
+// reserved ports whose numbers are greater than maxPort, and the ports whose numbers
+// cannot be stored in the database, are excluded.
+func newDiscoveredSwitch(dpid uint64, desc Descriptions, maxPort uint32, ports []openflow.Port) DiscoveredSwitch {
+	v := DiscoveredSwitch{
+		DPID:        dpid,
+		Description: describeSwitch(desc),
+		Ports:       make([]DiscoveredPort, 0, len(ports)),
+	}
+	for _, p := range ports {
+		if p.Number() > maxPort || p.Number() > 0xFFFF {
+			logger.Debugf("skip to discover a port: DPID=%v, port=%v", dpid, p.Number())
+			continue
+		}
+		v.Ports = append(v.Ports, DiscoveredPort{
+			Number: uint16(p.Number()),
+			Name:   p.Name(),
+			MAC:    p.MAC(),
+			Speed:  p.Speed(),
+		})
+	}
+	sort.Slice(v.Ports, func(i, j int) bool { return v.Ports[i].Number < v.Ports[j].Number })
+
+	return v
+}
+
+func describeSwitch(desc Descriptions) string {
+	v := strings.TrimSpace(desc.Description)
+	if len(v) == 0 {
+		v = strings.TrimSpace(fmt.Sprintf("%v %v", desc.Manufacturer, desc.Hardware))
+	}
+	for utf8.RuneCountInString(v) > maxSwitchDescription {
+		_, size := utf8.DecodeLastRuneInString(v)
+		v = v[:len(v)-size]
+	}
+
+	return v
+}
+
+// key returns a string that represents this switch to check whether it has been changed.
+func (r DiscoveredSwitch) key() string {
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "%v/%v", r.DPID, r.Description)
+	for _, p := range r.Ports {
+		fmt.Fprintf(b, "/%v,%v,%v,%v", p.Number, p.Name, p.MAC, p.Speed)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,84 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015-2019 Samjung Data Service, Inc. All rights reserved.
+ *  Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/superkkt/cherry/openflow"
+)
+
+type mockPort struct {
+	number uint32
+	name   string
+}
+
+func (r *mockPort) Number() uint32                    { return r.number }
+func (r *mockPort) MAC() net.HardwareAddr             { return net.HardwareAddr{0, 0, 0, 0, 0, byte(r.number)} }
+func (r *mockPort) Name() string                      { return r.name }
+func (r *mockPort) IsPortDown() bool                  { return false }
+func (r *mockPort) IsLinkDown() bool                  { return false }
+func (r *mockPort) IsCopper() bool                    { return true }
+func (r *mockPort) IsFiber() bool                     { return false }
+func (r *mockPort) IsAutoNego() bool                  { return true }
+func (r *mockPort) Speed() uint64                     { return 1000 }
+func (r *mockPort) UnmarshalBinary(data []byte) error { return nil }
+
+func TestDiscoveredSwitch(t *testing.T) {
+	ports := []openflow.Port{
+		&mockPort{number: 3, name: "eth3"},
+		&mockPort{number: 0xfffe, name: "local"},
+		&mockPort{number: 1, name: "eth1"},
+		&mockPort{number: 2, name: "eth2"},
+	}
+	desc := Descriptions{Manufacturer: "Cherry", Hardware: "Switch"}
+
+	sw := newDiscoveredSwitch(1, desc, 0xff00, ports)
+	if sw.Description != "Cherry Switch" {
+		t.Fatalf("unexpected description: %v", sw.Description)
+	}
+	if len(sw.Ports) != 3 {
+		t.Fatalf("unexpected number of ports: expected=3, got=%v", len(sw.Ports))
+	}
+	for i, p := range sw.Ports {
+		if p.Number != uint16(i+1) {
+			t.Fatalf("unexpected port order: expected=%v, got=%v", i+1, p.Number)
+		}
+	}
+
+	// The key should be changed if a port is changed.
+	ports[0] = &mockPort{number: 3, name: "eth3-new"}
+	if newDiscoveredSwitch(1, desc, 0xff00, ports).key() == sw.key() {
+		t.Fatal("the key is not changed by a renamed port")
+	}
+	if newDiscoveredSwitch(1, desc, 0xff00, ports[1:]).key() == sw.key() {
+		t.Fatal("the key is not changed by a removed port")
+	}
+
+	// The description should be truncated to fit in the database.
+	desc.Description = strings.Repeat("가", maxSwitchDescription+1)
+	if v := newDiscoveredSwitch(1, desc, 0xff00, ports).Description; v != strings.Repeat("가", maxSwitchDescription) {
+		t.Fatalf("unexpected truncated description: %v", v)
+	}
+}
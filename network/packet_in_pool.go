@@ -0,0 +1,192 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/protocol"
+)
+
+// PacketInOverflow decides how to treat a PACKET_IN message whose worker queue is full.
+type PacketInOverflow int
+
+const (
+	// OverflowBlock waits until the worker queue has a room, which stops reading the
+	// next messages from the switch.
+	OverflowBlock PacketInOverflow = iota
+	// OverflowShed drops the message.
+	OverflowShed
+)
+
+func (r PacketInOverflow) String() string {
+	switch r {
+	case OverflowBlock:
+		return "block"
+	case OverflowShed:
+		return "shed"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(r))
+	}
+}
+
+// ParsePacketInOverflow converts overflow into a PacketInOverflow. An empty string means
+// the default that blocks.
+func ParsePacketInOverflow(overflow string) (PacketInOverflow, error) {
+	switch strings.ToLower(strings.TrimSpace(overflow)) {
+	case "", "block":
+		return OverflowBlock, nil
+	case "shed":
+		return OverflowShed, nil
+	default:
+		return OverflowBlock, fmt.Errorf("unknown PACKET_IN overflow policy: %v", overflow)
+	}
+}
+
+type packetInJob struct {
+	inPort *Port
+	packet *protocol.Ethernet
+}
+
+type packetInHandler func(inPort *Port, packet *protocol.Ethernet) error
+
+// packetInPool delivers the PACKET_IN messages to the handler using a fixed number of
+// workers. The messages are sharded by their source MAC addresses, so that the messages
+// from a host are handled in order while the ones from different hosts are handled in
+// parallel.
+type packetInPool struct {
+	handler  packetInHandler
+	overflow PacketInOverflow
+	queues   []chan packetInJob
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mutex sync.Mutex
+	// Number of the shed messages that have not been reported yet.
+	shed     uint64
+	reported time.Time
+}
+
+// newPacketInPool returns a pool that has the specified number of workers, each of which
+// has a queue of queueSize messages. It returns nil if workers is zero or one, which means
+// that the messages should be handled by the caller in the order they are received, because
+// a single worker does not handle the messages in parallel.
+func newPacketInPool(workers, queueSize int, overflow PacketInOverflow, handler packetInHandler) *packetInPool {
+	if workers <= 1 {
+		return nil
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	v := &packetInPool{
+		handler:  handler,
+		overflow: overflow,
+		queues:   make([]chan packetInJob, workers),
+		done:     make(chan struct{}),
+	}
+	for i := range v.queues {
+		v.queues[i] = make(chan packetInJob, queueSize)
+	}
+
+	return v
+}
+
+func (r *packetInPool) run() {
+	for _, queue := range r.queues {
+		r.wg.Add(1)
+		go r.work(queue)
+	}
+}
+
+func (r *packetInPool) work(queue <-chan packetInJob) {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case job := <-queue:
+			// The session cannot be closed by the errors of the applications any more
+			// because they are not returned to the transceiver.
+			if err := r.handler(job.inPort, job.packet); err != nil {
+				logger.Errorf("failed to handle PACKET_IN: deviceID=%v, inPort=%v: %v", job.inPort.Device().ID(), job.inPort.Number(), err)
+			}
+		}
+	}
+}
+
+// stop terminates the workers after they finish the current messages. The remaining
+// messages in the queues are discarded.
+func (r *packetInPool) stop() {
+	close(r.done)
+	r.wg.Wait()
+}
+
+// submit queues the packet received from inPort to the worker responsible for its source
+// MAC address. It returns false if the packet has been shed or the pool has been stopped.
+func (r *packetInPool) submit(inPort *Port, packet *protocol.Ethernet) bool {
+	job := packetInJob{inPort: inPort, packet: packet}
+	queue := r.queues[r.shard(packet)]
+
+	if r.overflow == OverflowShed {
+		select {
+		case queue <- job:
+			return true
+		default:
+			r.reportShed(inPort)
+			return false
+		}
+	}
+
+	select {
+	case queue <- job:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+func (r *packetInPool) shard(packet *protocol.Ethernet) int {
+	h := fnv.New32a()
+	h.Write(packet.SrcMAC)
+
+	return int(h.Sum32() % uint32(len(r.queues)))
+}
+
+// reportShed logs the number of the shed messages at most once a second not to flood the log.
+func (r *packetInPool) reportShed(inPort *Port) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.shed++
+	if time.Since(r.reported) < time.Second {
+		return
+	}
+	logger.Warningf("shed %v PACKET_IN message(s) due to the full worker queues: deviceID=%v", r.shed, inPort.Device().ID())
+	r.shed = 0
+	r.reported = time.Now()
+}
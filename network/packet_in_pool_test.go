@@ -0,0 +1,126 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015-2019 Samjung Data Service, Inc. All rights reserved.
+ *  Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/superkkt/cherry/protocol"
+)
+
+func TestPacketInPoolOrdering(t *testing.T) {
+	var mutex sync.Mutex
+	received := make(map[string][]uint16)
+
+	pool := newPacketInPool(4, 2, OverflowBlock, func(inPort *Port, packet *protocol.Ethernet) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		received[packet.SrcMAC.String()] = append(received[packet.SrcMAC.String()], packet.Type)
+		return nil
+	})
+	pool.run()
+
+	port := NewPort(&Device{}, 1)
+	hosts := []net.HardwareAddr{
+		net.HardwareAddr{0, 0, 0, 0, 0, 1},
+		net.HardwareAddr{0, 0, 0, 0, 0, 2},
+		net.HardwareAddr{0, 0, 0, 0, 0, 3},
+		net.HardwareAddr{0, 0, 0, 0, 0, 4},
+		net.HardwareAddr{0, 0, 0, 0, 0, 5},
+	}
+	const count = 1000
+	for i := 0; i < count; i++ {
+		for _, mac := range hosts {
+			// Type is used as the sequence number of the packet.
+			if pool.submit(port, &protocol.Ethernet{SrcMAC: mac, Type: uint16(i)}) == false {
+				t.Fatalf("failed to submit a packet: mac=%v, seq=%v", mac, i)
+			}
+		}
+	}
+
+	// Wait until all the submitted packets are handled.
+	for {
+		mutex.Lock()
+		n := 0
+		for _, v := range received {
+			n += len(v)
+		}
+		mutex.Unlock()
+		if n == count*len(hosts) {
+			break
+		}
+		runtime.Gosched()
+	}
+	pool.stop()
+
+	for _, mac := range hosts {
+		seq := received[mac.String()]
+		if len(seq) != count {
+			t.Fatalf("unexpected number of packets: mac=%v, expected=%v, got=%v", mac, count, len(seq))
+		}
+		for i, v := range seq {
+			if v != uint16(i) {
+				t.Fatalf("unexpected order of packets: mac=%v, expected=%v, got=%v", mac, i, v)
+			}
+		}
+	}
+}
+
+func TestPacketInPoolShedding(t *testing.T) {
+	release := make(chan struct{})
+	pool := newPacketInPool(2, 1, OverflowShed, func(inPort *Port, packet *protocol.Ethernet) error {
+		<-release
+		return nil
+	})
+	pool.run()
+	defer pool.stop()
+
+	port := NewPort(&Device{}, 1)
+	packet := &protocol.Ethernet{SrcMAC: net.HardwareAddr{0, 0, 0, 0, 0, 1}}
+
+	// The first packet is taken by the worker, and then the second one fills the queue.
+	if pool.submit(port, packet) == false {
+		t.Fatal("failed to submit the first packet")
+	}
+	for len(pool.queues[pool.shard(packet)]) != 0 {
+		runtime.Gosched()
+	}
+	if pool.submit(port, packet) == false {
+		t.Fatal("failed to submit the second packet")
+	}
+	if pool.submit(port, packet) == true {
+		t.Fatal("expected the third packet to be shed")
+	}
+	close(release)
+}
+
+func TestPacketInPoolDisabled(t *testing.T) {
+	if newPacketInPool(0, 256, OverflowBlock, nil) != nil {
+		t.Fatal("expected a nil pool for zero workers")
+	}
+	if newPacketInPool(1, 256, OverflowBlock, nil) != nil {
+		t.Fatal("expected a nil pool for a single worker")
+	}
+}
@@ -0,0 +1,138 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/superkkt/cherry/graph"
+)
+
+// PathConstraint restricts the candidate paths between two hosts.
+type PathConstraint struct {
+	// Device IDs that should not be on the paths.
+	ExcludeDevices []string
+	// Link IDs that should not be on the paths.
+	ExcludeLinks []string
+	// Minimum link speed in MB. Zero means no limit.
+	MinBandwidth uint64
+	// Maximum number of links among switches on a path. Zero means no limit.
+	MaxHops int
+}
+
+func (r PathConstraint) graphConstraint() graph.Constraint {
+	c := graph.Constraint{
+		ExcludeVertexies: make(map[string]bool),
+		ExcludeEdges:     make(map[string]bool),
+		MaxHops:          r.MaxHops,
+	}
+	for _, v := range r.ExcludeDevices {
+		c.ExcludeVertexies[v] = true
+	}
+	for _, v := range r.ExcludeLinks {
+		c.ExcludeEdges[v] = true
+	}
+	if r.MinBandwidth > 0 {
+		c.Filter = func(e graph.Edge) bool {
+			return e.(*link).Bandwidth() >= r.MinBandwidth
+		}
+	}
+
+	return c
+}
+
+// PathSnapshot is a candidate path between two hosts down to the switch-port level.
+type PathSnapshot struct {
+	// Cost is the sum of the link costs used in the shortest path calculation.
+	Cost float64       `json:"cost"`
+	Hops []HopSnapshot `json:"hops"`
+}
+
+// HopSnapshot is a switch on a path with its ingress and egress ports.
+type HopSnapshot struct {
+	DeviceID string `json:"device_id"`
+	InPort   uint32 `json:"in_port"`
+	OutPort  uint32 `json:"out_port"`
+}
+
+// Paths returns at most k candidate paths from the src host to the dst host that satisfy
+// c, in increasing order of their costs. The paths may go through the links disabled by
+// the spanning tree.
+func (r *Controller) Paths(src, dst net.HardwareAddr, k int, c PathConstraint) ([]PathSnapshot, error) {
+	if k <= 0 {
+		return nil, errors.New("invalid number of paths")
+	}
+
+	srcNode, err := r.hostNode(src)
+	if err != nil {
+		return nil, err
+	}
+	dstNode, err := r.hostNode(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.topo.paths(srcNode.Port(), dstNode.Port(), k, c), nil
+}
+
+func (r *Controller) hostNode(mac net.HardwareAddr) (*Node, error) {
+	node, status, err := r.topo.Node(mac)
+	if err != nil {
+		return nil, err
+	}
+	if status != LocationDiscovered {
+		return nil, fmt.Errorf("unknown location of the host: %v", mac)
+	}
+
+	return node, nil
+}
+
+func (r *topology) paths(src, dst *Port, k int, c PathConstraint) []PathSnapshot {
+	result := make([]PathSnapshot, 0)
+	for _, v := range c.ExcludeDevices {
+		if v == src.Device().ID() || v == dst.Device().ID() {
+			return result
+		}
+	}
+
+	// Both hosts are on the same device.
+	if src.Device().ID() == dst.Device().ID() {
+		hop := HopSnapshot{DeviceID: src.Device().ID(), InPort: src.Number(), OutPort: dst.Number()}
+		return append(result, PathSnapshot{Cost: 0, Hops: []HopSnapshot{hop}})
+	}
+
+	for _, path := range r.graph.FindKShortestPaths(src.Device(), dst.Device(), k, c.graphConstraint()) {
+		v := PathSnapshot{Cost: graph.Cost(path), Hops: make([]HopSnapshot, 0, len(path)+1)}
+		ingress := src
+		for _, hop := range path {
+			ports := pickPort(hop.V.(*Device), hop.E.(*link))
+			v.Hops = append(v.Hops, HopSnapshot{DeviceID: ingress.Device().ID(), InPort: ingress.Number(), OutPort: ports[0].Number()})
+			ingress = ports[1]
+		}
+		v.Hops = append(v.Hops, HopSnapshot{DeviceID: ingress.Device().ID(), InPort: ingress.Number(), OutPort: dst.Number()})
+		result = append(result, v)
+	}
+
+	return result
+}
@@ -0,0 +1,173 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"sync"
+	"time"
+
+	"github.com/superkkt/viper"
+)
+
+// tokenBucket allows rate events per second on average, and bursts of up to rate events.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		tokens: rate,
+		last:   now,
+	}
+}
+
+// take consumes a token, and then returns whether the token has been available.
+func (r *tokenBucket) take(now time.Time) bool {
+	if elapsed := now.Sub(r.last).Seconds(); elapsed > 0 {
+		r.tokens += elapsed * r.rate
+		if r.tokens > r.rate {
+			r.tokens = r.rate
+		}
+	}
+	r.last = now
+
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+
+	return true
+}
+
+type policerVerdict int
+
+const (
+	// Accept the PACKET_IN message.
+	verdictAccept policerVerdict = iota
+	// Drop the PACKET_IN message whose source has been already reported.
+	verdictDrop
+	// Drop the PACKET_IN message whose ingress port has exceeded its budget, which has
+	// not been reported during the block time.
+	verdictPortExceeded
+	// Drop the PACKET_IN message whose device has exceeded its budget, which has not
+	// been reported during the block time.
+	verdictDeviceExceeded
+)
+
+// packetInPolicer limits the rate of the PACKET_IN messages from each ingress port and
+// from a device to protect the controller from a flood of the PACKET_IN messages. The
+// ports connected to other switches are only limited by the rate of the device.
+type packetInPolicer struct {
+	mutex      sync.Mutex
+	portRate   float64 // Zero means unlimited.
+	deviceRate float64 // Zero means unlimited.
+	// True if the offending port should be blocked during the block time after it exceeds
+	// its budget. Otherwise, only the excess PACKET_IN messages are dropped.
+	blockPort bool
+	// Duration that the offending port is blocked, or that the excess PACKET_IN messages
+	// are not reported again.
+	blockTime time.Duration
+	device    *tokenBucket
+	ports     map[uint32]*tokenBucket
+	// Time until that the port is blocked.
+	blocked map[uint32]time.Time
+	// Last time that the port has been reported to exceed its budget.
+	portReported map[uint32]time.Time
+	// Last time that the device has been reported to exceed its budget. The excess
+	// PACKET_IN messages of the device are just dropped without blocking the device.
+	deviceReported time.Time
+}
+
+func newPacketInPolicer() *packetInPolicer {
+	return &packetInPolicer{
+		portRate:     viper.GetFloat64("packet_in.port_rate"),
+		deviceRate:   viper.GetFloat64("packet_in.device_rate"),
+		blockPort:    viper.GetBool("packet_in.block_port"),
+		blockTime:    time.Duration(viper.GetInt("packet_in.block_time")) * time.Second,
+		ports:        make(map[uint32]*tokenBucket),
+		blocked:      make(map[uint32]time.Time),
+		portReported: make(map[uint32]time.Time),
+	}
+}
+
+// police returns the verdict on a PACKET_IN message from port. edge should be true if
+// the port is connected to another switch.
+func (r *packetInPolicer) police(port uint32, edge bool, now time.Time) policerVerdict {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.isBlocked(port, now) {
+		return verdictDrop
+	}
+
+	// Do not limit the edge between switches, which relays the PACKET_IN messages of
+	// all the hosts behind it.
+	if r.portRate > 0 && !edge {
+		bucket, ok := r.ports[port]
+		if !ok {
+			bucket = newTokenBucket(r.portRate, now)
+			r.ports[port] = bucket
+		}
+		if bucket.take(now) == false {
+			if r.blockPort {
+				r.blocked[port] = now.Add(r.blockTime)
+				return verdictPortExceeded
+			}
+			if now.Sub(r.portReported[port]) < r.blockTime {
+				return verdictDrop
+			}
+			r.portReported[port] = now
+			return verdictPortExceeded
+		}
+	}
+	if r.deviceRate > 0 {
+		if r.device == nil {
+			r.device = newTokenBucket(r.deviceRate, now)
+		}
+		if r.device.take(now) == false {
+			if now.Sub(r.deviceReported) < r.blockTime {
+				return verdictDrop
+			}
+			r.deviceReported = now
+			return verdictDeviceExceeded
+		}
+	}
+
+	return verdictAccept
+}
+
+// XXX: Caller should lock the mutex.
+func (r *packetInPolicer) isBlocked(port uint32, now time.Time) bool {
+	until, ok := r.blocked[port]
+	if !ok {
+		return false
+	}
+	if now.Before(until) {
+		return true
+	}
+	delete(r.blocked, port)
+
+	return false
+}
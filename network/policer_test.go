@@ -0,0 +1,112 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015-2019 Samjung Data Service, Inc. All rights reserved.
+ *  Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPacketInPolicer(t *testing.T) {
+	p := &packetInPolicer{
+		portRate:     2,
+		deviceRate:   3,
+		blockPort:    true,
+		blockTime:    10 * time.Second,
+		ports:        make(map[uint32]*tokenBucket),
+		blocked:      make(map[uint32]time.Time),
+		portReported: make(map[uint32]time.Time),
+	}
+	now := time.Now()
+
+	src := []struct {
+		port     uint32
+		elapsed  time.Duration // Since the beginning of the test.
+		expected policerVerdict
+	}{
+		{1, 0, verdictAccept},
+		{1, 0, verdictAccept},
+		// Port 1 exceeds its budget, and then it is blocked.
+		{1, 0, verdictPortExceeded},
+		{1, 0, verdictDrop},
+		{2, 0, verdictAccept},
+		// The device exceeds its budget, which is reported only once during the block time.
+		{3, 0, verdictDeviceExceeded},
+		{3, 0, verdictDrop},
+		{4, 0, verdictDrop},
+		// The device bucket is refilled, but port 1 is still blocked.
+		{1, 1 * time.Second, verdictDrop},
+		{2, 1 * time.Second, verdictAccept},
+		// Port 1 is unblocked after the block time.
+		{1, 11 * time.Second, verdictAccept},
+	}
+
+	for i, v := range src {
+		verdict := p.police(v.port, false, now.Add(v.elapsed))
+		if verdict != v.expected {
+			t.Fatalf("#%v: unexpected verdict: port=%v, expected=%v, got=%v", i, v.port, v.expected, verdict)
+		}
+	}
+}
+
+func TestPacketInPolicerWithoutBlocking(t *testing.T) {
+	p := &packetInPolicer{
+		portRate:     2,
+		blockTime:    10 * time.Second,
+		ports:        make(map[uint32]*tokenBucket),
+		blocked:      make(map[uint32]time.Time),
+		portReported: make(map[uint32]time.Time),
+	}
+	now := time.Now()
+
+	src := []struct {
+		port     uint32
+		edge     bool
+		elapsed  time.Duration // Since the beginning of the test.
+		expected policerVerdict
+	}{
+		{1, false, 0, verdictAccept},
+		{1, false, 0, verdictAccept},
+		// Port 1 exceeds its budget, which is reported only once during the block time.
+		{1, false, 0, verdictPortExceeded},
+		{1, false, 0, verdictDrop},
+		// The edge between switches is not limited.
+		{2, true, 0, verdictAccept},
+		{2, true, 0, verdictAccept},
+		{2, true, 0, verdictAccept},
+		// Port 1 is not blocked, so only the excess messages are dropped.
+		{1, false, 1 * time.Second, verdictAccept},
+		{1, false, 1 * time.Second, verdictAccept},
+		{1, false, 1 * time.Second, verdictDrop},
+		// Reported again after the block time.
+		{1, false, 11 * time.Second, verdictAccept},
+		{1, false, 11 * time.Second, verdictAccept},
+		{1, false, 11 * time.Second, verdictPortExceeded},
+	}
+
+	for i, v := range src {
+		verdict := p.police(v.port, v.edge, now.Add(v.elapsed))
+		if verdict != v.expected {
+			t.Fatalf("#%v: unexpected verdict: port=%v, expected=%v, got=%v", i, v.port, v.expected, verdict)
+		}
+	}
+}
@@ -23,7 +23,9 @@ package network
 
 import (
 	"fmt"
+	"net"
 	"sync"
+	"time"
 
 	"github.com/superkkt/cherry/graph"
 	"github.com/superkkt/cherry/openflow"
@@ -31,10 +33,25 @@ import (
 
 // Port represents a switch port and also implements the graph.Point interface.
 type Port struct {
-	mutex  sync.RWMutex
-	device *Device
-	number uint32
-	value  openflow.Port
+	mutex    sync.RWMutex
+	device   *Device
+	number   uint32
+	value    openflow.Port
+	neighbor *Neighbor
+	stats    portStats
+}
+
+// Neighbor is a third-party (non-OpenFlow) device, such as a server, a legacy switch,
+// or a router, that has been discovered on a port by its LLDP advertisement.
+type Neighbor struct {
+	ChassisID         string    `json:"chassis_id"`
+	PortID            string    `json:"port_id"`
+	PortDescription   string    `json:"port_description,omitempty"`
+	SystemName        string    `json:"system_name,omitempty"`
+	SystemDescription string    `json:"system_description,omitempty"`
+	ManagementAddress net.IP    `json:"management_address,omitempty"`
+	Timestamp         time.Time `json:"timestamp"` // Last time that the advertisement has been received.
+	TTL               uint16    `json:"ttl"`
 }
 
 func NewPort(d *Device, num uint32) *Port {
@@ -68,6 +85,11 @@ func (r *Port) Number() uint32 {
 	return r.number
 }
 
+// VLAN returns the VLAN configuration of this port.
+func (r *Port) VLAN() PortVLAN {
+	return portVLAN(r.device.ID(), r.number)
+}
+
 func (r *Port) Value() openflow.Port {
 	// Read lock
 	r.mutex.RLock()
@@ -83,3 +105,29 @@ func (r *Port) SetValue(p openflow.Port) {
 
 	r.value = p
 }
+
+// Neighbor returns the LLDP neighbor discovered on this port. It returns nil if there
+// is no neighbor or the last advertisement has been expired by its TTL.
+func (r *Port) Neighbor() *Neighbor {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.neighbor == nil {
+		return nil
+	}
+	if time.Since(r.neighbor.Timestamp) > time.Duration(r.neighbor.TTL)*time.Second {
+		return nil
+	}
+	v := *r.neighbor
+
+	return &v
+}
+
+func (r *Port) setNeighbor(n *Neighbor) {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.neighbor = n
+}
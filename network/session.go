@@ -25,17 +25,22 @@ import (
 	"bytes"
 	"context"
 	"encoding"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/superkkt/cherry"
 	"github.com/superkkt/cherry/openflow"
 	"github.com/superkkt/cherry/openflow/of10"
 	"github.com/superkkt/cherry/openflow/of13"
 	"github.com/superkkt/cherry/openflow/transceiver"
 	"github.com/superkkt/cherry/protocol"
+
+	"github.com/superkkt/viper"
 )
 
 var (
@@ -44,29 +49,52 @@ var (
 
 const (
 	deviceExplorerInterval = 1 * time.Minute
+	// This interval should be shorter than the idle timeout of the normal flows to
+	// reinstall the evicted flows before they are considered as unused ones.
+	flowReconcileInterval = 30 * time.Second
 )
 
 type session struct {
 	negotiated  bool
+	localAddr   net.Addr
+	remoteAddr  net.Addr
 	device      *Device
 	transceiver *transceiver.Transceiver
 	handler     transceiver.Handler
 	watcher     watcher
 	finder      Finder
 	listener    ControllerEventListener
+	publisher   EventPublisher
+	policer     *packetInPolicer
+	// Nil if the PACKET_IN messages are handled by the transceiver loop.
+	pool      *packetInPool
+	db        database
+	admission AdmissionPolicy
+
+	mutex       sync.RWMutex
+	quarantined bool
+	// DPID of the device, which is available after receiving FEATURES_REPLY.
+	dpid uint64
+	// Key of the last discovered switch reported to the database.
+	discovered string
 }
 
 type sessionConfig struct {
-	conn     net.Conn
-	watcher  watcher
-	finder   Finder
-	listener ControllerEventListener
+	conn      net.Conn
+	db        database
+	watcher   watcher
+	finder    Finder
+	listener  ControllerEventListener
+	publisher EventPublisher
 }
 
 func checkParam(c sessionConfig) {
 	if c.conn == nil {
 		panic("Conn is nil")
 	}
+	if c.db == nil {
+		panic("DB is nil")
+	}
 	if c.watcher == nil {
 		panic("Watcher is nil")
 	}
@@ -76,16 +104,37 @@ func checkParam(c sessionConfig) {
 	if c.listener == nil {
 		panic("Listener is nil")
 	}
+	if c.publisher == nil {
+		panic("Publisher is nil")
+	}
 }
 
 func newSession(c sessionConfig) *session {
 	checkParam(c)
 
+	admission, err := ParseAdmissionPolicy(viper.GetString("default.admission"))
+	if err != nil {
+		// admission should be already checked in the main code.
+		panic("invalid default.admission in the config file")
+	}
+	overflow, err := ParsePacketInOverflow(viper.GetString("packet_in.overflow"))
+	if err != nil {
+		// overflow should be already checked in the main code.
+		panic("invalid packet_in.overflow in the config file")
+	}
+
 	stream := transceiver.NewStream(c.conn, 0xFFFF)
 	v := new(session)
 	v.watcher = c.watcher
 	v.finder = c.finder
 	v.listener = c.listener
+	v.publisher = c.publisher
+	v.policer = newPacketInPolicer()
+	v.pool = newPacketInPool(viper.GetInt("packet_in.workers"), viper.GetInt("packet_in.queue_size"), overflow, v.handlePacketIn)
+	v.db = c.db
+	v.admission = admission
+	v.localAddr = c.conn.LocalAddr()
+	v.remoteAddr = c.conn.RemoteAddr()
 	v.device = newDevice(v)
 	v.transceiver = transceiver.NewTransceiver(stream, v)
 
@@ -143,8 +192,10 @@ func (r *session) OnFeaturesReply(f openflow.Factory, w transceiver.Writer, v op
 		// FeaturesReply packet. This additional FeaturesReply packet is raised by our
 		// device explorer. So, we have to skip the following device initialization routine.
 		logger.Debug("received FEATURES_REPLY that is a response for our device explorer's probe")
+		r.discoverFeaturesPorts(v)
 		return r.handler.OnFeaturesReply(f, w, v)
 	}
+	r.dpid = v.DPID()
 
 	// We got a first FeaturesReply packet! Let's initialize this device.
 	dpid := strconv.FormatUint(v.DPID(), 10)
@@ -152,6 +203,24 @@ func (r *session) OnFeaturesReply(f openflow.Factory, w transceiver.Writer, v op
 	if r.finder.Device(dpid) != nil {
 		return errors.New("duplicated device DPID (aux. connection is not supported yet)")
 	}
+	admitted, err := r.admit(v.DPID())
+	if err != nil {
+		return err
+	}
+	if !admitted {
+		logger.Warningf("device is quarantined: DPID=%v, address=%v", dpid, r.remoteAddr)
+		// Keep the connection without initializing the device. The device explorer will probe
+		// this device again to check whether it has been registered.
+		if f.ProtocolVersion() == openflow.OF13_VERSION {
+			// Discover the ports of this device so that the administrator can register it.
+			if err := sendPortDescriptionRequest(f, w); err != nil {
+				return err
+			}
+		} else {
+			r.discoverFeaturesPorts(v)
+		}
+		return nil
+	}
 	r.device.setID(dpid)
 	logger.Infof("device is ready: DPID=%v, Description=%+v", dpid, r.device.Descriptions())
 
@@ -167,10 +236,112 @@ func (r *session) OnFeaturesReply(f openflow.Factory, w transceiver.Writer, v op
 		NumTables:  v.NumTables(),
 	}
 	r.device.setFeatures(features)
+	r.discoverFeaturesPorts(v)
 
 	return r.handler.OnFeaturesReply(f, w, v)
 }
 
+// discoverFeaturesPorts reports the ports in v if the device is OF10 that provides
+// ports information in FEATURES_REPLY.
+func (r *session) discoverFeaturesPorts(v openflow.FeaturesReply) {
+	if r.device.Factory().ProtocolVersion() != openflow.OF10_VERSION {
+		return
+	}
+	r.discover(of10.OFPP_MAX, v.Ports())
+}
+
+// discover reports the device and its ports to the database as a discovered switch if they
+// have been changed since the last report. The administrator can register the discovered
+// switch without typing its information by hand, and the ports of the registered switch
+// are synchronized with the discovered ones.
+func (r *session) discover(maxPort uint32, ports []openflow.Port) {
+	sw := newDiscoveredSwitch(r.dpid, r.device.Descriptions(), maxPort, ports)
+	key := sw.key()
+	if key == r.discovered {
+		return
+	}
+
+	if err := r.db.UpdateDiscoveredSwitch(sw); err != nil {
+		// Ignore this error. We will retry on the next probe of the device explorer.
+		logger.Errorf("failed to update the discovered switch: DPID=%v: %v", r.dpid, err)
+		return
+	}
+	logger.Debugf("updated the discovered switch: DPID=%v, # of ports=%v", r.dpid, len(sw.Ports))
+	r.discovered = key
+}
+
+// admit checks the admission policy for the device whose DPID is dpid, and then returns
+// whether the device can be initialized. An error is returned if the device is rejected.
+func (r *session) admit(dpid uint64) (admitted bool, err error) {
+	if r.admission == AdmissionNone {
+		return true, nil
+	}
+
+	registered, err := r.db.IsRegisteredSwitch(dpid)
+	if err != nil {
+		return false, fmt.Errorf("failed to check the switch registration: %v", err)
+	}
+	event := AdmissionEvent{DeviceID: strconv.FormatUint(dpid, 10), Address: r.remoteAddr.String()}
+	if registered {
+		if r.setQuarantined(false) {
+			logger.Infof("quarantined device has been registered: DPID=%v", dpid)
+			r.publisher.Publish(EventSwitchAdmitted, event)
+		}
+		return true, nil
+	}
+
+	switch r.admission {
+	case AdmissionReject:
+		r.addPendingSwitch(dpid, false)
+		r.publisher.Publish(EventSwitchRejected, event)
+		return false, fmt.Errorf("unregistered device is rejected: DPID=%v", dpid)
+	case AdmissionQuarantine:
+		// Already quarantined device that is probed by our device explorer?
+		if r.setQuarantined(true) {
+			r.addPendingSwitch(dpid, true)
+			r.publisher.Publish(EventSwitchQuarantined, event)
+		}
+		return false, nil
+	default:
+		panic(fmt.Sprintf("unexpected admission policy: %v", r.admission))
+	}
+}
+
+func (r *session) addPendingSwitch(dpid uint64, quarantined bool) {
+	sw := PendingSwitch{
+		DPID:        dpid,
+		Address:     r.remoteAddr.String(),
+		Quarantined: quarantined,
+	}
+	if err := r.db.AddPendingSwitch(sw); err != nil {
+		// Ignore this error.
+		logger.Errorf("failed to add a pending switch: DPID=%v: %v", dpid, err)
+	}
+}
+
+// setQuarantined sets the quarantine state of this session, and then returns whether
+// the state has been changed.
+func (r *session) setQuarantined(quarantined bool) bool {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.quarantined == quarantined {
+		return false
+	}
+	r.quarantined = quarantined
+
+	return true
+}
+
+func (r *session) isQuarantined() bool {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.quarantined
+}
+
 func (r *session) OnGetConfigReply(f openflow.Factory, w transceiver.Writer, v openflow.GetConfigReply) error {
 	logger.Debug("GET_CONFIG_REPLY is received")
 
@@ -198,6 +369,9 @@ func (r *session) OnDescReply(f openflow.Factory, w transceiver.Writer, v openfl
 		Description:  v.Description(),
 	}
 	r.device.setDescriptions(desc)
+	driver := findDriverProfile(desc)
+	r.device.setDriver(driver)
+	logger.Infof("driver profile for %v: %v", r.device.ID(), driver.Name)
 
 	return r.handler.OnDescReply(f, w, v)
 }
@@ -209,10 +383,71 @@ func (r *session) OnPortDescReply(f openflow.Factory, w transceiver.Writer, v op
 		return errNotNegotiated
 	}
 
+	r.discover(of13.OFPP_MAX, v.Ports())
+	// Do not initialize the ports of the quarantined device.
+	if r.isQuarantined() {
+		return nil
+	}
+
 	return r.handler.OnPortDescReply(f, w, v)
 }
 
-func newLLDPEtherFrame(deviceID string, port openflow.Port) ([]byte, error) {
+func (r *session) OnFlowStatsReply(f openflow.Factory, w transceiver.Writer, v openflow.FlowStatsReply) error {
+	logger.Debugf("FLOW_STATS_REPLY is received (# of flows=%v, more=%v)", len(v.Flows()), v.More())
+
+	if !r.negotiated {
+		return errNotNegotiated
+	}
+
+	if err := r.device.reconcileFlows(v); err != nil {
+		logger.Errorf("failed to reconcile the flows on %v: %v", r.device.ID(), err)
+		// Ignore this error and keep go on.
+	}
+
+	return r.handler.OnFlowStatsReply(f, w, v)
+}
+
+func (r *session) OnPortStatsReply(f openflow.Factory, w transceiver.Writer, v openflow.PortStatsReply) error {
+	logger.Debugf("PORT_STATS_REPLY is received (# of ports=%v, more=%v)", len(v.Ports()), v.More())
+
+	if !r.negotiated {
+		return errNotNegotiated
+	}
+
+	r.device.updatePortStats(v)
+	if v.More() == false {
+		r.watcher.PortStatsUpdated(r.device)
+	}
+
+	return r.handler.OnPortStatsReply(f, w, v)
+}
+
+const (
+	lldpEtherType = 0x88CC
+	// BDDP (Broadcast Domain Discovery Protocol) ethertype. BDDP is a LLDP packet that
+	// is sent to the broadcast address so that it can go through legacy switches.
+	bddpEtherType = 0x8942
+	// Subtype of the organizationally specific TLV that carries the probe timestamp.
+	lldpTimestampSubType = 0x80
+)
+
+var (
+	// OUI of the organizationally specific TLV that carries the probe timestamp.
+	cherryOUI = [3]byte{0x00, 0x26, 0xE1}
+	// LLDP multicast MAC address that is not forwarded by the 802.1D bridges.
+	lldpDstMAC = net.HardwareAddr([]byte{0x01, 0x80, 0xC2, 0x00, 0x00, 0x0E})
+	bddpDstMAC = net.HardwareAddr([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+)
+
+func newLLDPEtherFrame(deviceID string, port openflow.Port, mgmtAddr net.IP) ([]byte, error) {
+	return newDiscoveryEtherFrame(lldpDstMAC, lldpEtherType, deviceID, port, mgmtAddr)
+}
+
+func newBDDPEtherFrame(deviceID string, port openflow.Port, mgmtAddr net.IP) ([]byte, error) {
+	return newDiscoveryEtherFrame(bddpDstMAC, bddpEtherType, deviceID, port, mgmtAddr)
+}
+
+func newDiscoveryEtherFrame(dstMAC net.HardwareAddr, etherType uint16, deviceID string, port openflow.Port, mgmtAddr net.IP) ([]byte, error) {
 	lldp := &protocol.LLDP{
 		ChassisID: protocol.LLDPChassisID{
 			SubType: 7, // Locally assigned alpha-numeric string
@@ -223,6 +458,19 @@ func newLLDPEtherFrame(deviceID string, port openflow.Port) ([]byte, error) {
 			Data:    []byte(fmt.Sprintf("cherry/%v", port.Number())),
 		},
 		TTL: 120,
+		// Optional TLVs to let legacy switches identify us.
+		PortDescription:   port.Name(),
+		SystemName:        fmt.Sprintf("cherry/%v", deviceID),
+		SystemDescription: fmt.Sprintf("Cherry OpenFlow Controller %v", cherry.Version),
+		// Timestamp to measure the link latency.
+		OrgSpecific: []protocol.LLDPOrgSpecific{newLLDPTimestamp(time.Now())},
+	}
+	if mgmtAddr != nil {
+		lldp.ManagementAddress = &protocol.LLDPManagementAddress{
+			Address:          mgmtAddr,
+			InterfaceSubType: 3, // System port number
+			InterfaceNumber:  port.Number(),
+		}
 	}
 	payload, err := lldp.MarshalBinary()
 	if err != nil {
@@ -230,11 +478,9 @@ func newLLDPEtherFrame(deviceID string, port openflow.Port) ([]byte, error) {
 	}
 
 	ethernet := &protocol.Ethernet{
-		SrcMAC: port.MAC(),
-		// LLDP multicast MAC address
-		DstMAC: []byte{0x01, 0x80, 0xC2, 0x00, 0x00, 0x0E},
-		// LLDP ethertype
-		Type:    0x88CC,
+		SrcMAC:  port.MAC(),
+		DstMAC:  dstMAC,
+		Type:    etherType,
 		Payload: payload,
 	}
 	frame, err := ethernet.MarshalBinary()
@@ -245,12 +491,49 @@ func newLLDPEtherFrame(deviceID string, port openflow.Port) ([]byte, error) {
 	return frame, nil
 }
 
+// sendLLDP sends LLDP and BDDP packets to p. BDDP discovers the links through the
+// legacy switches that drop LLDP packets.
 func sendLLDP(device *Device, p openflow.Port) error {
-	lldp, err := newLLDPEtherFrame(device.ID(), p)
+	lldp, err := newLLDPEtherFrame(device.ID(), p, device.session.localIP())
+	if err != nil {
+		return err
+	}
+	if err := sendDiscoveryFrame(device, p, lldp); err != nil {
+		return err
+	}
+
+	bddp, err := newBDDPEtherFrame(device.ID(), p, device.session.localIP())
 	if err != nil {
 		return err
 	}
 
+	return sendDiscoveryFrame(device, p, bddp)
+}
+
+func newLLDPTimestamp(t time.Time) protocol.LLDPOrgSpecific {
+	v := protocol.LLDPOrgSpecific{
+		OUI:     cherryOUI,
+		SubType: lldpTimestampSubType,
+		Info:    make([]byte, 8),
+	}
+	binary.BigEndian.PutUint64(v.Info, uint64(t.UnixNano()))
+
+	return v
+}
+
+// extractTimestamp returns the timestamp when the probe p has been sent.
+func extractTimestamp(p *protocol.LLDP) (t time.Time, ok bool) {
+	for _, v := range p.OrgSpecific {
+		if v.OUI != cherryOUI || v.SubType != lldpTimestampSubType || len(v.Info) != 8 {
+			continue
+		}
+		return time.Unix(0, int64(binary.BigEndian.Uint64(v.Info))), true
+	}
+
+	return time.Time{}, false
+}
+
+func sendDiscoveryFrame(device *Device, p openflow.Port, frame []byte) error {
 	outPort := openflow.NewOutPort()
 	outPort.SetValue(p.Number())
 
@@ -268,11 +551,21 @@ func sendLLDP(device *Device, p openflow.Port) error {
 	// From controller
 	out.SetInPort(openflow.NewInPort())
 	out.SetAction(action)
-	out.SetData(lldp)
+	out.SetData(frame)
 
 	return device.SendMessage(out)
 }
 
+// localIP returns the local IP address of the control channel, which is used as our management address.
+func (r *session) localIP() net.IP {
+	addr, ok := r.localAddr.(*net.TCPAddr)
+	if !ok || addr.IP.IsUnspecified() {
+		return nil
+	}
+
+	return addr.IP
+}
+
 func (r *session) sendPortEvent(portNum uint32, up bool) {
 	port := r.device.Port(portNum)
 	if port == nil {
@@ -348,6 +641,10 @@ func (r *session) OnFlowRemoved(f openflow.Factory, w transceiver.Writer, v open
 	if !r.negotiated {
 		return errNotNegotiated
 	}
+	// The removed flow is no longer a desired one.
+	if v.Cookie()&(0x1<<63) == 0 {
+		r.device.removeDesiredFlow(v.Cookie())
+	}
 
 	if err := r.listener.OnFlowRemoved(r.finder, v); err != nil {
 		logger.Errorf("error on OnFlowRemoved listeners: %v", err)
@@ -367,7 +664,11 @@ func getEthernet(packet []byte) (*protocol.Ethernet, error) {
 }
 
 func isLLDP(e *protocol.Ethernet) bool {
-	return e.Type == 0x88CC
+	return e.Type == lldpEtherType
+}
+
+func isBDDP(e *protocol.Ethernet) bool {
+	return e.Type == bddpEtherType
 }
 
 func getLLDP(packet []byte) (*protocol.LLDP, error) {
@@ -396,6 +697,20 @@ func isCherryLLDP(p *protocol.LLDP) bool {
 	return true
 }
 
+// hasCherryTLV returns whether p carries any TLV of the probes that we send.
+func hasCherryTLV(p *protocol.LLDP) bool {
+	if bytes.HasPrefix(p.PortID.Data, []byte("cherry/")) {
+		return true
+	}
+	for _, v := range p.OrgSpecific {
+		if v.OUI == cherryOUI {
+			return true
+		}
+	}
+
+	return false
+}
+
 func extractDeviceInfo(p *protocol.LLDP) (deviceID string, portNum uint32, err error) {
 	if !isCherryLLDP(p) {
 		return "", 0, errors.New("not found cherry LLDP packet")
@@ -424,15 +739,74 @@ func (r *session) findNeighborPort(deviceID string, portNum uint32) (*Port, erro
 	return port, nil
 }
 
+func (r *session) updateNeighbor(inPort *Port, lldp *protocol.LLDP) {
+	n := &Neighbor{
+		ChassisID:         formatLLDPID(lldp.ChassisID.SubType == 4, lldp.ChassisID.Data),
+		PortID:            formatLLDPID(lldp.PortID.SubType == 3, lldp.PortID.Data),
+		PortDescription:   lldp.PortDescription,
+		SystemName:        lldp.SystemName,
+		SystemDescription: lldp.SystemDescription,
+		Timestamp:         time.Now(),
+		TTL:               lldp.TTL,
+	}
+	if lldp.ManagementAddress != nil {
+		n.ManagementAddress = lldp.ManagementAddress.Address
+	}
+	inPort.setNeighbor(n)
+	logger.Debugf("updated the LLDP neighbor on %v: %+v", inPort.ID(), n)
+}
+
+// formatLLDPID returns a human readable string of the chassis ID or port ID.
+func formatLLDPID(isMAC bool, data []byte) string {
+	if isMAC && len(data) == 6 {
+		return net.HardwareAddr(data).String()
+	}
+
+	return string(data)
+}
+
+// linkLatency estimates the one-way latency of the link from the sender device to us
+// using the timestamp in the probe. The elapsed time of the probe includes the half
+// RTTs of the control channels to the sender and receiver devices. It returns a negative
+// value if the latency cannot be estimated.
+func (r *session) linkLatency(p *protocol.LLDP, sender *Device) time.Duration {
+	sent, ok := extractTimestamp(p)
+	if !ok {
+		return -1
+	}
+	rtt1 := sender.session.transceiver.RTT()
+	rtt2 := r.transceiver.RTT()
+	// RTTs are not yet measured?
+	if rtt1 == 0 || rtt2 == 0 {
+		return -1
+	}
+
+	latency := time.Since(sent) - (rtt1+rtt2)/2
+	if latency < 0 {
+		latency = 0
+	}
+
+	return latency
+}
+
 func (r *session) handleLLDP(inPort *Port, ethernet *protocol.Ethernet) error {
 	lldp, err := getLLDP(ethernet.Payload)
 	if err != nil {
 		return err
 	}
+	bddp := isBDDP(ethernet)
 	deviceID, portNum, err := extractDeviceInfo(lldp)
 	if err != nil {
-		// Do nothing if this packet is not the one we sent
-		logger.Debug("ignoring a LLDP packet issued by an unknown device")
+		// Malformed probe or the one sent by a different version of Cherry?
+		if hasCherryTLV(lldp) {
+			logger.Debugf("ignoring an unrecognized Cherry LLDP packet on %v: %v", inPort.ID(), err)
+			return nil
+		}
+		// This packet is not the one we sent, so that it is issued by a third-party neighbor,
+		// which is only recorded on the edge ports that are not connected to other switches.
+		if !bddp && !r.finder.IsEdge(inPort) {
+			r.updateNeighbor(inPort, lldp)
+		}
 		return nil
 	}
 	port, err := r.findNeighborPort(deviceID, portNum)
@@ -441,7 +815,8 @@ func (r *session) handleLLDP(inPort *Port, ethernet *protocol.Ethernet) error {
 		logger.Debugf("ignoring a LLDP packet: %v", err)
 		return nil
 	}
-	r.watcher.DeviceLinked([2]*Port{inPort, port})
+	// BDDP is received through a broadcast domain, which may connect more than two ports.
+	r.watcher.DeviceLinked([2]*Port{inPort, port}, bddp, r.linkLatency(lldp, port.Device()))
 
 	return nil
 }
@@ -471,22 +846,71 @@ func (r *session) OnPacketIn(f openflow.Factory, w transceiver.Writer, v openflo
 		logger.Errorf("failed to find a port: deviceID=%v, portNum=%v, so ignore PACKET_IN..", r.device.ID(), v.InPort())
 		return nil
 	}
-	// Process LLDP, and then add an edge among two switches. This should be executed
+	// Process LLDP and BDDP, and then add an edge among two switches. This should be executed
 	// before checking whether the ingress port is one of STP disabled ports!
-	if isLLDP(ethernet) {
+	if isLLDP(ethernet) || isBDDP(ethernet) {
 		return r.handleLLDP(inPort, ethernet)
 	}
+	// Protect the controller from a flood of PACKET_IN messages.
+	if r.police(f, w, inPort) == false {
+		return nil
+	}
 	// Do nothing if the ingress port is an edge between switches and is disabled by STP.
 	if r.finder.IsEdge(inPort) && !r.finder.IsEnabledBySTP(inPort) {
-		logger.Debugf("ignoring PACKET_IN from %v:%v by STP", r.device.ID(), v.InPort())
-		return nil
+		// Unicast packets can come through the edges disabled by STP in the ECMP and SPB modes,
+		// but broadcast and multicast packets should be only flooded over the spanning
+		// tree to avoid a loop.
+		if r.finder.ForwardingMode() == ForwardingSTP || isMulticast(ethernet.DstMAC) {
+			logger.Debugf("ignoring PACKET_IN from %v:%v by STP", r.device.ID(), v.InPort())
+			return nil
+		}
 	}
 	// Call specific version handler
 	if err := r.handler.OnPacketIn(f, w, v); err != nil {
 		return err
 	}
 
-	return r.listener.OnPacketIn(r.finder, inPort, ethernet)
+	if r.pool == nil {
+		return r.handlePacketIn(inPort, ethernet)
+	}
+	r.pool.submit(inPort, ethernet)
+
+	return nil
+}
+
+func (r *session) handlePacketIn(inPort *Port, packet *protocol.Ethernet) error {
+	return r.listener.OnPacketIn(r.finder, inPort, packet)
+}
+
+// police returns whether the PACKET_IN message from inPort is allowed by the policer.
+func (r *session) police(f openflow.Factory, w transceiver.Writer, inPort *Port) bool {
+	event := PolicerEvent{DeviceID: r.device.ID()}
+
+	switch r.policer.police(inPort.Number(), r.finder.IsEdge(inPort), time.Now()) {
+	case verdictAccept:
+		return true
+	case verdictDrop:
+		return false
+	case verdictPortExceeded:
+		logger.Warningf("too many PACKET_IN messages from a port: deviceID=%v, port=%v", r.device.ID(), inPort.Number())
+		event.Port = inPort.Number()
+		// Block the port on the switch only if it is configured. Zero block time means that
+		// the excess messages are just dropped by the controller.
+		if r.policer.blockPort && r.policer.blockTime >= time.Second {
+			if err := setPortDrop(f, w, inPort.Number(), r.policer.blockTime); err != nil {
+				logger.Errorf("failed to block a port: deviceID=%v, port=%v: %v", r.device.ID(), inPort.Number(), err)
+			} else {
+				event.Blocked = true
+			}
+		}
+	case verdictDeviceExceeded:
+		logger.Warningf("too many PACKET_IN messages from a device: deviceID=%v", r.device.ID())
+	default:
+		panic("unexpected policer verdict")
+	}
+	r.publisher.Publish(EventPacketInPoliced, event)
+
+	return false
 }
 
 func (r *session) OnBarrierReply(f openflow.Factory, w transceiver.Writer, v openflow.BarrierReply) error {
@@ -501,6 +925,14 @@ func (r *session) OnBarrierReply(f openflow.Factory, w transceiver.Writer, v ope
 func (r *session) Run(ctx context.Context) {
 	stopExplorer := r.runDeviceExplorer(ctx)
 	logger.Debugf("started a new device explorer")
+	stopReconciler := r.runFlowReconciler(ctx)
+	logger.Debugf("started a new flow reconciler")
+	stopCollector := r.runPortStatsCollector(ctx)
+	logger.Debugf("started a new port stats collector")
+	if r.pool != nil {
+		r.pool.run()
+		logger.Debugf("started PACKET_IN workers")
+	}
 
 	if err := r.transceiver.Run(ctx); err != nil {
 		logger.Errorf("openflow transceiver is unexpectedly closed: %v", err)
@@ -508,6 +940,11 @@ func (r *session) Run(ctx context.Context) {
 	logger.Infof("disconnected device (DPID=%v)", r.device.ID())
 
 	stopExplorer()
+	stopReconciler()
+	stopCollector()
+	if r.pool != nil {
+		r.pool.stop()
+	}
 	r.transceiver.Close()
 	r.device.Close()
 	if r.device.isReady() {
@@ -534,6 +971,13 @@ func (r *session) runDeviceExplorer(ctx context.Context) context.CancelFunc {
 				return
 			case <-ticker:
 				if r.device.isReady() == false {
+					// Probe the quarantined device to check whether it has been registered.
+					if r.isQuarantined() {
+						if err := sendFeaturesRequest(r.device.Factory(), r.device.Writer()); err != nil {
+							logger.Errorf("failed to send a feature request: %v", err)
+						}
+						continue
+					}
 					logger.Debug("skip to execute the device explorer due to incomplete device status")
 					continue
 				}
@@ -565,6 +1009,69 @@ func (r *session) runDeviceExplorer(ctx context.Context) context.CancelFunc {
 	return canceller
 }
 
+// runFlowReconciler periodically requests the flow stats of the device to reconcile
+// the installed flows with the desired flows. The reconciliation is done when all
+// the flow stats replies are received.
+func (r *session) runFlowReconciler(ctx context.Context) context.CancelFunc {
+	subCtx, canceller := context.WithCancel(ctx)
+
+	go func() {
+		ticker := time.NewTicker(flowReconcileInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-subCtx.Done():
+				logger.Debugf("terminating the flow reconciler: deviceID=%v", r.device.ID())
+				return
+			case <-ticker.C:
+				if r.device.isReady() == false {
+					logger.Debug("skip to execute the flow reconciler due to incomplete device status")
+					continue
+				}
+				if err := r.device.sendFlowStatsRequest(); err != nil {
+					logger.Errorf("failed to send a flow stats request to %v: %v", r.device.ID(), err)
+					continue
+				}
+				logger.Debugf("sent a FlowStatsRequest packet to %v", r.device.ID())
+			}
+		}
+	}()
+
+	return canceller
+}
+
+// runPortStatsCollector periodically requests the port stats of the device to measure
+// the utilizations of its ports, which are used to calculate the link weights.
+func (r *session) runPortStatsCollector(ctx context.Context) context.CancelFunc {
+	subCtx, canceller := context.WithCancel(ctx)
+
+	go func() {
+		ticker := time.NewTicker(portStatsInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-subCtx.Done():
+				logger.Debugf("terminating the port stats collector: deviceID=%v", r.device.ID())
+				return
+			case <-ticker.C:
+				if r.device.isReady() == false {
+					logger.Debug("skip to execute the port stats collector due to incomplete device status")
+					continue
+				}
+				if err := r.device.sendPortStatsRequest(); err != nil {
+					logger.Errorf("failed to send a port stats request to %v: %v", r.device.ID(), err)
+					continue
+				}
+				logger.Debugf("sent a PortStatsRequest packet to %v", r.device.ID())
+			}
+		}
+	}()
+
+	return canceller
+}
+
 func (r *session) Write(msg encoding.BinaryMarshaler) error {
 	return r.transceiver.Write(msg)
 }
@@ -643,7 +1150,20 @@ func setLLDPSender(f openflow.Factory, w transceiver.Writer) error {
 	if err != nil {
 		return err
 	}
-	match.SetEtherType(0x88CC /* LLDP */)
+	match.SetEtherType(lldpEtherType)
+
+	// Permanent flow.
+	return setSpecialFlow(f, w, match, 100, 0, 0, false)
+}
+
+// setBDDPSender installs a flow that sends all BDDP packets to the controller, which also
+// prevents the switches from flooding BDDP packets.
+func setBDDPSender(f openflow.Factory, w transceiver.Writer) error {
+	match, err := f.NewMatch()
+	if err != nil {
+		return err
+	}
+	match.SetEtherType(bddpEtherType)
 
 	// Permanent flow.
 	return setSpecialFlow(f, w, match, 100, 0, 0, false)
@@ -661,6 +1181,20 @@ func setTemporaryDrop(f openflow.Factory, w transceiver.Writer) error {
 	return setSpecialFlow(f, w, match, 50, 0, 5, true)
 }
 
+// setPortDrop installs a temporary flow that drops all the packets from port.
+func setPortDrop(f openflow.Factory, w transceiver.Writer, port uint32, timeout time.Duration) error {
+	match, err := f.NewMatch()
+	if err != nil {
+		return err
+	}
+	inPort := openflow.NewInPort()
+	inPort.SetValue(port)
+	match.SetInPort(inPort)
+
+	// Temporary flow that takes precedence over all the other flows.
+	return setSpecialFlow(f, w, match, 200, 0, uint16(timeout/time.Second), true)
+}
+
 func setDHCPSender(f openflow.Factory, w transceiver.Writer) error {
 	match, err := f.NewMatch()
 	if err != nil {
@@ -680,6 +1214,8 @@ func setSpecialFlow(f openflow.Factory, w transceiver.Writer, match openflow.Mat
 	if err != nil {
 		return err
 	}
+	// We use MSB to distinguish the special flows from the normal flows.
+	flow.SetCookie(0x1 << 63)
 	flow.SetIdleTimeout(idleTimeout)
 	flow.SetHardTimeout(hardTimeout)
 	flow.SetPriority(priority)
@@ -724,3 +1260,18 @@ func sendRemoveAllFlows(f openflow.Factory, w transceiver.Writer) error {
 
 	return w.Write(msg)
 }
+
+// isMulticast returns whether mac is a multicast (including broadcast) address.
+func isMulticast(mac net.HardwareAddr) bool {
+	return len(mac) > 0 && mac[0]&0x01 == 0x01
+}
+
+func sendRemoveAllGroups(f openflow.Factory, w transceiver.Writer) error {
+	msg, err := f.NewGroupMod(openflow.GroupDelete)
+	if err != nil {
+		return err
+	}
+	msg.SetGroupID(openflow.AllGroups)
+
+	return w.Write(msg)
+}
@@ -0,0 +1,183 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"sort"
+	"time"
+)
+
+// TopologySnapshot is a read-only model of the network topology at a point in time.
+type TopologySnapshot struct {
+	Devices []DeviceSnapshot `json:"devices"`
+	Links   []LinkSnapshot   `json:"links"`
+	Hosts   []HostSnapshot   `json:"hosts"`
+}
+
+type DeviceSnapshot struct {
+	ID           string         `json:"id"`
+	Manufacturer string         `json:"manufacturer"`
+	Hardware     string         `json:"hardware"`
+	Software     string         `json:"software"`
+	Description  string         `json:"description"`
+	NumTables    uint8          `json:"n_tables"`
+	VLANID       uint16         `json:"vlan_id"` // Service VLAN ID.
+	FlowDrift    FlowDrift      `json:"flow_drift"`
+	Ports        []PortSnapshot `json:"ports"`
+}
+
+type PortSnapshot struct {
+	ID     string `json:"id"`
+	Number uint32 `json:"number"`
+	Name   string `json:"name"`
+	MAC    string `json:"mac"`
+	// Speed in MB.
+	Speed   uint64 `json:"speed"`
+	AdminUp bool   `json:"admin_up"`
+	LinkUp  bool   `json:"link_up"`
+	// Edge is true if this port is connected to another switch.
+	Edge bool `json:"edge"`
+	// Neighbor is a third-party device discovered by LLDP on this port.
+	Neighbor *Neighbor `json:"neighbor,omitempty"`
+	// VLAN is the VLAN mode of this port (native, access, or trunk:<VLAN ID>).
+	VLAN string `json:"vlan"`
+	// Utilization of the busier direction measured by the port stats. (0 to 1)
+	Utilization float64 `json:"utilization"`
+}
+
+type LinkSnapshot struct {
+	ID    string    `json:"id"`
+	Ports [2]string `json:"ports"` // Port IDs.
+	// Enabled is true if this link belongs to the spanning tree.
+	Enabled bool    `json:"enabled"`
+	Weight  float64 `json:"weight"`
+	// Broadcast is true if this link goes through a broadcast domain, e.g., legacy switches.
+	Broadcast bool `json:"broadcast"`
+	// Latency is the moving average of the one-way latency in milliseconds. Negative value means unknown.
+	Latency float64 `json:"latency"`
+}
+
+type HostSnapshot struct {
+	MAC  string `json:"mac"`
+	IP   string `json:"ip"`
+	Port string `json:"port"` // Port ID that this host is attached to.
+}
+
+// HostLocation is a host whose physical location has been discovered.
+type HostLocation struct {
+	MAC  string
+	IP   string
+	DPID string
+	Port uint32
+}
+
+func (r *topology) snapshot() (*TopologySnapshot, error) {
+	result := &TopologySnapshot{
+		Devices: make([]DeviceSnapshot, 0),
+		Links:   make([]LinkSnapshot, 0),
+		Hosts:   make([]HostSnapshot, 0),
+	}
+
+	for _, d := range r.Devices() {
+		if d.IsClosed() {
+			continue
+		}
+		result.Devices = append(result.Devices, r.deviceSnapshot(d))
+	}
+	sort.Slice(result.Devices, func(i, j int) bool { return result.Devices[i].ID < result.Devices[j].ID })
+
+	for _, e := range r.graph.Edges() {
+		l := e.Edge.(*link)
+		result.Links = append(result.Links, LinkSnapshot{
+			ID:        l.ID(),
+			Ports:     [2]string{l.ports[0].ID(), l.ports[1].ID()},
+			Enabled:   e.Enabled,
+			Weight:    l.Weight(),
+			Broadcast: e.Broadcast,
+			Latency:   latencyMillis(l.Latency()),
+		})
+	}
+
+	hosts, err := r.db.HostLocations()
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range hosts {
+		// Only the hosts attached to the connected devices.
+		d := r.Device(h.DPID)
+		if d == nil || d.Port(h.Port) == nil {
+			continue
+		}
+		result.Hosts = append(result.Hosts, HostSnapshot{
+			MAC:  h.MAC,
+			IP:   h.IP,
+			Port: d.Port(h.Port).ID(),
+		})
+	}
+
+	return result, nil
+}
+
+func latencyMillis(latency time.Duration) float64 {
+	if latency < 0 {
+		return -1
+	}
+
+	return float64(latency) / float64(time.Millisecond)
+}
+
+func (r *topology) deviceSnapshot(d *Device) DeviceSnapshot {
+	desc := d.Descriptions()
+	v := DeviceSnapshot{
+		ID:           d.ID(),
+		Manufacturer: desc.Manufacturer,
+		Hardware:     desc.Hardware,
+		Software:     desc.Software,
+		Description:  desc.Description,
+		NumTables:    d.Features().NumTables,
+		VLANID:       d.VLANID(),
+		FlowDrift:    d.FlowDrift(),
+		Ports:        make([]PortSnapshot, 0),
+	}
+
+	for _, p := range d.Ports() {
+		port := PortSnapshot{
+			ID:          p.ID(),
+			Number:      p.Number(),
+			Edge:        r.IsEdge(p),
+			Neighbor:    p.Neighbor(),
+			VLAN:        p.VLAN().String(),
+			Utilization: p.Utilization(),
+		}
+		if value := p.Value(); value != nil {
+			port.Name = value.Name()
+			port.MAC = value.MAC().String()
+			port.Speed = value.Speed()
+			port.AdminUp = !value.IsPortDown()
+			port.LinkUp = !value.IsLinkDown()
+		}
+		v.Ports = append(v.Ports, port)
+	}
+	sort.Slice(v.Ports, func(i, j int) bool { return v.Ports[i].Number < v.Ports[j].Number })
+
+	return v
+}
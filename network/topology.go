@@ -31,13 +31,19 @@ import (
 	"github.com/superkkt/cherry/graph"
 
 	"github.com/pkg/errors"
+	"github.com/superkkt/viper"
 )
 
 type watcher interface {
 	DeviceAdded(*Device)
-	DeviceLinked([2]*Port)
+	// DeviceLinked is called when a link between two ports is discovered. broadcast is true
+	// if the link goes through a broadcast domain that is discovered by BDDP. latency is the
+	// one-way latency of the link measured by the probe, and negative latency means unknown.
+	DeviceLinked(ports [2]*Port, broadcast bool, latency time.Duration)
 	DeviceRemoved(*Device)
 	PortRemoved(*Port)
+	// PortStatsUpdated is called when the port stats of a device have been updated.
+	PortStatsUpdated(*Device)
 }
 
 type Finder interface {
@@ -48,7 +54,16 @@ type Finder interface {
 	// IsEdge returns whether p is an edge among two switches
 	IsEdge(p *Port) bool
 	Node(mac net.HardwareAddr) (*Node, LocationStatus, error)
+	// Path returns the path through the spanning tree, or the shortest-path tree of the
+	// destination device in the SPB forwarding mode.
 	Path(srcDeviceID, dstDeviceID string) [][2]*Port
+	// EqualCostPaths returns all the shortest paths, whose costs are same, regardless of the spanning tree.
+	EqualCostPaths(srcDeviceID, dstDeviceID string) [][][2]*Port
+	// BackupPort returns a port on the source device that can be used to reach the destination
+	// device when primary fails. It returns nil if there is no such a port.
+	BackupPort(srcDeviceID, dstDeviceID string, primary *Port) *Port
+	// ForwardingMode returns the forwarding mode for the unicast packets among switches.
+	ForwardingMode() ForwardingMode
 }
 
 type topology struct {
@@ -58,15 +73,31 @@ type topology struct {
 	graph    *graph.Graph
 	listener TopologyEventListener
 	db       database
+	mode     ForwardingMode
+	// Host locations cached from the database.
+	locations *locationCache
 }
 
 func newTopology(db database) *topology {
+	mode, err := ParseForwardingMode(viper.GetString("default.forwarding_mode"))
+	if err != nil {
+		// mode should be already checked in the main code.
+		panic("invalid default.forwarding_mode in the config file")
+	}
+
 	v := &topology{
-		devices: make(map[string]*Device),
-		graph:   graph.New(),
-		db:      db,
+		devices:   make(map[string]*Device),
+		graph:     graph.New(),
+		db:        db,
+		mode:      mode,
+		locations: newLocationCache(db),
+	}
+	if err := v.locations.load(); err != nil {
+		// The locations will be loaded on demand.
+		logger.Errorf("failed to load the host locations: %v", err)
 	}
 	go v.staleEdgeRemover()
+	go v.locations.versionChecker()
 
 	return v
 }
@@ -99,6 +130,19 @@ func (r *topology) sendEvent() {
 	}
 }
 
+// Caller should make sure the mutex is unlocked before calling this function.
+// Otherwise, event listeners may cause a deadlock by calling other topology functions.
+func (r *topology) sendPathEvent() {
+	if r.listener == nil {
+		return
+	}
+
+	if err := r.listener.OnPathChange(r); err != nil {
+		logger.Errorf("OnPathChange: %v", err)
+		return
+	}
+}
+
 func (r *topology) Devices() []*Device {
 	// Read lock
 	r.mutex.RLock()
@@ -155,8 +199,8 @@ func (r *topology) DeviceRemoved(d *Device) {
 	r.sendEvent()
 }
 
-func (r *topology) DeviceLinked(ports [2]*Port) {
-	var added bool
+func (r *topology) DeviceLinked(ports [2]*Port, broadcast bool, latency time.Duration) {
+	var added, updated bool
 	var err error
 
 	// NOTE: This is an anonymous function (NOT a goroutine!) that has a critical section.
@@ -165,41 +209,58 @@ func (r *topology) DeviceLinked(ports [2]*Port) {
 		r.mutex.Lock()
 		defer r.mutex.Unlock()
 
-		link := newLink(ports)
-		added, err = r.graph.AddEdge(link)
+		l := newLink(ports, broadcast)
+		// Keep the latency on the existing link to calculate its moving average.
+		if v, ok := r.graph.Edge(l.ID()).(*link); ok && v.broadcast == broadcast {
+			updated = v.updateLatency(latency)
+		} else {
+			l.updateLatency(latency)
+		}
+		added, err = r.graph.AddEdge(l)
 		if err != nil {
 			logger.Errorf("failed to add a new graph edge: %v", err)
 			return
 		}
+		if !added && updated {
+			logger.Infof("link weight has been changed by its latency: id=%v", l.ID())
+			// The latency does not affect the spanning tree.
+			r.graph.UpdatePathWeights()
+		}
 	}()
 
+	// The paths in the STP mode only depend on the spanning tree.
+	if err == nil && !added && updated && r.mode != ForwardingSTP {
+		// XXX: Make sure the mutex is unlocked before calling sendPathEvent().
+		r.sendPathEvent()
+	}
 	// Send the event only if the topology has been changed.
 	if err == nil && added {
 		// XXX: Make sure the mutex is unlocked before calling sendEvent().
 		r.sendEvent()
-		logger.Infof("devices have been linked: %v:%v / %v:%v", ports[0].Device().ID(), ports[0].Number(), ports[1].Device().ID(), ports[1].Number())
+		logger.Infof("devices have been linked: %v:%v / %v:%v (broadcast=%v)", ports[0].Device().ID(), ports[0].Number(), ports[1].Device().ID(), ports[1].Number(), broadcast)
 	}
 }
 
 // Node may return nil if the node is unregistered or still undiscovered.
 func (r *topology) Node(mac net.HardwareAddr) (*Node, LocationStatus, error) {
-	// Read lock
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
-
-	dpid, portNum, status, err := r.db.Location(mac)
+	// Don't hold the lock while looking up the location because it may query the database.
+	loc, err := r.locations.lookup(mac)
 	if err != nil {
-		return nil, status, errors.Wrap(&networkErr{temporary: true, err: err}, "querying host location to the database")
+		return nil, loc.status, errors.Wrap(&networkErr{temporary: true, err: err}, "querying host location to the database")
 	}
-	if status != LocationDiscovered {
-		return nil, status, nil
+	if loc.status != LocationDiscovered {
+		return nil, loc.status, nil
 	}
 
-	device, ok := r.devices[dpid]
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	device, ok := r.devices[loc.dpid]
 	if !ok {
 		return nil, LocationUnregistered, nil
 	}
-	port := device.Port(portNum)
+	port := device.Port(loc.port)
 	if port == nil {
 		return nil, LocationUnregistered, nil
 	}
@@ -242,7 +303,12 @@ func (r *topology) Path(srcDeviceID, dstDeviceID string) [][2]*Port {
 		return v
 	}
 
-	path := r.graph.FindPath(src, dst)
+	var path []graph.Path
+	if r.mode == ForwardingSPB {
+		path = r.graph.FindTreePath(src, dst)
+	} else {
+		path = r.graph.FindPath(src, dst)
+	}
 	for _, p := range path {
 		device := p.V.(*Device)
 		link := p.E.(*link)
@@ -252,6 +318,74 @@ func (r *topology) Path(srcDeviceID, dstDeviceID string) [][2]*Port {
 	return v
 }
 
+func (r *topology) EqualCostPaths(srcDeviceID, dstDeviceID string) [][][2]*Port {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	v := make([][][2]*Port, 0)
+	src := r.devices[srcDeviceID]
+	dst := r.devices[dstDeviceID]
+	// Unknown source or destination device?
+	if src == nil || dst == nil {
+		// Return empty paths
+		return v
+	}
+
+	for _, path := range r.graph.FindEqualCostPaths(src, dst) {
+		p := make([][2]*Port, 0, len(path))
+		for _, hop := range path {
+			p = append(p, pickPort(hop.V.(*Device), hop.E.(*link)))
+		}
+		v = append(v, p)
+	}
+
+	return v
+}
+
+func (r *topology) BackupPort(srcDeviceID, dstDeviceID string, primary *Port) *Port {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	src := r.devices[srcDeviceID]
+	dst := r.devices[dstDeviceID]
+	// Unknown source or destination device?
+	if src == nil || dst == nil || primary == nil {
+		return nil
+	}
+
+	for _, e := range r.graph.FindLoopFreeAlternates(src, dst, primary) {
+		ports := pickPort(src, e.(*link))
+		// The neighbor forwards packets through the spanning tree in the STP mode, so that
+		// the tree path from the neighbor should not go back through the source device.
+		neighbor := ports[1].Device()
+		if r.mode == ForwardingSTP && neighbor.ID() != dst.ID() {
+			path := r.graph.FindPath(neighbor, dst)
+			if len(path) == 0 || pathContains(path, src) {
+				continue
+			}
+		}
+		return ports[0]
+	}
+
+	return nil
+}
+
+func pathContains(path []graph.Path, v graph.Vertex) bool {
+	for _, p := range path {
+		if p.V.ID() == v.ID() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *topology) ForwardingMode() ForwardingMode {
+	return r.mode
+}
+
 func pickPort(d *Device, l *link) [2]*Port {
 	p := l.Points()
 	if p[0].Vertex().ID() == d.ID() {
@@ -0,0 +1,205 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"time"
+
+	"github.com/superkkt/cherry/openflow"
+)
+
+const (
+	portStatsInterval = 10 * time.Second
+	// Utilization of a link from which its weight starts to rise.
+	congestionThreshold = 0.5
+	// Utilization step that raises the congestion level of a link by one.
+	congestionStep = 0.1
+	// The congestion level goes down only if the utilization is lower than the threshold
+	// of the current level by this margin, to avoid flapping of the link weight.
+	congestionHysteresis = 0.05
+	// The congestion level goes down by one only if it has not been changed for this period,
+	// so that the link weight does not oscillate as the traffic moves to and from other links
+	// whenever the weight is changed.
+	congestionHoldDown = 60 * time.Second
+	// Weight added to a link for each congestion level.
+	congestionWeightUnit = 2
+)
+
+type portStats struct {
+	timestamp time.Time
+	rxBytes   uint64
+	txBytes   uint64
+	// Utilization of the busier direction in the last sampling interval. (0 to 1)
+	utilization float64
+}
+
+// Utilization returns the utilization of the busier direction of this port measured by
+// the last two port stats samples. It returns zero if the utilization is unknown.
+func (r *Port) Utilization() float64 {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.stats.utilization
+}
+
+func (r *Port) updateStats(v openflow.PortStats, now time.Time) {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	prev := r.stats
+	r.stats = portStats{timestamp: now, rxBytes: v.RxBytes, txBytes: v.TxBytes}
+	// First sample or the counters have been reset?
+	if prev.timestamp.IsZero() || v.RxBytes < prev.rxBytes || v.TxBytes < prev.txBytes {
+		return
+	}
+	elapsed := now.Sub(prev.timestamp).Seconds()
+	if elapsed <= 0 || r.value == nil || r.value.Speed() == 0 {
+		return
+	}
+
+	delta := v.RxBytes - prev.rxBytes
+	if tx := v.TxBytes - prev.txBytes; tx > delta {
+		delta = tx
+	}
+	// Speed is in MB.
+	util := float64(delta) * 8 / elapsed / (float64(r.value.Speed()) * 1000000)
+	if util > 1 {
+		util = 1
+	}
+	r.stats.utilization = util
+}
+
+func (r *Device) sendPortStatsRequest() error {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return ErrClosedDevice
+	}
+
+	msg, err := r.factory.NewPortStatsRequest()
+	if err != nil {
+		return err
+	}
+
+	return r.session.Write(msg)
+}
+
+func (r *Device) updatePortStats(v openflow.PortStatsReply) {
+	now := time.Now()
+	for _, s := range v.Ports() {
+		port := r.Port(s.PortNo)
+		if port == nil {
+			continue
+		}
+		port.updateStats(s, now)
+	}
+}
+
+// congestionLevel returns the new congestion level of a link whose utilization is util
+// and whose congestion level is current. The level rises immediately, but it goes down
+// by one for each hold-down period elapsed since the last change.
+func congestionLevel(util float64, current int, changed, now time.Time) int {
+	level := 0
+	if util >= congestionThreshold {
+		level = 1 + int((util-congestionThreshold)/congestionStep)
+	}
+	if level >= current {
+		return level
+	}
+	// Keep the current level while the utilization is around its threshold.
+	if util > congestionThreshold+float64(current-1)*congestionStep-congestionHysteresis {
+		return current
+	}
+	// Keep the current level until the hold-down period is elapsed.
+	if now.Sub(changed) < congestionHoldDown {
+		return current
+	}
+
+	return current - 1
+}
+
+// updateCongestion updates the congestion level of this link by the utilizations of its
+// ports, and then returns whether the weight of this link has been changed.
+func (r *link) updateCongestion(now time.Time) (weightChanged bool) {
+	util := r.ports[0].Utilization()
+	if v := r.ports[1].Utilization(); v > util {
+		util = v
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	prev := r.congestion
+	r.congestion = congestionLevel(util, prev, r.congestionChanged, now)
+	if prev == r.congestion {
+		return false
+	}
+	r.congestionChanged = now
+
+	return true
+}
+
+// Congestion returns the congestion level of this link. Zero means not congested.
+func (r *link) Congestion() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.congestion
+}
+
+// PortStatsUpdated updates the weights of the links on d by the utilizations of their ports.
+func (r *topology) PortStatsUpdated(d *Device) {
+	var updated bool
+	now := time.Now()
+
+	// NOTE: This is an anonymous function (NOT a goroutine!) that has a critical section.
+	func() {
+		// Write lock
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		for _, e := range r.graph.Edges() {
+			l := e.Edge.(*link)
+			if l.ports[0].Device() != d && l.ports[1].Device() != d {
+				continue
+			}
+			if l.updateCongestion(now) {
+				logger.Infof("link weight has been changed by its utilization: id=%v, congestion=%v", l.ID(), l.Congestion())
+				updated = true
+			}
+		}
+		if updated {
+			// The congestion does not affect the spanning tree.
+			r.graph.UpdatePathWeights()
+		}
+	}()
+
+	// The paths in the STP mode only depend on the spanning tree.
+	if updated && r.mode != ForwardingSTP {
+		// XXX: Make sure the mutex is unlocked before calling sendPathEvent().
+		r.sendPathEvent()
+	}
+}
@@ -0,0 +1,76 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015-2019 Samjung Data Service, Inc. All rights reserved.
+ *  Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCongestionLevel(t *testing.T) {
+	src := []struct {
+		util     float64
+		current  int
+		expected int
+	}{
+		{0, 0, 0},
+		{0.49, 0, 0},
+		{0.5, 0, 1},
+		{0.75, 0, 3},
+		{1, 0, 6},
+		// Rising is not delayed.
+		{0.62, 1, 2},
+		// Falling within the hysteresis margin keeps the current level.
+		{0.47, 1, 1},
+		{0.67, 3, 3},
+		// Falling beyond the margin goes down by one level at a time.
+		{0.44, 1, 0},
+		{0.64, 3, 2},
+		{0.1, 6, 5},
+	}
+
+	now := time.Now()
+	changed := now.Add(-congestionHoldDown)
+	for _, v := range src {
+		level := congestionLevel(v.util, v.current, changed, now)
+		if level != v.expected {
+			t.Fatalf("unexpected congestion level: util=%v, current=%v, expected=%v, got=%v", v.util, v.current, v.expected, level)
+		}
+	}
+}
+
+func TestCongestionLevelHoldDown(t *testing.T) {
+	now := time.Now()
+
+	// Rising is not held down.
+	if level := congestionLevel(0.75, 1, now, now); level != 3 {
+		t.Fatalf("unexpected congestion level: expected=3, got=%v", level)
+	}
+	// Falling is held down until the period is elapsed since the last change.
+	if level := congestionLevel(0.1, 3, now, now.Add(congestionHoldDown-time.Second)); level != 3 {
+		t.Fatalf("unexpected congestion level: expected=3, got=%v", level)
+	}
+	// Then, it goes down only by one.
+	if level := congestionLevel(0.1, 3, now, now.Add(congestionHoldDown)); level != 2 {
+		t.Fatalf("unexpected congestion level: expected=2, got=%v", level)
+	}
+}
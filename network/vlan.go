@@ -0,0 +1,210 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/superkkt/viper"
+)
+
+// accessVLANFlowPriority is the priority of the flows that tag the untagged frames received
+// from the access ports, which is lower than the temporary drop flow on connection.
+const accessVLANFlowPriority = 40
+
+// VLANMode decides how the VLAN tag of packets is handled when they are sent out to a port.
+type VLANMode int
+
+const (
+	// VLANNative leaves the VLAN tag as it is. The switch should untag the frames of its
+	// service VLAN by itself, e.g., by configuring the service VLAN as the native VLAN.
+	VLANNative VLANMode = iota
+	// VLANAccess removes the VLAN tag so that hosts on the port receive untagged frames.
+	// If the port has its VLAN ID, the untagged frames received from the port are also
+	// tagged with the VLAN ID. Otherwise, the switch should tag them by itself.
+	VLANAccess
+	// VLANTrunk sends frames tagged with the VLAN ID of the port.
+	VLANTrunk
+)
+
+func (r VLANMode) String() string {
+	switch r {
+	case VLANNative:
+		return "native"
+	case VLANAccess:
+		return "access"
+	case VLANTrunk:
+		return "trunk"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(r))
+	}
+}
+
+// PortVLAN is the VLAN configuration of a switch port.
+type PortVLAN struct {
+	Mode VLANMode
+	// ID is the VLAN ID tagged on the trunk port, or pushed to the untagged frames
+	// received from the access port. Zero means none on the access port.
+	ID uint16
+}
+
+func (r PortVLAN) String() string {
+	if r.Mode == VLANTrunk || (r.Mode == VLANAccess && r.ID != 0) {
+		return fmt.Sprintf("%v:%v", r.Mode, r.ID)
+	}
+
+	return r.Mode.String()
+}
+
+// ParsePortVLAN converts s, which is one of "native", "access", "access:<VLAN ID>", and
+// "trunk:<VLAN ID>", into a PortVLAN. An empty string means the default native mode.
+func ParsePortVLAN(s string) (PortVLAN, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case v == "" || v == "native":
+		return PortVLAN{Mode: VLANNative}, nil
+	case v == "access":
+		return PortVLAN{Mode: VLANAccess}, nil
+	case strings.HasPrefix(v, "access:"):
+		id, err := parseVLANID(v[len("access:"):])
+		if err != nil {
+			return PortVLAN{}, err
+		}
+		if id == 0 {
+			return PortVLAN{}, fmt.Errorf("invalid access VLAN ID: %v", s)
+		}
+		return PortVLAN{Mode: VLANAccess, ID: id}, nil
+	case strings.HasPrefix(v, "trunk:"):
+		id, err := parseVLANID(v[len("trunk:"):])
+		if err != nil {
+			return PortVLAN{}, err
+		}
+		return PortVLAN{Mode: VLANTrunk, ID: id}, nil
+	default:
+		return PortVLAN{}, fmt.Errorf("unknown port VLAN mode: %v", s)
+	}
+}
+
+func parseVLANID(s string) (uint16, error) {
+	id, err := strconv.ParseUint(strings.TrimSpace(s), 10, 16)
+	if err != nil || id > 4095 {
+		return 0, fmt.Errorf("invalid VLAN ID: %v", s)
+	}
+
+	return uint16(id), nil
+}
+
+// ValidateVLANConfig checks the per-device and per-port VLAN configurations in the
+// config file, which are vlan.devices and vlan.ports.
+func ValidateVLANConfig() error {
+	for device, id := range viper.GetStringMapString("vlan.devices") {
+		if _, err := strconv.ParseUint(device, 10, 64); err != nil {
+			return fmt.Errorf("invalid device ID in vlan.devices: %v", device)
+		}
+		if _, err := parseVLANID(id); err != nil {
+			return fmt.Errorf("invalid vlan.devices of %v: %v", device, err)
+		}
+	}
+	for key, mode := range viper.GetStringMapString("vlan.ports") {
+		device, _, err := parsePortKey(key)
+		if err != nil {
+			return err
+		}
+		conf, err := ParsePortVLAN(mode)
+		if err != nil {
+			return fmt.Errorf("invalid vlan.ports of %v: %v", key, err)
+		}
+		// The tagged frames should be matched by the normal flows of the device.
+		if conf.Mode == VLANAccess && conf.ID != 0 && conf.ID != deviceVLANID(device) {
+			return fmt.Errorf("invalid vlan.ports of %v: access VLAN ID %v is not the service VLAN ID of the device", key, conf.ID)
+		}
+	}
+
+	return nil
+}
+
+// parsePortKey parses key of vlan.ports, which consists of the device ID and port number
+// separated by a slash (e.g., "12345/48").
+func parsePortKey(key string) (deviceID string, portNum uint32, err error) {
+	token := strings.Split(key, "/")
+	if len(token) != 2 {
+		return "", 0, fmt.Errorf("invalid port key in vlan.ports: %v", key)
+	}
+	if _, err := strconv.ParseUint(token[0], 10, 64); err != nil {
+		return "", 0, fmt.Errorf("invalid device ID in vlan.ports: %v", key)
+	}
+	num, err := strconv.ParseUint(token[1], 10, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port number in vlan.ports: %v", key)
+	}
+
+	return token[0], uint32(num), nil
+}
+
+// deviceVLANID returns the service VLAN ID of the device, which is used to match the normal
+// flows. default.vlan_id is used if the device does not have its own configuration.
+func deviceVLANID(deviceID string) uint16 {
+	if v, ok := viper.GetStringMapString("vlan.devices")[deviceID]; ok {
+		if id, err := parseVLANID(v); err == nil {
+			return id
+		}
+		// This should be already checked in the main code.
+		logger.Errorf("invalid vlan.devices of %v: %v", deviceID, v)
+	}
+
+	return uint16(viper.GetInt("default.vlan_id"))
+}
+
+// portVLAN returns the VLAN configuration of the port, which is native by default.
+func portVLAN(deviceID string, portNum uint32) PortVLAN {
+	v, ok := viper.GetStringMapString("vlan.ports")[fmt.Sprintf("%v/%v", deviceID, portNum)]
+	if !ok {
+		return PortVLAN{Mode: VLANNative}
+	}
+	conf, err := ParsePortVLAN(v)
+	if err != nil {
+		// This should be already checked in the main code.
+		logger.Errorf("invalid vlan.ports of %v/%v: %v", deviceID, portNum, v)
+		return PortVLAN{Mode: VLANNative}
+	}
+
+	return conf
+}
+
+// accessVLANs returns the VLAN IDs of the access ports of the device that tag the untagged
+// frames received from them. Key is the port number.
+func accessVLANs(deviceID string) map[uint32]uint16 {
+	result := make(map[uint32]uint16)
+	for key := range viper.GetStringMapString("vlan.ports") {
+		id, num, err := parsePortKey(key)
+		if err != nil || id != deviceID {
+			continue
+		}
+		if conf := portVLAN(id, num); conf.Mode == VLANAccess && conf.ID != 0 {
+			result[num] = conf.ID
+		}
+	}
+
+	return result
+}
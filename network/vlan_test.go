@@ -0,0 +1,61 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015-2019 Samjung Data Service, Inc. All rights reserved.
+ *  Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package network
+
+import (
+	"testing"
+)
+
+func TestParsePortVLAN(t *testing.T) {
+	src := []struct {
+		Value         string
+		Expected      PortVLAN
+		ErrorExpected bool
+	}{
+		{Value: "", Expected: PortVLAN{Mode: VLANNative}},
+		{Value: "native", Expected: PortVLAN{Mode: VLANNative}},
+		{Value: "Access", Expected: PortVLAN{Mode: VLANAccess}},
+		{Value: "access:2000", Expected: PortVLAN{Mode: VLANAccess, ID: 2000}},
+		{Value: "access:0", ErrorExpected: true},
+		{Value: "access:abc", ErrorExpected: true},
+		{Value: "trunk:3000", Expected: PortVLAN{Mode: VLANTrunk, ID: 3000}},
+		{Value: "trunk", ErrorExpected: true},
+		{Value: "trunk:4096", ErrorExpected: true},
+		{Value: "hybrid", ErrorExpected: true},
+	}
+
+	for _, v := range src {
+		conf, err := ParsePortVLAN(v.Value)
+		if v.ErrorExpected {
+			if err == nil {
+				t.Fatalf("expected error for %v, but got nil", v.Value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for %v: %v", v.Value, err)
+		}
+		if conf != v.Expected {
+			t.Fatalf("unexpected port VLAN for %v: expected=%v, got=%v", v.Value, v.Expected, conf)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package acl
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/protocol"
+
+	"github.com/superkkt/go-logging"
+)
+
+const (
+	// Interval to reload the ACL rules from the database, which can be changed by walnut
+	// or any other controller sharing the database.
+	reloadInterval = 5 * time.Second
+)
+
+var (
+	logger = logging.MustGetLogger("acl")
+)
+
+// ACL filters the IPv4 packets by the ACL rules in the database. The rules are compiled
+// into the ACL flows that are installed in all the switches, and the PACKET_IN messages
+// are also filtered before they are forwarded by the following applications.
+//
+// NOTE: This ACL module should be executed before the L2Switch module.
+type ACL struct {
+	app.BaseProcessor
+	db   database
+	once sync.Once
+
+	mutex sync.RWMutex
+	// Compiled ACL flows in descending order of their priorities.
+	flows []network.ACLFlow
+}
+
+type database interface {
+	// ACLRules returns all the ACL rules whose groups have been resolved into the
+	// addresses of their hosts.
+	ACLRules() ([]Rule, error)
+}
+
+func New(db database) *ACL {
+	return &ACL{
+		db: db,
+	}
+}
+
+func (r *ACL) Init() error {
+	rules, err := r.db.ACLRules()
+	if err != nil {
+		return err
+	}
+	flows, err := compile(rules)
+	if err != nil {
+		return err
+	}
+	r.flows = flows
+
+	return nil
+}
+
+func (r *ACL) Name() string {
+	return "ACL"
+}
+
+func (r *ACL) String() string {
+	return fmt.Sprintf("%v", r.Name())
+}
+
+func (r *ACL) OnDeviceUp(finder network.Finder, device *network.Device) error {
+	// Make sure that there is only one reloader in this application.
+	r.once.Do(func() {
+		go r.reloader(finder)
+	})
+
+	// Write lock not to race with the reloader that updates the flows in all the devices.
+	r.mutex.Lock()
+	if err := device.SetACLFlows(r.flows); err != nil {
+		logger.Errorf("failed to install the ACL flows: deviceID=%v: %v", device.ID(), err)
+	}
+	r.mutex.Unlock()
+
+	return r.BaseProcessor.OnDeviceUp(finder, device)
+}
+
+func (r *ACL) reloader(finder network.Finder) {
+	logger.Debug("executed ACL reloader")
+
+	ticker := time.Tick(reloadInterval)
+	// Infinite loop.
+	for range ticker {
+		rules, err := r.db.ACLRules()
+		if err != nil {
+			logger.Errorf("failed to query the ACL rules: %v", err)
+			continue
+		}
+		flows, err := compile(rules)
+		if err != nil {
+			logger.Errorf("failed to compile the ACL rules: %v", err)
+			continue
+		}
+		r.update(finder, flows)
+	}
+}
+
+// update installs flows in all the devices if they are different from the current flows.
+func (r *ACL) update(finder network.Finder, flows []network.ACLFlow) {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if equalFlows(r.flows, flows) {
+		return
+	}
+	logger.Infof("updating the ACL flows: %v flow(s)", len(flows))
+	r.flows = flows
+
+	for _, device := range finder.Devices() {
+		if err := device.SetACLFlows(flows); err != nil {
+			logger.Errorf("failed to update the ACL flows: deviceID=%v: %v", device.ID(), err)
+		}
+	}
+}
+
+func equalFlows(a, b []network.ACLFlow) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].String() != b[i].String() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *ACL) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	p, ok := parsePacket(eth)
+	if !ok {
+		return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+	}
+
+	// Read lock
+	r.mutex.RLock()
+	allow := allowed(r.flows, p)
+	r.mutex.RUnlock()
+
+	if !allow {
+		logger.Debugf("dropping the packet denied by ACL: ingress=%v, src=%v, dst=%v, protocol=%v", ingress.ID(), p.src, p.dst, p.protocol)
+		return nil
+	}
+
+	return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+}
+
+// parsePacket returns the packet to be filtered if eth is an IPv4 packet.
+func parsePacket(eth *protocol.Ethernet) (p packet, ok bool) {
+	if eth.Type != 0x0800 {
+		return packet{}, false
+	}
+	ip := new(protocol.IPv4)
+	if err := ip.UnmarshalBinary(eth.Payload); err != nil {
+		logger.Debugf("invalid IPv4 packet: %v", err)
+		return packet{}, false
+	}
+
+	p = packet{src: ip.SrcIP, dst: ip.DstIP, protocol: ip.Protocol}
+	// Source and destination ports are the first 4 bytes of both TCP and UDP headers.
+	if (p.protocol == protocolTCP || p.protocol == protocolUDP) && len(ip.Payload) >= 4 {
+		p.srcPort = binary.BigEndian.Uint16(ip.Payload[0:2])
+		p.dstPort = binary.BigEndian.Uint16(ip.Payload[2:4])
+	}
+
+	return p, true
+}
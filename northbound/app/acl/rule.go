@@ -0,0 +1,302 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package acl
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/superkkt/cherry/network"
+)
+
+const (
+	protocolTCP = 6
+	protocolUDP = 17
+	// Maximum number of the flows expanded from the source and destination networks of the
+	// rules, which limits the time to compile the rules.
+	maxCandidates = 10 * network.MaxACLFlows
+)
+
+// Rule is an ACL rule whose groups have been resolved into the addresses of their hosts.
+type Rule struct {
+	ID uint64
+	// Larger value has higher priority. A deny rule takes precedence over an allow rule
+	// that has the same priority.
+	Priority uint16
+	Allow    bool
+	// Networks of the source and destination addresses. Nil means any address, and an empty
+	// slice matches nothing, e.g., a group that has no host.
+	Src, Dst []*net.IPNet
+	// Zero means any protocol.
+	Protocol uint8
+	// Zero means any port.
+	SrcPort, DstPort uint16
+}
+
+type candidate struct {
+	level int
+	flow  network.ACLFlow
+}
+
+// compile converts rules into the ACL flows in descending order of their priorities. The
+// packets that do not match any flow are allowed.
+func compile(rules []Rule) ([]network.ACLFlow, error) {
+	sorted := make([]Rule, len(rules))
+	copy(sorted, rules)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority > sorted[j].Priority
+		}
+		if sorted[i].Allow != sorted[j].Allow {
+			return !sorted[i].Allow
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	// Each distinct (priority, action) pair is a level, and the higher level has the lower index.
+	candidates := make([]candidate, 0)
+	level := 0
+	for i, v := range sorted {
+		if i > 0 && (v.Priority != sorted[i-1].Priority || v.Allow != sorted[i-1].Allow) {
+			level++
+		}
+		srcNets, dstNets := networks(v.Src), networks(v.Dst)
+		// A rule between groups is expanded into the cross product of their networks.
+		if n := len(candidates) + len(srcNets)*len(dstNets); n > maxCandidates {
+			return nil, fmt.Errorf("too many ACL flows expanded from the rules: %v or more (max %v), rule ID=%v", n, maxCandidates, v.ID)
+		}
+		for _, src := range srcNets {
+			for _, dst := range dstNets {
+				candidates = append(candidates, candidate{
+					level: level,
+					flow: network.ACLFlow{
+						Allow:    v.Allow,
+						SrcIP:    src,
+						DstIP:    dst,
+						Protocol: v.Protocol,
+						SrcPort:  v.SrcPort,
+						DstPort:  v.DstPort,
+					},
+				})
+			}
+		}
+	}
+
+	// Skip the flows that never match any packet because they are covered by higher flows.
+	flows := make([]candidate, 0)
+	for _, v := range candidates {
+		covered := false
+		for _, f := range flows {
+			if covers(f.flow, v.flow) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			flows = append(flows, v)
+		}
+	}
+
+	// The allow flows are only necessary to exclude the packets from lower deny flows.
+	necessary := make([]candidate, 0)
+	for i, v := range flows {
+		if v.flow.Allow && !overlapsDeny(v.flow, flows[i+1:]) {
+			continue
+		}
+		necessary = append(necessary, v)
+	}
+
+	if len(necessary) > network.MaxACLFlows {
+		return nil, fmt.Errorf("too many ACL flows: %v (max %v)", len(necessary), network.MaxACLFlows)
+	}
+
+	// Assign the flow priorities to the remaining levels.
+	levels := 0
+	for i, v := range necessary {
+		if i == 0 || v.level != necessary[i-1].level {
+			levels++
+		}
+	}
+	if levels > network.MaxACLPriority+1 {
+		return nil, fmt.Errorf("too many ACL priority levels: %v", levels)
+	}
+	result := make([]network.ACLFlow, 0, len(necessary))
+	for i, v := range necessary {
+		if i == 0 || v.level != necessary[i-1].level {
+			levels--
+		}
+		v.flow.Priority = uint16(levels)
+		result = append(result, v.flow)
+	}
+
+	return result, nil
+}
+
+// networks returns the canonical form of nets, which aggregates them into the fewest
+// prefixes that cover exactly the same addresses, e.g., the addresses of the hosts in a
+// group. It returns a nil network if nets is nil, which means any address.
+func networks(nets []*net.IPNet) []*net.IPNet {
+	if nets == nil {
+		return []*net.IPNet{nil}
+	}
+
+	type prefix struct {
+		addr uint32
+		ones int
+	}
+	prefixes := make([]prefix, 0, len(nets))
+	for _, v := range nets {
+		ip := v.IP.To4()
+		if ip == nil || len(v.Mask) != net.IPv4len {
+			// Ignore non-IPv4 networks.
+			continue
+		}
+		ones, _ := v.Mask.Size()
+		prefixes = append(prefixes, prefix{addr: binary.BigEndian.Uint32(ip.Mask(v.Mask)), ones: ones})
+	}
+	// The broader prefix comes first among the ones that have the same address.
+	sort.Slice(prefixes, func(i, j int) bool {
+		if prefixes[i].addr != prefixes[j].addr {
+			return prefixes[i].addr < prefixes[j].addr
+		}
+		return prefixes[i].ones < prefixes[j].ones
+	})
+
+	size := func(p prefix) uint64 { return 1 << uint(32-p.ones) }
+	merged := make([]prefix, 0, len(prefixes))
+	for _, v := range prefixes {
+		// Covered by the previous prefix?
+		if n := len(merged); n > 0 && uint64(v.addr) < uint64(merged[n-1].addr)+size(merged[n-1]) {
+			continue
+		}
+		merged = append(merged, v)
+		// Merge the last two prefixes while they are the halves of a broader prefix.
+		for n := len(merged); n >= 2; n = len(merged) {
+			a, b := merged[n-2], merged[n-1]
+			if a.ones != b.ones || a.ones == 0 || uint64(a.addr)+size(a) != uint64(b.addr) || a.addr&uint32(size(a)) != 0 {
+				break
+			}
+			merged = append(merged[:n-2], prefix{addr: a.addr, ones: a.ones - 1})
+		}
+	}
+
+	result := make([]*net.IPNet, 0, len(merged))
+	for _, v := range merged {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, v.addr)
+		result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(v.ones, 32)})
+	}
+
+	return result
+}
+
+func overlapsDeny(flow network.ACLFlow, lower []candidate) bool {
+	for _, v := range lower {
+		if !v.flow.Allow && overlaps(flow, v.flow) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// covers returns whether all the packets matched by b are also matched by a.
+func covers(a, b network.ACLFlow) bool {
+	return coversNetwork(a.SrcIP, b.SrcIP) && coversNetwork(a.DstIP, b.DstIP) &&
+		coversValue(uint16(a.Protocol), uint16(b.Protocol)) &&
+		coversValue(a.SrcPort, b.SrcPort) && coversValue(a.DstPort, b.DstPort)
+}
+
+// overlaps returns whether there is a packet matched by both a and b.
+func overlaps(a, b network.ACLFlow) bool {
+	return overlapsNetwork(a.SrcIP, b.SrcIP) && overlapsNetwork(a.DstIP, b.DstIP) &&
+		overlapsValue(uint16(a.Protocol), uint16(b.Protocol)) &&
+		overlapsValue(a.SrcPort, b.SrcPort) && overlapsValue(a.DstPort, b.DstPort)
+}
+
+func coversNetwork(a, b *net.IPNet) bool {
+	if a == nil {
+		return true
+	}
+	if b == nil {
+		return false
+	}
+	onesA, _ := a.Mask.Size()
+	onesB, _ := b.Mask.Size()
+
+	return onesA <= onesB && a.Contains(b.IP)
+}
+
+func overlapsNetwork(a, b *net.IPNet) bool {
+	if a == nil || b == nil {
+		return true
+	}
+
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// Zero value means any value.
+func coversValue(a, b uint16) bool {
+	return a == 0 || a == b
+}
+
+// Zero value means any value.
+func overlapsValue(a, b uint16) bool {
+	return a == 0 || b == 0 || a == b
+}
+
+type packet struct {
+	src, dst         net.IP
+	protocol         uint8
+	srcPort, dstPort uint16
+}
+
+// allowed returns whether the first flow that matches p allows it. The packet that does not
+// match any flow is allowed.
+func allowed(flows []network.ACLFlow, p packet) bool {
+	for _, v := range flows {
+		if matches(v, p) {
+			return v.Allow
+		}
+	}
+
+	return true
+}
+
+func matches(flow network.ACLFlow, p packet) bool {
+	if flow.SrcIP != nil && !flow.SrcIP.Contains(p.src) {
+		return false
+	}
+	if flow.DstIP != nil && !flow.DstIP.Contains(p.dst) {
+		return false
+	}
+	if flow.Protocol != 0 && flow.Protocol != p.protocol {
+		return false
+	}
+	if p.protocol != protocolTCP && p.protocol != protocolUDP {
+		return flow.SrcPort == 0 && flow.DstPort == 0
+	}
+
+	return coversValue(flow.SrcPort, p.srcPort) && coversValue(flow.DstPort, p.dstPort)
+}
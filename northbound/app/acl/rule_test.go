@@ -0,0 +1,157 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015-2019 Samjung Data Service, Inc. All rights reserved.
+ *  Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package acl
+
+import (
+	"net"
+	"testing"
+
+	"github.com/superkkt/cherry/network"
+)
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func nets(v ...string) []*net.IPNet {
+	result := []*net.IPNet{}
+	for _, s := range v {
+		result = append(result, mustParseCIDR(s))
+	}
+	return result
+}
+
+func TestCompile(t *testing.T) {
+	rules := []Rule{
+		// Deny the traffic from the web servers to the database servers except MySQL.
+		{ID: 1, Priority: 10, Allow: false, Src: nets("10.0.1.0/24"), Dst: nets("10.0.2.0/24")},
+		{ID: 2, Priority: 20, Allow: true, Src: nets("10.0.1.0/24"), Dst: nets("10.0.2.0/24"), Protocol: protocolTCP, DstPort: 3306},
+		// Covered by the rule 1.
+		{ID: 3, Priority: 5, Allow: false, Src: nets("10.0.1.128/25"), Dst: nets("10.0.2.1/32")},
+		// Not necessary because it does not overlap any deny rule.
+		{ID: 4, Priority: 30, Allow: true, Src: nets("10.0.3.0/24")},
+		// Group that has no host.
+		{ID: 5, Priority: 40, Allow: false, Src: nets(), Dst: nil},
+		// Deny rule takes precedence over the allow rule of the same priority.
+		{ID: 6, Priority: 20, Allow: false, Src: nets("10.0.1.1/32"), Dst: nets("10.0.2.0/24")},
+	}
+
+	flows, err := compile(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flows) != 3 {
+		t.Fatalf("unexpected number of flows: expected=3, got=%v: %v", len(flows), flows)
+	}
+	expected := []struct {
+		priority uint16
+		allow    bool
+		src      string
+	}{
+		{2, false, "10.0.1.1/32"},
+		{1, true, "10.0.1.0/24"},
+		{0, false, "10.0.1.0/24"},
+	}
+	for i, v := range expected {
+		if flows[i].Priority != v.priority || flows[i].Allow != v.allow || flows[i].SrcIP.String() != v.src {
+			t.Fatalf("#%v: unexpected flow: %v", i, flows[i])
+		}
+	}
+
+	src := []struct {
+		packet  packet
+		allowed bool
+	}{
+		{packet{net.IPv4(10, 0, 1, 2), net.IPv4(10, 0, 2, 3), protocolTCP, 40000, 3306}, true},
+		{packet{net.IPv4(10, 0, 1, 2), net.IPv4(10, 0, 2, 3), protocolTCP, 40000, 22}, false},
+		{packet{net.IPv4(10, 0, 1, 2), net.IPv4(10, 0, 2, 3), protocolUDP, 40000, 3306}, false},
+		{packet{net.IPv4(10, 0, 1, 1), net.IPv4(10, 0, 2, 3), protocolTCP, 40000, 3306}, false},
+		{packet{net.IPv4(10, 0, 1, 2), net.IPv4(10, 0, 3, 3), protocolTCP, 40000, 22}, true},
+		{packet{net.IPv4(10, 0, 3, 2), net.IPv4(10, 0, 2, 3), 1, 0, 0}, true},
+	}
+	for i, v := range src {
+		if allowed(flows, v.packet) != v.allowed {
+			t.Fatalf("#%v: unexpected decision: packet=%+v, expected=%v", i, v.packet, v.allowed)
+		}
+	}
+}
+
+func TestCompileTooManyLevels(t *testing.T) {
+	rules := make([]Rule, 0)
+	for i := 0; i <= network.MaxACLPriority+1; i++ {
+		// Rules that do not cover each other.
+		dst := &net.IPNet{IP: net.IPv4(10, 0, byte(i>>8), byte(i)), Mask: net.CIDRMask(32, 32)}
+		rules = append(rules, Rule{ID: uint64(i), Priority: uint16(i), Dst: []*net.IPNet{dst}})
+	}
+	if _, err := compile(rules); err == nil {
+		t.Fatal("expected an error for too many priority levels")
+	}
+}
+
+func TestNetworksAggregation(t *testing.T) {
+	src := []struct {
+		nets     []*net.IPNet
+		expected []string
+	}{
+		// Hosts of a group are aggregated into the prefixes.
+		{nets("10.0.0.3/32", "10.0.0.1/32", "10.0.0.0/32", "10.0.0.2/32"), []string{"10.0.0.0/30"}},
+		{nets("10.0.0.1/32", "10.0.0.2/32"), []string{"10.0.0.1/32", "10.0.0.2/32"}},
+		// Covered and duplicated networks.
+		{nets("10.0.1.0/24", "10.0.1.7/32", "10.0.1.0/24"), []string{"10.0.1.0/24"}},
+		{nets("10.0.0.0/25", "10.0.0.128/26", "10.0.0.192/26"), []string{"10.0.0.0/24"}},
+		{nets("0.0.0.0/1", "128.0.0.0/1"), []string{"0.0.0.0/0"}},
+		{nets(), []string{}},
+	}
+
+	for i, v := range src {
+		result := networks(v.nets)
+		if len(result) != len(v.expected) {
+			t.Fatalf("#%v: unexpected networks: expected=%v, got=%v", i, v.expected, result)
+		}
+		for j := range result {
+			if result[j].String() != v.expected[j] {
+				t.Fatalf("#%v: unexpected networks: expected=%v, got=%v", i, v.expected, result)
+			}
+		}
+	}
+}
+
+func TestCompileTooManyFlows(t *testing.T) {
+	hosts := func(third, n int) []*net.IPNet {
+		result := []*net.IPNet{}
+		// Even addresses that cannot be aggregated.
+		for i := 0; i < n; i++ {
+			result = append(result, &net.IPNet{IP: net.IPv4(10, 0, byte(third), byte(i*2)).To4(), Mask: net.CIDRMask(32, 32)})
+		}
+		return result
+	}
+	rules := []Rule{
+		{ID: 1, Priority: 10, Allow: false, Src: hosts(1, 120), Dst: hosts(2, 100)},
+	}
+	if _, err := compile(rules); err == nil {
+		t.Fatal("expected an error for too many ACL flows")
+	}
+}
@@ -0,0 +1,159 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package external
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	errQueueOverflow = errors.New("send queue overflow")
+	errClosedClient  = errors.New("closed client")
+)
+
+// client is a connected external application.
+type client struct {
+	name        string
+	events      map[string]bool
+	permissions map[string]bool
+	conn        net.Conn
+	// Messages waiting to be written to the connection by the writer goroutine, so that
+	// the callers of send are never blocked by a slow application.
+	queue chan interface{}
+	done  chan struct{}
+
+	mutex   sync.Mutex
+	lastID  uint64
+	pending map[uint64]chan bool
+}
+
+func newClient(name string, events, permissions map[string]bool, conn net.Conn, queueSize int) *client {
+	return &client{
+		name:        name,
+		events:      events,
+		permissions: permissions,
+		conn:        conn,
+		queue:       make(chan interface{}, queueSize),
+		done:        make(chan struct{}),
+		pending:     make(map[uint64]chan bool),
+	}
+}
+
+// send queues v to be written as a line of JSON without blocking. The application is
+// disconnected if its queue is full, because it cannot keep up with the messages.
+func (r *client) send(v interface{}) error {
+	select {
+	case <-r.done:
+		return errClosedClient
+	default:
+	}
+
+	select {
+	case r.queue <- v:
+		return nil
+	default:
+		logger.Errorf("disconnecting %v whose send queue is full", r.name)
+		// The reader of the connection will remove this client.
+		r.conn.Close()
+		return errQueueOverflow
+	}
+}
+
+// write writes the queued messages to the connection until the client is closed. It
+// should be called as a goroutine.
+func (r *client) write() {
+	encoder := json.NewEncoder(r.conn)
+	for {
+		select {
+		case v := <-r.queue:
+			r.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := encoder.Encode(v); err != nil {
+				logger.Errorf("failed to write a message to %v: %v", r.name, err)
+				// The reader of the connection will remove this client.
+				r.conn.Close()
+				return
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// deliver sends the event, and then returns the ID of the event and the channel that
+// will receive the verdict of the event.
+func (r *client) deliver(event string, data interface{}) (id uint64, verdict <-chan bool, err error) {
+	c := make(chan bool, 1)
+
+	r.mutex.Lock()
+	r.lastID++
+	id = r.lastID
+	r.pending[id] = c
+	r.mutex.Unlock()
+
+	if err := r.send(reply{Type: msgEvent, ID: id, Event: event, Data: data}); err != nil {
+		r.forget(id)
+		return 0, nil, err
+	}
+
+	return id, c, nil
+}
+
+// resolve delivers the verdict of the event whose ID is id. The late verdict of an
+// event that has been timed out is ignored.
+func (r *client) resolve(id uint64, consume bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	c, ok := r.pending[id]
+	if !ok {
+		logger.Debugf("ignore the unknown or expired verdict from %v: id=%v", r.name, id)
+		return
+	}
+	c <- consume
+	delete(r.pending, id)
+}
+
+func (r *client) forget(id uint64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.pending, id)
+}
+
+// close closes the connection and stops the writer goroutine. The pending events are
+// considered as ones that are not consumed.
+func (r *client) close() {
+	r.conn.Close()
+	close(r.done)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for id, c := range r.pending {
+		c <- false
+		delete(r.pending, id)
+	}
+}
@@ -0,0 +1,530 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package external
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/protocol"
+
+	"github.com/superkkt/go-logging"
+	"github.com/superkkt/viper"
+)
+
+var (
+	logger = logging.MustGetLogger("external")
+)
+
+const (
+	// Default time to wait for the verdicts of an event from the external applications.
+	defaultVerdictTimeout = 100 * time.Millisecond
+	// Time to wait for the hello message of a new connection.
+	helloTimeout = 10 * time.Second
+	// Time to wait for writing a message to an external application.
+	writeTimeout = 5 * time.Second
+	// Maximum length of a message sent by an external application.
+	maxRequestSize = 1 << 20
+	// Default maximum number of messages waiting to be written to an external application.
+	defaultQueueSize = 256
+)
+
+// External delivers the network events to the out-of-process applications connected over
+// a Unix or TCP socket, and then continues the application chain unless one of them
+// consumes the event. The messages are lines of JSON, and the applications can send
+// PACKET_OUT and FLOW_MOD messages if they are permitted to do so.
+type External struct {
+	app.BaseProcessor
+	timeout   time.Duration
+	queueSize int
+	// Tokens of the registered applications. The key is the application name.
+	tokens map[string]string
+	// Permissions of the registered applications. The key is the application name.
+	permissions map[string]map[string]bool
+
+	mutex   sync.RWMutex
+	clients map[string]*client
+	finder  network.Finder
+}
+
+func New() *External {
+	return &External{
+		queueSize: defaultQueueSize,
+		clients:   make(map[string]*client),
+	}
+}
+
+func (r *External) Init() error {
+	addr := viper.GetString("external.listen")
+	if len(addr) == 0 {
+		logger.Info("external application API is disabled")
+		return nil
+	}
+
+	r.timeout = defaultVerdictTimeout
+	if t := viper.GetInt("external.timeout"); t > 0 {
+		r.timeout = time.Duration(t) * time.Millisecond
+	}
+	if v := viper.GetInt("external.queue_size"); v > 0 {
+		r.queueSize = v
+	}
+	r.tokens = viper.GetStringMapString("external.tokens")
+	if len(r.tokens) == 0 {
+		return errors.New("no external application in external.tokens")
+	}
+	r.permissions = make(map[string]map[string]bool)
+	for name, v := range viper.GetStringMapString("external.permissions") {
+		perms, err := parsePermissions(v)
+		if err != nil {
+			return fmt.Errorf("invalid permissions of %v: %v", name, err)
+		}
+		r.permissions[name] = perms
+	}
+
+	ln, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	logger.Infof("listening the external applications on %v", addr)
+	go r.serve(ln)
+
+	return nil
+}
+
+func parsePermissions(s string) (map[string]bool, error) {
+	perms := make(map[string]bool)
+	for _, v := range strings.Split(strings.Replace(s, " ", "", -1), ",") {
+		switch v {
+		case "":
+			continue
+		case permPacketOut, permFlowMod:
+			perms[v] = true
+		default:
+			return nil, fmt.Errorf("unknown permission: %v", v)
+		}
+	}
+
+	return perms, nil
+}
+
+// listen listens on addr that is unix:<path> or tcp:<host>:<port>.
+func listen(addr string) (net.Listener, error) {
+	tokens := strings.SplitN(addr, ":", 2)
+	if len(tokens) != 2 || len(tokens[1]) == 0 {
+		return nil, fmt.Errorf("invalid listen address: %v", addr)
+	}
+
+	switch tokens[0] {
+	case "unix":
+		// Remove the stale socket file left by the previous process.
+		if err := os.Remove(tokens[1]); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return net.Listen("unix", tokens[1])
+	case "tcp":
+		return net.Listen("tcp", tokens[1])
+	default:
+		return nil, fmt.Errorf("unsupported network of the listen address: %v", addr)
+	}
+}
+
+func (r *External) Name() string {
+	return "External"
+}
+
+func (r *External) String() string {
+	return fmt.Sprintf("%v", r.Name())
+}
+
+func (r *External) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			logger.Errorf("failed to accept a new external application: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		go r.handle(conn)
+	}
+}
+
+func (r *External) handle(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxRequestSize)
+
+	conn.SetReadDeadline(time.Now().Add(helloTimeout))
+	c, err := r.authenticate(conn, scanner)
+	if err != nil {
+		logger.Errorf("failed to authenticate an external application from %v: %v", conn.RemoteAddr(), err)
+		sendError(conn, err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	if err := r.addClient(c); err != nil {
+		sendError(conn, err)
+		return
+	}
+	defer r.removeClient(c)
+	go c.write()
+	if err := c.send(reply{Type: msgWelcome}); err != nil {
+		return
+	}
+	logger.Infof("external application is connected: name=%v, address=%v", c.name, conn.RemoteAddr())
+
+	for scanner.Scan() {
+		req := new(request)
+		if err := json.Unmarshal(scanner.Bytes(), req); err != nil {
+			c.send(reply{Type: msgError, Message: fmt.Sprintf("invalid message: %v", err)})
+			continue
+		}
+		r.process(c, req)
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Errorf("failed to read a message from %v: %v", c.name, err)
+	}
+	logger.Infof("external application is disconnected: name=%v", c.name)
+}
+
+// sendError writes the error to the connection that is not added as a client.
+func sendError(conn net.Conn, err error) {
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	json.NewEncoder(conn).Encode(reply{Type: msgError, Message: err.Error()})
+}
+
+func (r *External) authenticate(conn net.Conn, scanner *bufio.Scanner) (*client, error) {
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("connection closed before hello")
+	}
+
+	hello := new(request)
+	if err := json.Unmarshal(scanner.Bytes(), hello); err != nil {
+		return nil, err
+	}
+	if hello.Type != msgHello {
+		return nil, fmt.Errorf("unexpected message: %v", hello.Type)
+	}
+	token, ok := r.tokens[strings.ToLower(hello.Name)]
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(hello.Token)) != 1 {
+		return nil, fmt.Errorf("invalid name or token: %v", hello.Name)
+	}
+
+	subscribed := make(map[string]bool)
+	for _, v := range hello.Events {
+		if !events[v] {
+			return nil, fmt.Errorf("unknown event: %v", v)
+		}
+		subscribed[v] = true
+	}
+
+	return newClient(strings.ToLower(hello.Name), subscribed, r.permissions[strings.ToLower(hello.Name)], conn, r.queueSize), nil
+}
+
+func (r *External) addClient(c *client) error {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.clients[c.name]; ok {
+		return fmt.Errorf("already connected application: %v", c.name)
+	}
+	r.clients[c.name] = c
+
+	return nil
+}
+
+func (r *External) removeClient(c *client) {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.clients, c.name)
+	c.close()
+}
+
+func (r *External) subscribers(event string) []*client {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make([]*client, 0)
+	for _, c := range r.clients {
+		if c.events[event] {
+			result = append(result, c)
+		}
+	}
+
+	return result
+}
+
+func (r *External) setFinder(finder network.Finder) {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.finder = finder
+}
+
+func (r *External) getFinder() network.Finder {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.finder
+}
+
+// dispatch delivers the event to the subscribed applications, and then returns whether
+// one of them has consumed the event. The applications that do not reply within the
+// timeout are considered as ones that do not consume the event. The events are queued
+// to be written to the applications, so that dispatch is never blocked by a slow one.
+func (r *External) dispatch(finder network.Finder, event string, data interface{}) (consumed bool) {
+	// Remember the finder to process the requests of the external applications.
+	if r.getFinder() == nil {
+		r.setFinder(finder)
+	}
+
+	clients := r.subscribers(event)
+	if len(clients) == 0 {
+		return false
+	}
+
+	type pending struct {
+		client  *client
+		id      uint64
+		verdict <-chan bool
+	}
+	waiting := make([]pending, 0, len(clients))
+	for _, c := range clients {
+		id, verdict, err := c.deliver(event, data)
+		if err != nil {
+			logger.Errorf("failed to deliver an event to %v: %v", c.name, err)
+			continue
+		}
+		waiting = append(waiting, pending{client: c, id: id, verdict: verdict})
+	}
+
+	timer := time.NewTimer(r.timeout)
+	defer timer.Stop()
+	expired := false
+	for _, v := range waiting {
+		var consume, replied bool
+		if expired {
+			// Take the verdict only if it has already arrived.
+			select {
+			case consume = <-v.verdict:
+				replied = true
+			default:
+			}
+		} else {
+			select {
+			case consume = <-v.verdict:
+				replied = true
+			case <-timer.C:
+				expired = true
+			}
+		}
+		v.client.forget(v.id)
+
+		if !replied {
+			logger.Warningf("timeout to wait the verdict of %v event from %v", event, v.client.name)
+			continue
+		}
+		if consume {
+			logger.Debugf("%v event is consumed by %v", event, v.client.name)
+			consumed = true
+		}
+	}
+
+	return consumed
+}
+
+func (r *External) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	packet, err := eth.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	data := PacketInEvent{DeviceID: ingress.Device().ID(), Port: ingress.Number(), Packet: packet}
+	if r.dispatch(finder, eventPacketIn, data) {
+		return nil
+	}
+
+	return r.BaseProcessor.OnPacketIn(finder, ingress, eth)
+}
+
+func (r *External) OnPortUp(finder network.Finder, port *network.Port) error {
+	data := network.PortEvent{DeviceID: port.Device().ID(), Port: port.Number()}
+	if r.dispatch(finder, eventPortUp, data) {
+		return nil
+	}
+
+	return r.BaseProcessor.OnPortUp(finder, port)
+}
+
+func (r *External) OnPortDown(finder network.Finder, port *network.Port) error {
+	data := network.PortEvent{DeviceID: port.Device().ID(), Port: port.Number()}
+	if r.dispatch(finder, eventPortDown, data) {
+		return nil
+	}
+
+	return r.BaseProcessor.OnPortDown(finder, port)
+}
+
+func (r *External) OnDeviceUp(finder network.Finder, device *network.Device) error {
+	data := network.DeviceEvent{DeviceID: device.ID()}
+	if r.dispatch(finder, eventDeviceUp, data) {
+		return nil
+	}
+
+	return r.BaseProcessor.OnDeviceUp(finder, device)
+}
+
+func (r *External) OnDeviceDown(finder network.Finder, device *network.Device) error {
+	data := network.DeviceEvent{DeviceID: device.ID()}
+	if r.dispatch(finder, eventDeviceDown, data) {
+		return nil
+	}
+
+	return r.BaseProcessor.OnDeviceDown(finder, device)
+}
+
+func (r *External) OnTopologyChange(finder network.Finder) error {
+	if r.dispatch(finder, eventTopologyChange, nil) {
+		return nil
+	}
+
+	return r.BaseProcessor.OnTopologyChange(finder)
+}
+
+func (r *External) OnFlowRemoved(finder network.Finder, flow openflow.FlowRemoved) error {
+	if r.dispatch(finder, eventFlowRemoved, newFlowRemovedEvent(flow)) {
+		return nil
+	}
+
+	return r.BaseProcessor.OnFlowRemoved(finder, flow)
+}
+
+func (r *External) process(c *client, req *request) {
+	switch req.Type {
+	case msgVerdict:
+		c.resolve(req.ID, req.Consume)
+	case msgPacketOut:
+		c.send(newResult(req.ID, r.packetOut(c, req)))
+	case msgFlowMod:
+		c.send(newResult(req.ID, r.flowMod(c, req)))
+	default:
+		c.send(reply{Type: msgError, ID: req.ID, Message: fmt.Sprintf("unknown message type: %v", req.Type)})
+	}
+}
+
+func newResult(id uint64, err error) reply {
+	v := reply{Type: msgResult, ID: id}
+	if err != nil {
+		v.Message = err.Error()
+	}
+
+	return v
+}
+
+func (r *External) device(id string) (*network.Device, error) {
+	finder := r.getFinder()
+	if finder == nil {
+		return nil, errors.New("network is not ready")
+	}
+	device := finder.Device(id)
+	if device == nil {
+		return nil, fmt.Errorf("unknown device: %v", id)
+	}
+
+	return device, nil
+}
+
+func (r *External) packetOut(c *client, req *request) error {
+	if !c.permissions[permPacketOut] {
+		return errors.New("permission denied")
+	}
+	if len(req.Data) == 0 {
+		return errors.New("empty packet")
+	}
+
+	device, err := r.device(req.DeviceID)
+	if err != nil {
+		return err
+	}
+	egress := device.Port(req.Port)
+	if egress == nil {
+		return fmt.Errorf("unknown port: %v", req.Port)
+	}
+	logger.Debugf("sending PACKET_OUT requested by %v: deviceID=%v, port=%v", c.name, req.DeviceID, req.Port)
+
+	return r.PacketOut(egress, req.Data)
+}
+
+// flowMod installs or removes a flow in the cookie namespace of this application, so that
+// the external applications cannot touch the flows installed by the other applications.
+func (r *External) flowMod(c *client, req *request) error {
+	if !c.permissions[permFlowMod] {
+		return errors.New("permission denied")
+	}
+	if req.Match == nil {
+		return errors.New("empty match")
+	}
+
+	device, err := r.device(req.DeviceID)
+	if err != nil {
+		return err
+	}
+	if device.Port(req.Port) == nil {
+		return fmt.Errorf("unknown port: %v", req.Port)
+	}
+	match, err := req.Match.build(device.Factory())
+	if err != nil {
+		return err
+	}
+	outPort := openflow.NewOutPort()
+	outPort.SetValue(req.Port)
+	logger.Debugf("sending FLOW_MOD requested by %v: deviceID=%v, command=%v, match=%+v, port=%v", c.name, req.DeviceID, req.Command, req.Match, req.Port)
+
+	switch req.Command {
+	case "add":
+		return device.SetOwnedFlow(r.FlowOwner(), match, outPort)
+	case "delete":
+		return device.RemoveOwnedFlow(r.FlowOwner(), match, outPort)
+	default:
+		return fmt.Errorf("unknown command: %v", req.Command)
+	}
+}
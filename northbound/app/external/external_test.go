@@ -0,0 +1,169 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015-2019 Samjung Data Service, Inc. All rights reserved.
+ *  Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package external
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+)
+
+func connect(t *testing.T, r *External, hello request) (*bufio.Scanner, *json.Encoder) {
+	server, conn := net.Pipe()
+	go r.handle(server)
+
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	if err := encoder.Encode(hello); err != nil {
+		t.Fatal(err)
+	}
+	if !scanner.Scan() {
+		t.Fatalf("failed to read the welcome message: %v", scanner.Err())
+	}
+	welcome := new(reply)
+	if err := json.Unmarshal(scanner.Bytes(), welcome); err != nil {
+		t.Fatal(err)
+	}
+	if welcome.Type != msgWelcome {
+		t.Fatalf("unexpected reply for hello: %+v", welcome)
+	}
+
+	return scanner, encoder
+}
+
+func TestDispatch(t *testing.T) {
+	r := New()
+	r.timeout = 100 * time.Millisecond
+	r.tokens = map[string]string{"myapp": "secret"}
+
+	scanner, encoder := connect(t, r, request{Type: msgHello, Name: "myapp", Token: "secret", Events: []string{eventDeviceUp}})
+	// Wait until the client is added.
+	for len(r.subscribers(eventDeviceUp)) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	src := []struct {
+		reply    bool
+		consume  bool
+		expected bool
+	}{
+		{true, true, true},
+		{true, false, false},
+		// Timeout.
+		{false, true, false},
+	}
+	for i, v := range src {
+		done := make(chan bool)
+		go func() {
+			done <- r.dispatch(nil, eventDeviceUp, network.DeviceEvent{DeviceID: "1"})
+		}()
+
+		if !scanner.Scan() {
+			t.Fatalf("#%v: failed to read an event: %v", i, scanner.Err())
+		}
+		event := new(reply)
+		if err := json.Unmarshal(scanner.Bytes(), event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Type != msgEvent || event.Event != eventDeviceUp {
+			t.Fatalf("#%v: unexpected event: %+v", i, event)
+		}
+		if v.reply {
+			if err := encoder.Encode(request{Type: msgVerdict, ID: event.ID, Consume: v.consume}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if consumed := <-done; consumed != v.expected {
+			t.Fatalf("#%v: unexpected verdict: expected=%v, got=%v", i, v.expected, consumed)
+		}
+	}
+
+	// Not subscribed event.
+	if r.dispatch(nil, eventPortUp, network.PortEvent{DeviceID: "1", Port: 1}) {
+		t.Fatal("not subscribed event is consumed")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	r := New()
+	r.tokens = map[string]string{"myapp": "secret"}
+
+	server, conn := net.Pipe()
+	go r.handle(server)
+
+	if err := json.NewEncoder(conn).Encode(request{Type: msgHello, Name: "myapp", Token: "wrong"}); err != nil {
+		t.Fatal(err)
+	}
+	scanner := bufio.NewScanner(conn)
+	if !scanner.Scan() {
+		t.Fatalf("failed to read the reply: %v", scanner.Err())
+	}
+	v := new(reply)
+	if err := json.Unmarshal(scanner.Bytes(), v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Type != msgError {
+		t.Fatalf("unexpected reply for an invalid token: %+v", v)
+	}
+}
+
+func TestQueueOverflow(t *testing.T) {
+	r := New()
+	r.timeout = 10 * time.Millisecond
+	r.queueSize = 2
+	r.tokens = map[string]string{"myapp": "secret"}
+
+	// The application never reads the events after the welcome message.
+	connect(t, r, request{Type: msgHello, Name: "myapp", Token: "secret", Events: []string{eventDeviceUp}})
+	for len(r.subscribers(eventDeviceUp)) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The writer is blocked by the first event, and then the next ones fill the queue.
+	for i := 0; i < r.queueSize+2; i++ {
+		done := make(chan bool)
+		go func() {
+			done <- r.dispatch(nil, eventDeviceUp, network.DeviceEvent{DeviceID: "1"})
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("#%v: dispatch is blocked by the slow application", i)
+		}
+	}
+
+	// The application is disconnected due to the overflow.
+	timeout := time.After(time.Second)
+	for len(r.subscribers(eventDeviceUp)) != 0 {
+		select {
+		case <-timeout:
+			t.Fatal("the slow application is not disconnected")
+		default:
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package external
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/superkkt/cherry/openflow"
+)
+
+// An external application sends a hello message first to authenticate itself and to
+// subscribe to the events, and then receives a welcome message. Each event delivered to
+// the application should be replied by a verdict message that has the ID of the event.
+// PACKET_OUT and FLOW_MOD requests are replied by result messages that have the IDs of the
+// requests, whose messages are empty on success.
+
+// Types of the messages sent by the external applications.
+const (
+	// hello should be the first message to authenticate the application and to subscribe
+	// the events.
+	msgHello = "hello"
+	// verdict is the reply for an event, which decides whether the event is consumed or
+	// delivered to the next applications.
+	msgVerdict   = "verdict"
+	msgPacketOut = "packet_out"
+	msgFlowMod   = "flow_mod"
+)
+
+// Types of the messages sent by the controller.
+const (
+	msgWelcome = "welcome"
+	msgEvent   = "event"
+	// result is the reply for a packet_out or flow_mod request.
+	msgResult = "result"
+	msgError  = "error"
+)
+
+// Events that can be subscribed by the external applications.
+const (
+	eventPacketIn       = "packet_in"
+	eventPortUp         = "port_up"
+	eventPortDown       = "port_down"
+	eventDeviceUp       = "device_up"
+	eventDeviceDown     = "device_down"
+	eventTopologyChange = "topology_change"
+	eventFlowRemoved    = "flow_removed"
+)
+
+var events = map[string]bool{
+	eventPacketIn:       true,
+	eventPortUp:         true,
+	eventPortDown:       true,
+	eventDeviceUp:       true,
+	eventDeviceDown:     true,
+	eventTopologyChange: true,
+	eventFlowRemoved:    true,
+}
+
+// Permissions that can be granted to the external applications.
+const (
+	permPacketOut = "packet_out"
+	permFlowMod   = "flow_mod"
+)
+
+// request is a message sent by an external application, which is a line of JSON.
+type request struct {
+	Type string `json:"type"`
+	// ID of the event for a verdict, or the request ID chosen by the application for the
+	// other requests. The result of a request has the same ID.
+	ID uint64 `json:"id"`
+
+	// Hello.
+	Name   string   `json:"name"`
+	Token  string   `json:"token"`
+	Events []string `json:"events"`
+
+	// Verdict.
+	Consume bool `json:"consume"`
+
+	// PACKET_OUT and FLOW_MOD.
+	DeviceID string `json:"device_id"`
+	// Egress port of PACKET_OUT, or the output port of FLOW_MOD.
+	Port uint32 `json:"port"`
+	// Ethernet frame of PACKET_OUT, which is encoded in base64.
+	Data []byte `json:"data"`
+	// Command of FLOW_MOD: add or delete.
+	Command string     `json:"command"`
+	Match   *flowMatch `json:"match"`
+}
+
+// reply is a message sent by the controller, which is a line of JSON.
+type reply struct {
+	Type    string      `json:"type"`
+	ID      uint64      `json:"id,omitempty"`
+	Event   string      `json:"event,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+// PacketInEvent is the data of a packet_in event.
+type PacketInEvent struct {
+	DeviceID string `json:"device_id"`
+	Port     uint32 `json:"port"`
+	// Ethernet frame encoded in base64.
+	Packet []byte `json:"packet"`
+}
+
+// FlowRemovedEvent is the data of a flow_removed event.
+type FlowRemovedEvent struct {
+	Cookie      uint64 `json:"cookie"`
+	Priority    uint16 `json:"priority"`
+	Reason      uint8  `json:"reason"`
+	TableID     uint8  `json:"table_id"`
+	DurationSec uint32 `json:"duration_sec"`
+	PacketCount uint64 `json:"packet_count"`
+	ByteCount   uint64 `json:"byte_count"`
+}
+
+func newFlowRemovedEvent(flow openflow.FlowRemoved) FlowRemovedEvent {
+	return FlowRemovedEvent{
+		Cookie:      flow.Cookie(),
+		Priority:    flow.Priority(),
+		Reason:      flow.Reason(),
+		TableID:     flow.TableID(),
+		DurationSec: flow.DurationSec(),
+		PacketCount: flow.PacketCount(),
+		ByteCount:   flow.ByteCount(),
+	}
+}
+
+// flowMatch is the match of a FLOW_MOD request. Zero values and empty strings are wildcards.
+type flowMatch struct {
+	InPort     uint32 `json:"in_port"`
+	EtherType  uint16 `json:"eth_type"`
+	SrcMAC     string `json:"src_mac"`
+	DstMAC     string `json:"dst_mac"`
+	SrcIP      string `json:"src_ip"`
+	DstIP      string `json:"dst_ip"`
+	IPProtocol uint8  `json:"ip_proto"`
+	SrcPort    uint16 `json:"tp_src"`
+	DstPort    uint16 `json:"tp_dst"`
+}
+
+func (r *flowMatch) UnmarshalJSON(data []byte) error {
+	type alias flowMatch
+	v := alias{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*r = flowMatch(v)
+
+	return r.validate()
+}
+
+func (r *flowMatch) validate() error {
+	if len(r.SrcIP) > 0 || len(r.DstIP) > 0 || r.IPProtocol != 0 {
+		if r.EtherType != 0x0800 {
+			return errors.New("IP match fields require eth_type 0x0800")
+		}
+	}
+	if r.SrcPort != 0 || r.DstPort != 0 {
+		// TCP or UDP.
+		if r.IPProtocol != 6 && r.IPProtocol != 17 {
+			return errors.New("transport port match fields require ip_proto 6 or 17")
+		}
+	}
+
+	return nil
+}
+
+// build returns a new match created by f.
+func (r *flowMatch) build(f openflow.Factory) (openflow.Match, error) {
+	match, err := f.NewMatch()
+	if err != nil {
+		return nil, err
+	}
+
+	if r.InPort != 0 {
+		inPort := openflow.NewInPort()
+		inPort.SetValue(r.InPort)
+		match.SetInPort(inPort)
+	}
+	if r.EtherType != 0 {
+		match.SetEtherType(r.EtherType)
+	}
+	if len(r.SrcMAC) > 0 {
+		mac, err := net.ParseMAC(r.SrcMAC)
+		if err != nil {
+			return nil, err
+		}
+		match.SetSrcMAC(mac)
+	}
+	if len(r.DstMAC) > 0 {
+		mac, err := net.ParseMAC(r.DstMAC)
+		if err != nil {
+			return nil, err
+		}
+		match.SetDstMAC(mac)
+	}
+	if len(r.SrcIP) > 0 {
+		ip, err := parseIPNet(r.SrcIP)
+		if err != nil {
+			return nil, err
+		}
+		match.SetSrcIP(ip)
+	}
+	if len(r.DstIP) > 0 {
+		ip, err := parseIPNet(r.DstIP)
+		if err != nil {
+			return nil, err
+		}
+		match.SetDstIP(ip)
+	}
+	if r.IPProtocol != 0 {
+		match.SetIPProtocol(r.IPProtocol)
+	}
+	if r.SrcPort != 0 {
+		match.SetSrcPort(r.SrcPort)
+	}
+	if r.DstPort != 0 {
+		match.SetDstPort(r.DstPort)
+	}
+
+	return match, match.Error()
+}
+
+// parseIPNet parses s that is an IPv4 address or a CIDR notation.
+func parseIPNet(s string) (*net.IPNet, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		if ip.To4() == nil {
+			return nil, fmt.Errorf("not an IPv4 address: %v", s)
+		}
+		return &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}, nil
+	}
+
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+	if ipnet.IP.To4() == nil {
+		return nil, fmt.Errorf("not an IPv4 network: %v", s)
+	}
+
+	return ipnet, nil
+}
@@ -0,0 +1,165 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package l2switch
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+)
+
+const (
+	// Tracked flows that are no longer installed in their devices are discarded after this
+	// duration since they have been updated. This should be longer than the flow idle timeout.
+	trackedFlowExpiration = 3 * time.Minute
+)
+
+// flowTracker remembers the flows installed by L2Switch and the ports they depend on, so
+// that we can update only the flows affected by a topology change.
+type flowTracker struct {
+	mutex sync.Mutex
+	flows map[string]trackedFlow // Key = device ID and destination MAC address.
+}
+
+type trackedFlow struct {
+	device *network.Device
+	dstMAC net.HardwareAddr
+	// dstPort is the port that the destination node is connected to.
+	dstPort *network.Port
+	// outPorts is nil if the flow has been removed from the device.
+	outPorts  []uint32
+	backup    uint32
+	timestamp time.Time
+}
+
+func newFlowTracker() *flowTracker {
+	return &flowTracker{
+		flows: make(map[string]trackedFlow),
+	}
+}
+
+func trackerKey(deviceID string, mac net.HardwareAddr) string {
+	return fmt.Sprintf("%v/%v", deviceID, mac)
+}
+
+func (r *flowTracker) add(p flowParam) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ports := make([]uint32, len(p.outPorts))
+	copy(ports, p.outPorts)
+	r.flows[trackerKey(p.device.ID(), p.dstMAC)] = trackedFlow{
+		device:    p.device,
+		dstMAC:    p.dstMAC,
+		dstPort:   p.dstPort,
+		outPorts:  ports,
+		backup:    p.backup,
+		timestamp: time.Now(),
+	}
+}
+
+func (r *flowTracker) remove(deviceID string, mac net.HardwareAddr) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.flows, trackerKey(deviceID, mac))
+}
+
+// invalidatePort marks the flows heading to port as removed.
+func (r *flowTracker) invalidatePort(port *network.Port) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for k, v := range r.flows {
+		if v.device.ID() != port.Device().ID() || containsPort(v.outPorts, port.Number()) == false {
+			continue
+		}
+		v.outPorts = nil
+		r.flows[k] = v
+	}
+}
+
+func (r *flowTracker) removeDevice(deviceID string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for k, v := range r.flows {
+		if v.device.ID() == deviceID {
+			delete(r.flows, k)
+		}
+	}
+}
+
+// snapshot returns a copy of the tracked flows after discarding the expired ones. A tracked
+// flow never expires while its flow owned by owner is still installed in the device.
+func (r *flowTracker) snapshot(owner network.FlowOwner) []trackedFlow {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	installed := make(map[*network.Device]map[string]bool)
+	result := make([]trackedFlow, 0, len(r.flows))
+	for k, v := range r.flows {
+		if now.Sub(v.timestamp) > trackedFlowExpiration {
+			macs, ok := installed[v.device]
+			if !ok {
+				macs = v.device.OwnedFlowDstMACs(owner)
+				installed[v.device] = macs
+			}
+			if v.outPorts == nil || !macs[v.dstMAC.String()] {
+				delete(r.flows, k)
+				continue
+			}
+			v.timestamp = now
+			r.flows[k] = v
+		}
+		result = append(result, v)
+	}
+
+	return result
+}
+
+func containsPort(ports []uint32, num uint32) bool {
+	for _, v := range ports {
+		if v == num {
+			return true
+		}
+	}
+
+	return false
+}
+
+func equalPorts(p1, p2 []uint32) bool {
+	if len(p1) != len(p2) {
+		return false
+	}
+	for _, v := range p1 {
+		if containsPort(p2, v) == false {
+			return false
+		}
+	}
+
+	return true
+}
@@ -24,9 +24,8 @@ package l2switch
 import (
 	"bytes"
 	"fmt"
+	"hash/fnv"
 	"net"
-	"sync"
-	"time"
 
 	"github.com/superkkt/cherry/network"
 	"github.com/superkkt/cherry/northbound/app"
@@ -36,6 +35,7 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/pkg/errors"
 	"github.com/superkkt/go-logging"
+	"github.com/superkkt/viper"
 )
 
 var (
@@ -44,20 +44,16 @@ var (
 
 type L2Switch struct {
 	app.BaseProcessor
-	stormCtrl *stormController
-	db        Database
-	once      sync.Once
+	stormCtrl    *stormController
+	fastFailover bool
+	tracker      *flowTracker
 }
 
-type Database interface {
-	// MACAddrs returns all the registered MAC addresses.
-	MACAddrs() ([]net.HardwareAddr, error)
-}
-
-func New(db Database) *L2Switch {
+func New() *L2Switch {
 	return &L2Switch{
-		stormCtrl: newStormController(100, new(flooder)),
-		db:        db,
+		stormCtrl:    newStormController(100, new(flooder)),
+		fastFailover: viper.GetBool("default.fast_failover"),
+		tracker:      newFlowTracker(),
 	}
 }
 
@@ -81,16 +77,25 @@ func isBroadcast(eth *protocol.Ethernet) bool {
 }
 
 type flowParam struct {
-	device  *network.Device
-	dstMAC  net.HardwareAddr
-	outPort uint32
+	device *network.Device
+	dstMAC net.HardwareAddr
+	// dstPort is the port that the destination node is connected to.
+	dstPort *network.Port
+	// outPorts has multiple ports if there are equal-cost paths to the destination.
+	outPorts []uint32
+	// backup is the port that is used when the single output port fails. Zero means no backup port.
+	backup uint32
 }
 
 func (r flowParam) String() string {
-	return fmt.Sprintf("Device=%v, DstMAC=%v, OutPort=%v", r.device.ID(), r.dstMAC, r.outPort)
+	return fmt.Sprintf("Device=%v, DstMAC=%v, OutPorts=%v, Backup=%v", r.device.ID(), r.dstMAC, r.outPorts, r.backup)
 }
 
 func (r *L2Switch) setFlow(p flowParam) error {
+	if len(p.outPorts) == 0 {
+		return errors.New("empty output ports")
+	}
+
 	f := p.device.Factory()
 	match, err := f.NewMatch()
 	if err != nil {
@@ -98,38 +103,121 @@ func (r *L2Switch) setFlow(p flowParam) error {
 	}
 	match.SetDstMAC(p.dstMAC)
 
-	outPort := openflow.NewOutPort()
-	outPort.SetValue(p.outPort)
+	var groupID uint32
+	switch {
+	// OF1.0 does not support the group table, so that we only use the first port.
+	case f.ProtocolVersion() == openflow.OF10_VERSION:
+	case len(p.outPorts) > 1:
+		if groupID, err = p.device.SetSelectGroup(p.outPorts); err != nil {
+			return err
+		}
+	case p.backup != 0:
+		if groupID, err = p.device.SetFailoverGroup(p.outPorts[0], p.backup); err != nil {
+			return err
+		}
+	}
 
-	if err := p.device.SetFlow(match, outPort); err != nil {
-		return err
+	if groupID != 0 {
+		if err := p.device.SetOwnedGroupFlow(r.FlowOwner(), match, groupID); err != nil {
+			return err
+		}
+	} else {
+		outPort := openflow.NewOutPort()
+		outPort.SetValue(p.outPorts[0])
+
+		if err := p.device.SetOwnedFlow(r.FlowOwner(), match, outPort); err != nil {
+			return err
+		}
 	}
+	r.tracker.add(p)
 	logger.Debugf("installed a new flow rule: %v", p)
 
 	return nil
 }
 
+// nextHops returns the egress ports on device to reach dstDevice. It returns multiple
+// ports if there are equal-cost paths in the ECMP forwarding mode.
+func nextHops(finder network.Finder, device, dstDevice *network.Device) []*network.Port {
+	if finder.ForwardingMode() != network.ForwardingECMP {
+		path := finder.Path(device.ID(), dstDevice.ID())
+		if len(path) == 0 {
+			return nil
+		}
+		return []*network.Port{path[0][0]}
+	}
+
+	result := make([]*network.Port, 0)
+	dup := make(map[uint32]bool)
+	for _, path := range finder.EqualCostPaths(device.ID(), dstDevice.ID()) {
+		if len(path) == 0 {
+			continue
+		}
+		egress := path[0][0]
+		if dup[egress.Number()] {
+			continue
+		}
+		dup[egress.Number()] = true
+		result = append(result, egress)
+	}
+
+	return result
+}
+
+// backupPort returns the number of the port on device that is used to reach dstDevice when
+// the single egress port fails. It returns zero if the fast failover is disabled or there
+// is no such a port.
+func (r *L2Switch) backupPort(finder network.Finder, device, dstDevice *network.Device, egress []*network.Port) uint32 {
+	if r.fastFailover == false || len(egress) != 1 || device.ID() == dstDevice.ID() {
+		return 0
+	}
+
+	backup := finder.BackupPort(device.ID(), dstDevice.ID(), egress[0])
+	if backup == nil {
+		return 0
+	}
+
+	return backup.Number()
+}
+
 type switchParam struct {
 	finder    network.Finder
 	ethernet  *protocol.Ethernet
 	ingress   *network.Port
-	egress    *network.Port
+	dstPort   *network.Port
+	egress    []*network.Port
+	backup    uint32
 	rawPacket []byte
 }
 
 func (r *L2Switch) switching(p switchParam) error {
 	param := flowParam{
-		device:  p.ingress.Device(),
-		dstMAC:  p.ethernet.DstMAC,
-		outPort: p.egress.Number(),
+		device:   p.ingress.Device(),
+		dstMAC:   p.ethernet.DstMAC,
+		dstPort:  p.dstPort,
+		outPorts: make([]uint32, 0, len(p.egress)),
+		backup:   p.backup,
+	}
+	for _, v := range p.egress {
+		param.outPorts = append(param.outPorts, v.Number())
 	}
 	if err := r.setFlow(param); err != nil {
 		return err
 	}
 
+	// Pick an egress port for this packet by hashing the MAC addresses, as the switch
+	// does for the following packets, to reduce the packet reordering.
+	egress := p.egress[hashMAC(p.ethernet.SrcMAC, p.ethernet.DstMAC)%uint32(len(p.egress))]
 	// Send this ethernet packet directly to the destination node
-	logger.Debugf("sending a packet (Src=%v, Dst=%v) to egress port %v..", p.ethernet.SrcMAC, p.ethernet.DstMAC, p.egress.ID())
-	return r.PacketOut(p.egress, p.rawPacket)
+	logger.Debugf("sending a packet (Src=%v, Dst=%v) to egress port %v..", p.ethernet.SrcMAC, p.ethernet.DstMAC, egress.ID())
+	return r.PacketOut(egress, p.rawPacket)
+}
+
+func hashMAC(src, dst net.HardwareAddr) uint32 {
+	h := fnv.New32a()
+	h.Write(src)
+	h.Write(dst)
+
+	return h.Sum32()
 }
 
 func (r *L2Switch) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
@@ -162,6 +250,12 @@ func (r *L2Switch) processPacket(finder network.Finder, ingress *network.Port, e
 	}
 	if status != network.LocationDiscovered {
 		if status == network.LocationUndiscovered {
+			// Packets can come through the edges disabled by STP in the ECMP and SPB modes. Flooding
+			// them may result in a loop, so that we only flood the packets from the spanning tree.
+			if finder.IsEdge(ingress) && !finder.IsEnabledBySTP(ingress) {
+				logger.Debugf("undiscovered node from an edge disabled by STP! dropping.. SrcMAC=%v, DstMAC=%v", eth.SrcMAC, eth.DstMAC)
+				return true, nil
+			}
 			// Broadcast!
 			logger.Debugf("undiscovered node! broadcasting.. SrcMAC=%v, DstMAC=%v", eth.SrcMAC, eth.DstMAC)
 			return true, ingress.Device().Flood(ingress, packet)
@@ -182,36 +276,34 @@ func (r *L2Switch) processPacket(finder network.Finder, ingress *network.Port, e
 		return true, nil
 	}
 
-	param := switchParam{}
+	param := switchParam{
+		finder:    finder,
+		ethernet:  eth,
+		ingress:   ingress,
+		dstPort:   dstNode.Port(),
+		rawPacket: packet,
+	}
 	// Check whether src and dst nodes reside on a same switch device
 	if ingress.Device().ID() == dstNode.Port().Device().ID() {
-		param = switchParam{
-			finder:    finder,
-			ethernet:  eth,
-			ingress:   ingress,
-			egress:    dstNode.Port(),
-			rawPacket: packet,
-		}
+		param.egress = []*network.Port{dstNode.Port()}
 	} else {
-		path := finder.Path(ingress.Device().ID(), dstNode.Port().Device().ID())
-		if len(path) == 0 {
+		egress := nextHops(finder, ingress.Device(), dstNode.Port().Device())
+		if len(egress) == 0 {
 			logger.Debugf("empty path.. dropping SrcMAC=%v, DstMAC=%v", eth.SrcMAC, eth.DstMAC)
 			return true, nil
 		}
-		egress := path[0][0]
-		// Drop this packet if it goes back to the ingress port to avoid duplicated packet routing
-		if ingress.Number() == egress.Number() {
+		// Exclude the ingress port to avoid duplicated packet routing that goes back to the ingress port.
+		for _, v := range egress {
+			if v.Number() == ingress.Number() {
+				continue
+			}
+			param.egress = append(param.egress, v)
+		}
+		if len(param.egress) == 0 {
 			logger.Debugf("ignore routing path that goes back to the ingress port (SrcMAC=%v, DstMAC=%v)", eth.SrcMAC, eth.DstMAC)
 			return true, nil
 		}
-
-		param = switchParam{
-			finder:    finder,
-			ethernet:  eth,
-			ingress:   ingress,
-			egress:    egress,
-			rawPacket: packet,
-		}
+		param.backup = r.backupPort(finder, ingress.Device(), dstNode.Port().Device(), param.egress)
 	}
 
 	return true, r.switching(param)
@@ -220,29 +312,124 @@ func (r *L2Switch) processPacket(finder network.Finder, ingress *network.Port, e
 func (r *L2Switch) OnTopologyChange(finder network.Finder) error {
 	logger.Debug("OnTopologyChange..")
 
-	// We should remove all edges from all switch devices when the network topology is changed.
-	// Otherwise, installed flow rules in switches may result in incorrect packet routing based on the previous topology.
-	if err := r.removeAllFlows(finder.Devices()); err != nil {
-		return err
-	}
+	// Installed flow rules in switches may result in incorrect packet routing based on the previous topology.
+	// Update only the flows whose paths have been changed, instead of removing all the flows from all devices.
+	r.updateFlows(finder)
 
 	return r.BaseProcessor.OnTopologyChange(finder)
 }
 
-func (r *L2Switch) removeAllFlows(devices []*network.Device) error {
-	logger.Debug("removing all flows from all devices..")
+func (r *L2Switch) OnPathChange(finder network.Finder) error {
+	logger.Debug("OnPathChange..")
+
+	// The link weights have been changed by the latency or the congestion, so the flows may
+	// be rerouted to the new shortest paths.
+	r.updateFlows(finder)
+
+	return r.BaseProcessor.OnPathChange(finder)
+}
+
+// route returns the egress ports and the backup port on device to reach dstPort.
+func (r *L2Switch) route(finder network.Finder, device *network.Device, dstPort *network.Port) (egress []*network.Port, backup uint32) {
+	// Reside on this device?
+	if device.ID() == dstPort.Device().ID() {
+		return []*network.Port{dstPort}, 0
+	}
+
+	// Find the shortest paths from this device to an another device that is connected to the destination node.
+	egress = nextHops(finder, device, dstPort.Device())
+	return egress, r.backupPort(finder, device, dstPort.Device(), egress)
+}
+
+// trackAdoptedFlows registers the flows adopted from the previous controller instance in
+// the flow tracker. The adopted flows whose destination nodes are unknown are removed so
+// that they will be reinstalled through the normal path.
+func (r *L2Switch) trackAdoptedFlows(finder network.Finder) {
+	for _, device := range finder.Devices() {
+		for _, f := range device.TakeAdoptedFlows(r.FlowOwner()) {
+			node, _, err := finder.Node(f.DstMAC)
+			if err != nil || node == nil {
+				logger.Debugf("removing the adopted flow for the unknown node %v on %v", f.DstMAC, device.ID())
+				if err := device.RemoveOwnedFlowByMAC(r.FlowOwner(), f.DstMAC); err != nil {
+					logger.Errorf("failed to remove the adopted flow for %v on %v: %v", f.DstMAC, device.ID(), err)
+				}
+				continue
+			}
+			r.tracker.add(flowParam{
+				device:   device,
+				dstMAC:   f.DstMAC,
+				dstPort:  node.Port(),
+				outPorts: []uint32{f.OutPort},
+			})
+		}
+	}
+}
 
-	for _, d := range devices {
-		if d.IsClosed() {
+// updateFlows recomputes the paths of the tracked flows, and then modifies or removes
+// only the flows whose paths have been changed.
+func (r *L2Switch) updateFlows(finder network.Finder) {
+	// The adopted flows should be also updated.
+	r.trackAdoptedFlows(finder)
+
+	var modified, removed int
+	// Devices whose flows have been modified or removed.
+	updated := make(map[string]*network.Device)
+
+	for _, f := range r.tracker.snapshot(r.FlowOwner()) {
+		// Disconnected device?
+		device := finder.Device(f.device.ID())
+		if device == nil || device != f.device || device.IsClosed() {
+			r.tracker.remove(f.device.ID(), f.dstMAC)
 			continue
 		}
-		if err := d.RemoveFlows(); err != nil {
-			return err
+
+		var egress []*network.Port
+		var backup uint32
+		dstDevice := finder.Device(f.dstPort.Device().ID())
+		if dstDevice != nil && dstDevice == f.dstPort.Device() {
+			egress, backup = r.route(finder, device, f.dstPort)
+		}
+
+		// No path to the destination node?
+		if len(egress) == 0 {
+			if err := device.RemoveOwnedFlowByMAC(r.FlowOwner(), f.dstMAC); err != nil {
+				logger.Errorf("failed to remove the flow for %v on %v: %v", f.dstMAC, device.ID(), err)
+				continue
+			}
+			r.tracker.remove(device.ID(), f.dstMAC)
+			updated[device.ID()] = device
+			removed++
+			continue
+		}
+
+		flow := flowParam{
+			device:  device,
+			dstMAC:  f.dstMAC,
+			dstPort: f.dstPort,
+			backup:  backup,
+		}
+		for _, v := range egress {
+			flow.outPorts = append(flow.outPorts, v.Number())
 		}
-		logger.Debugf("removed all flows from DPID %v", d.ID())
+		// Not affected by the topology change?
+		if equalPorts(flow.outPorts, f.outPorts) && flow.backup == f.backup {
+			continue
+		}
+		if err := r.setFlow(flow); err != nil {
+			logger.Errorf("failed to modify the flow for %v on %v: %v", f.dstMAC, device.ID(), err)
+			continue
+		}
+		updated[device.ID()] = device
+		modified++
 	}
 
-	return nil
+	// The groups of the previous paths may be no longer referenced.
+	for _, device := range updated {
+		if err := device.RemoveUnusedGroups(); err != nil {
+			logger.Errorf("failed to remove the unused groups on %v: %v", device.ID(), err)
+		}
+	}
+	logger.Debugf("updated the flows affected by the path change: modified=%v, removed=%v", modified, removed)
 }
 
 func (r *L2Switch) String() string {
@@ -262,91 +449,17 @@ func (r *L2Switch) OnPortDown(finder network.Finder, port *network.Port) error {
 	outPort := openflow.NewOutPort()
 	outPort.SetValue(port.Number())
 
-	if err := device.RemoveFlow(match, outPort); err != nil {
+	if err := device.RemoveOwnedFlow(r.FlowOwner(), match, outPort); err != nil {
 		return errors.Wrap(err, fmt.Sprintf("removing flows heading to port %v", port.ID()))
 	}
 	logger.Debugf("removed all flows heading to the port %v", port.ID())
+	r.tracker.invalidatePort(port)
 
 	return r.BaseProcessor.OnPortDown(finder, port)
 }
 
-func (r *L2Switch) OnDeviceUp(finder network.Finder, device *network.Device) error {
-	// Make sure that there is only one flow manager in this application.
-	r.once.Do(func() {
-		// Run the background flow manager.
-		go r.flowManager(finder)
-	})
-
-	return r.BaseProcessor.OnDeviceUp(finder, device)
-}
-
-func (r *L2Switch) flowManager(finder network.Finder) {
-	logger.Debug("executed flow manager")
+func (r *L2Switch) OnDeviceDown(finder network.Finder, device *network.Device) error {
+	r.tracker.removeDevice(device.ID())
 
-	// This interval should be shorter than the flow hard-timeout specified by network.Device.SetFlow().
-	ticker := time.Tick(35 * time.Second)
-	// Infinite loop.
-	for range ticker {
-		mac, err := r.db.MACAddrs()
-		if err != nil {
-			logger.Errorf("failed to get MAC addresses: %v", err)
-			continue
-		}
-		logger.Debugf("got %v MAC addresses", len(mac))
-
-		for _, addr := range mac {
-			logger.Debugf("modifying the flow for %v...", addr)
-			r.modifyFlows(finder, addr)
-		}
-	}
-}
-
-func (r *L2Switch) modifyFlows(finder network.Finder, mac net.HardwareAddr) {
-	// Locate the destination node for the address.
-	node, status, err := finder.Node(mac)
-	if err != nil {
-		logger.Errorf("failed to locate the node %v: %v", mac, err)
-		return
-	}
-	if status != network.LocationDiscovered {
-		logger.Debugf("skip flow management for %v: undiscovered location", mac)
-		return
-	}
-
-	// Disconnected node?
-	port := node.Port().Value()
-	if port.IsPortDown() || port.IsLinkDown() {
-		logger.Debugf("skip flow management for %v: link down", mac)
-		return
-	}
-
-	// Update the flows on all devices.
-	for _, device := range finder.Devices() {
-		var egress *network.Port
-
-		// Reside on this device?
-		if device.ID() == node.Port().Device().ID() {
-			logger.Debugf("reside on the same device: DPID=%v, Port=%v", device.ID(), node.Port().Number())
-			egress = node.Port()
-		} else {
-			// Find the shortest path from this device to an another device that is connected to the destination node.
-			path := finder.Path(device.ID(), node.Port().Device().ID())
-			// No path to the destination node?
-			if len(path) == 0 {
-				logger.Debugf("skip flow management for %v on %v: no path", mac, device.ID())
-				continue
-			}
-			egress = path[0][0]
-		}
-
-		flow := flowParam{
-			device:  device,
-			dstMAC:  mac,
-			outPort: egress.Number(),
-		}
-		if err := r.setFlow(flow); err != nil {
-			logger.Errorf("failed to modify the flows for %v on %v: %v", mac, device.ID(), err)
-			continue
-		}
-	}
+	return r.BaseProcessor.OnDeviceDown(finder, device)
 }
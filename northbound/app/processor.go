@@ -32,6 +32,8 @@ import (
 // Processor should prepare to be executed by multiple goroutines simultaneously.
 type Processor interface {
 	Dependencies() []string
+	// FlowOwner returns the owner of the flows installed by this application.
+	FlowOwner() network.FlowOwner
 	fmt.Stringer
 	Init() error
 	// Name returns the application name that is globally unique
@@ -39,10 +41,13 @@ type Processor interface {
 	network.EventListener
 	Next() (next Processor, ok bool)
 	SetNext(Processor)
+	// SetFlowOwner sets the owner of the flows, which is allocated by the application manager.
+	SetFlowOwner(network.FlowOwner)
 }
 
 type BaseProcessor struct {
-	next Processor
+	next  Processor
+	owner network.FlowOwner
 }
 
 func (r *BaseProcessor) Init() error {
@@ -111,7 +116,21 @@ func (r *BaseProcessor) OnTopologyChange(finder network.Finder) error {
 	return next.OnTopologyChange(finder)
 }
 
+func (r *BaseProcessor) OnPathChange(finder network.Finder) error {
+	// Do nothging and execute the next processor if it exists
+	next, ok := r.Next()
+	if !ok {
+		return nil
+	}
+	return next.OnPathChange(finder)
+}
+
 func (r *BaseProcessor) OnFlowRemoved(finder network.Finder, flow openflow.FlowRemoved) error {
+	// The removed flow owned by an application is delivered only to its owner.
+	if owner, ok := network.CookieOwner(flow.Cookie()); ok && owner != network.NoFlowOwner {
+		return nil
+	}
+
 	// Do nothging and execute the next processor if it exists
 	next, ok := r.Next()
 	if !ok {
@@ -132,6 +151,14 @@ func (r *BaseProcessor) SetNext(next Processor) {
 	r.next = next
 }
 
+func (r *BaseProcessor) FlowOwner() network.FlowOwner {
+	return r.owner
+}
+
+func (r *BaseProcessor) SetFlowOwner(owner network.FlowOwner) {
+	r.owner = owner
+}
+
 func (r *BaseProcessor) PacketOut(egress *network.Port, packet []byte) error {
 	f := egress.Device().Factory()
 
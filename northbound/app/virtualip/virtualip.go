@@ -39,7 +39,8 @@ var (
 // NOTE: This VirtualIP module should be executed before the Discovery module.
 type VirtualIP struct {
 	app.BaseProcessor
-	db database
+	db     database
+	events network.EventPublisher
 }
 
 type database interface {
@@ -52,9 +53,10 @@ type Address struct {
 	MAC net.HardwareAddr
 }
 
-func New(db database) *VirtualIP {
+func New(db database, events network.EventPublisher) *VirtualIP {
 	return &VirtualIP{
-		db: db,
+		db:     db,
+		events: events,
 	}
 }
 
@@ -83,7 +85,7 @@ func (r *VirtualIP) OnPortDown(finder network.Finder, port *network.Port) error
 		logger.Errorf("failed to toggle VIP hosts: %v", err)
 		return r.BaseProcessor.OnPortDown(finder, port)
 	}
-	broadcastARPAnnouncement(finder, vips)
+	r.announce(finder, vips)
 
 	return r.BaseProcessor.OnPortDown(finder, port)
 }
@@ -101,12 +103,12 @@ func (r *VirtualIP) OnDeviceDown(finder network.Finder, device *network.Device)
 		logger.Errorf("failed to toggle VIP hosts: %v", err)
 		return r.BaseProcessor.OnDeviceDown(finder, device)
 	}
-	broadcastARPAnnouncement(finder, vips)
+	r.announce(finder, vips)
 
 	return r.BaseProcessor.OnDeviceDown(finder, device)
 }
 
-func broadcastARPAnnouncement(finder network.Finder, vips []Address) {
+func (r *VirtualIP) announce(finder network.Finder, vips []Address) {
 	for _, v := range vips {
 		for _, d := range finder.Devices() {
 			if err := d.SendARPAnnouncement(v.IP, v.MAC); err != nil {
@@ -116,5 +118,6 @@ func broadcastARPAnnouncement(finder network.Finder, vips []Address) {
 		}
 
 		logger.Warningf("VIP toggled: IP=%v, MAC=%v", v.IP, v.MAC)
+		r.events.Publish(network.EventVIPToggled, network.VIPEvent{IP: v.IP.String(), MAC: v.MAC.String()})
 	}
 }
@@ -24,19 +24,25 @@ package northbound
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
 	"sync"
 
 	"github.com/superkkt/cherry/database"
 	"github.com/superkkt/cherry/network"
 	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/northbound/app/acl"
 	"github.com/superkkt/cherry/northbound/app/announcer"
 	"github.com/superkkt/cherry/northbound/app/dhcp"
 	"github.com/superkkt/cherry/northbound/app/discovery"
+	"github.com/superkkt/cherry/northbound/app/external"
 	"github.com/superkkt/cherry/northbound/app/l2switch"
 	"github.com/superkkt/cherry/northbound/app/monitor"
 	"github.com/superkkt/cherry/northbound/app/proxyarp"
 	"github.com/superkkt/cherry/northbound/app/virtualip"
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/protocol"
 
 	"github.com/pkg/errors"
 	"github.com/superkkt/go-logging"
@@ -51,35 +57,64 @@ type EventSender interface {
 }
 
 type application struct {
-	instance app.Processor
-	enabled  bool
+	instance    app.Processor
+	enabled     bool
+	initialized bool
+}
+
+// AppStatus is the status of a registered application.
+type AppStatus struct {
+	Name         string   `json:"name"`
+	Enabled      bool     `json:"enabled"`
+	Dependencies []string `json:"dependencies"`
 }
 
 type Manager struct {
-	mutex      sync.Mutex
-	apps       map[string]*application // Registered applications
-	head, tail app.Processor
-	db         *database.MySQL
+	mutex     sync.Mutex
+	apps      map[string]*application // Registered applications
+	lastOwner network.FlowOwner       // Last flow owner allocated to an application
+	order     []string                // Names of the enabled applications in the preferred order
+	db        *database.MySQL
+
+	// chain is read locked while an event is delivered through the application chain,
+	// and write locked while the chain is rebuilt so that an event never sees a partially
+	// rebuilt chain.
+	chain sync.RWMutex
+	head  app.Processor
+
+	metrics *metrics
+	tracer  *tracer
 }
 
-func NewManager(db *database.MySQL) (*Manager, error) {
+func NewManager(db *database.MySQL, events network.EventPublisher) (*Manager, error) {
 	v := &Manager{
-		apps: make(map[string]*application),
-		db:   db,
+		apps:    make(map[string]*application),
+		db:      db,
+		metrics: newMetrics(),
+		tracer:  &tracer{},
 	}
 	// Registering north-bound applications
 	v.register(discovery.New(db))
-	v.register(l2switch.New(db))
+	v.register(l2switch.New())
 	v.register(proxyarp.New(db))
 	v.register(monitor.New())
-	v.register(virtualip.New(db))
+	v.register(virtualip.New(db, events))
 	v.register(announcer.New(db))
 	v.register(dhcp.New(db))
+	v.register(external.New())
+	v.register(acl.New(db))
 
 	return v, nil
 }
 
 func (r *Manager) register(app app.Processor) {
+	if r.lastOwner == network.MaxFlowOwner {
+		panic("too many applications to allocate the flow owners")
+	}
+	// Allocate a cookie namespace for the flows installed by this application.
+	r.lastOwner++
+	app.SetFlowOwner(r.lastOwner)
+
 	r.apps[strings.ToUpper(app.Name())] = &application{
 		instance: app,
 		enabled:  false,
@@ -104,6 +139,8 @@ func (r *Manager) checkDependencies(appNames []string) error {
 	return nil
 }
 
+// Enable enables the application whose name is appName. The application is placed at the
+// end of the application chain unless it has to precede the applications depending on it.
 func (r *Manager) Enable(appName string) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -119,39 +156,345 @@ func (r *Manager) Enable(appName string) error {
 	}
 
 	app := v.instance
-	if err := app.Init(); err != nil {
-		return errors.Wrap(err, "initializing application")
-	}
 	if err := r.checkDependencies(app.Dependencies()); err != nil {
 		return errors.Wrap(err, "checking dependencies")
 	}
+	// Initialize the application only once even if it is enabled again after disabled.
+	if v.initialized == false {
+		if err := app.Init(); err != nil {
+			return errors.Wrap(err, "initializing application")
+		}
+		v.initialized = true
+	}
+
 	v.enabled = true
+	order := append(append([]string{}, r.order...), strings.ToUpper(app.Name()))
+	if err := r.rebuild(order); err != nil {
+		v.enabled = false
+		return errors.Wrap(err, "rebuilding the application chain")
+	}
 	logger.Debugf("enabled %v application", appName)
 
-	if r.head == nil {
-		r.head = app
-		r.tail = app
-	} else {
-		r.tail.SetNext(app)
-		r.tail = app
+	return nil
+}
+
+// Disable removes the application whose name is appName from the application chain. The
+// flows installed by the application are not removed.
+func (r *Manager) Disable(appName string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	logger.Debugf("disabling %v application..", appName)
+	name := strings.ToUpper(appName)
+	v, ok := r.apps[name]
+	if !ok {
+		return fmt.Errorf("unknown application: %v", appName)
+	}
+	if v.enabled == false {
+		logger.Debugf("%v: already disabled", appName)
+		return nil
 	}
 
+	for _, other := range r.apps {
+		if other.enabled == false {
+			continue
+		}
+		for _, dep := range other.instance.Dependencies() {
+			if strings.ToUpper(dep) == name {
+				return fmt.Errorf("%v application depends on %v", other.instance.Name(), appName)
+			}
+		}
+	}
+
+	order := make([]string, 0, len(r.order))
+	for _, v := range r.order {
+		if v != name {
+			order = append(order, v)
+		}
+	}
+	v.enabled = false
+	if err := r.rebuild(order); err != nil {
+		v.enabled = true
+		return errors.Wrap(err, "rebuilding the application chain")
+	}
+	logger.Debugf("disabled %v application", appName)
+
 	return nil
 }
 
-func (r *Manager) AddEventSender(sender EventSender) {
+// Reorder changes the order of the enabled applications in the application chain. appNames
+// should contain all the enabled applications. An application is still placed after the
+// applications that it depends on.
+func (r *Manager) Reorder(appNames []string) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	if r.head == nil {
-		return
+	order := make([]string, len(appNames))
+	seen := make(map[string]bool)
+	for i, v := range appNames {
+		name := strings.ToUpper(v)
+		app, ok := r.apps[name]
+		if !ok {
+			return fmt.Errorf("unknown application: %v", v)
+		}
+		if app.enabled == false {
+			return fmt.Errorf("%v application is not enabled", v)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicated application: %v", v)
+		}
+		seen[name] = true
+		order[i] = name
 	}
-	sender.SetEventListener(r.head)
+	if len(order) != len(r.order) {
+		return errors.New("all the enabled applications should be specified")
+	}
+
+	return r.rebuild(order)
 }
 
-func (r *Manager) String() string {
+// XXX: Caller should lock the mutex.
+func (r *Manager) rebuild(order []string) error {
+	deps := make(map[string][]string)
+	for _, name := range order {
+		for _, v := range r.apps[name].instance.Dependencies() {
+			deps[name] = append(deps[name], strings.ToUpper(v))
+		}
+	}
+	sorted, err := sortApplications(order, deps)
+	if err != nil {
+		return err
+	}
+
+	// Wait until the events being delivered through the current chain are done.
+	r.chain.Lock()
+	defer r.chain.Unlock()
+
+	var head, tail app.Processor
+	for _, name := range sorted {
+		app := r.instrument(r.apps[name].instance)
+		app.SetNext(nil)
+		if head == nil {
+			head = app
+		} else {
+			tail.SetNext(app)
+		}
+		tail = app
+	}
+	r.head = head
+	r.order = order
+	logger.Infof("application chain: %v", strings.Join(sorted, " -> "))
+
+	return nil
+}
+
+// sortApplications sorts the applications in order topologically so that an application
+// follows the applications that it depends on, which are specified by deps. The relative
+// order in order is kept as possible. An error is returned if there is a circular dependency.
+func sortApplications(order []string, deps map[string][]string) ([]string, error) {
+	enabled := make(map[string]bool)
+	for _, v := range order {
+		enabled[v] = true
+	}
+	for _, v := range order {
+		for _, dep := range deps[v] {
+			if enabled[dep] == false {
+				return nil, fmt.Errorf("%v depends on %v that is not enabled", v, dep)
+			}
+		}
+	}
+
+	result := make([]string, 0, len(order))
+	placed := make(map[string]bool)
+	for len(result) < len(order) {
+		found := false
+		// Place the first application whose dependencies have been placed.
+		for _, v := range order {
+			if placed[v] || !satisfied(deps[v], placed) {
+				continue
+			}
+			result = append(result, v)
+			placed[v] = true
+			found = true
+			break
+		}
+		if !found {
+			remains := make([]string, 0)
+			for _, v := range order {
+				if !placed[v] {
+					remains = append(remains, v)
+				}
+			}
+			return nil, fmt.Errorf("circular dependency among the applications: %v", strings.Join(remains, ", "))
+		}
+	}
+
+	return result, nil
+}
+
+func satisfied(deps []string, placed map[string]bool) bool {
+	for _, v := range deps {
+		if !placed[v] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Applications returns the status of all the registered applications. The enabled ones
+// come first in the order of the application chain.
+func (r *Manager) Applications() []AppStatus {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
+	// XXX: The chain should be locked after the mutex as rebuild() does.
+	r.chain.RLock()
+	defer r.chain.RUnlock()
+
+	result := make([]AppStatus, 0, len(r.apps))
+	chained := make(map[string]bool)
+	for app := r.head; app != nil; {
+		result = append(result, newAppStatus(app, true))
+		chained[strings.ToUpper(app.Name())] = true
+		next, ok := app.Next()
+		if !ok {
+			break
+		}
+		app = next
+	}
+
+	disabled := make([]AppStatus, 0)
+	for name, v := range r.apps {
+		if !chained[name] {
+			disabled = append(disabled, newAppStatus(v.instance, false))
+		}
+	}
+	sort.Slice(disabled, func(i, j int) bool { return disabled[i].Name < disabled[j].Name })
+
+	return append(result, disabled...)
+}
+
+func newAppStatus(app app.Processor, enabled bool) AppStatus {
+	deps := app.Dependencies()
+	if deps == nil {
+		deps = []string{}
+	}
+
+	return AppStatus{Name: app.Name(), Enabled: enabled, Dependencies: deps}
+}
+
+func (r *Manager) AddEventSender(sender EventSender) {
+	// The router always delivers the events to the current application chain.
+	sender.SetEventListener(&flowRouter{manager: r})
+}
+
+// owner returns the enabled application that owns the flows of owner.
+func (r *Manager) owner(owner network.FlowOwner) (app.Processor, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, v := range r.apps {
+		if v.enabled && v.instance.FlowOwner() == owner {
+			return v.instance, true
+		}
+	}
+
+	return nil, false
+}
+
+// flowRouter delivers the FLOW_REMOVED events of the owned flows only to their owner
+// application, and all the other events to the application chain.
+type flowRouter struct {
+	manager *Manager
+}
+
+// deliver calls f with the head of the application chain while the chain is read locked.
+func (r *flowRouter) deliver(f func(head app.Processor) error) error {
+	r.manager.chain.RLock()
+	defer r.manager.chain.RUnlock()
+
+	// No enabled application?
+	if r.manager.head == nil {
+		return nil
+	}
+
+	return f(r.manager.head)
+}
+
+func (r *flowRouter) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	return r.deliver(func(head app.Processor) error { return head.OnPacketIn(finder, ingress, eth) })
+}
+
+func (r *flowRouter) OnPortUp(finder network.Finder, port *network.Port) error {
+	return r.deliver(func(head app.Processor) error { return head.OnPortUp(finder, port) })
+}
+
+func (r *flowRouter) OnPortDown(finder network.Finder, port *network.Port) error {
+	return r.deliver(func(head app.Processor) error { return head.OnPortDown(finder, port) })
+}
+
+func (r *flowRouter) OnDeviceUp(finder network.Finder, device *network.Device) error {
+	return r.deliver(func(head app.Processor) error { return head.OnDeviceUp(finder, device) })
+}
+
+func (r *flowRouter) OnDeviceDown(finder network.Finder, device *network.Device) error {
+	return r.deliver(func(head app.Processor) error { return head.OnDeviceDown(finder, device) })
+}
+
+func (r *flowRouter) OnTopologyChange(finder network.Finder) error {
+	return r.deliver(func(head app.Processor) error { return head.OnTopologyChange(finder) })
+}
+
+func (r *flowRouter) OnPathChange(finder network.Finder) error {
+	return r.deliver(func(head app.Processor) error { return head.OnPathChange(finder) })
+}
+
+func (r *flowRouter) OnFlowRemoved(finder network.Finder, flow openflow.FlowRemoved) error {
+	owner, ok := network.CookieOwner(flow.Cookie())
+	if !ok || owner == network.NoFlowOwner {
+		return r.deliver(func(head app.Processor) error { return head.OnFlowRemoved(finder, flow) })
+	}
+
+	app, ok := r.manager.owner(owner)
+	if !ok {
+		logger.Debugf("ignore the FLOW_REMOVED event of an unknown flow owner: %v", owner)
+		return nil
+	}
+
+	return r.manager.instrument(app).OnFlowRemoved(finder, flow)
+}
+
+// instrument returns the application that records the metrics of app.
+func (r *Manager) instrument(app app.Processor) app.Processor {
+	return &instrumented{Processor: app, metrics: r.metrics, tracer: r.tracer}
+}
+
+// Metrics returns the processing metrics of the applications for each event type.
+func (r *Manager) Metrics() []AppMetrics {
+	return r.metrics.snapshot()
+}
+
+// WriteMetrics writes the processing metrics of the applications in the Prometheus text
+// exposition format.
+func (r *Manager) WriteMetrics(w io.Writer) error {
+	return writePrometheus(w, r.metrics.snapshot())
+}
+
+// SetTrace enables the trace mode that logs the decision of each application for the
+// PACKET_IN messages matching filter. nil filter disables the trace mode.
+func (r *Manager) SetTrace(filter *TraceFilter) {
+	r.tracer.set(filter)
+	logger.Infof("packet trace filter: %+v", filter)
+}
+
+// Trace returns the filter of the trace mode, which is nil if the trace mode is disabled.
+func (r *Manager) Trace() *TraceFilter {
+	return r.tracer.get()
+}
+
+func (r *Manager) String() string {
+	r.chain.RLock()
+	defer r.chain.RUnlock()
 
 	var buf bytes.Buffer
 	app := r.head
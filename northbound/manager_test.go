@@ -0,0 +1,63 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015-2019 Samjung Data Service, Inc. All rights reserved.
+ *  Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package northbound
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortApplications(t *testing.T) {
+	src := []struct {
+		order    []string
+		deps     map[string][]string
+		expected []string
+		err      bool
+	}{
+		// No dependency keeps the order.
+		{[]string{"A", "B", "C"}, nil, []string{"A", "B", "C"}, false},
+		// A depends on C.
+		{[]string{"A", "B", "C"}, map[string][]string{"A": {"C"}}, []string{"B", "C", "A"}, false},
+		// A depends on B, and B depends on C.
+		{[]string{"A", "B", "C", "D"}, map[string][]string{"A": {"B"}, "B": {"C"}}, []string{"C", "B", "A", "D"}, false},
+		// Circular dependency.
+		{[]string{"A", "B", "C"}, map[string][]string{"A": {"B"}, "B": {"A"}}, nil, true},
+		// Dependency on a disabled application.
+		{[]string{"A", "B"}, map[string][]string{"A": {"C"}}, nil, true},
+	}
+
+	for i, v := range src {
+		result, err := sortApplications(v.order, v.deps)
+		if v.err {
+			if err == nil {
+				t.Fatalf("#%v: expected an error, but got %v", i, result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("#%v: unexpected error: %v", i, err)
+		}
+		if !reflect.DeepEqual(result, v.expected) {
+			t.Fatalf("#%v: expected=%v, got=%v", i, v.expected, result)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package northbound
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+	"github.com/superkkt/cherry/openflow"
+	"github.com/superkkt/cherry/protocol"
+)
+
+// Event types of the metrics.
+const (
+	eventPacketIn       = "packet_in"
+	eventPortUp         = "port_up"
+	eventPortDown       = "port_down"
+	eventDeviceUp       = "device_up"
+	eventDeviceDown     = "device_down"
+	eventTopologyChange = "topology_change"
+	eventPathChange     = "path_change"
+	eventFlowRemoved    = "flow_removed"
+)
+
+// Upper bounds of the latency histogram buckets.
+var latencyBuckets = []time.Duration{
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	1 * time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+}
+
+// AppMetrics is the processing metrics of an application for an event type.
+type AppMetrics struct {
+	App         string `json:"app"`
+	Event       string `json:"event"`
+	Invocations uint64 `json:"invocations"`
+	Errors      uint64 `json:"errors"`
+	// Consumed is the number of the events that have not been delivered to the next
+	// application, and Passed is the number of the ones that have been delivered.
+	Consumed uint64 `json:"consumed"`
+	Passed   uint64 `json:"passed"`
+	// Latency of the application itself, which excludes the time spent by the next
+	// applications.
+	Latency Histogram `json:"latency"`
+}
+
+// Histogram is a cumulative histogram of the latencies in seconds.
+type Histogram struct {
+	Buckets []Bucket `json:"buckets"`
+	Sum     float64  `json:"sum"`
+	Count   uint64   `json:"count"`
+}
+
+// Bucket is the number of the latencies that are less than or equal to LE seconds.
+type Bucket struct {
+	LE    float64 `json:"le"`
+	Count uint64  `json:"count"`
+}
+
+type metricKey struct {
+	app, event string
+}
+
+// appStats is the counters of an application for an event type.
+// NOTE: All the fields should be accessed by the atomic operations.
+type appStats struct {
+	invocations uint64
+	errors      uint64
+	consumed    uint64
+	passed      uint64
+	// Non-cumulative counts of the latency buckets. The last one is for +Inf.
+	buckets []uint64
+	sum     int64 // Nanoseconds
+}
+
+type metrics struct {
+	// The mutex only protects the map. The counters of an entry are updated atomically
+	// without the write lock, so that the applications do not contend with each other.
+	mutex sync.RWMutex
+	stats map[metricKey]*appStats
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		stats: make(map[metricKey]*appStats),
+	}
+}
+
+func (r *metrics) record(app, event string, latency time.Duration, passed bool, err error) {
+	v := r.get(metricKey{app: app, event: event})
+
+	atomic.AddUint64(&v.invocations, 1)
+	if err != nil {
+		atomic.AddUint64(&v.errors, 1)
+	}
+	if passed {
+		atomic.AddUint64(&v.passed, 1)
+	} else {
+		atomic.AddUint64(&v.consumed, 1)
+	}
+	i := sort.Search(len(latencyBuckets), func(i int) bool { return latency <= latencyBuckets[i] })
+	atomic.AddUint64(&v.buckets[i], 1)
+	atomic.AddInt64(&v.sum, int64(latency))
+}
+
+// get returns the counters of key, which are created if they do not exist.
+func (r *metrics) get(key metricKey) *appStats {
+	// Read lock
+	r.mutex.RLock()
+	v, ok := r.stats[key]
+	r.mutex.RUnlock()
+	if ok {
+		return v
+	}
+
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Check again to avoid the race condition.
+	v, ok = r.stats[key]
+	if !ok {
+		v = &appStats{buckets: make([]uint64, len(latencyBuckets)+1)}
+		r.stats[key] = v
+	}
+
+	return v
+}
+
+// snapshot returns the metrics sorted by the application names and the event types.
+func (r *metrics) snapshot() []AppMetrics {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make([]AppMetrics, 0, len(r.stats))
+	for key, v := range r.stats {
+		m := AppMetrics{
+			App:         key.app,
+			Event:       key.event,
+			Invocations: atomic.LoadUint64(&v.invocations),
+			Errors:      atomic.LoadUint64(&v.errors),
+			Consumed:    atomic.LoadUint64(&v.consumed),
+			Passed:      atomic.LoadUint64(&v.passed),
+			Latency: Histogram{
+				Buckets: make([]Bucket, len(latencyBuckets)),
+				Sum:     time.Duration(atomic.LoadInt64(&v.sum)).Seconds(),
+			},
+		}
+		var count uint64
+		for i, le := range latencyBuckets {
+			count += atomic.LoadUint64(&v.buckets[i])
+			m.Latency.Buckets[i] = Bucket{LE: le.Seconds(), Count: count}
+		}
+		// The count should be same with the +Inf bucket even if the counters are being
+		// updated while they are loaded.
+		m.Latency.Count = count + atomic.LoadUint64(&v.buckets[len(latencyBuckets)])
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].App != result[j].App {
+			return result[i].App < result[j].App
+		}
+		return result[i].Event < result[j].Event
+	})
+
+	return result
+}
+
+// writePrometheus writes the metrics in the Prometheus text exposition format.
+func writePrometheus(w io.Writer, metrics []AppMetrics) error {
+	var buf bytes.Buffer
+
+	counters := []struct {
+		name, help string
+		value      func(AppMetrics) uint64
+	}{
+		{"cherry_app_invocations_total", "Number of the events delivered to the application.", func(m AppMetrics) uint64 { return m.Invocations }},
+		{"cherry_app_errors_total", "Number of the events whose processing has failed.", func(m AppMetrics) uint64 { return m.Errors }},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(&buf, "# HELP %v %v\n# TYPE %v counter\n", c.name, c.help, c.name)
+		for _, m := range metrics {
+			fmt.Fprintf(&buf, "%v{app=%q,event=%q} %v\n", c.name, m.App, m.Event, c.value(m))
+		}
+	}
+
+	name := "cherry_app_decisions_total"
+	fmt.Fprintf(&buf, "# HELP %v Number of the events consumed or passed to the next application.\n# TYPE %v counter\n", name, name)
+	for _, m := range metrics {
+		fmt.Fprintf(&buf, "%v{app=%q,event=%q,decision=\"consumed\"} %v\n", name, m.App, m.Event, m.Consumed)
+		fmt.Fprintf(&buf, "%v{app=%q,event=%q,decision=\"passed\"} %v\n", name, m.App, m.Event, m.Passed)
+	}
+
+	name = "cherry_app_latency_seconds"
+	fmt.Fprintf(&buf, "# HELP %v Processing time of the application excluding the next applications.\n# TYPE %v histogram\n", name, name)
+	for _, m := range metrics {
+		for _, b := range m.Latency.Buckets {
+			fmt.Fprintf(&buf, "%v_bucket{app=%q,event=%q,le=\"%v\"} %v\n", name, m.App, m.Event, b.LE, b.Count)
+		}
+		fmt.Fprintf(&buf, "%v_bucket{app=%q,event=%q,le=\"+Inf\"} %v\n", name, m.App, m.Event, m.Latency.Count)
+		fmt.Fprintf(&buf, "%v_sum{app=%q,event=%q} %v\n", name, m.App, m.Event, m.Latency.Sum)
+		fmt.Fprintf(&buf, "%v_count{app=%q,event=%q} %v\n", name, m.App, m.Event, m.Latency.Count)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// frame is the finder delivered to an application by instrumented, which tells the
+// instrumented of the next application that the event has been passed.
+type frame struct {
+	network.Finder // Original finder
+	parent         *frame
+	start          time.Time
+	passed         bool
+	// Time spent by the next applications.
+	downstream time.Duration
+}
+
+// instrumented is an application in the chain that records the metrics of the application.
+// NOTE: An application should deliver the event to the next one in the same goroutine with
+// the finder that it has received, which is true for all the applications that call the
+// BaseProcessor's event handlers.
+type instrumented struct {
+	app.Processor
+	metrics *metrics
+	tracer  *tracer
+}
+
+func (r *instrumented) enter(finder network.Finder) *frame {
+	f := &frame{Finder: finder, start: time.Now()}
+	// Is this event passed by the previous application?
+	if parent, ok := finder.(*frame); ok {
+		parent.passed = true
+		f.Finder = parent.Finder
+		f.parent = parent
+	}
+
+	return f
+}
+
+func (r *instrumented) leave(event string, f *frame, err error) time.Duration {
+	elapsed := time.Since(f.start)
+	if f.parent != nil {
+		f.parent.downstream += elapsed
+	}
+	latency := elapsed - f.downstream
+	r.metrics.record(r.Name(), event, latency, f.passed, err)
+
+	return latency
+}
+
+func (r *instrumented) OnPacketIn(finder network.Finder, ingress *network.Port, eth *protocol.Ethernet) error {
+	f := r.enter(finder)
+	err := r.Processor.OnPacketIn(f, ingress, eth)
+	latency := r.leave(eventPacketIn, f, err)
+	r.tracer.trace(r.Name(), ingress, eth, f.passed, latency, err)
+
+	return err
+}
+
+func (r *instrumented) OnPortUp(finder network.Finder, port *network.Port) error {
+	f := r.enter(finder)
+	err := r.Processor.OnPortUp(f, port)
+	r.leave(eventPortUp, f, err)
+
+	return err
+}
+
+func (r *instrumented) OnPortDown(finder network.Finder, port *network.Port) error {
+	f := r.enter(finder)
+	err := r.Processor.OnPortDown(f, port)
+	r.leave(eventPortDown, f, err)
+
+	return err
+}
+
+func (r *instrumented) OnDeviceUp(finder network.Finder, device *network.Device) error {
+	f := r.enter(finder)
+	err := r.Processor.OnDeviceUp(f, device)
+	r.leave(eventDeviceUp, f, err)
+
+	return err
+}
+
+func (r *instrumented) OnDeviceDown(finder network.Finder, device *network.Device) error {
+	f := r.enter(finder)
+	err := r.Processor.OnDeviceDown(f, device)
+	r.leave(eventDeviceDown, f, err)
+
+	return err
+}
+
+func (r *instrumented) OnTopologyChange(finder network.Finder) error {
+	f := r.enter(finder)
+	err := r.Processor.OnTopologyChange(f)
+	r.leave(eventTopologyChange, f, err)
+
+	return err
+}
+
+func (r *instrumented) OnPathChange(finder network.Finder) error {
+	f := r.enter(finder)
+	err := r.Processor.OnPathChange(f)
+	r.leave(eventPathChange, f, err)
+
+	return err
+}
+
+func (r *instrumented) OnFlowRemoved(finder network.Finder, flow openflow.FlowRemoved) error {
+	f := r.enter(finder)
+	err := r.Processor.OnFlowRemoved(f, flow)
+	r.leave(eventFlowRemoved, f, err)
+
+	return err
+}
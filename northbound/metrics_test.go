@@ -0,0 +1,125 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015-2019 Samjung Data Service, Inc. All rights reserved.
+ *  Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package northbound
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/northbound/app"
+)
+
+type mockApp struct {
+	app.BaseProcessor
+	name  string
+	delay time.Duration
+	err   error
+}
+
+func (r *mockApp) Name() string {
+	return r.name
+}
+
+func (r *mockApp) String() string {
+	return r.name
+}
+
+func (r *mockApp) OnTopologyChange(finder network.Finder) error {
+	time.Sleep(r.delay)
+	if r.err != nil {
+		return r.err
+	}
+
+	return r.BaseProcessor.OnTopologyChange(finder)
+}
+
+func TestInstrumentedChain(t *testing.T) {
+	m := &Manager{metrics: newMetrics(), tracer: &tracer{}}
+	first := m.instrument(&mockApp{name: "First"})
+	second := m.instrument(&mockApp{name: "Second", delay: 10 * time.Millisecond, err: errors.New("failure")})
+	first.SetNext(second)
+
+	if err := first.OnTopologyChange(nil); err == nil {
+		t.Fatal("expected an error from the second application")
+	}
+
+	metrics := m.Metrics()
+	if len(metrics) != 2 {
+		t.Fatalf("unexpected number of metrics: %v", len(metrics))
+	}
+	if v := metrics[0]; v.App != "First" || v.Invocations != 1 || v.Passed != 1 || v.Consumed != 0 || v.Errors != 1 {
+		t.Fatalf("unexpected metrics of the first application: %+v", v)
+	}
+	// The latency of the first application should exclude the time spent by the second one.
+	if v := metrics[0]; v.Latency.Sum >= (10 * time.Millisecond).Seconds() {
+		t.Fatalf("unexpected latency of the first application: %v", v.Latency.Sum)
+	}
+	if v := metrics[1]; v.App != "Second" || v.Invocations != 1 || v.Passed != 0 || v.Consumed != 1 || v.Errors != 1 {
+		t.Fatalf("unexpected metrics of the second application: %+v", v)
+	}
+	if v := metrics[1]; v.Latency.Sum < (10 * time.Millisecond).Seconds() {
+		t.Fatalf("unexpected latency of the second application: %v", v.Latency.Sum)
+	}
+
+	var buf bytes.Buffer
+	if err := m.WriteMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{
+		`cherry_app_invocations_total{app="First",event="topology_change"} 1`,
+		`cherry_app_decisions_total{app="Second",event="topology_change",decision="consumed"} 1`,
+		`cherry_app_latency_seconds_bucket{app="Second",event="topology_change",le="+Inf"} 1`,
+	} {
+		if !strings.Contains(buf.String(), v) {
+			t.Fatalf("missing metric: %v", v)
+		}
+	}
+}
+
+func TestMetricsConcurrentRecord(t *testing.T) {
+	m := newMetrics()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				m.record("App", eventPacketIn, time.Millisecond, j%2 == 0, nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	metrics := m.snapshot()
+	if len(metrics) != 1 {
+		t.Fatalf("unexpected number of metrics: %v", len(metrics))
+	}
+	if v := metrics[0]; v.Invocations != 8000 || v.Passed != 4000 || v.Consumed != 4000 || v.Latency.Count != 8000 {
+		t.Fatalf("unexpected metrics: %+v", v)
+	}
+}
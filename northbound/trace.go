@@ -0,0 +1,116 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package northbound
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/superkkt/cherry/network"
+	"github.com/superkkt/cherry/protocol"
+)
+
+// TraceFilter selects the packets whose processing is logged by the trace mode. The
+// packets should match all the specified fields, and nil or zero means any.
+type TraceFilter struct {
+	// Source or destination MAC address.
+	MAC net.HardwareAddr `json:"mac"`
+	// Source or destination IPv4 address of IPv4 or ARP packets.
+	IP        net.IP `json:"ip"`
+	EtherType uint16 `json:"eth_type"`
+}
+
+func (r *TraceFilter) match(eth *protocol.Ethernet) bool {
+	if r.EtherType != 0 && eth.Type != r.EtherType {
+		return false
+	}
+	if r.MAC != nil && !bytes.Equal(eth.SrcMAC, r.MAC) && !bytes.Equal(eth.DstMAC, r.MAC) {
+		return false
+	}
+	if r.IP != nil {
+		src, dst, ok := ipAddresses(eth)
+		if !ok || (!src.Equal(r.IP) && !dst.Equal(r.IP)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func ipAddresses(eth *protocol.Ethernet) (src, dst net.IP, ok bool) {
+	switch eth.Type {
+	case 0x0800:
+		ip := new(protocol.IPv4)
+		if err := ip.UnmarshalBinary(eth.Payload); err != nil {
+			return nil, nil, false
+		}
+		return ip.SrcIP, ip.DstIP, true
+	case 0x0806:
+		arp := new(protocol.ARP)
+		if err := arp.UnmarshalBinary(eth.Payload); err != nil {
+			return nil, nil, false
+		}
+		return arp.SPA, arp.TPA, true
+	default:
+		return nil, nil, false
+	}
+}
+
+// tracer logs the decision of each application for the PACKET_IN messages that match
+// the filter.
+type tracer struct {
+	mutex  sync.RWMutex
+	filter *TraceFilter
+}
+
+func (r *tracer) set(filter *TraceFilter) {
+	// Write lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.filter = filter
+}
+
+func (r *tracer) get() *TraceFilter {
+	// Read lock
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.filter
+}
+
+func (r *tracer) trace(app string, ingress *network.Port, eth *protocol.Ethernet, passed bool, latency time.Duration, err error) {
+	filter := r.get()
+	// Trace mode is disabled?
+	if filter == nil || !filter.match(eth) {
+		return
+	}
+
+	decision := "consumed"
+	if passed {
+		decision = "passed"
+	}
+	logger.Infof("trace: app=%v, ingress=%v, src=%v, dst=%v, type=0x%04x, decision=%v, latency=%v, err=%v",
+		app, ingress.ID(), eth.SrcMAC, eth.DstMAC, eth.Type, decision, latency, err)
+}
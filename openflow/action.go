@@ -35,13 +35,23 @@ type Action interface {
 	Queue() (ok bool, queue uint32)
 	// Error() returns last error message
 	Error() error
+	// Group returns the group ID that packets are forwarded to instead of the output port.
+	Group() (ok bool, id uint32)
 	OutPort() OutPort
+	// PushVLAN returns whether a new VLAN tag is pushed before setting the VLAN ID.
+	PushVLAN() bool
 	SetDstMAC(mac net.HardwareAddr)
+	SetGroup(id uint32)
 	SetQueue(queue uint32)
 	SetOutPort(port OutPort)
+	// SetPushVLAN pushes a new VLAN tag, whose ID is set by SetVLANID, to the untagged packets.
+	SetPushVLAN()
 	SetSrcMAC(mac net.HardwareAddr)
+	// SetStripVLAN removes the outermost VLAN tag before sending out packets.
+	SetStripVLAN()
 	SetVLANID(vid uint16)
 	SrcMAC() (ok bool, mac net.HardwareAddr)
+	StripVLAN() bool
 	VLANID() (ok bool, vid uint16)
 }
 
@@ -52,15 +62,31 @@ type BaseAction struct {
 	dstMAC *net.HardwareAddr
 	queue  int64
 	vlanID int32
+	group  int64
+	strip  bool
+	push   bool
 }
 
 func NewBaseAction() *BaseAction {
 	return &BaseAction{
 		queue:  -1,
 		vlanID: -1,
+		group:  -1,
 	}
 }
 
+func (r *BaseAction) Group() (ok bool, id uint32) {
+	if r.group == -1 {
+		return false, 0
+	}
+
+	return true, uint32(r.group)
+}
+
+func (r *BaseAction) SetGroup(id uint32) {
+	r.group = int64(id)
+}
+
 func (r *BaseAction) VLANID() (ok bool, vid uint16) {
 	if r.vlanID == -1 {
 		return false, 0
@@ -73,6 +99,22 @@ func (r *BaseAction) SetVLANID(vid uint16) {
 	r.vlanID = int32(vid)
 }
 
+func (r *BaseAction) StripVLAN() bool {
+	return r.strip
+}
+
+func (r *BaseAction) SetStripVLAN() {
+	r.strip = true
+}
+
+func (r *BaseAction) PushVLAN() bool {
+	return r.push
+}
+
+func (r *BaseAction) SetPushVLAN() {
+	r.push = true
+}
+
 func (r *BaseAction) Queue() (ok bool, queue uint32) {
 	if r.queue == -1 {
 		return false, 0
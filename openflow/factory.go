@@ -55,9 +55,10 @@ type Factory interface {
 	NewFlowMod(cmd FlowModCmd) (FlowMod, error)
 	NewFlowRemoved() (FlowRemoved, error)
 	NewFlowStatsRequest() (FlowStatsRequest, error)
-	// TODO: NewFlowStatsReply() (FlowStatsReply, error)
+	NewFlowStatsReply() (FlowStatsReply, error)
 	NewGetConfigRequest() (GetConfigRequest, error)
 	NewGetConfigReply() (GetConfigReply, error)
+	NewGroupMod(cmd GroupModCmd) (GroupMod, error)
 	NewHello() (Hello, error)
 	NewInstruction() (Instruction, error)
 	NewMatch() (Match, error)
@@ -65,6 +66,8 @@ type Factory interface {
 	NewPacketOut() (PacketOut, error)
 	NewPortDescRequest() (PortDescRequest, error)
 	NewPortDescReply() (PortDescReply, error)
+	NewPortStatsRequest() (PortStatsRequest, error)
+	NewPortStatsReply() (PortStatsReply, error)
 	NewPortStatus() (PortStatus, error)
 	NewQueueGetConfigRequest() (QueueGetConfigRequest, error)
 	NewSetConfig() (SetConfig, error)
@@ -31,6 +31,7 @@ const (
 	FlowAdd FlowModCmd = iota
 	FlowModify
 	FlowDelete
+	FlowDeleteStrict
 )
 
 type FlowMod interface {
@@ -40,4 +40,25 @@ type FlowStatsRequest interface {
 	TableID() uint8
 }
 
-// TODO: Implement FlowStatsReply
+// FlowStats is a flow entry reported by the flow stats reply.
+type FlowStats struct {
+	TableID     uint8
+	Priority    uint16
+	IdleTimeout uint16
+	HardTimeout uint16
+	Cookie      uint64
+	DurationSec uint32
+	PacketCount uint64
+	ByteCount   uint64
+	Match       Match
+	// Action is the applied actions of the flow. It is nil if the flow has no applied actions.
+	Action Action
+}
+
+type FlowStatsReply interface {
+	Header
+	encoding.BinaryUnmarshaler
+	Flows() []FlowStats
+	// More returns whether more replies will follow this reply.
+	More() bool
+}
@@ -0,0 +1,74 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package openflow
+
+import (
+	"encoding"
+)
+
+type GroupModCmd uint8
+
+const (
+	GroupAdd GroupModCmd = iota
+	GroupModify
+	GroupDelete
+)
+
+type GroupType uint8
+
+const (
+	// All buckets are executed (multicast/broadcast).
+	GroupTypeAll GroupType = iota
+	// One bucket is executed based on a switch-computed selection algorithm (e.g., hash).
+	GroupTypeSelect
+	// Only one bucket is defined in this group.
+	GroupTypeIndirect
+	// The first live bucket is executed.
+	GroupTypeFastFailover
+)
+
+const (
+	// AllGroups represents all the groups for the group delete command.
+	AllGroups uint32 = 0xfffffffc
+)
+
+// Bucket is an action bucket of a group entry.
+type Bucket struct {
+	// Weight is only meaningful for the select groups.
+	Weight uint16
+	// WatchPort is only meaningful for the fast failover groups. Zero means that
+	// this bucket does not watch any port.
+	WatchPort uint32
+	Action    Action
+}
+
+type GroupMod interface {
+	AddBucket(b Bucket)
+	Buckets() []Bucket
+	encoding.BinaryMarshaler
+	Error() error
+	GroupID() uint32
+	GroupType() GroupType
+	Header
+	SetGroupID(id uint32)
+	SetGroupType(t GroupType)
+}
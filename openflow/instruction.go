@@ -27,6 +27,9 @@ import (
 
 type Instruction interface {
 	ApplyAction(act Action)
+	// ApplyActionAndGotoTable applies act to the packets, and then sends them to the
+	// table whose ID is tableID.
+	ApplyActionAndGotoTable(act Action, tableID uint8)
 	encoding.BinaryMarshaler
 	Error() error
 	GotoTable(tableID uint8)
@@ -51,6 +51,8 @@ type Match interface {
 	// SetSrcPort sets protocol (TCP or UDP) source port number
 	SetSrcPort(p uint16)
 	SetVLANID(id uint16)
+	// SetUntaggedVLAN matches only the packets that do not have a VLAN tag.
+	SetUntaggedVLAN()
 	SetVLANPriority(p uint8)
 	SetWildcardEtherType()
 	SetWildcardDstMAC()
@@ -23,6 +23,7 @@ package of10
 
 import (
 	"encoding/binary"
+	"errors"
 	"net"
 
 	"github.com/superkkt/cherry/openflow"
@@ -117,10 +118,22 @@ func marshalVLANID(vid uint16) ([]byte, error) {
 	return v, nil
 }
 
+func marshalStripVLAN() ([]byte, error) {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint16(v[0:2], uint16(OFPAT_STRIP_VLAN))
+	binary.BigEndian.PutUint16(v[2:4], 8)
+	// v[4:8] is padding
+
+	return v, nil
+}
+
 func (r *Action) MarshalBinary() ([]byte, error) {
 	if err := r.Error(); err != nil {
 		return nil, err
 	}
+	if ok, _ := r.Group(); ok {
+		return nil, errors.New("of10 does not support group action")
+	}
 
 	result := make([]byte, 0)
 	if ok, srcMAC := r.SrcMAC(); ok {
@@ -138,6 +151,13 @@ func (r *Action) MarshalBinary() ([]byte, error) {
 		result = append(result, v...)
 	}
 
+	if r.StripVLAN() {
+		v, err := marshalStripVLAN()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v...)
+	}
 	ok, vlanID := r.VLANID()
 	if ok {
 		v, err := marshalVLANID(vlanID)
@@ -170,7 +190,7 @@ func (r *Action) UnmarshalBinary(data []byte) error {
 	for len(buf) >= 4 {
 		t := binary.BigEndian.Uint16(buf[0:2])
 		length := binary.BigEndian.Uint16(buf[2:4])
-		if len(buf) < int(length) {
+		if length < 4 || len(buf) < int(length) {
 			return openflow.ErrInvalidPacketLength
 		}
 
@@ -220,6 +240,8 @@ func (r *Action) UnmarshalBinary(data []byte) error {
 			if err := r.Error(); err != nil {
 				return err
 			}
+		case OFPAT_STRIP_VLAN:
+			r.SetStripVLAN()
 		default:
 			// Do nothing
 		}
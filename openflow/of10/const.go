@@ -72,6 +72,11 @@ const (
 	OFPP_NONE       = 0xffff
 )
 
+const (
+	/* No VLAN id was set. */
+	OFP_VLAN_NONE = 0xffff
+)
+
 const (
 	OFPFW_IN_PORT     = 1 << 0  /* Switch input port. */
 	OFPFW_DL_VLAN     = 1 << 1  /* VLAN id. */
@@ -169,6 +174,10 @@ const (
 	OFPST_VENDOR = 0xffff
 )
 
+const (
+	OFPSF_REPLY_MORE = 1 << 0 /* More replies to follow. */
+)
+
 const (
 	OFPC_FRAG_NORMAL = iota /* No special handling for fragments. */
 	OFPC_FRAG_DROP          /* Drop fragments. */
@@ -104,6 +104,8 @@ func getFlowModCmd(cmd openflow.FlowModCmd) uint16 {
 		c = OFPFC_MODIFY
 	case openflow.FlowDelete:
 		c = OFPFC_DELETE
+	case openflow.FlowDeleteStrict:
+		c = OFPFC_DELETE_STRICT
 	default:
 		panic(fmt.Sprintf("unexpected FlowModCmd: %v", cmd))
 	}
@@ -143,7 +145,17 @@ func (r *Factory) NewFlowStatsRequest() (openflow.FlowStatsRequest, error) {
 	return NewFlowStatsRequest(r.getTransactionID()), nil
 }
 
-// TODO: NewFlowStatsReply() (openflow.FlowStatsReply, error) {
+func (r *Factory) NewFlowStatsReply() (openflow.FlowStatsReply, error) {
+	return new(FlowStatsReply), nil
+}
+
+func (r *Factory) NewPortStatsRequest() (openflow.PortStatsRequest, error) {
+	return NewPortStatsRequest(r.getTransactionID()), nil
+}
+
+func (r *Factory) NewPortStatsReply() (openflow.PortStatsReply, error) {
+	return new(PortStatsReply), nil
+}
 
 func (r *Factory) NewPortDescRequest() (openflow.PortDescRequest, error) {
 	return nil, errors.New("of10 does not support PortDescRequest")
@@ -153,6 +165,10 @@ func (r *Factory) NewPortDescReply() (openflow.PortDescReply, error) {
 	return nil, errors.New("of10 does not support PortDescReply")
 }
 
+func (r *Factory) NewGroupMod(cmd openflow.GroupModCmd) (openflow.GroupMod, error) {
+	return nil, errors.New("of10 does not support GroupMod")
+}
+
 func (r *Factory) NewTableFeaturesRequest() (openflow.TableFeaturesRequest, error) {
 	return nil, errors.New("of10 does not support TableFeaturesRequest")
 }
@@ -109,4 +109,65 @@ func (r *FlowStatsRequest) MarshalBinary() ([]byte, error) {
 	return r.Message.MarshalBinary()
 }
 
-// TODO: Implement FlowStatsReply
+type FlowStatsReply struct {
+	openflow.Message
+	more  bool
+	flows []openflow.FlowStats
+}
+
+func (r *FlowStatsReply) Flows() []openflow.FlowStats {
+	return r.flows
+}
+
+func (r *FlowStatsReply) More() bool {
+	return r.more
+}
+
+func (r *FlowStatsReply) UnmarshalBinary(data []byte) error {
+	if err := r.Message.UnmarshalBinary(data); err != nil {
+		return err
+	}
+
+	payload := r.Payload()
+	if payload == nil || len(payload) < 4 {
+		return openflow.ErrInvalidPacketLength
+	}
+	if binary.BigEndian.Uint16(payload[0:2]) != OFPST_FLOW {
+		return errors.New("not a flow stats reply")
+	}
+	r.more = binary.BigEndian.Uint16(payload[2:4])&OFPSF_REPLY_MORE != 0
+
+	r.flows = make([]openflow.FlowStats, 0)
+	buf := payload[4:]
+	for len(buf) >= 88 {
+		length := int(binary.BigEndian.Uint16(buf[0:2]))
+		if length < 88 || len(buf) < length {
+			return openflow.ErrInvalidPacketLength
+		}
+		v := openflow.FlowStats{
+			TableID:     buf[2],
+			Match:       NewMatch(),
+			DurationSec: binary.BigEndian.Uint32(buf[44:48]),
+			Priority:    binary.BigEndian.Uint16(buf[52:54]),
+			IdleTimeout: binary.BigEndian.Uint16(buf[54:56]),
+			HardTimeout: binary.BigEndian.Uint16(buf[56:58]),
+			// buf[58:64] is padding
+			Cookie:      binary.BigEndian.Uint64(buf[64:72]),
+			PacketCount: binary.BigEndian.Uint64(buf[72:80]),
+			ByteCount:   binary.BigEndian.Uint64(buf[80:88]),
+		}
+		if err := v.Match.UnmarshalBinary(buf[4:44]); err != nil {
+			return err
+		}
+		if length > 88 {
+			v.Action = NewAction()
+			if err := v.Action.UnmarshalBinary(buf[88:length]); err != nil {
+				return err
+			}
+		}
+		r.flows = append(r.flows, v)
+		buf = buf[length:]
+	}
+
+	return nil
+}
@@ -54,6 +54,11 @@ func (r *Instruction) ApplyAction(act openflow.Action) {
 	r.action = act
 }
 
+func (r *Instruction) ApplyActionAndGotoTable(act openflow.Action, tableID uint8) {
+	// OpenFlow 1.0 does not support GotoTable
+	r.ApplyAction(act)
+}
+
 func (r *Instruction) MarshalBinary() ([]byte, error) {
 	if r.err != nil {
 		return nil, r.err
@@ -243,6 +243,11 @@ func (r *Match) SetVLANID(id uint16) {
 	r.wildcards.VLANID = false
 }
 
+func (r *Match) SetUntaggedVLAN() {
+	r.vlanID = OFP_VLAN_NONE
+	r.wildcards.VLANID = false
+}
+
 func (r *Match) VLANID() (wildcard bool, vlanID uint16) {
 	return r.wildcards.VLANID, r.vlanID
 }
@@ -79,6 +79,30 @@ func marshalMAC(t uint8, mac net.HardwareAddr) ([]byte, error) {
 		return nil, err
 	}
 
+	return marshalSetField(tlv), nil
+}
+
+func marshalVLANID(vid uint16) ([]byte, error) {
+	tlv, err := marshalUint16TLV(OFPXMT_OFB_VLAN_VID, vid|OFPVID_PRESENT)
+	if err != nil {
+		return nil, err
+	}
+
+	return marshalSetField(tlv), nil
+}
+
+func marshalPushVLAN() ([]byte, error) {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint16(v[0:2], OFPAT_PUSH_VLAN)
+	binary.BigEndian.PutUint16(v[2:4], 8)
+	// IEEE 802.1Q
+	binary.BigEndian.PutUint16(v[4:6], 0x8100)
+	// v[6:8] is padding
+
+	return v, nil
+}
+
+func marshalSetField(tlv []byte) []byte {
 	v := make([]byte, 4+len(tlv))
 	binary.BigEndian.PutUint16(v[0:2], OFPAT_SET_FIELD)
 	// Add padding to align as a multiple of 8
@@ -89,12 +113,28 @@ func marshalMAC(t uint8, mac net.HardwareAddr) ([]byte, error) {
 	binary.BigEndian.PutUint16(v[2:4], uint16(len(v)))
 	copy(v[4:], tlv)
 
+	return v
+}
+
+func marshalPopVLAN() ([]byte, error) {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint16(v[0:2], uint16(OFPAT_POP_VLAN))
+	binary.BigEndian.PutUint16(v[2:4], 8)
+	// v[4:8] is padding
+
 	return v, nil
 }
 
-// TODO: Marshal Enqueue
+func marshalGroup(id uint32) ([]byte, error) {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint16(v[0:2], uint16(OFPAT_GROUP))
+	binary.BigEndian.PutUint16(v[2:4], 8)
+	binary.BigEndian.PutUint32(v[4:8], id)
 
-// TODO: Marshal SetVLANVID
+	return v, nil
+}
+
+// TODO: Marshal Enqueue
 
 func (r *Action) MarshalBinary() ([]byte, error) {
 	if err := r.Error(); err != nil {
@@ -116,8 +156,41 @@ func (r *Action) MarshalBinary() ([]byte, error) {
 		}
 		result = append(result, v...)
 	}
+	if r.StripVLAN() {
+		v, err := marshalPopVLAN()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v...)
+	}
+	if r.PushVLAN() {
+		v, err := marshalPushVLAN()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v...)
+	}
+	if ok, vlanID := r.VLANID(); ok {
+		v, err := marshalVLANID(vlanID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v...)
+	}
 
-	v, err := marshalOutput(r.OutPort())
+	// Group action replaces the output action if it is specified.
+	var v []byte
+	var err error
+	output := r.OutPort()
+	switch ok, groupID := r.Group(); {
+	case ok:
+		v, err = marshalGroup(groupID)
+	case output.IsNone():
+		// No output action. The packets are sent to the next table by the instruction.
+		return result, nil
+	default:
+		v, err = marshalOutput(output)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -128,14 +201,12 @@ func (r *Action) MarshalBinary() ([]byte, error) {
 
 // TODO: Unmarshal Enqueue
 
-// TODO: Unmarshal SetVLANVID
-
 func (r *Action) UnmarshalBinary(data []byte) error {
 	buf := data
 	for len(buf) >= 4 {
 		t := binary.BigEndian.Uint16(buf[0:2])
 		length := binary.BigEndian.Uint16(buf[2:4])
-		if len(buf) < int(length) {
+		if length < 4 || len(buf) < int(length) {
 			return openflow.ErrInvalidPacketLength
 		}
 
@@ -150,6 +221,15 @@ func (r *Action) UnmarshalBinary(data []byte) error {
 			if err := r.Error(); err != nil {
 				return err
 			}
+		case OFPAT_GROUP:
+			if len(buf) < 8 {
+				return openflow.ErrInvalidPacketLength
+			}
+			r.SetGroup(binary.BigEndian.Uint32(buf[4:8]))
+		case OFPAT_PUSH_VLAN:
+			r.SetPushVLAN()
+		case OFPAT_POP_VLAN:
+			r.SetStripVLAN()
 		case OFPAT_SET_FIELD:
 			if len(buf) < 8 {
 				return openflow.ErrInvalidPacketLength
@@ -178,6 +258,11 @@ func (r *Action) UnmarshalBinary(data []byte) error {
 				if err := r.Error(); err != nil {
 					return err
 				}
+			case OFPXMT_OFB_VLAN_VID:
+				if len(buf) < 10 {
+					return openflow.ErrInvalidPacketLength
+				}
+				r.SetVLANID(binary.BigEndian.Uint16(buf[8:10]) &^ OFPVID_PRESENT)
 			default:
 				// Do nothing
 			}
@@ -66,9 +66,19 @@ const (
 
 const (
 	OFPAT_OUTPUT    = 0
+	OFPAT_PUSH_VLAN = 17
+	OFPAT_POP_VLAN  = 18
+	OFPAT_GROUP     = 22
 	OFPAT_SET_FIELD = 25
 )
 
+const (
+	/* Bit that indicate that a VLAN id is set. */
+	OFPVID_PRESENT = 0x1000
+	/* No VLAN id was set. */
+	OFPVID_NONE = 0x0000
+)
+
 const (
 	/* Maximum number of physical and logical switch ports. */
 	OFPP_MAX = 0xffffff00
@@ -184,6 +194,10 @@ const (
 	OFPPF_PAUSE_ASYM = 1 << 15
 )
 
+const (
+	OFPMPF_REPLY_MORE = 1 << 0 /* More replies to follow. */
+)
+
 const (
 	/* Description of this OpenFlow switch.
 	 * The request body is empty.
@@ -252,9 +266,27 @@ const (
 )
 
 const (
+	/* Last usable group number. */
+	OFPG_MAX = 0xffffff00
+	/* Represents all groups for group delete commands. */
+	OFPG_ALL = 0xfffffffc
+	/* Wildcard group used only for flow stats requests. */
 	OFPG_ANY = 0xffffffff
 )
 
+const (
+	OFPGC_ADD    = 0 /* New group. */
+	OFPGC_MODIFY = 1 /* Modify all matching groups. */
+	OFPGC_DELETE = 2 /* Delete all matching groups. */
+)
+
+const (
+	OFPGT_ALL      = 0 /* All (multicast/broadcast) group. */
+	OFPGT_SELECT   = 1 /* Select group. */
+	OFPGT_INDIRECT = 2 /* Indirect group. */
+	OFPGT_FF       = 3 /* Fast failover group. */
+)
+
 const (
 	OFPC_FRAG_NORMAL = 0      /* No special handling for fragments. */
 	OFPC_FRAG_DROP   = 1 << 0 /* Drop fragments. */
@@ -103,6 +103,8 @@ func getFlowModCmd(cmd openflow.FlowModCmd) uint8 {
 		c = OFPFC_MODIFY
 	case openflow.FlowDelete:
 		c = OFPFC_DELETE
+	case openflow.FlowDeleteStrict:
+		c = OFPFC_DELETE_STRICT
 	default:
 		panic(fmt.Sprintf("unexpected FlowModCmd: %v", cmd))
 	}
@@ -114,6 +116,26 @@ func (r *Factory) NewFlowMod(cmd openflow.FlowModCmd) (openflow.FlowMod, error)
 	return NewFlowMod(r.getTransactionID(), getFlowModCmd(cmd)), nil
 }
 
+func getGroupModCmd(cmd openflow.GroupModCmd) uint16 {
+	var c uint16
+	switch cmd {
+	case openflow.GroupAdd:
+		c = OFPGC_ADD
+	case openflow.GroupModify:
+		c = OFPGC_MODIFY
+	case openflow.GroupDelete:
+		c = OFPGC_DELETE
+	default:
+		panic(fmt.Sprintf("unexpected GroupModCmd: %v", cmd))
+	}
+
+	return c
+}
+
+func (r *Factory) NewGroupMod(cmd openflow.GroupModCmd) (openflow.GroupMod, error) {
+	return NewGroupMod(r.getTransactionID(), getGroupModCmd(cmd)), nil
+}
+
 func (r *Factory) NewFlowRemoved() (openflow.FlowRemoved, error) {
 	return new(FlowRemoved), nil
 }
@@ -142,7 +164,17 @@ func (r *Factory) NewFlowStatsRequest() (openflow.FlowStatsRequest, error) {
 	return NewFlowStatsRequest(r.getTransactionID()), nil
 }
 
-// TODO: NewFlowStatsReply() (openflow.FlowStatsReply, error) {
+func (r *Factory) NewFlowStatsReply() (openflow.FlowStatsReply, error) {
+	return new(FlowStatsReply), nil
+}
+
+func (r *Factory) NewPortStatsRequest() (openflow.PortStatsRequest, error) {
+	return NewPortStatsRequest(r.getTransactionID()), nil
+}
+
+func (r *Factory) NewPortStatsReply() (openflow.PortStatsReply, error) {
+	return new(PortStatsReply), nil
+}
 
 func (r *Factory) NewPortDescRequest() (openflow.PortDescRequest, error) {
 	return NewPortDescRequest(r.getTransactionID()), nil
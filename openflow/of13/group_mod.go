@@ -0,0 +1,147 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package of13
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/superkkt/cherry/openflow"
+)
+
+type GroupMod struct {
+	err error
+	openflow.Message
+	command   uint16
+	groupType openflow.GroupType
+	groupID   uint32
+	buckets   []openflow.Bucket
+}
+
+func NewGroupMod(xid uint32, cmd uint16) openflow.GroupMod {
+	return &GroupMod{
+		Message: openflow.NewMessage(openflow.OF13_VERSION, OFPT_GROUP_MOD, xid),
+		command: cmd,
+	}
+}
+
+func (r *GroupMod) Error() error {
+	return r.err
+}
+
+func (r *GroupMod) GroupID() uint32 {
+	return r.groupID
+}
+
+func (r *GroupMod) SetGroupID(id uint32) {
+	if id > OFPG_MAX && id != OFPG_ALL {
+		r.err = errors.New("invalid group ID")
+		return
+	}
+	r.groupID = id
+}
+
+func (r *GroupMod) GroupType() openflow.GroupType {
+	return r.groupType
+}
+
+func (r *GroupMod) SetGroupType(t openflow.GroupType) {
+	r.groupType = t
+}
+
+func (r *GroupMod) Buckets() []openflow.Bucket {
+	return r.buckets
+}
+
+func (r *GroupMod) AddBucket(b openflow.Bucket) {
+	if b.Action == nil {
+		r.err = errors.New("nil bucket action")
+		return
+	}
+	r.buckets = append(r.buckets, b)
+}
+
+func getGroupType(t openflow.GroupType) (uint8, error) {
+	switch t {
+	case openflow.GroupTypeAll:
+		return OFPGT_ALL, nil
+	case openflow.GroupTypeSelect:
+		return OFPGT_SELECT, nil
+	case openflow.GroupTypeIndirect:
+		return OFPGT_INDIRECT, nil
+	case openflow.GroupTypeFastFailover:
+		return OFPGT_FF, nil
+	default:
+		return 0, errors.New("unknown group type")
+	}
+}
+
+func marshalBucket(b openflow.Bucket) ([]byte, error) {
+	action, err := b.Action.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	v := make([]byte, 16)
+	binary.BigEndian.PutUint16(v[0:2], uint16(16+len(action)))
+	binary.BigEndian.PutUint16(v[2:4], b.Weight)
+	watchPort := uint32(OFPP_ANY)
+	if b.WatchPort != 0 {
+		watchPort = b.WatchPort
+	}
+	binary.BigEndian.PutUint32(v[4:8], watchPort)
+	binary.BigEndian.PutUint32(v[8:12], OFPG_ANY)
+	// v[12:16] is padding
+
+	return append(v, action...), nil
+}
+
+func (r *GroupMod) MarshalBinary() ([]byte, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	groupType, err := getGroupType(r.groupType)
+	if err != nil {
+		return nil, err
+	}
+
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint16(v[0:2], r.command)
+	v[2] = groupType
+	// v[3] is padding
+	binary.BigEndian.PutUint32(v[4:8], r.groupID)
+
+	// Buckets are meaningless for the delete command.
+	if r.command != OFPGC_DELETE {
+		for _, b := range r.buckets {
+			bucket, err := marshalBucket(b)
+			if err != nil {
+				return nil, err
+			}
+			v = append(v, bucket...)
+		}
+	}
+	r.SetPayload(v)
+
+	return r.Message.MarshalBinary()
+}
@@ -92,6 +92,24 @@ func (r *applyAction) MarshalBinary() ([]byte, error) {
 	return v, nil
 }
 
+type applyActionAndGotoTable struct {
+	apply applyAction
+	next  gotoTable
+}
+
+func (r *applyActionAndGotoTable) MarshalBinary() ([]byte, error) {
+	apply, err := r.apply.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	next, err := r.next.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(apply, next...), nil
+}
+
 func (r *Instruction) Error() error {
 	return r.err
 }
@@ -114,6 +132,16 @@ func (r *Instruction) ApplyAction(act openflow.Action) {
 	r.value = &applyAction{action: act}
 }
 
+func (r *Instruction) ApplyActionAndGotoTable(act openflow.Action, tableID uint8) {
+	if act == nil {
+		panic("act is nil")
+	}
+	r.value = &applyActionAndGotoTable{
+		apply: applyAction{action: act},
+		next:  gotoTable{tableID: tableID},
+	}
+}
+
 func (r *Instruction) MarshalBinary() ([]byte, error) {
 	if r.err != nil {
 		return nil, r.err
@@ -186,6 +186,13 @@ func (r *Match) SetVLANID(id uint16) {
 	r.m[OFPXMT_OFB_VLAN_VID] = id
 }
 
+func (r *Match) SetUntaggedVLAN() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.m[OFPXMT_OFB_VLAN_VID] = uint16(OFPVID_NONE)
+}
+
 func (r *Match) VLANID() (wildcard bool, vlanID uint16) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -491,7 +498,7 @@ func marshalUint8TLV(field uint8, v uint8) ([]byte, error) {
 	// TLV header
 	var header uint32 = 0x8000<<16 | uint32(field)<<9 | 0x0<<8 | 1
 	binary.BigEndian.PutUint32(data[0:4], header)
-	data[5] = v
+	data[4] = v
 	return data, nil
 }
 
@@ -111,4 +111,94 @@ func (r *FlowStatsRequest) MarshalBinary() ([]byte, error) {
 	return r.Message.MarshalBinary()
 }
 
-// TODO: Implement FlowStatsReply
+type FlowStatsReply struct {
+	openflow.Message
+	more  bool
+	flows []openflow.FlowStats
+}
+
+func (r *FlowStatsReply) Flows() []openflow.FlowStats {
+	return r.flows
+}
+
+func (r *FlowStatsReply) More() bool {
+	return r.more
+}
+
+func (r *FlowStatsReply) UnmarshalBinary(data []byte) error {
+	if err := r.Message.UnmarshalBinary(data); err != nil {
+		return err
+	}
+
+	payload := r.Payload()
+	if payload == nil || len(payload) < 8 {
+		return openflow.ErrInvalidPacketLength
+	}
+	if binary.BigEndian.Uint16(payload[0:2]) != OFPMP_FLOW {
+		return errors.New("not a flow stats reply")
+	}
+	r.more = binary.BigEndian.Uint16(payload[2:4])&OFPMPF_REPLY_MORE != 0
+	// payload[4:8] is padding
+
+	r.flows = make([]openflow.FlowStats, 0)
+	buf := payload[8:]
+	for len(buf) >= 56 {
+		length := int(binary.BigEndian.Uint16(buf[0:2]))
+		if length < 56 || len(buf) < length {
+			return openflow.ErrInvalidPacketLength
+		}
+		v := openflow.FlowStats{
+			TableID:     buf[2],
+			DurationSec: binary.BigEndian.Uint32(buf[4:8]),
+			Priority:    binary.BigEndian.Uint16(buf[12:14]),
+			IdleTimeout: binary.BigEndian.Uint16(buf[14:16]),
+			HardTimeout: binary.BigEndian.Uint16(buf[16:18]),
+			Cookie:      binary.BigEndian.Uint64(buf[24:32]),
+			PacketCount: binary.BigEndian.Uint64(buf[32:40]),
+			ByteCount:   binary.BigEndian.Uint64(buf[40:48]),
+			Match:       NewMatch(),
+		}
+		if err := v.Match.UnmarshalBinary(buf[48:length]); err != nil {
+			return err
+		}
+		// The match is padded to align to 64 bits.
+		matchLen := int(binary.BigEndian.Uint16(buf[50:52]))
+		offset := 48 + (matchLen+7)/8*8
+		if offset > length {
+			return openflow.ErrInvalidPacketLength
+		}
+		action, err := unmarshalApplyActions(buf[offset:length])
+		if err != nil {
+			return err
+		}
+		v.Action = action
+		r.flows = append(r.flows, v)
+		buf = buf[length:]
+	}
+
+	return nil
+}
+
+// unmarshalApplyActions returns the actions of the APPLY_ACTIONS instruction in data
+// that contains a list of instructions. It returns nil if there is no such instruction.
+func unmarshalApplyActions(data []byte) (openflow.Action, error) {
+	buf := data
+	for len(buf) >= 8 {
+		t := binary.BigEndian.Uint16(buf[0:2])
+		length := int(binary.BigEndian.Uint16(buf[2:4]))
+		if length < 8 || len(buf) < length {
+			return nil, openflow.ErrInvalidPacketLength
+		}
+		if t == OFPIT_APPLY_ACTIONS {
+			action := NewAction()
+			// buf[4:8] is padding
+			if err := action.UnmarshalBinary(buf[8:length]); err != nil {
+				return nil, err
+			}
+			return action, nil
+		}
+		buf = buf[length:]
+	}
+
+	return nil, nil
+}
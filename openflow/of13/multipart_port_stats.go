@@ -0,0 +1,112 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package of13
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/superkkt/cherry/openflow"
+)
+
+type PortStatsRequest struct {
+	err error
+	openflow.Message
+}
+
+func NewPortStatsRequest(xid uint32) openflow.PortStatsRequest {
+	return &PortStatsRequest{
+		Message: openflow.NewMessage(openflow.OF13_VERSION, OFPT_MULTIPART_REQUEST, xid),
+	}
+}
+
+func (r *PortStatsRequest) Error() error {
+	return r.err
+}
+
+func (r *PortStatsRequest) MarshalBinary() ([]byte, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	v := make([]byte, 16)
+	// Port stats request
+	binary.BigEndian.PutUint16(v[0:2], OFPMP_PORT_STATS)
+	// v[4:8] is padding
+	// OFPP_ANY means all ports.
+	binary.BigEndian.PutUint32(v[8:12], OFPP_ANY)
+	// v[12:16] is padding
+	r.SetPayload(v)
+
+	return r.Message.MarshalBinary()
+}
+
+type PortStatsReply struct {
+	openflow.Message
+	more  bool
+	ports []openflow.PortStats
+}
+
+func (r *PortStatsReply) Ports() []openflow.PortStats {
+	return r.ports
+}
+
+func (r *PortStatsReply) More() bool {
+	return r.more
+}
+
+func (r *PortStatsReply) UnmarshalBinary(data []byte) error {
+	if err := r.Message.UnmarshalBinary(data); err != nil {
+		return err
+	}
+
+	payload := r.Payload()
+	if payload == nil || len(payload) < 8 {
+		return openflow.ErrInvalidPacketLength
+	}
+	if binary.BigEndian.Uint16(payload[0:2]) != OFPMP_PORT_STATS {
+		return errors.New("not a port stats reply")
+	}
+	r.more = binary.BigEndian.Uint16(payload[2:4])&OFPMPF_REPLY_MORE != 0
+	// payload[4:8] is padding
+
+	r.ports = make([]openflow.PortStats, 0)
+	buf := payload[8:]
+	for len(buf) >= 112 {
+		r.ports = append(r.ports, openflow.PortStats{
+			PortNo: binary.BigEndian.Uint32(buf[0:4]),
+			// buf[4:8] is padding
+			RxPackets: binary.BigEndian.Uint64(buf[8:16]),
+			TxPackets: binary.BigEndian.Uint64(buf[16:24]),
+			RxBytes:   binary.BigEndian.Uint64(buf[24:32]),
+			TxBytes:   binary.BigEndian.Uint64(buf[32:40]),
+			RxDropped: binary.BigEndian.Uint64(buf[40:48]),
+			TxDropped: binary.BigEndian.Uint64(buf[48:56]),
+			RxErrors:  binary.BigEndian.Uint64(buf[56:64]),
+			TxErrors:  binary.BigEndian.Uint64(buf[64:72]),
+		})
+		// buf[72:112] are the other error counters and the duration.
+		buf = buf[112:]
+	}
+
+	return nil
+}
@@ -105,6 +105,11 @@ func (r *OutPort) Value() uint32 {
 	return r.value
 }
 
+// IsPhysical returns whether this port is a switch port specified by SetValue, not a logical one.
+func (r *OutPort) IsPhysical() bool {
+	return r.logical == 0
+}
+
 func (r OutPort) String() string {
 	return fmt.Sprintf("logical: %v, value: %v", r.logical, r.value)
 }
@@ -0,0 +1,54 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved.
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package openflow
+
+import (
+	"encoding"
+)
+
+// PortStatsRequest requests the statistics of all the ports on a switch.
+type PortStatsRequest interface {
+	encoding.BinaryMarshaler
+	Error() error
+	Header
+}
+
+// PortStats is the statistics of a port reported by the port stats reply.
+type PortStats struct {
+	PortNo    uint32
+	RxPackets uint64
+	TxPackets uint64
+	RxBytes   uint64
+	TxBytes   uint64
+	RxDropped uint64
+	TxDropped uint64
+	RxErrors  uint64
+	TxErrors  uint64
+}
+
+type PortStatsReply interface {
+	Header
+	encoding.BinaryUnmarshaler
+	Ports() []PortStats
+	// More returns whether more replies will follow this reply.
+	More() bool
+}
@@ -26,6 +26,7 @@ import (
 	"encoding"
 	"encoding/binary"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/superkkt/cherry/openflow"
@@ -58,6 +59,9 @@ type WriteCloser interface {
 }
 
 type Transceiver struct {
+	// Round-trip time in nanoseconds, measured by the echo request. This should be
+	// accessed by the atomic functions.
+	rtt         int64
 	stream      *Stream
 	observer    Handler
 	version     uint8
@@ -73,6 +77,8 @@ type Handler interface {
 	OnGetConfigReply(openflow.Factory, Writer, openflow.GetConfigReply) error
 	OnDescReply(openflow.Factory, Writer, openflow.DescReply) error
 	OnPortDescReply(openflow.Factory, Writer, openflow.PortDescReply) error
+	OnFlowStatsReply(openflow.Factory, Writer, openflow.FlowStatsReply) error
+	OnPortStatsReply(openflow.Factory, Writer, openflow.PortStatsReply) error
 	OnPortStatus(openflow.Factory, Writer, openflow.PortStatus) error
 	OnFlowRemoved(openflow.Factory, Writer, openflow.FlowRemoved) error
 	OnPacketIn(openflow.Factory, Writer, openflow.PacketIn) error
@@ -93,6 +99,12 @@ func NewTransceiver(stream *Stream, handler Handler) *Transceiver {
 	}
 }
 
+// RTT returns the last round-trip time between the controller and the device. It
+// returns zero if the round-trip time has not been measured yet.
+func (r *Transceiver) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&r.rtt))
+}
+
 func (r *Transceiver) Version() (negotiated bool, version uint8) {
 	if r.version == 0 {
 		// Not yet negotiated
@@ -124,10 +136,8 @@ func (r *Transceiver) sendEchoRequest() error {
 		return err
 	}
 	// We use current timestamp to check network latency between our controller and a switch.
-	timestamp, err := time.Now().GobEncode()
-	if err != nil {
-		return err
-	}
+	timestamp := make([]byte, 8)
+	binary.BigEndian.PutUint64(timestamp, uint64(time.Now().UnixNano()))
 	echo.SetData(timestamp)
 
 	if err := r.Write(echo); err != nil {
@@ -223,6 +233,7 @@ func (r *Transceiver) runReader(ctx context.Context) <-chan []byte {
 		defer logger.Info("transceiver reader is closed")
 
 		lastActivated := time.Now()
+		lastPinged := time.Now()
 		for {
 			select {
 			case <-ctx.Done():
@@ -244,12 +255,22 @@ func (r *Transceiver) runReader(ctx context.Context) <-chan []byte {
 						logger.Errorf("failed to send an echo request: %v", err)
 						return
 					}
+					lastPinged = time.Now()
 				}
 				continue
 			}
 			// Update the timestamp
 			lastActivated = time.Now()
 
+			// Send a ping request periodically even if the device is busy to measure the round-trip time.
+			if time.Now().After(lastPinged.Add(maxIdleTime)) {
+				if err := r.sendEchoRequest(); err != nil {
+					logger.Errorf("failed to send an echo request: %v", err)
+					return
+				}
+				lastPinged = time.Now()
+			}
+
 			ok, err := r.handleEcho(packet)
 			if err != nil {
 				logger.Errorf("failed to handle the echo request or response: %v", err)
@@ -376,6 +397,10 @@ func (r *Transceiver) handleOF10Message(packet []byte) error {
 		switch binary.BigEndian.Uint16(packet[8:10]) {
 		case of10.OFPST_DESC:
 			return r.handleDescReply(packet)
+		case of10.OFPST_FLOW:
+			return r.handleFlowStatsReply(packet)
+		case of10.OFPST_PORT:
+			return r.handlePortStatsReply(packet)
 		default:
 			// Unsupported message. Do nothing.
 			return nil
@@ -410,6 +435,10 @@ func (r *Transceiver) handleOF13Message(packet []byte) error {
 			return r.handleDescReply(packet)
 		case of13.OFPMP_PORT_DESC:
 			return r.handlePortDescReply(packet)
+		case of13.OFPMP_FLOW:
+			return r.handleFlowStatsReply(packet)
+		case of13.OFPMP_PORT_STATS:
+			return r.handlePortStatsReply(packet)
 		default:
 			// Unsupported message. Do nothing.
 			return nil
@@ -470,12 +499,14 @@ func (r *Transceiver) handleEchoReply(packet []byte) error {
 		// Some broken switch sends an unexpected echo reply data.
 		logger.Debug("unexpected ECHO_REPLY data: invalid data length")
 	} else {
-		timestamp := time.Time{}
-		if err := timestamp.GobDecode(data); err != nil {
+		timestamp := time.Unix(0, int64(binary.BigEndian.Uint64(data)))
+		rtt := time.Now().Sub(timestamp)
+		if rtt < 0 {
 			logger.Debug("unexpected timestamp data in the ECHO_REPLY packet")
 		} else {
 			// Network latency
-			logger.Debugf("transceiver latency: %v", time.Now().Sub(timestamp))
+			logger.Debugf("transceiver latency: %v", rtt)
+			atomic.StoreInt64(&r.rtt, int64(rtt))
 		}
 	}
 
@@ -557,6 +588,30 @@ func (r *Transceiver) handlePortDescReply(packet []byte) error {
 	return r.observer.OnPortDescReply(r.factory, r, msg)
 }
 
+func (r *Transceiver) handleFlowStatsReply(packet []byte) error {
+	msg, err := r.factory.NewFlowStatsReply()
+	if err != nil {
+		return err
+	}
+	if err := msg.UnmarshalBinary(packet); err != nil {
+		return err
+	}
+
+	return r.observer.OnFlowStatsReply(r.factory, r, msg)
+}
+
+func (r *Transceiver) handlePortStatsReply(packet []byte) error {
+	msg, err := r.factory.NewPortStatsReply()
+	if err != nil {
+		return err
+	}
+	if err := msg.UnmarshalBinary(packet); err != nil {
+		return err
+	}
+
+	return r.observer.OnPortStatsReply(r.factory, r, msg)
+}
+
 func (r *Transceiver) handlePortStatus(packet []byte) error {
 	msg, err := r.factory.NewPortStatus()
 	if err != nil {
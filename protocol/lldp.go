@@ -24,6 +24,20 @@ package protocol
 import (
 	"encoding/binary"
 	"errors"
+	"net"
+)
+
+// LLDP TLV types.
+const (
+	lldpTLVEnd               = 0
+	lldpTLVChassisID         = 1
+	lldpTLVPortID            = 2
+	lldpTLVTTL               = 3
+	lldpTLVPortDescription   = 4
+	lldpTLVSystemName        = 5
+	lldpTLVSystemDescription = 6
+	lldpTLVManagementAddress = 8
+	lldpTLVOrgSpecific       = 127
 )
 
 type LLDPChassisID struct {
@@ -36,10 +50,32 @@ type LLDPPortID struct {
 	Data    []byte
 }
 
+// LLDPManagementAddress is an address that can be used to reach the management entity of the sender.
+type LLDPManagementAddress struct {
+	Address net.IP
+	// InterfaceSubType is the interface numbering subtype (1 = unknown, 2 = ifIndex, 3 = system port number).
+	InterfaceSubType uint8
+	InterfaceNumber  uint32
+}
+
+// LLDPOrgSpecific is an organizationally specific TLV that carries vendor defined information.
+type LLDPOrgSpecific struct {
+	OUI     [3]byte
+	SubType uint8
+	Info    []byte
+}
+
 type LLDP struct {
 	ChassisID LLDPChassisID
 	PortID    LLDPPortID
 	TTL       uint16
+
+	// Optional TLVs. Empty values are not marshaled.
+	PortDescription   string
+	SystemName        string
+	SystemDescription string
+	ManagementAddress *LLDPManagementAddress
+	OrgSpecific       []LLDPOrgSpecific
 }
 
 func (r *LLDP) marshalChassisID() ([]byte, error) {
@@ -94,6 +130,88 @@ func (r *LLDP) marshalTTL() ([]byte, error) {
 	return v, nil
 }
 
+func marshalTLV(t uint8, value []byte) ([]byte, error) {
+	if len(value) > 511 {
+		return nil, errors.New("too long TLV value")
+	}
+
+	v := make([]byte, len(value)+2)
+	binary.BigEndian.PutUint16(v[0:2], uint16(t)<<9|uint16(len(value)&0x1FF))
+	copy(v[2:], value)
+
+	return v, nil
+}
+
+func (r *LLDP) marshalManagementAddress() ([]byte, error) {
+	addr := r.ManagementAddress.Address
+	// IANA address family numbers: 1 = IPv4, 2 = IPv6.
+	var family uint8
+	if v := addr.To4(); v != nil {
+		family, addr = 1, v
+	} else if v := addr.To16(); v != nil {
+		family, addr = 2, v
+	} else {
+		return nil, errors.New("invalid management address")
+	}
+
+	v := make([]byte, 0, 2+len(addr)+6)
+	v = append(v, uint8(len(addr)+1), family)
+	v = append(v, addr...)
+	num := make([]byte, 5)
+	num[0] = r.ManagementAddress.InterfaceSubType
+	binary.BigEndian.PutUint32(num[1:5], r.ManagementAddress.InterfaceNumber)
+	v = append(v, num...)
+	// Empty OID string.
+	v = append(v, 0)
+
+	return marshalTLV(lldpTLVManagementAddress, v)
+}
+
+func (r *LLDP) marshalOptionalTLVs() ([]byte, error) {
+	v := make([]byte, 0)
+
+	texts := []struct {
+		t     uint8
+		value string
+	}{
+		{lldpTLVPortDescription, r.PortDescription},
+		{lldpTLVSystemName, r.SystemName},
+		{lldpTLVSystemDescription, r.SystemDescription},
+	}
+	for _, s := range texts {
+		if len(s.value) == 0 {
+			continue
+		}
+		tlv, err := marshalTLV(s.t, []byte(s.value))
+		if err != nil {
+			return nil, err
+		}
+		v = append(v, tlv...)
+	}
+
+	if r.ManagementAddress != nil {
+		tlv, err := r.marshalManagementAddress()
+		if err != nil {
+			return nil, err
+		}
+		v = append(v, tlv...)
+	}
+
+	for _, o := range r.OrgSpecific {
+		value := make([]byte, 0, 4+len(o.Info))
+		value = append(value, o.OUI[:]...)
+		value = append(value, o.SubType)
+		value = append(value, o.Info...)
+		tlv, err := marshalTLV(lldpTLVOrgSpecific, value)
+		if err != nil {
+			return nil, err
+		}
+		v = append(v, tlv...)
+	}
+
+	return v, nil
+}
+
 func (r *LLDP) MarshalBinary() ([]byte, error) {
 	v := make([]byte, 0)
 
@@ -115,6 +233,12 @@ func (r *LLDP) MarshalBinary() ([]byte, error) {
 	}
 	v = append(v, ttl...)
 
+	optional, err := r.marshalOptionalTLVs()
+	if err != nil {
+		return nil, err
+	}
+	v = append(v, optional...)
+
 	// End of TLV
 	v = append(v, []byte{0, 0}...)
 
@@ -216,10 +340,79 @@ func (r *LLDP) UnmarshalBinary(data []byte) error {
 	if length < offset {
 		return errors.New("invalid LLDP packet length")
 	}
-	_, err = r.unmarshalTTL(data[offset:])
+	n, err = r.unmarshalTTL(data[offset:])
 	if err != nil {
 		return err
 	}
+	offset += n
+
+	return r.unmarshalOptionalTLVs(data[offset:])
+}
+
+func (r *LLDP) unmarshalOptionalTLVs(data []byte) error {
+	for len(data) >= 2 {
+		header := binary.BigEndian.Uint16(data[0:2])
+		tlvType := (header >> 9) & 0x7F
+		tlvLength := int(header & 0x1FF)
+		if tlvType == lldpTLVEnd {
+			break
+		}
+		if len(data) < tlvLength+2 {
+			return errors.New("invalid LLDP optional TLV length")
+		}
+		value := data[2 : 2+tlvLength]
+
+		switch tlvType {
+		case lldpTLVPortDescription:
+			r.PortDescription = string(value)
+		case lldpTLVSystemName:
+			r.SystemName = string(value)
+		case lldpTLVSystemDescription:
+			r.SystemDescription = string(value)
+		case lldpTLVManagementAddress:
+			if err := r.unmarshalManagementAddress(value); err != nil {
+				return err
+			}
+		case lldpTLVOrgSpecific:
+			if len(value) < 4 {
+				return errors.New("invalid organizationally specific TLV length")
+			}
+			o := LLDPOrgSpecific{
+				SubType: value[3],
+				Info:    append([]byte(nil), value[4:]...),
+			}
+			copy(o.OUI[:], value[0:3])
+			r.OrgSpecific = append(r.OrgSpecific, o)
+		default:
+			// Ignore unknown TLVs.
+		}
+		data = data[2+tlvLength:]
+	}
+
+	return nil
+}
+
+func (r *LLDP) unmarshalManagementAddress(data []byte) error {
+	if len(data) < 2 {
+		return errors.New("invalid management address TLV length")
+	}
+	// The address string length includes the address subtype.
+	addrLength := int(data[0])
+	if addrLength < 1 || len(data) < 1+addrLength+5 {
+		return errors.New("invalid management address TLV length")
+	}
+	family := data[1]
+	addr := data[2 : 1+addrLength]
+
+	v := &LLDPManagementAddress{
+		InterfaceSubType: data[1+addrLength],
+		InterfaceNumber:  binary.BigEndian.Uint32(data[2+addrLength : 6+addrLength]),
+	}
+	// Only IPv4 and IPv6 addresses are supported.
+	if (family == 1 && len(addr) == net.IPv4len) || (family == 2 && len(addr) == net.IPv6len) {
+		v.Address = net.IP(append([]byte(nil), addr...))
+	}
+	r.ManagementAddress = v
 
 	return nil
 }
@@ -0,0 +1,70 @@
+/*
+ * Cherry - An OpenFlow Controller
+ *
+ * Copyright (C) 2015 Samjung Data Service, Inc. All rights reserved. 
+ * Kitae Kim <superkkt@sds.co.kr>
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package protocol
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLLDPCodec(t *testing.T) {
+	samples := []LLDP{
+		{
+			ChassisID: LLDPChassisID{SubType: 7, Data: []byte("1234")},
+			PortID:    LLDPPortID{SubType: 5, Data: []byte("cherry/1")},
+			TTL:       120,
+		},
+		{
+			ChassisID:         LLDPChassisID{SubType: 4, Data: []byte{0x00, 0x0b, 0x82, 0x01, 0xfc, 0x42}},
+			PortID:            LLDPPortID{SubType: 5, Data: []byte("eth0")},
+			TTL:               60,
+			PortDescription:   "uplink",
+			SystemName:        "server01",
+			SystemDescription: "Linux server01 4.15.0",
+			ManagementAddress: &LLDPManagementAddress{
+				Address:          net.IPv4(10, 0, 0, 1).To4(),
+				InterfaceSubType: 2,
+				InterfaceNumber:  3,
+			},
+			OrgSpecific: []LLDPOrgSpecific{
+				{OUI: [3]byte{0x00, 0x26, 0xe1}, SubType: 0x80, Info: []byte{0, 0, 0, 0, 0, 0, 0, 1}},
+			},
+		},
+	}
+
+	for _, v := range samples {
+		packet, err := v.MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to marshal LLDP: %v", err)
+		}
+
+		decoded := LLDP{}
+		if err := decoded.UnmarshalBinary(packet); err != nil {
+			t.Fatalf("failed to unmarshal LLDP: %v", err)
+		}
+		if diff := cmp.Diff(v, decoded); diff != "" {
+			t.Fatalf("unexpected decoded LLDP: %v", diff)
+		}
+	}
+}